@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+var checkOutputFormat string
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Checks that the backups per namespace and pvc are fresh (for alerting)",
+	Long: `Checks per namespace and 'backup-ns.sh/pvc' label that
+  * the newest ready VolumeSnapshot is younger than BAK_CHECK_MAX_SNAPSHOT_AGE,
+  * the daily, weekly and monthly retention labels have no gaps (up to BAK_RETAIN_LAST_DAILY days,
+    BAK_RETAIN_LAST_WEEKLY weeks and BAK_RETAIN_LAST_MONTHLY months back) and
+  * the dump file of every enabled database engine (e.g. BAK_DB_POSTGRES=true) is younger than BAK_CHECK_MAX_DUMP_AGE
+    (only for BAK_NAMESPACE and the first pvc of BAK_PVC_NAME).
+
+All pvcs of BAK_PVC_NAME of the checked namespace must have snapshots, otherwise the check fails.
+The results are printed as table or json, the command exits non-zero if any check failed.`,
+	Example: `  # check the backups of the current namespace
+  backup-ns check
+
+  # check the snapshots of all namespaces
+  backup-ns check -A -o json`,
+	Run: func(_ *cobra.Command, _ []string) {
+		config := lib.LoadConfig()
+
+		if allNamespaces && namespace != "" {
+			log.Fatal("Cannot specify both --namespace and --all-namespaces")
+		}
+
+		if !allNamespaces && namespace == "" {
+			namespace = config.Namespace
+		}
+
+		results, err := runCheck(config, namespace, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		failed := 0
+		for _, r := range results {
+			if !r.OK() {
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			log.Fatalf("check failed for %d of %d pvcs.", failed, len(results))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Check the snapshots in all namespaces")
+	checkCmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace to check (defaults to BAK_NAMESPACE or the current namespace)")
+	checkCmd.Flags().StringVarP(&checkOutputFormat, "output", "o", "table", "Output format (table or json)")
+}
+
+// runCheck checks the snapshots in the namespace ("" means all namespaces) and prints the results.
+func runCheck(config lib.Config, namespace string, now time.Time) ([]lib.BackupCheckResult, error) {
+	maxSnapshotAge, err := time.ParseDuration(config.Check.MaxSnapshotAge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BAK_CHECK_MAX_SNAPSHOT_AGE='%s': %w", config.Check.MaxSnapshotAge, err)
+	}
+
+	maxDumpAge, err := time.ParseDuration(config.Check.MaxDumpAge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BAK_CHECK_MAX_DUMP_AGE='%s': %w", config.Check.MaxDumpAge, err)
+	}
+
+	vss, err := lib.GetVolumeSnapshotInfos(namespace, "backup-ns.sh/pvc")
+	if err != nil {
+		return nil, fmt.Errorf("error getting snapshots: %w", err)
+	}
+
+	var expectedPVCs []lib.NamespacedK8sObject
+	if namespace != "" {
+		for _, pvcName := range config.PVCNames {
+			expectedPVCs = append(expectedPVCs, lib.NamespacedK8sObject{Namespace: namespace, Name: pvcName})
+		}
+	}
+
+	results := lib.CheckVolumeSnapshots(vss, expectedPVCs, now, maxSnapshotAge, config.Retain)
+
+	for i := range results {
+		r := &results[i]
+		// the dumps are stored on the first pvc
+		if r.Namespace != config.Namespace || len(config.PVCNames) == 0 || r.PVCName != config.PVCNames[0] {
+			continue
+		}
+
+		for _, engine := range lib.EnabledEngines(config) {
+			resource, container := engine.ExecTarget()
+			r.CheckDumpFile(engine.Name(), engine.Instance(), resource, container, engine.DumpFile(), now, maxDumpAge)
+		}
+	}
+
+	if err := printOutput(checkOutputFormat, results, func(w io.Writer) {
+		fmt.Fprintln(w, "NAMESPACE\tPVC\tNEWEST-SNAPSHOT\tAGE\tDUMP-AGE\tCHAIN-GAPS\tSTATUS\tPROBLEMS")
+		for _, r := range results {
+			status := "OK"
+			if !r.OK() {
+				status = "FAILED"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				r.Namespace, r.PVCName, valueOrDash(r.NewestSnapshot), ageOrDash(r.NewestSnapshotCreated, now),
+				dumpAges(r.Dumps, now), len(r.ChainGaps), status, strings.Join(r.Problems, "; "))
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func ageOrDash(t *time.Time, now time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return duration.HumanDuration(now.Sub(*t))
+}
+
+func dumpAges(dumps []lib.DumpCheckResult, now time.Time) string {
+	if len(dumps) == 0 {
+		return "-"
+	}
+
+	ages := make([]string, 0, len(dumps))
+	for _, d := range dumps {
+		ages = append(ages, fmt.Sprintf("%s=%s", d.Name, ageOrDash(d.Modified, now)))
+	}
+	return strings.Join(ages, ",")
+}
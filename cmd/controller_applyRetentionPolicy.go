@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"log"
+	"log/slog"
 
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/allaboutapps/backup-ns/internal/lib/metrics"
 	"github.com/spf13/cobra"
 )
 
@@ -11,10 +15,27 @@ import (
 var applyRetentionPolicyCmd = &cobra.Command{
 	Use:   "applyRetentionPolicy",
 	Short: "Enforces that daily, weeky, monthly labels are only set for a specific number of snapshots",
-	// Long:  `...`,
+	Long: `Groups all VolumeSnapshots with the 'backup-ns.sh/retain' label by namespace and 'backup-ns.sh/pvc' label
+and only keeps the 'backup-ns.sh/daily', 'backup-ns.sh/weekly' and 'backup-ns.sh/monthly' labels on the newest
+BAK_RETAIN_LAST_DAILY, BAK_RETAIN_LAST_WEEKLY and BAK_RETAIN_LAST_MONTHLY snapshots. The label is removed from
+all older snapshots. Set BAK_DRY_RUN=true to only print the planned label removals.`,
 	Run: func(_ *cobra.Command, _ []string) {
-		fmt.Println("not implemented")
-		os.Exit(1)
+		config := lib.LoadConfig()
+
+		lib.PrintTimeZone()
+		slog.Info("Retain config", "last_daily", config.Retain.LastDaily, "last_weekly", config.Retain.LastWeekly, "last_monthly", config.Retain.LastMonthly)
+
+		if config.DryRun {
+			slog.Info("Dry run mode is active, write operations are skipped!")
+		}
+
+		err := runNotified(context.Background(), config, "controller applyRetentionPolicy", func() error { return runApplyRetentionPolicy(context.Background(), config) })
+
+		pushMetrics(config, "applyRetentionPolicy", "", err)
+
+		if err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
@@ -31,3 +52,50 @@ func init() {
 	// is called directly, e.g.:
 	// applyRetentionPolicyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+// runApplyRetentionPolicy removes the retention labels of the older snapshots (stops early if ctx is done).
+func runApplyRetentionPolicy(ctx context.Context, config lib.Config) error {
+	slog.InfoContext(ctx, "Starting retain, getting snapshots with 'backup-ns.sh/retain' and 'backup-ns.sh/pvc' labels set...")
+
+	vss, err := lib.GetVolumeSnapshotInfos("", "backup-ns.sh/retain,backup-ns.sh/pvc")
+	if err != nil {
+		return fmt.Errorf("error getting snapshots: %w", err)
+	}
+
+	removals := lib.PlanRetentionPolicy(vss, config.Retain)
+
+	slog.InfoContext(ctx, "Planned retention label removals", "removals", len(removals), "snapshots", len(vss))
+
+	metrics.RetentionLabels.Reset()
+	for _, c := range lib.CountRetentionLabels(vss, removals) {
+		metrics.RetentionLabels.WithLabelValues(c.Namespace, c.PVCName, c.LabelKey).Set(float64(c.Count))
+	}
+
+	fails := 0
+
+	for i, r := range removals {
+		if ctx.Err() != nil {
+			slog.WarnContext(ctx, "Stopping retain labeler", "remaining", len(removals)-i)
+			break
+		}
+
+		slog.InfoContext(ctx, "Unlabeling...", "namespace", r.Namespace, "pvc", r.PVCName, "label", r.LabelKey+"="+r.LabelValue, "vs_name", r.VSName)
+
+		if config.DryRun {
+			slog.InfoContext(ctx, "Skipping unlabeling - dry run mode is active")
+			continue
+		}
+
+		if err := lib.RemoveVolumeSnapshotLabel(r.Namespace, r.VSName, r.LabelKey); err != nil {
+			fails++
+			slog.ErrorContext(ctx, "Unlabeling failed", "fail", fails, "vs_name", r.VSName, "namespace", r.Namespace, "error", err)
+		}
+	}
+
+	if fails > 0 {
+		return fmt.Errorf("retain labeler failed with %d errors", fails)
+	}
+
+	slog.InfoContext(ctx, "Retain labeler done", "errors", fails)
+	return nil
+}
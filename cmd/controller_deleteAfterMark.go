@@ -1,33 +1,99 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"io"
+	"log"
+	"log/slog"
+	"time"
 
+	"github.com/allaboutapps/backup-ns/internal/lib"
 	"github.com/spf13/cobra"
 )
 
+var markOutputFormat string
+
 // deleteAfterMarkCmd represents the deleteAfterMark command
 var deleteAfterMarkCmd = &cobra.Command{
 	Use:   "deleteAfterMark",
 	Short: "Marks all daily_weekly_monthly snapshots without daily/weeky/monthly label for deleteAfter today (to be deleted tomorrow)",
-	// Long:  `...`,
+	Long: `Finds all VolumeSnapshots with 'backup-ns.sh/retain=daily_weekly_monthly' that no longer have any
+'backup-ns.sh/daily', 'backup-ns.sh/weekly' or 'backup-ns.sh/monthly' label (see applyRetentionPolicy)
+and labels them with 'backup-ns.sh/delete-after=<today>'. They will be deleted by the next deleteAfterSweep run after today.
+
+The plan is always printed to stdout first (table or json), set BAK_DRY_RUN=true to only print the plan.`,
+	Example: `  # review the plan only
+  BAK_DRY_RUN=true backup-ns controller deleteAfterMark -o json`,
 	Run: func(_ *cobra.Command, _ []string) {
-		fmt.Println("not implemented")
-		os.Exit(1)
+		config := lib.LoadConfig()
+
+		lib.PrintTimeZone()
+
+		if config.DryRun {
+			slog.Info("Dry run mode is active, write operations are skipped!")
+		}
+
+		err := runNotified(context.Background(), config, "controller deleteAfterMark", func() error { return runDeleteAfterMark(context.Background(), config) })
+
+		pushMetrics(config, "deleteAfterMark", "", err)
+
+		if err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
 func init() {
 	controllerCmd.AddCommand(deleteAfterMarkCmd)
+	deleteAfterMarkCmd.Flags().StringVarP(&markOutputFormat, "output", "o", "table", "Output format of the plan (table or json)")
+}
+
+// runDeleteAfterMark marks the unlabeled snapshots for deletion (stops early if ctx is done).
+func runDeleteAfterMark(ctx context.Context, config lib.Config) error {
+	slog.InfoContext(ctx, "Querying for volumesnapshots to mark for deletion with 'backup-ns.sh/retain=daily_weekly_monthly'...")
+
+	vss, err := lib.GetVolumeSnapshotInfos("", "backup-ns.sh/retain=daily_weekly_monthly")
+	if err != nil {
+		return fmt.Errorf("error getting snapshots: %w", err)
+	}
+
+	marks := lib.PlanDeleteAfterMark(vss, time.Now())
+
+	slog.InfoContext(ctx, "Planned volumesnapshots to mark for deletion", "count", len(marks))
+
+	if err := printOutput(markOutputFormat, marks, func(w io.Writer) {
+		fmt.Fprintln(w, "NAMESPACE\tNAME\tPVC\tCREATIONTIME\tDELETE-AFTER")
+		for _, m := range marks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Namespace, m.VSName, m.PVCName, m.CreationTime.Format(time.RFC3339), m.DeleteAfter)
+		}
+	}); err != nil {
+		return err
+	}
+
+	if config.DryRun {
+		slog.InfoContext(ctx, "Skipping marking - dry run mode is active")
+		return nil
+	}
+
+	fails := 0
+
+	for i, m := range marks {
+		if ctx.Err() != nil {
+			slog.WarnContext(ctx, "Stopping marking deletion", "remaining", len(marks)-i)
+			break
+		}
 
-	// Here you will define your flags and configuration settings.
+		if err := lib.MarkVolumeSnapshotDeleteAfter(m.Namespace, m.VSName, m.DeleteAfter); err != nil {
+			fails++
+			slog.ErrorContext(ctx, "Marking failed", "fail", fails, "vs_name", m.VSName, "namespace", m.Namespace, "error", err)
+		}
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// deleteAfterMarkCmd.PersistentFlags().String("foo", "", "A help for foo")
+	if fails > 0 {
+		return fmt.Errorf("marking deletion failed with %d errors", fails)
+	}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// deleteAfterMarkCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	slog.InfoContext(ctx, "Marking deletion done", "errors", fails)
+	return nil
 }
@@ -1,33 +1,188 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"io"
+	"log"
+	"log/slog"
+	"slices"
+	"time"
 
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/allaboutapps/backup-ns/internal/lib/metrics"
 	"github.com/spf13/cobra"
 )
 
+var sweepOutputFormat string
+
 // deleteAfterSweepCmd represents the deleteAfterSweep command
 var deleteAfterSweepCmd = &cobra.Command{
 	Use:   "deleteAfterSweep",
 	Short: "Sweeps all snapshots with a deleteAfter label mark smaller then today (after having them marked yesterday)",
-	// Long:  `...`,
+	Long: `Deletes all VolumeSnapshots with 'backup-ns.sh/retain' and a 'backup-ns.sh/delete-after' label before today
+(including their VolumeSnapshotContent and the underlying storage, see delete).
+
+Safety rails:
+  * The last remaining ready snapshot of a pvc is never deleted.
+  * At most BAK_SWEEP_MAX_DELETIONS snapshots are deleted per run (0 means unlimited), the rest is left for the next run.
+  * Members of a VolumeGroupSnapshot (label backup-ns.sh/group) are only deleted as a unit by deleting their group,
+    once all of them are due (a group counts as a single deletion).
+  * Set BAK_DRY_RUN=true to only print the plan.
+
+A per-namespace summary is printed at the end, the command exits non-zero if any deletion failed.`,
 	Run: func(_ *cobra.Command, _ []string) {
-		fmt.Println("not implemented")
-		os.Exit(1)
+		config := lib.LoadConfig()
+
+		lib.PrintTimeZone()
+
+		if config.DryRun {
+			slog.Info("Dry run mode is active, write operations are skipped!")
+		}
+
+		err := runNotified(context.Background(), config, "controller deleteAfterSweep", func() error { return runDeleteAfterSweep(context.Background(), config) })
+
+		pushMetrics(config, "deleteAfterSweep", "", err)
+
+		if err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
 func init() {
 	controllerCmd.AddCommand(deleteAfterSweepCmd)
+	deleteAfterSweepCmd.Flags().StringVarP(&sweepOutputFormat, "output", "o", "table", "Output format of the plan (table or json)")
+}
+
+type sweepSummary struct {
+	Deleted int
+	Skipped int
+	Failed  int
+}
+
+// runDeleteAfterSweep deletes the due snapshots (stops early if ctx is done, the rest is left for the next run).
+func runDeleteAfterSweep(ctx context.Context, config lib.Config) error {
+	slog.InfoContext(ctx, "Querying for volumesnapshots to delete...", "max_deletions", config.Sweep.MaxDeletions)
+
+	// we need all managed snapshots (not only the delete-after labeled ones) to protect the last ready snapshot of a pvc
+	vss, err := lib.GetVolumeSnapshotInfos("", "backup-ns.sh/type")
+	if err != nil {
+		return fmt.Errorf("error getting snapshots: %w", err)
+	}
+
+	candidates := lib.PlanDeleteAfterSweep(vss, time.Now(), config.Sweep.MaxDeletions)
+
+	if err := printOutput(sweepOutputFormat, candidates, func(w io.Writer) {
+		fmt.Fprintln(w, "NAMESPACE\tNAME\tPVC\tGROUP\tREADYTOUSE\tDELETE-AFTER\tSKIP")
+		for _, c := range candidates {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n", c.Namespace, c.VSName, c.PVCName, c.Group, c.ReadyToUse, c.DeleteAfter, c.Skip)
+		}
+	}); err != nil {
+		return err
+	}
+
+	summaries := make(map[string]*sweepSummary)
+	fails := 0
+
+	// the members of a group are deleted together with the first one, the result is counted for every member
+	groupResults := make(map[string]error)
+
+	for i, c := range candidates {
+		if ctx.Err() != nil {
+			slog.WarnContext(ctx, "Stopping sweep", "remaining", len(candidates)-i)
+			break
+		}
+
+		summary, ok := summaries[c.Namespace]
+		if !ok {
+			summary = &sweepSummary{}
+			summaries[c.Namespace] = summary
+		}
+
+		if c.Skip != "" {
+			summary.Skipped++
+			slog.InfoContext(ctx, "Skipping deletion", "vs_name", c.VSName, "namespace", c.Namespace, "reason", c.Skip)
+			continue
+		}
+
+		if config.DryRun {
+			summary.Deleted++
+			slog.InfoContext(ctx, "Skipping deletion - dry run mode is active", "vs_name", c.VSName, "namespace", c.Namespace)
+			continue
+		}
+
+		if c.Group != "" {
+			k := c.Namespace + "/" + c.Group
+			err, ok := groupResults[k]
+			if !ok {
+				slog.InfoContext(ctx, "Deleting group...", "vgs_name", c.Group, "namespace", c.Namespace, "delete_after", c.DeleteAfter)
+				err = lib.PruneVolumeGroupSnapshot(c.Namespace, c.Group, true)
+				groupResults[k] = err
+			}
+
+			if err != nil {
+				fails++
+				summary.Failed++
+				slog.ErrorContext(ctx, "Deleting failed", "fail", fails, "vs_name", c.VSName, "vgs_name", c.Group, "namespace", c.Namespace, "error", err)
+				continue
+			}
+
+			summary.Deleted++
+			slog.InfoContext(ctx, "Deleted", "vs_name", c.VSName, "vgs_name", c.Group, "namespace", c.Namespace)
+			continue
+		}
+
+		slog.InfoContext(ctx, "Deleting...", "vs_name", c.VSName, "namespace", c.Namespace, "delete_after", c.DeleteAfter)
+
+		if err := lib.PruneVolumeSnapshot(c.Namespace, c.VSName, true); err != nil {
+			fails++
+			summary.Failed++
+			slog.ErrorContext(ctx, "Deleting failed", "fail", fails, "vs_name", c.VSName, "namespace", c.Namespace, "error", err)
+			continue
+		}
+
+		summary.Deleted++
+		slog.InfoContext(ctx, "Deleted", "vs_name", c.VSName, "namespace", c.Namespace)
+	}
+
+	printSweepSummary(ctx, summaries, config.DryRun)
+
+	if !config.DryRun {
+		for ns, s := range summaries {
+			metrics.SweepDeletions.WithLabelValues(ns, "deleted").Add(float64(s.Deleted))
+			metrics.SweepDeletions.WithLabelValues(ns, "skipped").Add(float64(s.Skipped))
+			metrics.SweepDeletions.WithLabelValues(ns, "failed").Add(float64(s.Failed))
+		}
+	}
+
+	if fails > 0 {
+		return fmt.Errorf("sweep failed with %d errors", fails)
+	}
+
+	slog.InfoContext(ctx, "Sweep done", "errors", fails)
+	return nil
+}
 
-	// Here you will define your flags and configuration settings.
+func printSweepSummary(ctx context.Context, summaries map[string]*sweepSummary, dryRun bool) {
+	namespaces := make([]string, 0, len(summaries))
+	for ns := range summaries {
+		namespaces = append(namespaces, ns)
+	}
+	slices.Sort(namespaces)
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// deleteAfterSweepCmd.PersistentFlags().String("foo", "", "A help for foo")
+	deletedHeader := "DELETED"
+	if dryRun {
+		deletedHeader = "DELETED(DRY-RUN)"
+	}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// deleteAfterSweepCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	if err := printOutput("table", nil, func(w io.Writer) {
+		fmt.Fprintf(w, "NAMESPACE\t%s\tSKIPPED\tFAILED\n", deletedHeader)
+		for _, ns := range namespaces {
+			s := summaries[ns]
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", ns, s.Deleted, s.Skipped, s.Failed)
+		}
+	}); err != nil {
+		slog.WarnContext(ctx, "Failed to print sweep summary", "error", err)
+	}
 }
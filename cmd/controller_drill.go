@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/allaboutapps/backup-ns/internal/lib/metrics"
+	"github.com/spf13/cobra"
+)
+
+var controllerDrillOutputFormat string
+
+// controllerDrillCmd represents the controller drill command
+var controllerDrillCmd = &cobra.Command{
+	Use:   "drill",
+	Short: "Drills a random ready snapshot per namespace in the sandbox namespace (scheduled restore drills)",
+	Long: `Picks a random ready VolumeSnapshot (with a 'backup-ns.sh/pvc' label, not marked for deletion) per namespace and
+runs its restore drill (see drill) in the sandbox namespace BAK_CONTROLLER_DRILL_NAMESPACE: the snapshot is bound
+to a temporary VolumeSnapshot there (via a pre-provisioned VolumeSnapshotContent with deletionPolicy Retain), restored
+to a temporary PVC and checked by a drill pod. The file probes are BAK_DRILL_PROBES of the controller plus the
+BAK_DRILL_PROBES of the backup job that created the snapshot.
+
+Passed drills label the original snapshot backup-ns.sh/verified=<date>. The results are recorded as metrics and in the
+report ConfigMap backup-ns-drill-report of the sandbox namespace (last drill per namespace).
+Set BAK_DRY_RUN=true to only print the picked snapshots.
+
+The results are printed as table or json, the command exits non-zero if any drill failed.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		config := lib.LoadConfig()
+
+		lib.PrintTimeZone()
+
+		if config.DryRun {
+			slog.Info("Dry run mode is active, write operations are skipped!")
+		}
+
+		err := runNotified(context.Background(), config, "controller drill", func() error {
+			results, err := runDrills(context.Background(), config)
+			// nothing was drilled in dry run mode or if the snapshots could not be listed
+			if results != nil {
+				if printErr := printDrillResults(results); printErr != nil {
+					return printErr
+				}
+			}
+			return err
+		})
+
+		// the results of failed drills (drill_success, drills_total) are pushed too
+		pushMetrics(config, "drill", "", err)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	controllerCmd.AddCommand(controllerDrillCmd)
+	controllerDrillCmd.Flags().StringVarP(&controllerDrillOutputFormat, "output", "o", "table", "Output format (table or json)")
+}
+
+// printDrillResults prints the results of the controller drills as table or json (--output).
+func printDrillResults(results []lib.DrillResult) error {
+	return printOutput(controllerDrillOutputFormat, results, func(w io.Writer) {
+		fmt.Fprintln(w, "NAMESPACE\tSNAPSHOT\tPVC\tDUMPS\tPROBES\tSTATUS\tPROBLEMS")
+		for _, r := range results {
+			status := "OK"
+			if !r.OK() {
+				status = "FAILED"
+			}
+
+			problems := r.Problems
+			if r.Error != "" {
+				problems = append([]string{r.Error}, problems...)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.Namespace, r.VSName, valueOrDash(r.PVCName), drillDumps(r.Dumps),
+				drillProbeMatches(r.Probes), status, strings.Join(problems, "; "))
+		}
+	})
+}
+
+// runDrills drills a random snapshot per namespace in the sandbox namespace (stops early if ctx is done), records the
+// results and updates the report. The results are returned even if drills failed (err is set then).
+func runDrills(ctx context.Context, config lib.Config) ([]lib.DrillResult, error) {
+	sandboxNamespace := config.Controller.DrillNamespace
+
+	vss, err := lib.GetVolumeSnapshotInfos("", "backup-ns.sh/pvc")
+	if err != nil {
+		return nil, fmt.Errorf("error getting snapshots: %w", err)
+	}
+
+	picked := lib.PickDrillVolumeSnapshots(vss, sandboxNamespace, rand.IntN)
+
+	slog.InfoContext(ctx, "Picked snapshots for restore drills", "namespaces", len(picked), "sandbox_namespace", sandboxNamespace)
+
+	if config.DryRun {
+		for _, vs := range picked {
+			slog.InfoContext(ctx, "Skipping restore drill - dry run mode is active", "vs_name", vs.Name, "namespace", vs.Namespace, "pvc", vs.Labels["backup-ns.sh/pvc"])
+		}
+		return nil, nil
+	}
+
+	results := make([]lib.DrillResult, 0, len(picked))
+	failed := 0
+
+	for _, vs := range picked {
+		if ctx.Err() != nil {
+			slog.WarnContext(ctx, "Stopping restore drills", "remaining", len(picked)-len(results))
+			break
+		}
+
+		start := time.Now()
+		result, err := lib.DrillVolumeSnapshotInSandbox(ctx, vs.Namespace, vs.Name, sandboxNamespace, config.Drill)
+		if err != nil && ctx.Err() != nil {
+			// interrupted (e.g. leadership lost), not a failed drill
+			slog.WarnContext(ctx, "Stopping restore drills", "vs_name", vs.Name, "namespace", vs.Namespace, "remaining", len(picked)-len(results), "error", err)
+			break
+		}
+
+		outcome := "passed"
+		switch {
+		case err != nil:
+			outcome = "error"
+			result.Error = err.Error()
+			result.Drilled = time.Now().UTC()
+			slog.ErrorContext(ctx, "Restore drill failed", "vs_name", vs.Name, "namespace", vs.Namespace, "error", err)
+		case !result.OK():
+			outcome = "failed"
+		default:
+			if err := lib.MarkVolumeSnapshotVerified(vs.Namespace, vs.Name, result.Drilled); err != nil {
+				slog.ErrorContext(ctx, "Labeling the drilled snapshot failed", "vs_name", vs.Name, "namespace", vs.Namespace, "error", err)
+			}
+		}
+
+		if outcome != "passed" {
+			failed++
+		}
+
+		metrics.ObserveDrill(vs.Namespace, vs.Labels["backup-ns.sh/pvc"], outcome, time.Since(start), result.Drilled)
+		results = append(results, result)
+	}
+
+	if _, err := lib.UpdateDrillReport(sandboxNamespace, results, time.Now()); err != nil {
+		return results, fmt.Errorf("error updating the drill report: %w", err)
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("restore drills failed for %d of %d namespaces", failed, len(results))
+	}
+
+	slog.InfoContext(ctx, "Restore drills done", "namespaces", len(results))
+	return results, nil
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"github.com/allaboutapps/backup-ns/internal/lib/metrics"
+	"github.com/spf13/cobra"
+)
+
+// controllerRunCmd represents the controller run command
+var controllerRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Runs the long-running controller (vsc metadata sync, retention, marking, sweeping and restore drills)",
+	Long: `Runs until SIGINT/SIGTERM and replaces the one-shot controller CronJobs:
+
+  * Watches all VolumeSnapshots with the 'backup-ns.sh/type' label and continuously syncs their
+    'backup-ns.sh/' labels to the bound VolumeSnapshotContent (see syncMetadataToVsc).
+    The watch is restarted every BAK_CONTROLLER_RESYNC_INTERVAL to resync all snapshots.
+  * Every BAK_CONTROLLER_PRUNE_INTERVAL (and on start) applyRetentionPolicy, deleteAfterMark and
+    deleteAfterSweep are run in sequence.
+  * Every BAK_CONTROLLER_DRILL_INTERVAL (if set, first after one interval) a random ready snapshot per namespace
+    is drilled in the sandbox namespace BAK_CONTROLLER_DRILL_NAMESPACE (see drill).
+
+With BAK_CONTROLLER_LEADER_ELECTION=true (default) the controller only becomes active after acquiring the Lease
+BAK_CONTROLLER_LEASE_NAMESPACE/BAK_CONTROLLER_LEASE_NAME, so multiple replicas can be run as a Deployment.
+The process exits non-zero if the leadership is lost.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		config := lib.LoadConfig()
+
+		lib.PrintTimeZone()
+
+		if config.DryRun {
+			slog.Info("Dry run mode is active, write operations are skipped!")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if err := runNotified(ctx, config, "controller run", func() error { return runController(ctx, config) }); err != nil {
+			log.Fatal(err)
+		}
+
+		slog.Info("Controller stopped")
+	},
+}
+
+func init() {
+	controllerCmd.AddCommand(controllerRunCmd)
+}
+
+func runController(ctx context.Context, config lib.Config) error {
+	pruneInterval, err := time.ParseDuration(config.Controller.PruneInterval)
+	if err != nil || pruneInterval <= 0 {
+		return fmt.Errorf("invalid BAK_CONTROLLER_PRUNE_INTERVAL='%s'", config.Controller.PruneInterval)
+	}
+
+	resyncInterval, err := time.ParseDuration(config.Controller.ResyncInterval)
+	if err != nil || resyncInterval < 0 {
+		return fmt.Errorf("invalid BAK_CONTROLLER_RESYNC_INTERVAL='%s'", config.Controller.ResyncInterval)
+	}
+
+	var drillInterval time.Duration
+	if config.Controller.DrillInterval != "" {
+		drillInterval, err = time.ParseDuration(config.Controller.DrillInterval)
+		if err != nil || drillInterval < 0 {
+			return fmt.Errorf("invalid BAK_CONTROLLER_DRILL_INTERVAL='%s'", config.Controller.DrillInterval)
+		}
+	}
+
+	slog.Info("Controller config", "prune_interval", pruneInterval, "resync_interval", resyncInterval, "drill_interval", drillInterval, "leader_election", config.Controller.LeaderElection)
+
+	// metrics are served by all replicas, only the leader updates them
+	if config.Metrics.Address != "" {
+		go func() {
+			if err := metrics.Serve(ctx, config.Metrics.Address); err != nil {
+				slog.Error("Metrics endpoint stopped", "error", err)
+			}
+		}()
+	}
+
+	if !config.Controller.LeaderElection {
+		runControllerLoops(ctx, config, pruneInterval, resyncInterval, drillInterval)
+		return nil
+	}
+
+	client, err := k8s.Default()
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Waiting for leadership...", "lease", config.Controller.LeaseName, "namespace", config.Controller.LeaseNamespace, "identity", config.Controller.Identity)
+
+	return client.LeaderElect(ctx, k8s.LeaderElectionOptions{
+		LeaseNamespace: config.Controller.LeaseNamespace,
+		LeaseName:      config.Controller.LeaseName,
+		Identity:       config.Controller.Identity,
+		LeaseDuration:  15 * time.Second,
+		RenewDeadline:  10 * time.Second,
+		RetryPeriod:    2 * time.Second,
+	}, func(ctx context.Context) {
+		slog.Info("Acquired leadership", "lease", config.Controller.LeaseName, "namespace", config.Controller.LeaseNamespace, "identity", config.Controller.Identity)
+		runControllerLoops(ctx, config, pruneInterval, resyncInterval, drillInterval)
+	})
+}
+
+// runControllerLoops blocks until ctx is done (drillInterval 0 disables the drill loop). Every cycle (sync of a
+// snapshot, prune, drill) is logged and notified with its own run id.
+func runControllerLoops(ctx context.Context, config lib.Config, pruneInterval, resyncInterval, drillInterval time.Duration) {
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		if err := lib.WatchVolumeSnapshots(ctx, "backup-ns.sh/type", resyncInterval, func(vs lib.VolumeSnapshotInfo, deleted bool) {
+			if deleted {
+				return
+			}
+
+			cycleCtx := lib.ContextWithNewRunID(ctx)
+
+			if vs.ReadyToUse {
+				metrics.ObserveSuccessfulSnapshot(vs.Namespace, vs.Labels["backup-ns.sh/pvc"], vs.CreationTime)
+			}
+
+			synced, err := lib.SyncVSLabelsToVscIfChanged(vs, config.DryRun)
+			if err != nil {
+				slog.ErrorContext(cycleCtx, "Syncing metadata to vsc failed", "vs_name", vs.Name, "namespace", vs.Namespace, "error", err)
+				return
+			}
+
+			if synced {
+				slog.InfoContext(cycleCtx, "Synced metadata to vsc", "vsc_name", vs.ContentName, "vs_name", vs.Name, "namespace", vs.Namespace)
+			}
+		}); err != nil {
+			slog.Error("VolumeSnapshot watch stopped", "error", err)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+
+		for {
+			cycleCtx := lib.ContextWithNewRunID(ctx)
+
+			if err := runNotified(cycleCtx, config, "controller run prune", func() error { return runPrune(cycleCtx, config) }); err != nil {
+				slog.ErrorContext(cycleCtx, "Prune failed", "next_run_in", pruneInterval, "error", err)
+			} else {
+				metrics.SetSuccess()
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	if drillInterval > 0 {
+		wg.Add(1)
+
+		// drills are expensive (a pvc per namespace), so they are not run on every (re)start
+		go func() {
+			defer wg.Done()
+
+			ticker := time.NewTicker(drillInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+
+				cycleCtx := lib.ContextWithNewRunID(ctx)
+
+				if err := runNotified(cycleCtx, config, "controller run drill", func() error {
+					// the results are recorded in the report, printing is left to "controller drill"
+					_, err := runDrills(cycleCtx, config)
+					return err
+				}); err != nil {
+					slog.ErrorContext(cycleCtx, "Restore drills failed", "next_run_in", drillInterval, "error", err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// runPrune runs applyRetentionPolicy, deleteAfterMark and deleteAfterSweep in sequence (like the pruner CronJob), it
+// stops early if ctx is done (leadership lost).
+func runPrune(ctx context.Context, config lib.Config) error {
+	if err := runApplyRetentionPolicy(ctx, config); err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err := runDeleteAfterMark(ctx, config); err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return runDeleteAfterSweep(ctx, config)
+}
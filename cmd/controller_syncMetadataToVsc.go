@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"log/slog"
 
 	"github.com/allaboutapps/backup-ns/internal/lib"
 	"github.com/spf13/cobra"
@@ -13,27 +16,15 @@ var syncMetadataToVscCmd = &cobra.Command{
 	Short: "Synces vs label/annotations metadata to vsc",
 	// Long:  `...`, // accidental namespace/vs deletion -> restore namespace...
 	Run: func(_ *cobra.Command, _ []string) {
-		log.Println("starting sync vs metadata to vsc matching label 'backup-ns.sh/type'")
+		config := lib.LoadConfig()
 
-		vss, err := lib.GetManagedVolumeSnapshots()
-		if err != nil {
-			log.Fatalf("Error getting ready snapshots: %v\n", err)
-		}
+		err := runNotified(context.Background(), config, "controller syncMetadataToVsc", runSyncMetadataToVsc)
 
-		fails := 0
-
-		for _, vs := range vss {
-			if err := lib.SyncVSLabelsToVsc(vs.Namespace, vs.Name); err != nil {
-				fails++
-				log.Printf("fail#%d syncing metadata to vsc failed for vs_name='%s' in ns='%s'.\n", fails, vs.Name, vs.Namespace)
-			}
-		}
+		pushMetrics(config, "syncMetadataToVsc", "", err)
 
-		if fails > 0 {
-			log.Fatalf("syncing metadata to vsc failed with %d errors.\n", fails)
+		if err != nil {
+			log.Fatal(err)
 		}
-
-		log.Println("syncing metadata to vsc done with", fails, "errors.")
 	},
 }
 
@@ -50,3 +41,28 @@ func init() {
 	// is called directly, e.g.:
 	// syncMetadataToVscCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+func runSyncMetadataToVsc() error {
+	slog.Info("Starting sync vs metadata to vsc matching label 'backup-ns.sh/type'")
+
+	vss, err := lib.GetManagedVolumeSnapshots()
+	if err != nil {
+		return fmt.Errorf("error getting ready snapshots: %w", err)
+	}
+
+	fails := 0
+
+	for _, vs := range vss {
+		if err := lib.SyncVSLabelsToVsc(vs.Namespace, vs.Name); err != nil {
+			fails++
+			slog.Error("Syncing metadata to vsc failed", "fail", fails, "vs_name", vs.Name, "namespace", vs.Namespace)
+		}
+	}
+
+	if fails > 0 {
+		return fmt.Errorf("syncing metadata to vsc failed with %d errors", fails)
+	}
+
+	slog.Info("Syncing metadata to vsc done", "errors", fails)
+	return nil
+}
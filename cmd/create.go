@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/allaboutapps/backup-ns/internal/lib"
 	"github.com/allaboutapps/backup-ns/internal/lib/flock"
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"github.com/allaboutapps/backup-ns/internal/lib/metrics"
 	"github.com/spf13/cobra"
 )
 
@@ -38,55 +46,200 @@ func runCreate(_ *cobra.Command, _ []string) {
 	lib.PrintConfig(config)
 
 	if config.DryRun {
-		log.Println("Dry run mode is active, write operations are skipped!")
+		slog.Info("Dry run mode is active, write operations are skipped!")
 	}
 
-	if !config.Postgres.Enabled && !config.MySQL.Enabled && !config.DBSkip {
-		log.Fatal("Either BAK_DB_POSTGRES=true or BAK_DB_MYSQL=true or BAK_DB_SKIP=true must be set.")
+	event := lib.NotifyEvent{Command: "create", Namespace: config.Namespace, PVCName: strings.Join(config.PVCNames, ","), StartedAt: time.Now()}
+
+	err := createBackup(config, &event)
+
+	event.Finish(err)
+	lib.Notify(config.Notify, event)
+
+	pushMetrics(config, "create", config.Namespace+"/"+strings.Join(config.PVCNames, ","), err)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	slog.Info("Finished backup", "vs_name", event.VSName, "set", event.Set, "namespace", config.Namespace)
+}
+
+// createBackup dumps the enabled databases once and then creates a vs per pvc (labeled as one backup set) or a single
+// VolumeGroupSnapshot (BAK_VGS_SELECTOR), the vs names, the set and dump results are recorded in the event.
+func createBackup(config lib.Config, event *lib.NotifyEvent) error {
+	if len(config.PVCNames) == 0 {
+		return errors.New("BAK_PVC_NAME must be set")
+	}
+
+	if len(lib.EnabledEngines(config)) == 0 && !config.DBSkip {
+		return fmt.Errorf("either %s=true or BAK_DB_SKIP=true must be set", strings.Join(lib.EnabledEnvVars(), "=true or "))
+	}
+
+	if err := lib.ValidateEnabledEngines(config); err != nil {
+		return err
 	}
 
 	if config.Flock.Enabled {
 		lockFile := flock.ShuffleLockFile(config.Flock.Dir, config.Flock.Count)
-		log.Printf("Using lock_file='%s'...", lockFile)
+		slog.Info("Using lock file...", "lock_file", lockFile)
 
+		flockStart := time.Now()
 		unlock, err := flock.New(lockFile).WithTimeout(time.Duration(config.Flock.TimeoutSec) * time.Second).Lock(config.DryRun)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		metrics.FlockWaitDuration.WithLabelValues(config.Namespace).Set(time.Since(flockStart).Seconds())
 
 		defer func() {
 			if err := unlock(); err != nil {
-				log.Printf("Ignoring error while unlocking flock lock: %v", err)
+				slog.Warn("Ignoring error while unlocking flock lock", "error", err)
 			}
 		}()
 	}
 
-	vsName, err := lib.GenerateVSName(config.VSNameTemplate, config.PVCName, config.VSRand)
+	vsNames := make([]string, 0, len(config.PVCNames))
+	for _, pvcName := range config.PVCNames {
+		if err := lib.EnsurePVCAvailable(config.Namespace, pvcName); err != nil {
+			return err
+		}
+
+		// the names of the group members are chosen by the snapshot controller
+		if config.VGSSelector != "" {
+			continue
+		}
+
+		vsName, err := lib.GenerateVSName(config.VSNameTemplate, pvcName, config.VSRand)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(vsNames, vsName) {
+			return fmt.Errorf("BAK_VS_NAME_TEMPLATE generated the name '%s' for multiple PVCs, it must include {{ .pvcName }}", vsName)
+		}
+		slog.Info("Generated VolumeSnapshot name", "vs_name", vsName, "pvc", pvcName)
+		vsNames = append(vsNames, vsName)
+	}
+	event.VSName = strings.Join(vsNames, ",")
+
+	// validated upfront, a group not covering all PVCs is only detected after dumping and snapshotting otherwise
+	if config.VGSSelector != "" {
+		if err := ensureVGSSelectorMatchesPVCs(config); err != nil {
+			return err
+		}
+	}
+
+	for _, engine := range lib.EnabledEngines(config) {
+		dump, err := runEngineDump(config, engine)
+		if err != nil {
+			return err
+		}
+		event.Dumps = append(event.Dumps, dump)
+	}
+
+	// all vs of the set share the same labels (apart from the pvc), so they are retained as a unit
+	now := time.Now()
+	event.Set = lib.GenerateSetName(config.VSRand, now)
+
+	vsLabels := lib.GenerateVSLabels(config.Namespace, config.PVCNames[0], config.LabelVS, now)
+	vsLabels[lib.LabelSet] = event.Set
+	vsAnnotations := lib.GenerateVSAnnotations(lib.GetBAKEnvVars())
+	vsAnnotations[lib.AnnotationRunID] = lib.RunID()
+	for _, dump := range event.Dumps {
+		maps.Copy(vsAnnotations, dump.Annotations)
+	}
+
+	if config.VGSSelector != "" {
+		return createVolumeGroupSnapshot(config, event, vsLabels, vsAnnotations)
+	}
+
+	vsObjects := make(map[string]map[string]interface{}, len(vsNames))
+	for i, pvcName := range config.PVCNames {
+		labels := maps.Clone(vsLabels)
+		labels["backup-ns.sh/pvc"] = pvcName
+
+		vsObjects[vsNames[i]] = lib.GenerateVSObject(config.Namespace, config.VSClassName, pvcName, vsNames[i], labels, vsAnnotations)
+	}
+
+	return lib.CreateVolumeSnapshots(config.Namespace, config.DryRun, vsObjects, config.VSWaitUntilReady, config.VSWaitUntilReadyTimeout)
+}
+
+// ensureVGSSelectorMatchesPVCs fails if BAK_VGS_SELECTOR matches no PVCs or not all BAK_PVC_NAME PVCs.
+func ensureVGSSelectorMatchesPVCs(config lib.Config) error {
+	pvcNames, err := lib.ListPVCNames(config.Namespace, config.VGSSelector)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if len(pvcNames) == 0 {
+		return fmt.Errorf("BAK_VGS_SELECTOR '%s' matches no PVCs in namespace '%s'", config.VGSSelector, config.Namespace)
 	}
-	log.Println("VS Name:", vsName)
 
-	if err := lib.EnsurePVCAvailable(config.Namespace, config.PVCName); err != nil {
-		log.Fatal(err)
+	for _, pvcName := range config.PVCNames {
+		if !slices.Contains(pvcNames, pvcName) {
+			return fmt.Errorf("PVC '%s' (BAK_PVC_NAME) is not matched by BAK_VGS_SELECTOR '%s' (matches: %s)", pvcName, config.VGSSelector, strings.Join(pvcNames, ","))
+		}
 	}
 
-	if config.Postgres.Enabled {
-		runPostgresDump(config)
+	slog.Info("BAK_VGS_SELECTOR matches all PVCs", "selector", config.VGSSelector, "pvcs", pvcNames)
+	return nil
+}
+
+// createVolumeGroupSnapshot snapshots all PVCs matching BAK_VGS_SELECTOR at once, the group and its members share the
+// labels (members additionally get their pvc and the group label). All BAK_PVC_NAME PVCs must be members of the group,
+// the members of an incomplete or failed group are marked for deletion by the controller.
+func createVolumeGroupSnapshot(config lib.Config, event *lib.NotifyEvent, vsLabels, vsAnnotations map[string]string) error {
+	vgsName, err := lib.GenerateVSName(config.VSNameTemplate, "group", config.VSRand)
+	if err != nil {
+		return err
 	}
+	slog.Info("Generated VolumeGroupSnapshot name", "vgs_name", vgsName, "selector", config.VGSSelector)
+
+	groupLabels := maps.Clone(vsLabels)
+	delete(groupLabels, "backup-ns.sh/pvc")
 
-	if config.MySQL.Enabled {
-		runMySQLDump(config)
+	vgsObject, err := lib.GenerateVGSObject(config.Namespace, config.VGSClassName, config.VGSSelector, vgsName, groupLabels, vsAnnotations)
+	if err != nil {
+		return err
 	}
 
-	vsLabels := lib.GenerateVSLabels(config.Namespace, config.PVCName, config.LabelVS, time.Now())
-	vsAnnotations := lib.GenerateVSAnnotations(lib.GetBAKEnvVars())
+	members, err := lib.CreateVolumeGroupSnapshot(config.Namespace, config.DryRun, vgsName, vgsObject, groupLabels, vsAnnotations, config.VSWaitUntilReady, config.VSWaitUntilReadyTimeout)
+	if err != nil {
+		markFailedVolumeGroupSnapshot(config.Namespace, vgsName, groupLabels)
+		return err
+	}
 
-	vsObject := lib.GenerateVSObject(config.Namespace, config.VSClassName, config.PVCName, vsName, vsLabels, vsAnnotations)
+	if config.DryRun {
+		event.VSName = vgsName
+		return nil
+	}
 
-	if err := lib.CreateVolumeSnapshot(config.Namespace, config.DryRun, vsName, vsObject, config.VSWaitUntilReady, config.VSWaitUntilReadyTimeout); err != nil {
-		log.Fatal(err)
+	pvcNames := make([]string, 0, len(members))
+	vsNames := make([]string, 0, len(members))
+	for _, member := range members {
+		pvcNames = append(pvcNames, member.PVCName)
+		vsNames = append(vsNames, member.VSName)
+	}
+	event.PVCName = strings.Join(pvcNames, ",")
+	event.VSName = strings.Join(vsNames, ",")
+
+	// the PVCs matching the selector may have changed since they were validated
+	for _, pvcName := range config.PVCNames {
+		if !slices.Contains(pvcNames, pvcName) {
+			markFailedVolumeGroupSnapshot(config.Namespace, vgsName, groupLabels)
+			return fmt.Errorf("PVC '%s' (BAK_PVC_NAME) is not part of VolumeGroupSnapshot '%s' with selector '%s' (members: %s)", pvcName, vgsName, config.VGSSelector, event.PVCName)
+		}
 	}
 
-	log.Printf("Finished backup vs_name='%s' in namespace='%s'!", vsName, config.Namespace)
+	return nil
+}
+
+// markFailedVolumeGroupSnapshot marks a group (and its members) which must not be retained as a backup for deletion
+// (see lib.MarkFailedVolumeGroupSnapshot). The group may not exist if its creation itself failed.
+func markFailedVolumeGroupSnapshot(namespace, vgsName string, groupLabels map[string]string) {
+	if err := lib.MarkFailedVolumeGroupSnapshot(namespace, vgsName, groupLabels, time.Now()); err != nil {
+		if !k8s.IsNotFound(err) {
+			slog.Error("Failed to mark the failed VolumeGroupSnapshot for deletion", "namespace", namespace, "vgs_name", vgsName, "error", err)
+		}
+		return
+	}
+	slog.Warn("Marked the failed VolumeGroupSnapshot for deletion", "namespace", namespace, "vgs_name", vgsName)
 }
@@ -2,21 +2,28 @@ package cmd
 
 import (
 	"log"
+	"log/slog"
 
 	"github.com/allaboutapps/backup-ns/internal/lib"
 	"github.com/spf13/cobra"
 )
 
-var namespace string
+var (
+	namespace   string
+	deleteGroup bool
+)
 
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
-	Use:   "delete <volumesnapshot>",
+	Use:   "delete <volumesnapshot|volumegroupsnapshot>",
 	Short: "Deletes an application-aware snapshot (autopatches the vsc to deletionPolicy=delete first)",
 	Long: `This command deletes a VolumeSnapshot and its associated VolumeSnapshotContent,
 ensuring that the underlying storage is also deleted. It first patches the
 VolumeSnapshotContent's deletionPolicy to "Delete" before deleting the VolumeSnapshot.
 
+Members of a VolumeGroupSnapshot (label backup-ns.sh/group) can only be deleted together
+with their group via --group <volumegroupsnapshot>.
+
 CAUTION: This is a destructive operation and should be used with care!`,
 	Args: cobra.ExactArgs(1),
 	Run:  runDelete,
@@ -25,6 +32,7 @@ CAUTION: This is a destructive operation and should be used with care!`,
 func init() {
 	rootCmd.AddCommand(deleteCmd)
 	deleteCmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the VolumeSnapshot (defaults to the current namespace in the context)")
+	deleteCmd.Flags().BoolVar(&deleteGroup, "group", false, "Delete the VolumeGroupSnapshot with the name and all its member VolumeSnapshots")
 }
 
 func runDelete(_ *cobra.Command, args []string) {
@@ -38,11 +46,20 @@ func runDelete(_ *cobra.Command, args []string) {
 		}
 	}
 
-	log.Printf("Using namespace '%s'.\n", namespace)
+	slog.Info("Using namespace", "namespace", namespace)
+
+	if deleteGroup {
+		if err := lib.PruneVolumeGroupSnapshot(namespace, volumeSnapshotName, true); err != nil {
+			log.Fatalf("Error deleting VolumeGroupSnapshot: %v\n", err)
+		}
+
+		slog.Info("Successfully deleted VolumeGroupSnapshot", "vgs_name", volumeSnapshotName, "namespace", namespace)
+		return
+	}
 
 	if err := lib.PruneVolumeSnapshot(namespace, volumeSnapshotName, true); err != nil {
 		log.Fatalf("Error deleting VolumeSnapshot: %v\n", err)
 	}
 
-	log.Printf("Successfully deleted VolumeSnapshot %s in namespace %s\n", volumeSnapshotName, namespace)
+	slog.Info("Successfully deleted VolumeSnapshot", "vs_name", volumeSnapshotName, "namespace", namespace)
 }
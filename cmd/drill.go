@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/spf13/cobra"
+)
+
+var (
+	drillProbes       []string
+	drillStorageClass string
+	drillOutputFormat string
+)
+
+// drillCmd represents the drill command
+var drillCmd = &cobra.Command{
+	Use:   "drill SNAPSHOT_NAME",
+	Short: "Restores a volume snapshot to a temporary PVC and validates its contents (restore drill)",
+	Long: `Restores the volume snapshot to a temporary PVC (via BAK_DRILL_STORAGE_CLASS), mounts it read-only into a
+drill pod (BAK_DRILL_IMAGE) and checks that
+  * the restored volume is not empty,
+  * every database dump recorded in the backup-ns.sh/<name>-manifest annotations of the snapshot is found within
+    the volume with the checksum and size of its manifest and
+  * every file probe (BAK_DRILL_PROBES or --probe, globs relative to the volume root) matches at least one
+    non-empty file or directory.
+
+If the drill passes, the snapshot is labeled backup-ns.sh/verified=<date>. The drill pod and PVC are always deleted
+afterwards. Set BAK_DRY_RUN=true to only print the planned restore. The result is printed as table or json, the
+command exits non-zero if the drill failed.`,
+	Example: `  # drill the snapshot in the current namespace
+  backup-ns drill my-snapshot
+
+  # additionally check that uploads were restored
+  backup-ns drill my-snapshot -n my-namespace --probe 'uploads/*' -o json`,
+	Args: cobra.ExactArgs(1),
+	Run:  runDrill,
+}
+
+func init() {
+	rootCmd.AddCommand(drillCmd)
+	drillCmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the VolumeSnapshot (defaults to the current namespace in the context)")
+	drillCmd.Flags().StringArrayVar(&drillProbes, "probe", nil, "Additional file probe (glob relative to the volume root), may be repeated")
+	drillCmd.Flags().StringVar(&drillStorageClass, "storage-class", "", "Storage class of the temporary PVC (defaults to BAK_DRILL_STORAGE_CLASS)")
+	drillCmd.Flags().StringVarP(&drillOutputFormat, "output", "o", "table", "Output format (table or json)")
+}
+
+func runDrill(_ *cobra.Command, args []string) {
+	config := lib.LoadConfig()
+	vsName := args[0]
+
+	if namespace == "" {
+		var err error
+		namespace, err = lib.GetCurrentNamespace()
+		if err != nil {
+			log.Fatalf("Failed to get current namespace: %v", err)
+		}
+	}
+
+	config.Drill.Probes = append(config.Drill.Probes, drillProbes...)
+	if drillStorageClass != "" {
+		config.Drill.StorageClass = drillStorageClass
+	}
+
+	if config.DryRun {
+		slog.Info("Dry run mode is active, write operations are skipped!")
+	}
+
+	event := lib.NotifyEvent{Command: "drill", Namespace: namespace, VSName: vsName, StartedAt: time.Now()}
+
+	result, err := drillVolumeSnapshot(config, namespace, vsName)
+	event.PVCName = result.PVCName
+
+	event.Finish(err)
+	lib.Notify(config.Notify, event)
+
+	pushMetrics(config, "drill", namespace+"/"+vsName, err)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// drillVolumeSnapshot drills the snapshot, prints the result and labels the snapshot as verified if the drill passed.
+func drillVolumeSnapshot(config lib.Config, namespace, vsName string) (lib.DrillResult, error) {
+	if config.DryRun {
+		slog.Info("Skipping restore drill - dry run mode is active", "namespace", namespace, "vs_name", vsName,
+			"storage_class", config.Drill.StorageClass, "image", config.Drill.Image, "probes", config.Drill.Probes)
+		return lib.DrillResult{Namespace: namespace, VSName: vsName}, nil
+	}
+
+	result, err := lib.DrillVolumeSnapshot(context.Background(), namespace, vsName, config.Drill)
+	if err != nil {
+		return result, err
+	}
+
+	if err := printOutput(drillOutputFormat, result, func(w io.Writer) {
+		fmt.Fprintln(w, "NAMESPACE\tSNAPSHOT\tPVC\tDUMPS\tPROBES\tSTATUS\tPROBLEMS")
+
+		status := "OK"
+		if !result.OK() {
+			status = "FAILED"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			result.Namespace, result.VSName, valueOrDash(result.PVCName), drillDumps(result.Dumps),
+			drillProbeMatches(result.Probes), status, strings.Join(result.Problems, "; "))
+	}); err != nil {
+		return result, err
+	}
+
+	if !result.OK() {
+		return result, errors.New("restore drill failed: " + strings.Join(result.Problems, "; "))
+	}
+
+	return result, lib.MarkVolumeSnapshotVerified(namespace, vsName, result.Drilled)
+}
+
+func drillDumps(dumps []lib.DrillDumpResult) string {
+	if len(dumps) == 0 {
+		return "-"
+	}
+
+	values := make([]string, 0, len(dumps))
+	for _, d := range dumps {
+		values = append(values, fmt.Sprintf("%s=%s", d.Name, valueOrDash(d.DumpFile)))
+	}
+	return strings.Join(values, ",")
+}
+
+func drillProbeMatches(probes []lib.DrillProbeResult) string {
+	if len(probes) == 0 {
+		return "-"
+	}
+
+	values := make([]string, 0, len(probes))
+	for _, p := range probes {
+		values = append(values, fmt.Sprintf("%s=%d", p.Probe, p.Matches))
+	}
+	return strings.Join(values, ",")
+}
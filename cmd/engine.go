@@ -0,0 +1,456 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/spf13/cobra"
+)
+
+// The "backup-ns <engine> {dump,info,shell,downloadDump}" subcommands are generated for every registered engine,
+// "backup-ns <engine> restore" only for engines implementing lib.DumpRestorer and "backup-ns <engine> verify" only for
+// engines implementing lib.DumpVerifier.
+func init() {
+	for _, registration := range lib.RegisteredEngines() {
+		rootCmd.AddCommand(newEngineCmd(registration))
+	}
+}
+
+func newEngineCmd(r lib.EngineRegistration) *cobra.Command {
+	var db string
+
+	engineCmd := &cobra.Command{
+		Use:   fmt.Sprintf("%s <subcommand>", r.Name),
+		Short: fmt.Sprintf("%s database related subcommands", r.Title),
+		Run: func(cmd *cobra.Command, _ []string /* args */) {
+			if err := cmd.Help(); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		},
+	}
+
+	engineCmd.PersistentFlags().StringVar(&db, "db", "", fmt.Sprintf("Name of the %s database (BAK_DB_%s[_<N>]_NAME), required if multiple are enabled (dump: all if unset)", r.Title, strings.TrimPrefix(r.EnabledEnv, "BAK_DB_")))
+
+	engineCmd.AddCommand(
+		newEngineDumpCmd(r, &db),
+		newEngineInfoCmd(r, &db),
+		newEngineShellCmd(r, &db),
+		newEngineDownloadDumpCmd(r, &db),
+	)
+
+	if _, ok := r.Instances(lib.Config{})[0].(lib.DumpRestorer); ok {
+		engineCmd.AddCommand(newEngineRestoreCmd(r, &db))
+	}
+
+	if _, ok := r.Instances(lib.Config{})[0].(lib.DumpVerifier); ok {
+		engineCmd.AddCommand(newEngineVerifyCmd(r, &db))
+	}
+
+	return engineCmd
+}
+
+// loadEngineConfig loads the config and ensures the enabled engine instances are valid.
+func loadEngineConfig() lib.Config {
+	config := lib.LoadConfig()
+
+	if err := lib.ValidateEnabledEngines(config); err != nil {
+		log.Fatalf("Invalid database config: %v", err)
+	}
+
+	return config
+}
+
+// loadEnabledEngine loads the config and the enabled engine instance with the name (or the only enabled one if name is "").
+func loadEnabledEngine(r lib.EngineRegistration, name string) (lib.Config, lib.Engine) {
+	config := loadEngineConfig()
+
+	engine, err := r.SelectInstance(config, name)
+	if err != nil {
+		log.Fatalf("Failed to select the %s database (--db): %v", r.Name, err)
+	}
+
+	return config, engine
+}
+
+// loadEnabledEngines loads the config and all enabled engine instances (or only the instance with the name if name is set).
+func loadEnabledEngines(r lib.EngineRegistration, name string) (lib.Config, []lib.Engine) {
+	if name != "" {
+		config, engine := loadEnabledEngine(r, name)
+		return config, []lib.Engine{engine}
+	}
+
+	config := loadEngineConfig()
+
+	engines := r.EnabledInstances(config)
+	if len(engines) == 0 {
+		log.Fatalf("%s=true must be set.", r.EnabledEnv)
+	}
+
+	return config, engines
+}
+
+func newEngineDumpCmd(r lib.EngineRegistration, db *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "dump",
+		Short: fmt.Sprintf("Connects to the live %s containers and creates database dumps", r.Title),
+		Run: func(_ *cobra.Command, _ []string) {
+			config, engines := loadEnabledEngines(r, *db)
+
+			if config.DryRun {
+				slog.Info("Dry run mode is active, write operations are skipped!")
+			}
+
+			var err error
+			for _, engine := range engines {
+				if _, err = runEngineDump(config, engine); err != nil {
+					break
+				}
+			}
+
+			pushMetrics(config, r.Name+"_dump", config.Namespace, err)
+
+			if err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+}
+
+// runEngineDump checks the engine and the free disk space, then creates the dump.
+func runEngineDump(config lib.Config, engine lib.Engine) (lib.DumpResult, error) {
+	if err := engine.Check(config.Namespace); err != nil {
+		return lib.DumpResult{}, err
+	}
+
+	resource, container := engine.ExecTarget()
+	if err := lib.EnsureFreeSpace(config.Namespace, resource, container, filepath.Dir(engine.DumpFile()), config.ThresholdSpaceUsedPercent); err != nil {
+		return lib.DumpResult{}, err
+	}
+
+	result, err := engine.Dump(config.Namespace, config.DryRun)
+	if err != nil {
+		return lib.DumpResult{}, err
+	}
+
+	slog.Info("Finished dump", "engine", engine.Name(), "name", engine.Instance(), "namespace", config.Namespace)
+	return result, nil
+}
+
+func newEngineRestoreCmd(r lib.EngineRegistration, db *string) *cobra.Command {
+	var force bool
+
+	restoreCmd := &cobra.Command{
+		Use:   "restore",
+		Short: fmt.Sprintf("Connects to the live %s container and restores a preexisting database dump", r.Title),
+		Run: func(_ *cobra.Command, _ []string) {
+			config, engine := loadEnabledEngine(r, *db)
+
+			if config.DryRun {
+				slog.Info("Dry run mode is active, write operations are skipped!")
+			}
+
+			if err := engine.Check(config.Namespace); err != nil {
+				log.Fatal(err)
+			}
+
+			if !config.DryRun && !force && !confirmEngineRestore(engine.Instance(), config.Namespace) {
+				slog.Info("Restore cancelled by user")
+				return
+			}
+
+			if err := engine.(lib.DumpRestorer).Restore(config.Namespace, config.DryRun); err != nil {
+				log.Fatal(err)
+			}
+
+			slog.Info("Finished restore", "engine", engine.Name(), "name", engine.Instance(), "namespace", config.Namespace)
+		},
+	}
+
+	restoreCmd.Flags().BoolVarP(&force, "force", "f", false, "Skip confirmation prompt")
+
+	return restoreCmd
+}
+
+func confirmEngineRestore(name string, namespace string) bool {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("Are you sure you want to restore the %s dump in namespace '%s'? [y/N]: ", name, namespace)
+
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes"
+}
+
+func newEngineInfoCmd(r lib.EngineRegistration, db *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "info",
+		Short: fmt.Sprintf("Shows information about the %s database backup state", r.Title),
+		Run: func(_ *cobra.Command, _ []string) {
+			config, engine := loadEnabledEngine(r, *db)
+
+			if err := engine.Check(config.Namespace); err != nil {
+				log.Fatal(err)
+			}
+
+			info, err := engine.Info(config.Namespace)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			slog.Info("Last dump", "engine", info.Engine, "name", info.Name, "namespace", config.Namespace, "dump_file", info.DumpFile,
+				"created", info.Modified.UTC().Format("2006-01-02 15:04:05 MST"), "size_bytes", info.SizeBytes)
+
+			manifest, err := lib.VerifyDumpManifest(config.Namespace, engine)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if manifest == nil {
+				slog.Warn("No dump manifest found, the dump file cannot be verified", "manifest_file", lib.ManifestFile(info.DumpFile))
+				return
+			}
+
+			slog.Info("Dump manifest verified", "manifest_file", lib.ManifestFile(info.DumpFile), "sha256", manifest.SHA256,
+				"server_version", manifest.ServerVersion, "started", manifest.Start.UTC().Format("2006-01-02 15:04:05 MST"),
+				"finished", manifest.End.UTC().Format("2006-01-02 15:04:05 MST"), "uncompressed_size_bytes", manifest.UncompressedSizeBytes)
+
+			for _, table := range slices.Sorted(maps.Keys(manifest.RowCounts)) {
+				slog.Info("Estimated rows", "table", table, "rows", manifest.RowCounts[table])
+			}
+		},
+	}
+}
+
+func newEngineVerifyCmd(r lib.EngineRegistration, db *string) *cobra.Command {
+	var vsName string
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: fmt.Sprintf("Test-restores the latest %s dump into an ephemeral database and runs sanity checks", r.Title),
+		Long: fmt.Sprintf(`Starts a throwaway pod with the image of the %s container, restores the latest dump into its empty database and
+compares the restored tables with the dump manifest (optional BAK_DB_<ENGINE>_VERIFY_SQL checks are run afterwards).
+The result is recorded in the backup-ns.sh/<name>-verify annotation of the volume snapshot holding the dump (--vs, or the newest
+one of BAK_PVC_NAME with the same dump checksum), the pod is always deleted afterwards.`, r.Title),
+		Run: func(_ *cobra.Command, _ []string) {
+			config, engine := loadEnabledEngine(r, *db)
+
+			if err := engine.Check(config.Namespace); err != nil {
+				log.Fatal(err)
+			}
+
+			result, err := engine.(lib.DumpVerifier).Verify(config.Namespace, config.Verify)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			for _, table := range slices.Sorted(maps.Keys(result.RowCounts)) {
+				slog.Info("Restored rows", "table", table, "rows", result.RowCounts[table])
+			}
+
+			if config.DryRun {
+				slog.Info("Skipping volume snapshot annotation - dry run mode is active")
+			} else {
+				pvcName := ""
+				if len(config.PVCNames) > 0 {
+					pvcName = config.PVCNames[0]
+				}
+
+				vs, err := lib.AnnotateVerifiedVolumeSnapshot(config.Namespace, pvcName, vsName, result)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if vs == "" {
+					slog.Warn("No volume snapshot holds the verified dump yet, the result was not recorded", "pvc", pvcName, "sha256", result.SHA256)
+				}
+			}
+
+			if !result.Passed {
+				log.Fatalf("Verification of the %s dump failed: %s", engine.Instance(), result.Error)
+			}
+
+			slog.Info("Finished verify", "engine", engine.Name(), "name", engine.Instance(), "namespace", config.Namespace,
+				"tables", result.Tables, "rows", result.Rows, "duration_seconds", result.DurationSeconds)
+		},
+	}
+
+	verifyCmd.Flags().StringVar(&vsName, "vs", "", "Name of the volume snapshot to record the result in (default: the newest one of BAK_PVC_NAME holding the verified dump)")
+
+	return verifyCmd
+}
+
+func newEngineShellCmd(r lib.EngineRegistration, db *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "shell",
+		Short: fmt.Sprintf("Opens an interactive %s shell within the running database container", r.Title),
+		Run: func(_ *cobra.Command, _ []string) {
+			config, engine := loadEnabledEngine(r, *db)
+
+			if err := engine.Shell(config.Namespace); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+}
+
+func newEngineDownloadDumpCmd(r lib.EngineRegistration, db *string) *cobra.Command {
+	var (
+		customOutputFile string
+		retries          int
+		decrypt          bool
+	)
+
+	downloadDumpCmd := &cobra.Command{
+		Use:   "downloadDump",
+		Short: fmt.Sprintf("Downloads the latest %s dump from the container to the local filesystem", r.Title),
+		Run: func(_ *cobra.Command, _ []string) {
+			config, engine := loadEnabledEngine(r, *db)
+
+			if err := engine.Check(config.Namespace); err != nil {
+				log.Fatal(err)
+			}
+
+			info, err := engine.Info(config.Namespace)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// The manifest is read before the download, the downloaded file is verified against it
+			resource, container := engine.ExecTarget()
+			manifest, err := lib.ReadDumpManifest(config.Namespace, resource, container, engine.DumpFile())
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// Determine local destination path
+			localPath := customOutputFile
+			if localPath != "" {
+				if !filepath.IsAbs(localPath) {
+					log.Fatal("Custom output path must be absolute")
+				}
+			} else {
+				// Auto-generated name goes to current directory
+				suffix := r.DumpFileSuffix
+				if formatter, ok := engine.(lib.DumpFormatter); ok {
+					suffix = formatter.DumpFileSuffix()
+				}
+				localPath = filepath.Join(".", generateDumpFilename(config.Namespace, info.Name, suffix, info.Modified))
+			}
+
+			// Encrypted dump files are downloaded with the extension of the encryption, decrypted files without it
+			var encryption lib.EncryptionConfig
+			isDirectory := false
+			if formatter, ok := engine.(lib.DumpFormatter); ok {
+				encryption = formatter.DumpEncryption()
+				isDirectory = formatter.DumpIsDirectory()
+			}
+
+			decryptedPath := strings.TrimSuffix(localPath, encryption.Extension())
+			if decrypt {
+				if !encryption.Enabled() || isDirectory {
+					log.Fatal("--decrypt requires an encrypted dump file (BAK_DUMP_ENCRYPTION), the files of directory dumps must be decrypted after unpacking")
+				}
+				if decryptedPath == localPath {
+					localPath += encryption.Extension()
+				}
+			}
+
+			slog.Info("Downloading dump...", "engine", engine.Name(), "name", engine.Instance(), "namespace", config.Namespace, "path", localPath)
+
+			copyFromResource := lib.CopyFileFromResource
+			if isDirectory {
+				copyFromResource = lib.CopyDirFromResource
+			}
+
+			if err := copyFromResource(config.Namespace, resource, container, engine.DumpFile(), localPath, retries); err != nil {
+				log.Fatalf("Failed to download dump: %v", err)
+			}
+
+			if manifest != nil {
+				checksum, size, err := lib.LocalDumpChecksum(localPath, isDirectory)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if err := manifest.Verify(checksum, size); err != nil {
+					log.Fatalf("Downloaded dump '%s': %v", localPath, err)
+				}
+				slog.Info("Verified downloaded dump file", "path", localPath, "sha256", checksum)
+			} else {
+				slog.Warn("No dump manifest found, the downloaded dump file cannot be verified", "manifest_file", lib.ManifestFile(engine.DumpFile()))
+			}
+
+			if decrypt {
+				key, err := lib.LoadDecryptionKey(config.Namespace, encryption)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if key == "" {
+					log.Fatal("BAK_DUMP_DECRYPTION_KEY_FILE or BAK_DUMP_DECRYPTION_KEY_SECRET must be set to decrypt the dump")
+				}
+
+				if err := lib.DecryptFile(localPath, decryptedPath, key); err != nil {
+					log.Fatalf("Failed to decrypt dump: %v", err)
+				}
+				if err := os.Remove(localPath); err != nil {
+					log.Fatal(err)
+				}
+
+				slog.Info("Successfully decrypted dump file", "path", decryptedPath)
+				localPath = decryptedPath
+			}
+
+			if manifest != nil {
+				manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+				if err != nil {
+					log.Fatal(err)
+				}
+				if err := os.WriteFile(lib.ManifestFile(localPath), append(manifestJSON, '\n'), 0o600); err != nil {
+					log.Fatal(err)
+				}
+				slog.Info("Saved dump manifest", "path", lib.ManifestFile(localPath))
+			}
+
+			if stat, err := os.Stat(localPath); err == nil {
+				slog.Info("Successfully downloaded dump file", "path", localPath, "size_bytes", stat.Size())
+
+				if encryption.Enabled() && !isDirectory && localPath != decryptedPath {
+					slog.Info("To decrypt", "command", fmt.Sprintf("%s > %s", encryption.DecryptCommand(localPath), decryptedPath))
+					localPath = decryptedPath
+				}
+
+				if hinter, ok := engine.(lib.DumpHinter); ok {
+					for _, hint := range hinter.DumpHints(localPath) {
+						slog.Info(hint.Description, "command", hint.Command)
+					}
+				}
+			}
+		},
+	}
+
+	downloadDumpCmd.Flags().StringVarP(&customOutputFile, "output", "o", "", "Custom absolute output filepath")
+	downloadDumpCmd.Flags().IntVar(&retries, "retries", 3, "Number of retries for the download")
+	downloadDumpCmd.Flags().BoolVar(&decrypt, "decrypt", false, "Decrypt the downloaded dump file via the local age or gpg cli (BAK_DUMP_DECRYPTION_KEY_FILE or BAK_DUMP_DECRYPTION_KEY_SECRET)")
+
+	return downloadDumpCmd
+}
+
+func generateDumpFilename(namespace string, name string, suffix string, timestamp time.Time) string {
+	return fmt.Sprintf("%s_%s_%s_dump%s",
+		namespace,
+		timestamp.UTC().Format("2006-01-02T15-04-05Z"),
+		name,
+		suffix)
+}
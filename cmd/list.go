@@ -2,11 +2,14 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"log"
-	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/allaboutapps/backup-ns/internal/lib"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
 )
 
 var (
@@ -16,12 +19,14 @@ var (
 	filterMonthly bool
 	filterAdhoc   bool
 	filterCronjob bool
+	filterSet     string
+	listSets      bool
 )
 
 var vsListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List volume snapshots with backup-ns labels",
-	Run: func(_ *cobra.Command, args []string) {
+	Run: func(_ *cobra.Command, _ []string) {
 		// Handle namespace selection
 		if allNamespaces && namespace != "" {
 			log.Fatal("Cannot specify both --namespace and --all-namespaces")
@@ -52,26 +57,13 @@ var vsListCmd = &cobra.Command{
 		if filterCronjob {
 			labelSelector += ",backup-ns.sh/type=cronjob"
 		}
-
-		// Build kubectl command
-		args = []string{
-			"get",
-			"vs",
-			"-l" + labelSelector,
-			"-Lbackup-ns.sh/type,backup-ns.sh/retain,backup-ns.sh/daily,backup-ns.sh/weekly,backup-ns.sh/monthly,backup-ns.sh/delete-after",
-		}
-
-		if allNamespaces {
-			args = append(args, "--all-namespaces")
-		} else if namespace != "" {
-			args = append(args, "-n", namespace)
+		if filterSet != "" {
+			labelSelector += fmt.Sprintf(",%s=%s", lib.LabelSet, filterSet)
 		}
 
-		// #nosec G204
-		cmd := exec.Command("kubectl", args...)
-		output, err := cmd.CombinedOutput()
+		vss, err := lib.GetVolumeSnapshotInfos(namespace, labelSelector)
 		if err != nil {
-			log.Fatalf("Failed to list volume snapshots: %v\nOutput: %s", err, output)
+			log.Fatalf("Failed to list volume snapshots: %v", err)
 		}
 
 		if namespace != "" {
@@ -79,10 +71,74 @@ var vsListCmd = &cobra.Command{
 		}
 
 		fmt.Printf("Listing volume snapshots with labels: %s\n", labelSelector)
-		fmt.Print(string(output))
+		if err := printOutput("table", nil, func(w io.Writer) {
+			if listSets {
+				printVolumeSnapshotSetTable(w, lib.GroupVolumeSnapshotSets(vss), allNamespaces, time.Now())
+				return
+			}
+			printVolumeSnapshotTable(w, vss, allNamespaces, time.Now())
+		}); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
+func printVolumeSnapshotTable(w io.Writer, vss []lib.VolumeSnapshotInfo, withNamespace bool, now time.Time) {
+	header := "NAME\tREADYTOUSE\tRESTORESIZE\tSNAPSHOTCONTENT\tAGE\tTYPE\tRETAIN\tDAILY\tWEEKLY\tMONTHLY\tDELETE-AFTER\tSET"
+	if withNamespace {
+		header = "NAMESPACE\t" + header
+	}
+	fmt.Fprintln(w, header)
+
+	for _, vs := range vss {
+		if withNamespace {
+			fmt.Fprintf(w, "%s\t", vs.Namespace)
+		}
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			vs.Name,
+			vs.ReadyToUse,
+			vs.RestoreSize,
+			vs.ContentName,
+			duration.HumanDuration(now.Sub(vs.CreationTime)),
+			vs.Labels["backup-ns.sh/type"],
+			vs.Labels["backup-ns.sh/retain"],
+			vs.Labels["backup-ns.sh/daily"],
+			vs.Labels["backup-ns.sh/weekly"],
+			vs.Labels["backup-ns.sh/monthly"],
+			vs.Labels["backup-ns.sh/delete-after"],
+			vs.Labels[lib.LabelSet],
+		)
+	}
+}
+
+func printVolumeSnapshotSetTable(w io.Writer, sets []lib.VolumeSnapshotSet, withNamespace bool, now time.Time) {
+	header := "SET\tREADYTOUSE\tAGE\tPVCS\tSNAPSHOTS\tGROUP"
+	if withNamespace {
+		header = "NAMESPACE\t" + header
+	}
+	fmt.Fprintln(w, header)
+
+	for _, set := range sets {
+		if withNamespace {
+			fmt.Fprintf(w, "%s\t", set.Namespace)
+		}
+
+		names := make([]string, 0, len(set.Snapshots))
+		for _, vs := range set.Snapshots {
+			names = append(names, vs.Name)
+		}
+
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\t%s\n",
+			set.Name,
+			set.ReadyToUse(),
+			duration.HumanDuration(now.Sub(set.CreationTime())),
+			strings.Join(set.PVCNames(), ","),
+			strings.Join(names, ","),
+			set.Group(),
+		)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(vsListCmd)
 	vsListCmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "List volume snapshots in all namespaces")
@@ -92,4 +148,6 @@ func init() {
 	vsListCmd.Flags().BoolVar(&filterMonthly, "monthly", false, "Filter monthly snapshots")
 	vsListCmd.Flags().BoolVar(&filterAdhoc, "adhoc", false, "Filter type adhoc snapshots")
 	vsListCmd.Flags().BoolVar(&filterCronjob, "cronjob", false, "Filter type cronjob snapshots")
+	vsListCmd.Flags().StringVar(&filterSet, "set", "", "Filter snapshots of a backup set (label backup-ns.sh/set)")
+	vsListCmd.Flags().BoolVar(&listSets, "sets", false, "List backup sets (one row per backup-ns.sh/set) instead of single snapshots")
 }
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/allaboutapps/backup-ns/internal/lib/metrics"
+)
+
+// pushMetrics pushes all collected metrics of the one-shot command to BAK_METRICS_PUSHGATEWAY_URL (if set), the command
+// is only marked as successful if err (its result) is nil. It must be called before exiting on err, so failed runs are
+// pushed too. The metric group is identified by the command and instance grouping labels (the metrics already carry
+// namespace/pvc labels, so these can't be used for grouping). Failing to push is only logged.
+func pushMetrics(config lib.Config, command, instance string, err error) {
+	if err == nil {
+		metrics.SetSuccess()
+	}
+
+	if config.Metrics.PushgatewayURL == "" {
+		return
+	}
+
+	grouping := map[string]string{"command": command}
+	if instance != "" {
+		grouping["instance"] = instance
+	}
+
+	if pushErr := metrics.Push(config.Metrics.PushgatewayURL, config.Metrics.PushgatewayJob, grouping); pushErr != nil {
+		slog.Warn("Ignoring error while pushing metrics", "error", pushErr)
+	}
+}
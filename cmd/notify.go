@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+)
+
+// runNotified runs the command and notifies about its outcome (see lib.Notify), with the run id of ctx.
+func runNotified(ctx context.Context, config lib.Config, command string, run func() error) error {
+	event := lib.NotifyEvent{Command: command, StartedAt: time.Now(), RunID: lib.RunIDFromContext(ctx)}
+
+	err := run()
+
+	event.Finish(err)
+	lib.Notify(config.Notify, event)
+
+	return err
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// printOutput prints data to stdout either as indented json or as table (via the provided printTable func).
+func printOutput(format string, data any, printTable func(w io.Writer)) error {
+	switch format {
+	case "json":
+		jsonData, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+	case "table", "":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		printTable(w)
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to flush table: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid output format: %s (must be table or json)", format)
+	}
+
+	return nil
+}
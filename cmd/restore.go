@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/allaboutapps/backup-ns/internal/lib"
 	"github.com/spf13/cobra"
@@ -12,6 +16,8 @@ import (
 
 var (
 	pvcName      string
+	pvcPrefix    string
+	restoreSet   string
 	storageClass string
 	wait         bool
 	timeout      string
@@ -20,11 +26,14 @@ var (
 
 // restoreCmd represents the restore command
 var restoreCmd = &cobra.Command{
-	Use:   "restore SNAPSHOT_NAME",
-	Short: "Restore a volume snapshot to a new PVC",
+	Use:   "restore [SNAPSHOT_NAME]",
+	Short: "Restore a volume snapshot (or a backup set) to new PVCs",
 	Long: `Restore a volume snapshot to a new PVC.
 The snapshot name is provided as a positional argument.
 
+With --set all volume snapshots of a backup set (label backup-ns.sh/set, created by a single backup run
+over multiple BAK_PVC_NAME pvcs) are restored as a unit, each to a new PVC named <pvc-prefix><original pvc>.
+
 When using --output/-o flag, the PVC manifest will only be printed in the specified format
 without being applied to the cluster.`,
 	Example: `  # Create new PVC from snapshot
@@ -36,19 +45,20 @@ without being applied to the cluster.`,
   backup-ns restore my-snapshot --pvc new-pvc -o json
   
   # Print manifest without applying (alternative)
-  backup-ns restore my-snapshot --pvc new-pvc --dry-run`,
-	Args: cobra.ExactArgs(1),
+  backup-ns restore my-snapshot --pvc new-pvc --dry-run
+
+  # Create new PVCs restored-data and restored-uploads from the backup set (see backup-ns list --sets)
+  backup-ns restore --set 2025-01-08-023042-dcdkes --pvc-prefix restored-`,
+	Args: cobra.MaximumNArgs(1),
 	Run:  runRestore,
 }
 
 func init() {
 	rootCmd.AddCommand(restoreCmd)
 
-	// Required flags
-	restoreCmd.Flags().StringVarP(&pvcName, "pvc", "p", "", "Name of the new PVC to create")
-	if err := restoreCmd.MarkFlagRequired("pvc"); err != nil {
-		log.Fatalf("Failed to mark 'pvc' flag as required: %v", err)
-	}
+	restoreCmd.Flags().StringVarP(&pvcName, "pvc", "p", "", "Name of the new PVC to create (required when restoring a single snapshot)")
+	restoreCmd.Flags().StringVar(&restoreSet, "set", "", "Restore all snapshots of the backup set (label backup-ns.sh/set) instead of a single snapshot")
+	restoreCmd.Flags().StringVar(&pvcPrefix, "pvc-prefix", "", "Prefix of the new PVC names when restoring a backup set (required with --set, may be \"\" to restore to the original names)")
 
 	// Optional flags
 	restoreCmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the VolumeSnapshot (defaults to the current namespace in the context)")
@@ -58,9 +68,13 @@ func init() {
 	restoreCmd.Flags().StringVar(&timeout, "timeout", "30s", "Timeout for wait operation")
 }
 
-func runRestore(_ *cobra.Command, args []string) {
-	snapshotName := args[0]
+// restoreTarget is a snapshot and the new PVC to restore it to.
+type restoreTarget struct {
+	vsName  string
+	pvcName string
+}
 
+func runRestore(cmd *cobra.Command, args []string) {
 	if namespace == "" {
 		var err error
 		namespace, err = lib.GetCurrentNamespace()
@@ -69,28 +83,62 @@ func runRestore(_ *cobra.Command, args []string) {
 		}
 	}
 
-	// Create PVC manifest
-	pvcObject, err := lib.CreatePVCManifestFromVolumeSnapshot(
-		namespace,
-		snapshotName,
-		pvcName,
-		storageClass,
-	)
+	targets, err := getRestoreTargets(cmd, args)
 	if err != nil {
-		log.Fatalf("Failed to create PVC manifest: %v", err)
+		log.Fatal(err)
+	}
+
+	config := lib.LoadConfig()
+
+	vsNames := make([]string, 0, len(targets))
+	pvcNames := make([]string, 0, len(targets))
+	for _, target := range targets {
+		vsNames = append(vsNames, target.vsName)
+		pvcNames = append(pvcNames, target.pvcName)
+	}
+
+	// only an actual restore (no manifest output) is notified
+	event := lib.NotifyEvent{Command: "restore", Namespace: namespace, PVCName: strings.Join(pvcNames, ","), VSName: strings.Join(vsNames, ","), Set: restoreSet, StartedAt: time.Now()}
+	notifyRestore := func(err error) {
+		if outputFormat == "" {
+			event.Finish(err)
+			lib.Notify(config.Notify, event)
+		}
+	}
+
+	// Create PVC manifests
+	pvcObjects := make([]map[string]interface{}, 0, len(targets))
+	for _, target := range targets {
+		pvcObject, err := lib.CreatePVCManifestFromVolumeSnapshot(
+			namespace,
+			target.vsName,
+			target.pvcName,
+			storageClass,
+		)
+		if err != nil {
+			notifyRestore(err)
+			log.Fatalf("Failed to create PVC manifest: %v", err)
+		}
+		pvcObjects = append(pvcObjects, pvcObject)
+	}
+
+	// a single manifest is printed as is, the manifests of a set as kubectl compatible list
+	var output interface{} = map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": pvcObjects}
+	if restoreSet == "" {
+		output = pvcObjects[0]
 	}
 
 	// Handle output format
 	switch outputFormat {
 	case "json":
-		jsonData, err := json.MarshalIndent(pvcObject, "", "  ")
+		jsonData, err := json.MarshalIndent(output, "", "  ")
 		if err != nil {
 			log.Fatalf("Failed to marshal JSON: %v", err)
 		}
 		fmt.Println(string(jsonData))
 		return
 	case "yaml":
-		yamlData, err := yaml.Marshal(pvcObject)
+		yamlData, err := yaml.Marshal(output)
 		if err != nil {
 			log.Fatalf("Failed to marshal YAML: %v", err)
 		}
@@ -98,19 +146,58 @@ func runRestore(_ *cobra.Command, args []string) {
 		return
 	case "":
 		// Normal restore operation
-		err = lib.RestoreVolumeSnapshot(
-			namespace,
-			snapshotName,
-			pvcName,
-			storageClass,
-			wait,
-			timeout,
-		)
-		if err != nil {
-			log.Fatalf("Failed to restore snapshot: %v", err)
+		for _, target := range targets {
+			err = lib.RestoreVolumeSnapshot(
+				namespace,
+				target.vsName,
+				target.pvcName,
+				storageClass,
+				wait,
+				timeout,
+			)
+			if err != nil {
+				notifyRestore(err)
+				log.Fatalf("Failed to restore snapshot: %v", err)
+			}
+			slog.Info("Successfully restored snapshot", "vs_name", target.vsName, "pvc", target.pvcName)
 		}
-		log.Printf("Successfully restored snapshot '%s' to PVC '%s'", snapshotName, pvcName)
+		notifyRestore(nil)
 	default:
 		log.Fatalf("Invalid output format: %s (must be json or yaml)", outputFormat)
 	}
 }
+
+// getRestoreTargets returns the snapshot to restore (SNAPSHOT_NAME and --pvc) or all snapshots of the backup set (--set and --pvc-prefix).
+func getRestoreTargets(cmd *cobra.Command, args []string) ([]restoreTarget, error) {
+	if restoreSet == "" {
+		if len(args) != 1 || pvcName == "" {
+			return nil, errors.New("SNAPSHOT_NAME and --pvc are required (or --set and --pvc-prefix to restore a backup set)")
+		}
+
+		if labels, err := lib.GetBackupNsLabelMap(namespace, "vs", args[0]); err == nil && labels[lib.LabelSet] != "" {
+			if set, err := lib.GetVolumeSnapshotSet(namespace, labels[lib.LabelSet]); err == nil && len(set.Snapshots) > 1 {
+				slog.Warn("Snapshot is part of a backup set with multiple pvcs, use --set to restore all of them", "vs_name", args[0], "set", set.Name, "pvcs", strings.Join(set.PVCNames(), ","))
+			}
+		}
+
+		return []restoreTarget{{vsName: args[0], pvcName: pvcName}}, nil
+	}
+
+	if len(args) != 0 || pvcName != "" {
+		return nil, errors.New("SNAPSHOT_NAME and --pvc cannot be used with --set")
+	}
+	if !cmd.Flags().Changed("pvc-prefix") {
+		return nil, errors.New("--pvc-prefix is required with --set")
+	}
+
+	set, err := lib.GetVolumeSnapshotSet(namespace, restoreSet)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]restoreTarget, 0, len(set.Snapshots))
+	for i, vs := range set.Snapshots {
+		targets = append(targets, restoreTarget{vsName: vs.Name, pvcName: pvcPrefix + set.PVCNames()[i]})
+	}
+	return targets, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/allaboutapps/backup-ns/internal/lib"
 	"github.com/spf13/cobra"
 )
 
@@ -12,6 +13,9 @@ var rootCmd = &cobra.Command{
 	Use:   "backup-ns",
 	Short: "k8s application-aware snapshots",
 	// Long: ``,
+	PersistentPreRun: func(_ *cobra.Command, _ []string) {
+		lib.SetupLogging(lib.LoadLogFormat())
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -2,32 +2,55 @@ package lib
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
-	"os/exec"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/allaboutapps/backup-ns/internal/lib/flock"
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
 	"github.com/allaboutapps/backup-ns/internal/util"
 )
 
 // Config holds all the configuration options
 type Config struct {
-	DryRun                    bool   `json:"BAK_DRY_RUN"`
-	Namespace                 string `json:"BAK_NAMESPACE"`
-	PVCName                   string `json:"BAK_PVC_NAME"`
-	VSRand                    string `json:"BAK_VS_RAND"`
+	DryRun                    bool     `json:"BAK_DRY_RUN"`
+	LogFormat                 string   `json:"BAK_LOG_FORMAT"`
+	RunID                     string   `json:"BAK_RUN_ID"`
+	Namespace                 string   `json:"BAK_NAMESPACE"`
+	PVCNames                  []string `json:"BAK_PVC_NAME"`
+	VSRand                    string   `json:"BAK_VS_RAND"`
 	LabelVS                   LabelVSConfig
 	VSNameTemplate            string `json:"BAK_VS_NAME_TEMPLATE"`
 	VSClassName               string `json:"BAK_VS_CLASS_NAME"`
+	VGSSelector               string `json:"BAK_VGS_SELECTOR"`
+	VGSClassName              string `json:"BAK_VGS_CLASS_NAME"`
 	VSWaitUntilReady          bool   `json:"BAK_VS_WAIT_UNTIL_READY"`
 	VSWaitUntilReadyTimeout   string `json:"BAK_VS_WAIT_UNTIL_READY_TIMEOUT"`
 	ThresholdSpaceUsedPercent int    `json:"BAK_THRESHOLD_SPACE_USED_PERCENTAGE"`
 	DBSkip                    bool   `json:"BAK_DB_SKIP"`
+	DumpCompression           CompressionConfig
+	DumpEncryption            EncryptionConfig
 	Postgres                  PostgresConfig
+	AdditionalPostgres        []PostgresConfig `json:"BAK_DB_POSTGRES_<N>,omitempty"`
 	MySQL                     MySQLConfig
+	AdditionalMySQL           []MySQLConfig `json:"BAK_DB_MYSQL_<N>,omitempty"`
+	Mongo                     MongoConfig
+	AdditionalMongo           []MongoConfig `json:"BAK_DB_MONGO_<N>,omitempty"`
+	Redis                     RedisConfig
+	AdditionalRedis           []RedisConfig `json:"BAK_DB_REDIS_<N>,omitempty"`
 	Flock                     FlockConfig
+	Retain                    RetainConfig
+	Sweep                     SweepConfig
+	Controller                ControllerConfig
+	Metrics                   MetricsConfig
+	Check                     CheckConfig
+	Notify                    NotifyConfig
+	Verify                    VerifyConfig
+	Drill                     DrillConfig
 }
 
 type LabelVSConfig struct {
@@ -38,28 +61,70 @@ type LabelVSConfig struct {
 }
 
 type PostgresConfig struct {
-	Enabled       bool   `json:"BAK_DB_POSTGRES"`
-	ExecResource  string `json:"BAK_DB_POSTGRES_EXEC_RESOURCE"`
-	ExecContainer string `json:"BAK_DB_POSTGRES_EXEC_CONTAINER"`
-	DumpFile      string `json:"BAK_DB_POSTGRES_DUMP_FILE"`
-	Host          string `json:"BAK_DB_POSTGRES_HOST"`
-	Port          string `json:"BAK_DB_POSTGRES_PORT"`
-	User          string `json:"BAK_DB_POSTGRES_USER"`
-	Password      string `json:"-"` // sensitive
-	DB            string `json:"BAK_DB_POSTGRES_DB"`
+	Enabled       bool              `json:"BAK_DB_POSTGRES"`
+	Name          string            `json:"BAK_DB_POSTGRES_NAME"`
+	ExecResource  string            `json:"BAK_DB_POSTGRES_EXEC_RESOURCE"`
+	ExecContainer string            `json:"BAK_DB_POSTGRES_EXEC_CONTAINER"`
+	DumpFile      string            `json:"BAK_DB_POSTGRES_DUMP_FILE"`
+	DumpFormat    string            `json:"BAK_DB_POSTGRES_DUMP_FORMAT"`
+	Jobs          int               `json:"BAK_DB_POSTGRES_JOBS"`
+	AllDatabases  bool              `json:"BAK_DB_POSTGRES_ALL_DATABASES"`
+	Compression   CompressionConfig `json:"-"` // BAK_DUMP_COMPRESSION
+	Encryption    EncryptionConfig  `json:"-"` // BAK_DUMP_ENCRYPTION
+	Host          string            `json:"BAK_DB_POSTGRES_HOST"`
+	Port          string            `json:"BAK_DB_POSTGRES_PORT"`
+	User          string            `json:"BAK_DB_POSTGRES_USER"`
+	Password      string            `json:"-"` // sensitive
+	DB            string            `json:"BAK_DB_POSTGRES_DB"`
+	VerifySQL     string            `json:"BAK_DB_POSTGRES_VERIFY_SQL"`
 }
 
 type MySQLConfig struct {
-	Enabled             bool   `json:"BAK_DB_MYSQL"`
-	ExecResource        string `json:"BAK_DB_MYSQL_EXEC_RESOURCE"`
-	ExecContainer       string `json:"BAK_DB_MYSQL_EXEC_CONTAINER"`
-	DumpFile            string `json:"BAK_DB_MYSQL_DUMP_FILE"`
-	Host                string `json:"BAK_DB_MYSQL_HOST"`
-	Port                string `json:"BAK_DB_MYSQL_PORT"`
-	User                string `json:"BAK_DB_MYSQL_USER"`
-	Password            string `json:"-"` // sensitive
-	DB                  string `json:"BAK_DB_MYSQL_DB"`
-	DefaultCharacterSet string `json:"BAK_DB_MYSQL_DEFAULT_CHARACTER_SET"`
+	Enabled             bool              `json:"BAK_DB_MYSQL"`
+	Name                string            `json:"BAK_DB_MYSQL_NAME"`
+	ExecResource        string            `json:"BAK_DB_MYSQL_EXEC_RESOURCE"`
+	ExecContainer       string            `json:"BAK_DB_MYSQL_EXEC_CONTAINER"`
+	DumpFile            string            `json:"BAK_DB_MYSQL_DUMP_FILE"`
+	Host                string            `json:"BAK_DB_MYSQL_HOST"`
+	Port                string            `json:"BAK_DB_MYSQL_PORT"`
+	User                string            `json:"BAK_DB_MYSQL_USER"`
+	Password            string            `json:"-"` // sensitive
+	DB                  string            `json:"BAK_DB_MYSQL_DB"`
+	DefaultCharacterSet string            `json:"BAK_DB_MYSQL_DEFAULT_CHARACTER_SET"`
+	SingleTransaction   bool              `json:"BAK_DB_MYSQL_SINGLE_TRANSACTION"`
+	AllDatabases        bool              `json:"BAK_DB_MYSQL_ALL_DATABASES"`
+	Compression         CompressionConfig `json:"-"` // BAK_DUMP_COMPRESSION
+	Encryption          EncryptionConfig  `json:"-"` // BAK_DUMP_ENCRYPTION
+	VerifySQL           string            `json:"BAK_DB_MYSQL_VERIFY_SQL"`
+}
+
+type MongoConfig struct {
+	Enabled                bool              `json:"BAK_DB_MONGO"`
+	Name                   string            `json:"BAK_DB_MONGO_NAME"`
+	ExecResource           string            `json:"BAK_DB_MONGO_EXEC_RESOURCE"`
+	ExecContainer          string            `json:"BAK_DB_MONGO_EXEC_CONTAINER"`
+	DumpFile               string            `json:"BAK_DB_MONGO_DUMP_FILE"`
+	Host                   string            `json:"BAK_DB_MONGO_HOST"`
+	Port                   string            `json:"BAK_DB_MONGO_PORT"`
+	User                   string            `json:"BAK_DB_MONGO_USER"`
+	Password               string            `json:"-"` // sensitive
+	AuthenticationDatabase string            `json:"BAK_DB_MONGO_AUTHENTICATION_DATABASE"`
+	DB                     string            `json:"BAK_DB_MONGO_DB"`
+	Oplog                  bool              `json:"BAK_DB_MONGO_OPLOG"`
+	Compression            CompressionConfig `json:"-"` // BAK_DUMP_COMPRESSION
+	Encryption             EncryptionConfig  `json:"-"` // BAK_DUMP_ENCRYPTION
+}
+
+type RedisConfig struct {
+	Enabled        bool   `json:"BAK_DB_REDIS"`
+	Name           string `json:"BAK_DB_REDIS_NAME"`
+	ExecResource   string `json:"BAK_DB_REDIS_EXEC_RESOURCE"`
+	ExecContainer  string `json:"BAK_DB_REDIS_EXEC_CONTAINER"`
+	DumpFile       string `json:"BAK_DB_REDIS_DUMP_FILE"`
+	Host           string `json:"BAK_DB_REDIS_HOST"`
+	Port           string `json:"BAK_DB_REDIS_PORT"`
+	Password       string `json:"-"` // sensitive
+	SaveTimeoutSec int    `json:"BAK_DB_REDIS_SAVE_TIMEOUT_SEC"`
 }
 
 type FlockConfig struct {
@@ -69,16 +134,102 @@ type FlockConfig struct {
 	TimeoutSec int    `json:"BAK_FLOCK_TIMEOUT_SEC"`
 }
 
+type RetainConfig struct {
+	LastDaily   int `json:"BAK_RETAIN_LAST_DAILY"`
+	LastWeekly  int `json:"BAK_RETAIN_LAST_WEEKLY"`
+	LastMonthly int `json:"BAK_RETAIN_LAST_MONTHLY"`
+}
+
+type SweepConfig struct {
+	MaxDeletions int `json:"BAK_SWEEP_MAX_DELETIONS"`
+}
+
+type ControllerConfig struct {
+	PruneInterval  string `json:"BAK_CONTROLLER_PRUNE_INTERVAL"`
+	ResyncInterval string `json:"BAK_CONTROLLER_RESYNC_INTERVAL"`
+	LeaderElection bool   `json:"BAK_CONTROLLER_LEADER_ELECTION"`
+	LeaseNamespace string `json:"BAK_CONTROLLER_LEASE_NAMESPACE"`
+	LeaseName      string `json:"BAK_CONTROLLER_LEASE_NAME"`
+	Identity       string `json:"BAK_CONTROLLER_IDENTITY"`
+	DrillInterval  string `json:"BAK_CONTROLLER_DRILL_INTERVAL"`
+	DrillNamespace string `json:"BAK_CONTROLLER_DRILL_NAMESPACE"`
+}
+
+type MetricsConfig struct {
+	Address        string `json:"BAK_METRICS_ADDRESS"`
+	PushgatewayURL string `json:"BAK_METRICS_PUSHGATEWAY_URL"`
+	PushgatewayJob string `json:"BAK_METRICS_PUSHGATEWAY_JOB"`
+}
+
+type CheckConfig struct {
+	MaxSnapshotAge string `json:"BAK_CHECK_MAX_SNAPSHOT_AGE"`
+	MaxDumpAge     string `json:"BAK_CHECK_MAX_DUMP_AGE"`
+}
+
+type NotifyConfig struct {
+	On              string `json:"BAK_NOTIFY_ON"`
+	Timeout         string `json:"BAK_NOTIFY_TIMEOUT"`
+	WebhookURL      string `json:"-"` // sensitive
+	SlackWebhookURL string `json:"-"` // sensitive
+	SMTP            NotifySMTPConfig
+}
+
+type NotifySMTPConfig struct {
+	Host     string `json:"BAK_NOTIFY_SMTP_HOST"`
+	Port     string `json:"BAK_NOTIFY_SMTP_PORT"`
+	User     string `json:"BAK_NOTIFY_SMTP_USER"`
+	Password string `json:"-"` // sensitive
+	From     string `json:"BAK_NOTIFY_SMTP_FROM"`
+	To       string `json:"BAK_NOTIFY_SMTP_TO"`
+}
+
 func LoadConfig() Config {
-	return Config{
+	dumpCompression := CompressionConfig{
+		// The compression of the dump files ("gzip", "pigz", "zstd" or "none"), the cli must be available in the database containers
+		// Applies to postgres plain dumps, mysql and mongo dumps (the default dump file extensions follow it), restore detects the compression of the dump file
+		Algorithm: util.GetEnvEnum("BAK_DUMP_COMPRESSION", "gzip", []string{"gzip", "pigz", "zstd", "none"}),
+
+		// The compression level (e.g. 1-9 for gzip and pigz, 1-19 for zstd), 0 uses the default level of the cli
+		Level: util.GetEnvAsInt("BAK_DUMP_COMPRESSION_LEVEL", 0),
+
+		// The number of compression threads of pigz and zstd, 0 uses the default of the cli (pigz: all cores, zstd: 1)
+		Threads: util.GetEnvAsInt("BAK_DUMP_COMPRESSION_THREADS", 0),
+	}
+
+	dumpEncryption := EncryptionConfig{
+		// The client-side encryption of the dump files ("none", "age" or "gpg"), the cli must be available in the database containers
+		// Applies to postgres plain and custom dumps, mysql and mongo dumps (the default dump file extensions get ".age" or ".gpg" appended)
+		Algorithm: util.GetEnvEnum("BAK_DUMP_ENCRYPTION", "none", []string{"none", "age", "gpg"}),
+
+		// The public keys the dumps are encrypted to: comma or newline separated age recipients (e.g. "age1...") or
+		// the armored gpg public key(s), no private key is required to create encrypted dumps
+		Recipients: util.GetEnv("BAK_DUMP_ENCRYPTION_RECIPIENTS", ""),
+
+		// The local file holding the (unprotected) age identity or armored gpg private key to decrypt the dumps (restore, downloadDump --decrypt)
+		DecryptionKeyFile: util.GetEnv("BAK_DUMP_DECRYPTION_KEY_FILE", ""),
+
+		// Alternatively, the secret holding the private key in BAK_NAMESPACE as "<secret>/<key>" (e.g. "backup-ns-dump-key/key.txt")
+		DecryptionKeySecret: util.GetEnv("BAK_DUMP_DECRYPTION_KEY_SECRET", ""),
+	}
+
+	config := Config{
 		// If true, no actual dump/backup is performed, just a dry run to check if everything is in place (still exec into the target container)
 		DryRun: util.GetEnvAsBool("BAK_DRY_RUN", false),
 
+		// The format of all log records written to stderr ("text" or "json")
+		LogFormat: LoadLogFormat(),
+
+		// The id stamped on every log record (run_id), the notifications and the created volume snapshot (annotation "backup-ns.sh/run-id")
+		// Randomly generated per invocation by default
+		RunID: RunID(),
+
 		// The target namespace to backup
 		Namespace: util.GetEnv("BAK_NAMESPACE", getCurrentNamespaceWithFallback()),
 
 		// The name of the PVC to backup, the vs will also be labeled via the key "backup-ns.sh/pvc"
-		PVCName: util.GetEnv("BAK_PVC_NAME", "data"),
+		// Multiple comma separated PVCs (e.g. "data,uploads") are snapshotted after a single database dump, all vs of the run
+		// share the label key "backup-ns.sh/set" (the first PVC is expected to hold the database dumps)
+		PVCNames: slices.DeleteFunc(util.GetEnvAsStringArrTrimmed("BAK_PVC_NAME", []string{"data"}), func(s string) bool { return s == "" }),
 
 		// A random string to make the volume snapshot name unique (apart from the timestamp)
 		VSRand: util.GetEnv("BAK_VS_RAND", GenerateRandomStringOrPanic(6)),
@@ -106,6 +257,14 @@ func LoadConfig() Config {
 		// The name of the volume snapshot class to use, "" means default class
 		VSClassName: util.GetEnv("BAK_VS_CLASS_NAME", ""), // the snapshot calls should have "Retain" deletion policy set!
 
+		// If set, a single crash-consistent VolumeGroupSnapshot over all PVCs matching this label selector (e.g. "app=db") is
+		// created instead of a vs per pvc. Its member vs are labeled with "backup-ns.sh/group" and are retained/swept as a unit.
+		// BAK_PVC_NAME must list the PVCs expected in the group (the first one is expected to hold the database dumps)
+		VGSSelector: util.GetEnv("BAK_VGS_SELECTOR", ""),
+
+		// The name of the volume group snapshot class to use, "" means default class
+		VGSClassName: util.GetEnv("BAK_VGS_CLASS_NAME", ""), // the group snapshot class should have "Retain" deletion policy set!
+
 		// If true, the script will wait until the snapshot is actually ready (useable)
 		VSWaitUntilReady: util.GetEnvAsBool("BAK_VS_WAIT_UNTIL_READY", true),
 
@@ -118,72 +277,199 @@ func LoadConfig() Config {
 		// If true, no application-aware backup is performed (no db - useful for testing the snapshot creation only)
 		DBSkip: util.GetEnvAsBool("BAK_DB_SKIP", false),
 
-		Postgres: PostgresConfig{
+		DumpCompression: dumpCompression,
+
+		DumpEncryption: dumpEncryption,
+
+		Postgres: loadPostgresConfig("BAK_DB_POSTGRES", PostgresConfig{
 			// If true, a postgresql dump is created before the snapshot
-			Enabled: util.GetEnvAsBool("BAK_DB_POSTGRES", false),
+			Enabled: false,
+
+			// The name to select this database in the engine subcommands (--db) and to identify its dump in logs, metrics and notifications
+			Name: "postgres",
 
 			// The k8s resource to exec into to create the dump
-			ExecResource: util.GetEnv("BAK_DB_POSTGRES_EXEC_RESOURCE", "deployment/app-base"),
+			ExecResource: "deployment/app-base",
 
 			// The container inside the above resource to exec into to create the dump
-			ExecContainer: util.GetEnv("BAK_DB_POSTGRES_EXEC_CONTAINER", "postgres"),
+			ExecContainer: "postgres",
 
 			// The file inside the container to store the dump
-			DumpFile: util.GetEnv("BAK_DB_POSTGRES_DUMP_FILE", "/var/lib/postgresql/data/dump.sql.gz"),
+			// The extension is replaced according to BAK_DB_POSTGRES_DUMP_FORMAT if unset (dump.pgdump for custom, the directory dump.dir for directory)
+			// and BAK_DB_POSTGRES_ALL_DATABASES (the directory dump.all), plain dumps get the extension of BAK_DUMP_COMPRESSION (e.g. dump.sql.zst)
+			// and BAK_DUMP_ENCRYPTION (e.g. dump.sql.zst.age)
+			DumpFile: "/var/lib/postgresql/data/dump.sql.gz",
+
+			// The pg_dump --format: "plain" (sql compressed via BAK_DUMP_COMPRESSION, restored via psql), "custom" (restored via pg_restore)
+			// or "directory" (dumped and restored in parallel via --jobs, downloaded as tar archive)
+			DumpFormat: "plain",
+
+			// The number of parallel jobs of pg_dump (directory format) and pg_restore (custom and directory format)
+			Jobs: 4,
+
+			// The compression of plain dumps (custom and directory dumps are compressed by pg_dump)
+			Compression: dumpCompression,
+
+			// The encryption of plain and custom dumps (not supported for directory dumps)
+			Encryption: dumpEncryption,
+
+			// Dump the roles and tablespaces (pg_dumpall --globals-only) and all non-template databases of the postgres instance
+			// instead of only BAK_DB_POSTGRES_DB (still used to connect), restore recreates the roles first and creates missing databases
+			AllDatabases: false,
 
 			// The postgresql host to use for connecting/creating/restoring the dump
-			Host: util.GetEnv("BAK_DB_POSTGRES_HOST", "127.0.0.1"),
+			Host: "127.0.0.1",
 
 			// The postgresql host to use for connecting/creating/restoring the dump
-			Port: util.GetEnv("BAK_DB_POSTGRES_PORT", "5432"),
+			Port: "5432",
 
 			// The postgresql user to use for connecting/creating the dump (psql and pg_dump must be allowed)
 			// Read from inside the *container* by default (${POSTGRES_USER})
-			User: util.GetEnv("BAK_DB_POSTGRES_USER", "${POSTGRES_USER}"),
+			User: "${POSTGRES_USER}",
 
 			// The postgresql password to use for connecting/creating the dump
 			// Read from inside the *container* by default (${POSTGRES_PASSWORD})
-			Password: util.GetEnv("BAK_DB_POSTGRES_PASSWORD", "${POSTGRES_PASSWORD}"),
+			Password: "${POSTGRES_PASSWORD}",
 
 			// The postgresql database to use for connecting/creating the dump
 			// Read from inside the *container* by default (${POSTGRES_DB})
-			DB: util.GetEnv("BAK_DB_POSTGRES_DB", "${POSTGRES_DB}"),
-		},
+			DB: "${POSTGRES_DB}",
+
+			// Additional SQL checks run by "backup-ns postgres verify" after restoring the dump into the ephemeral database,
+			// the verification fails if a statement errors or returns a false, 0 or NULL value (e.g. "SELECT count(*) > 0 FROM users;")
+			VerifySQL: "",
+		}),
 
-		MySQL: MySQLConfig{
+		MySQL: loadMySQLConfig("BAK_DB_MYSQL", MySQLConfig{
 			// If true, a mysql dump is created before the snapshot
-			Enabled: util.GetEnvAsBool("BAK_DB_MYSQL", false),
+			Enabled: false,
+
+			// The name to select this database in the engine subcommands (--db) and to identify its dump in logs, metrics and notifications
+			Name: "mysql",
 
 			// The k8s resource to exec into to create the dump
-			ExecResource: util.GetEnv("BAK_DB_MYSQL_EXEC_RESOURCE", "deployment/app-base"),
+			ExecResource: "deployment/app-base",
 
 			// The container inside the above resource to exec into to create the dump
-			ExecContainer: util.GetEnv("BAK_DB_MYSQL_EXEC_CONTAINER", "mysql"),
+			ExecContainer: "mysql",
 
 			// The file inside the container to store the dump
-			DumpFile: util.GetEnv("BAK_DB_MYSQL_DUMP_FILE", "/var/lib/mysql/dump.sql.gz"),
+			// The extension is replaced according to BAK_DUMP_COMPRESSION and BAK_DUMP_ENCRYPTION if unset (e.g. dump.sql.zst.age for zstd and age)
+			DumpFile: "/var/lib/mysql/dump.sql.gz",
 
 			// The mysql host to use for connecting/creating/restoring the dump
-			Host: util.GetEnv("BAK_DB_MYSQL_HOST", "127.0.0.1"),
+			Host: "127.0.0.1",
 
 			// The mysql host to use for connecting/creating/restoring the dump
-			Port: util.GetEnv("BAK_DB_MYSQL_PORT", "3306"),
+			Port: "3306",
 
 			// The mysql user to use for connecting/creating the dump
-			User: util.GetEnv("BAK_DB_MYSQL_USER", "root"),
+			User: "root",
 
 			// The mysql password to use for connecting/creating the dump
 			// Read from inside the *container* by default (${MYSQL_ROOT_PASSWORD})
-			Password: util.GetEnv("BAK_DB_MYSQL_PASSWORD", "${MYSQL_ROOT_PASSWORD}"),
+			Password: "${MYSQL_ROOT_PASSWORD}",
 
 			// The mysql database to use for connecting/creating the dump
 			// Read from inside the *container* by default (${MYSQL_DATABASE})
-			DB: util.GetEnv("BAK_DB_MYSQL_DB", "${MYSQL_DATABASE}"),
+			DB: "${MYSQL_DATABASE}",
 
 			// The mysql character set to use for connecting/creating the dump
 			// utf8 is by default active for backwards compatibility
-			DefaultCharacterSet: util.GetEnv("BAK_DB_MYSQL_DEFAULT_CHARACTER_SET", "utf8"),
-		},
+			DefaultCharacterSet: "utf8",
+
+			// Dump InnoDB tables consistently without blocking writes (--single-transaction instead of --lock-tables),
+			// including routines, triggers and events. If binary logging is enabled, the binlog coordinates (and GTID set)
+			// of the dump are recorded in the backup-ns.sh/<name>-binlog volume snapshot annotation for point-in-time recovery
+			SingleTransaction: false,
+
+			// Dump all databases (--all-databases) instead of only BAK_DB_MYSQL_DB (still used to connect)
+			AllDatabases: false,
+
+			Compression: dumpCompression,
+
+			Encryption: dumpEncryption,
+
+			// Additional SQL checks run by "backup-ns mysql verify" after restoring the dump into the ephemeral database,
+			// the verification fails if a statement errors or returns a false, 0 or NULL value (e.g. "SELECT count(*) > 0 FROM users;")
+			VerifySQL: "",
+		}),
+
+		Mongo: loadMongoConfig("BAK_DB_MONGO", MongoConfig{
+			// If true, a mongodb dump (mongodump --archive, compressed via BAK_DUMP_COMPRESSION) is created before the snapshot
+			Enabled: false,
+
+			// The name to select this database in the engine subcommands (--db) and to identify its dump in logs, metrics and notifications
+			Name: "mongo",
+
+			// The k8s resource to exec into to create the dump
+			ExecResource: "deployment/app-base",
+
+			// The container inside the above resource to exec into to create the dump
+			ExecContainer: "mongo",
+
+			// The file inside the container to store the dump (compressed mongodump archive)
+			// The extension is replaced according to BAK_DUMP_COMPRESSION and BAK_DUMP_ENCRYPTION if unset (e.g. dump.archive.zst.age for zstd and age)
+			DumpFile: "/data/db/dump.archive.gz",
+
+			// The mongodb host to use for connecting/creating/restoring the dump
+			Host: "127.0.0.1",
+
+			// The mongodb port to use for connecting/creating/restoring the dump
+			Port: "27017",
+
+			// The mongodb user to use for connecting/creating the dump, "" disables authentication
+			// Read from inside the *container* by default (${MONGO_INITDB_ROOT_USERNAME})
+			User: "${MONGO_INITDB_ROOT_USERNAME}",
+
+			// The mongodb password to use for connecting/creating the dump
+			// Read from inside the *container* by default (${MONGO_INITDB_ROOT_PASSWORD})
+			Password: "${MONGO_INITDB_ROOT_PASSWORD}",
+
+			// The database the above user is defined in
+			AuthenticationDatabase: "admin",
+
+			// The mongodb database to dump/restore, "" means all databases
+			DB: "",
+
+			// If true, the oplog is included in the dump (--oplog) and replayed on restore (--oplogReplay) to get a point in time
+			// consistent dump of all databases. Requires a replica set member and BAK_DB_MONGO_DB="".
+			Oplog: false,
+
+			Compression: dumpCompression,
+
+			Encryption: dumpEncryption,
+		}),
+
+		Redis: loadRedisConfig("BAK_DB_REDIS", RedisConfig{
+			// If true, redis persists a fresh RDB file (BGSAVE, after BGREWRITEAOF if AOF is enabled) before the snapshot
+			Enabled: false,
+
+			// The name to select this database in the engine subcommands (--db) and to identify its dump in logs, metrics and notifications
+			Name: "redis",
+
+			// The k8s resource to exec into to trigger the save
+			ExecResource: "deployment/app-base",
+
+			// The container inside the above resource to exec into to trigger the save
+			ExecContainer: "redis",
+
+			// The RDB file inside the container written by redis (must match its "dir" and "dbfilename" config), verified after the save
+			DumpFile: "/data/dump.rdb",
+
+			// The redis host to use for connecting
+			Host: "127.0.0.1",
+
+			// The redis port to use for connecting
+			Port: "6379",
+
+			// The redis password to use for connecting, "" disables authentication
+			// Read from inside the *container* by default (${REDIS_PASSWORD})
+			Password: "${REDIS_PASSWORD}",
+
+			// The timeout in seconds to wait for the AOF rewrite and RDB save to finish
+			SaveTimeoutSec: 900,
+		}),
 
 		Flock: FlockConfig{
 			// If true, flock is used to coordinate concurrent backup script execution, e.g. controlling per k8s node backup script concurrency
@@ -198,17 +484,264 @@ func LoadConfig() Config {
 			// The timeout in seconds to wait for the flock lock until we exit 1
 			TimeoutSec: util.GetEnvAsInt("BAK_FLOCK_TIMEOUT_SEC", 3600),
 		},
+
+		Retain: RetainConfig{
+			// The number of newest snapshots per namespace and pvc that keep their "backup-ns.sh/daily" label (controller applyRetentionPolicy)
+			LastDaily: util.GetEnvAsInt("BAK_RETAIN_LAST_DAILY", 7),
+
+			// The number of newest snapshots per namespace and pvc that keep their "backup-ns.sh/weekly" label (controller applyRetentionPolicy)
+			LastWeekly: util.GetEnvAsInt("BAK_RETAIN_LAST_WEEKLY", 4),
+
+			// The number of newest snapshots per namespace and pvc that keep their "backup-ns.sh/monthly" label (controller applyRetentionPolicy)
+			LastMonthly: util.GetEnvAsInt("BAK_RETAIN_LAST_MONTHLY", 12),
+		},
+
+		Sweep: SweepConfig{
+			// The max number of snapshots deleted in a single controller deleteAfterSweep run (0 means unlimited)
+			MaxDeletions: util.GetEnvAsInt("BAK_SWEEP_MAX_DELETIONS", 50),
+		},
+
+		Controller: ControllerConfig{
+			// The interval in which controller run applies the retention policy, marks and sweeps (as go formatted duration spec)
+			PruneInterval: util.GetEnv("BAK_CONTROLLER_PRUNE_INTERVAL", "1h"),
+
+			// The interval in which controller run restarts its VolumeSnapshot watch to resync all vs labels to their vsc (as go formatted duration spec)
+			ResyncInterval: util.GetEnv("BAK_CONTROLLER_RESYNC_INTERVAL", "30m"),
+
+			// If true, controller run only becomes active after acquiring the below Lease (run multiple replicas for high availability)
+			LeaderElection: util.GetEnvAsBool("BAK_CONTROLLER_LEADER_ELECTION", true),
+
+			// The namespace of the coordination.k8s.io Lease used for leader election
+			LeaseNamespace: util.GetEnv("BAK_CONTROLLER_LEASE_NAMESPACE", getCurrentNamespaceWithFallback()),
+
+			// The name of the coordination.k8s.io Lease used for leader election
+			LeaseName: util.GetEnv("BAK_CONTROLLER_LEASE_NAME", "backup-ns-controller"),
+
+			// The unique identity of this leader election participant (defaults to the hostname, which is the pod name)
+			Identity: util.GetEnv("BAK_CONTROLLER_IDENTITY", getHostnameWithFallback()),
+
+			// The interval in which controller run drills a random ready vs per namespace in BAK_CONTROLLER_DRILL_NAMESPACE
+			// (as go formatted duration spec), "" disables the scheduled restore drills
+			DrillInterval: util.GetEnv("BAK_CONTROLLER_DRILL_INTERVAL", ""),
+
+			// The sandbox namespace the controller restores the drilled vs into, it also holds the drill report ConfigMap
+			DrillNamespace: util.GetEnv("BAK_CONTROLLER_DRILL_NAMESPACE", "backup-ns-drill"),
+		},
+
+		Metrics: MetricsConfig{
+			// The address controller run serves the prometheus metrics on (at /metrics), "" disables the endpoint
+			Address: util.GetEnv("BAK_METRICS_ADDRESS", ":9090"),
+
+			// The Pushgateway compatible endpoint one-shot commands (create, dump, controller subcommands) push their metrics to, "" disables pushing
+			PushgatewayURL: util.GetEnv("BAK_METRICS_PUSHGATEWAY_URL", ""),
+
+			// The job name used when pushing metrics to the Pushgateway
+			PushgatewayJob: util.GetEnv("BAK_METRICS_PUSHGATEWAY_JOB", "backup-ns"),
+		},
+
+		Check: CheckConfig{
+			// The max age of the newest ready snapshot per namespace and pvc before backup-ns check fails (as go formatted duration spec)
+			MaxSnapshotAge: util.GetEnv("BAK_CHECK_MAX_SNAPSHOT_AGE", "26h"),
+
+			// The max age of the postgres/mysql/mongo dump files and the redis rdb file before backup-ns check fails (as go formatted duration spec)
+			MaxDumpAge: util.GetEnv("BAK_CHECK_MAX_DUMP_AGE", "26h"),
+		},
+
+		Notify: NotifyConfig{
+			// When to send notifications at the end of create, restore and the controller commands ("failure", "always" or "never")
+			On: util.GetEnvEnum("BAK_NOTIFY_ON", "failure", []string{"failure", "always", "never"}),
+
+			// The timeout for sending all notifications of a single event (as go formatted duration spec)
+			Timeout: util.GetEnv("BAK_NOTIFY_TIMEOUT", "10s"),
+
+			// The generic webhook URL, the notification event is POSTed as JSON, "" disables it
+			WebhookURL: util.GetEnv("BAK_NOTIFY_WEBHOOK_URL", ""),
+
+			// The Slack compatible incoming webhook URL, "" disables it
+			SlackWebhookURL: util.GetEnv("BAK_NOTIFY_SLACK_WEBHOOK_URL", ""),
+
+			SMTP: NotifySMTPConfig{
+				// The SMTP server to send notification mails with (STARTTLS is used if supported), "" disables it
+				Host: util.GetEnv("BAK_NOTIFY_SMTP_HOST", ""),
+
+				// The SMTP server port
+				Port: util.GetEnv("BAK_NOTIFY_SMTP_PORT", "587"),
+
+				// The SMTP user for PLAIN auth, "" disables authentication
+				User: util.GetEnv("BAK_NOTIFY_SMTP_USER", ""),
+
+				// The SMTP password for PLAIN auth
+				Password: util.GetEnv("BAK_NOTIFY_SMTP_PASSWORD", ""),
+
+				// The sender address of notification mails
+				From: util.GetEnv("BAK_NOTIFY_SMTP_FROM", "backup-ns@localhost"),
+
+				// The comma separated recipient addresses of notification mails
+				To: util.GetEnv("BAK_NOTIFY_SMTP_TO", ""),
+			},
+		},
+
+		Verify: VerifyConfig{
+			// The timeout until the ephemeral database of "backup-ns <engine> verify" accepts connections (as go formatted duration spec)
+			ReadyTimeout: util.GetEnv("BAK_VERIFY_READY_TIMEOUT", "10m"),
+
+			// The max lifetime of the verifier pod (activeDeadlineSeconds), it is deleted by k8s even if backup-ns is killed (as go formatted duration spec)
+			MaxDuration: util.GetEnv("BAK_VERIFY_MAX_DURATION", "2h"),
+		},
+
+		Drill: DrillConfig{
+			// The image of the drill pod the restored pvc is mounted into (sh, find, stat and sha256sum are required)
+			Image: util.GetEnv("BAK_DRILL_IMAGE", "busybox:1.37"),
+
+			// The storage class of the temporary pvc ("" uses the default storage class)
+			StorageClass: util.GetEnv("BAK_DRILL_STORAGE_CLASS", ""),
+
+			// The timeout until the restored pvc is mounted in the running drill pod (as go formatted duration spec)
+			Timeout: util.GetEnv("BAK_DRILL_TIMEOUT", "15m"),
+
+			// The max lifetime of the drill pod (activeDeadlineSeconds), it is deleted by k8s even if backup-ns is killed (as go formatted duration spec)
+			MaxDuration: util.GetEnv("BAK_DRILL_MAX_DURATION", "1h"),
+
+			// Comma separated file probes (globs relative to the root of the restored volume, e.g. "uploads/*,postgresql/PG_VERSION"),
+			// each must match at least one non-empty file or directory
+			Probes: slices.DeleteFunc(util.GetEnvAsStringArrTrimmed("BAK_DRILL_PROBES", []string{}), func(s string) bool { return s == "" }),
+		},
+	}
+
+	// Additional databases per engine are configured via indexed ENV vars (e.g. BAK_DB_POSTGRES_1_EXEC_RESOURCE, BAK_DB_POSTGRES_2_...)
+	// Unset indexed ENV vars fall back to the base config of the engine, the instance is enabled by default (BAK_DB_POSTGRES_1=true)
+	// and named "<engine>-<N>" (BAK_DB_POSTGRES_1_NAME), its dump file gets the suffix "_<N>" (e.g. dump_1.sql.gz)
+	config.AdditionalPostgres = loadIndexedConfigs("BAK_DB_POSTGRES", config.Postgres, func(c PostgresConfig, index int) PostgresConfig {
+		c.Enabled, c.Name, c.DumpFile = true, fmt.Sprintf("postgres-%d", index), indexedDumpFile(c.DumpFile, index)
+		return c
+	}, loadPostgresConfig)
+
+	config.AdditionalMySQL = loadIndexedConfigs("BAK_DB_MYSQL", config.MySQL, func(c MySQLConfig, index int) MySQLConfig {
+		c.Enabled, c.Name, c.DumpFile = true, fmt.Sprintf("mysql-%d", index), indexedDumpFile(c.DumpFile, index)
+		return c
+	}, loadMySQLConfig)
+
+	config.AdditionalMongo = loadIndexedConfigs("BAK_DB_MONGO", config.Mongo, func(c MongoConfig, index int) MongoConfig {
+		c.Enabled, c.Name, c.DumpFile = true, fmt.Sprintf("mongo-%d", index), indexedDumpFile(c.DumpFile, index)
+		return c
+	}, loadMongoConfig)
+
+	config.AdditionalRedis = loadIndexedConfigs("BAK_DB_REDIS", config.Redis, func(c RedisConfig, index int) RedisConfig {
+		// the dump file is the rdb file written by the redis server, thus it's not suffixed
+		c.Enabled, c.Name = true, fmt.Sprintf("redis-%d", index)
+		return c
+	}, loadRedisConfig)
+
+	return config
+}
+
+// loadIndexedConfigs loads the configs of all indexed ENV var prefixes "<prefix>_<N>" ordered by N.
+// The defaults of each indexed config are derived from the base config.
+func loadIndexedConfigs[T any](prefix string, base T, defaults func(base T, index int) T, load func(prefix string, defaults T) T) []T {
+	var configs []T
+	for _, index := range util.GetEnvIndices(prefix) {
+		configs = append(configs, load(fmt.Sprintf("%s_%d", prefix, index), defaults(base, index)))
+	}
+	return configs
+}
+
+// loadPostgresConfig loads the postgres config from the ENV vars starting with prefix (e.g. "BAK_DB_POSTGRES" or "BAK_DB_POSTGRES_1"), unset ENV vars fall back to defaults.
+func loadPostgresConfig(prefix string, defaults PostgresConfig) PostgresConfig {
+	dumpFormat := util.GetEnvEnum(prefix+"_DUMP_FORMAT", defaults.DumpFormat, []string{"plain", "custom", "directory"})
+	allDatabases := util.GetEnvAsBool(prefix+"_ALL_DATABASES", defaults.AllDatabases)
+
+	return PostgresConfig{
+		Enabled:       util.GetEnvAsBool(prefix, defaults.Enabled),
+		Name:          util.GetEnv(prefix+"_NAME", defaults.Name),
+		ExecResource:  util.GetEnv(prefix+"_EXEC_RESOURCE", defaults.ExecResource),
+		ExecContainer: util.GetEnv(prefix+"_EXEC_CONTAINER", defaults.ExecContainer),
+		DumpFile:      util.GetEnv(prefix+"_DUMP_FILE", postgresDumpFile(defaults.DumpFile, dumpFormat, allDatabases, defaults.Compression, defaults.Encryption)),
+		DumpFormat:    dumpFormat,
+		Jobs:          util.GetEnvAsInt(prefix+"_JOBS", defaults.Jobs),
+		AllDatabases:  allDatabases,
+		Compression:   defaults.Compression,
+		Encryption:    defaults.Encryption,
+		Host:          util.GetEnv(prefix+"_HOST", defaults.Host),
+		Port:          util.GetEnv(prefix+"_PORT", defaults.Port),
+		User:          util.GetEnv(prefix+"_USER", defaults.User),
+		Password:      util.GetEnv(prefix+"_PASSWORD", defaults.Password),
+		DB:            util.GetEnv(prefix+"_DB", defaults.DB),
+		VerifySQL:     util.GetEnv(prefix+"_VERIFY_SQL", defaults.VerifySQL),
+	}
+}
+
+// loadMySQLConfig loads the mysql config from the ENV vars starting with prefix (e.g. "BAK_DB_MYSQL" or "BAK_DB_MYSQL_1"), unset ENV vars fall back to defaults.
+func loadMySQLConfig(prefix string, defaults MySQLConfig) MySQLConfig {
+	return MySQLConfig{
+		Enabled:             util.GetEnvAsBool(prefix, defaults.Enabled),
+		Name:                util.GetEnv(prefix+"_NAME", defaults.Name),
+		ExecResource:        util.GetEnv(prefix+"_EXEC_RESOURCE", defaults.ExecResource),
+		ExecContainer:       util.GetEnv(prefix+"_EXEC_CONTAINER", defaults.ExecContainer),
+		DumpFile:            util.GetEnv(prefix+"_DUMP_FILE", encryptedDumpFile(compressedDumpFile(unencryptedDumpFile(defaults.DumpFile), defaults.Compression), defaults.Encryption)),
+		Host:                util.GetEnv(prefix+"_HOST", defaults.Host),
+		Port:                util.GetEnv(prefix+"_PORT", defaults.Port),
+		User:                util.GetEnv(prefix+"_USER", defaults.User),
+		Password:            util.GetEnv(prefix+"_PASSWORD", defaults.Password),
+		DB:                  util.GetEnv(prefix+"_DB", defaults.DB),
+		DefaultCharacterSet: util.GetEnv(prefix+"_DEFAULT_CHARACTER_SET", defaults.DefaultCharacterSet),
+		SingleTransaction:   util.GetEnvAsBool(prefix+"_SINGLE_TRANSACTION", defaults.SingleTransaction),
+		AllDatabases:        util.GetEnvAsBool(prefix+"_ALL_DATABASES", defaults.AllDatabases),
+		Compression:         defaults.Compression,
+		Encryption:          defaults.Encryption,
+		VerifySQL:           util.GetEnv(prefix+"_VERIFY_SQL", defaults.VerifySQL),
+	}
+}
+
+// loadMongoConfig loads the mongo config from the ENV vars starting with prefix (e.g. "BAK_DB_MONGO" or "BAK_DB_MONGO_1"), unset ENV vars fall back to defaults.
+func loadMongoConfig(prefix string, defaults MongoConfig) MongoConfig {
+	return MongoConfig{
+		Enabled:                util.GetEnvAsBool(prefix, defaults.Enabled),
+		Name:                   util.GetEnv(prefix+"_NAME", defaults.Name),
+		ExecResource:           util.GetEnv(prefix+"_EXEC_RESOURCE", defaults.ExecResource),
+		ExecContainer:          util.GetEnv(prefix+"_EXEC_CONTAINER", defaults.ExecContainer),
+		DumpFile:               util.GetEnv(prefix+"_DUMP_FILE", encryptedDumpFile(compressedDumpFile(unencryptedDumpFile(defaults.DumpFile), defaults.Compression), defaults.Encryption)),
+		Host:                   util.GetEnv(prefix+"_HOST", defaults.Host),
+		Port:                   util.GetEnv(prefix+"_PORT", defaults.Port),
+		User:                   util.GetEnv(prefix+"_USER", defaults.User),
+		Password:               util.GetEnv(prefix+"_PASSWORD", defaults.Password),
+		AuthenticationDatabase: util.GetEnv(prefix+"_AUTHENTICATION_DATABASE", defaults.AuthenticationDatabase),
+		DB:                     util.GetEnv(prefix+"_DB", defaults.DB),
+		Oplog:                  util.GetEnvAsBool(prefix+"_OPLOG", defaults.Oplog),
+		Compression:            defaults.Compression,
+		Encryption:             defaults.Encryption,
+	}
+}
+
+// loadRedisConfig loads the redis config from the ENV vars starting with prefix (e.g. "BAK_DB_REDIS" or "BAK_DB_REDIS_1"), unset ENV vars fall back to defaults.
+func loadRedisConfig(prefix string, defaults RedisConfig) RedisConfig {
+	return RedisConfig{
+		Enabled:        util.GetEnvAsBool(prefix, defaults.Enabled),
+		Name:           util.GetEnv(prefix+"_NAME", defaults.Name),
+		ExecResource:   util.GetEnv(prefix+"_EXEC_RESOURCE", defaults.ExecResource),
+		ExecContainer:  util.GetEnv(prefix+"_EXEC_CONTAINER", defaults.ExecContainer),
+		DumpFile:       util.GetEnv(prefix+"_DUMP_FILE", defaults.DumpFile),
+		Host:           util.GetEnv(prefix+"_HOST", defaults.Host),
+		Port:           util.GetEnv(prefix+"_PORT", defaults.Port),
+		Password:       util.GetEnv(prefix+"_PASSWORD", defaults.Password),
+		SaveTimeoutSec: util.GetEnvAsInt(prefix+"_SAVE_TIMEOUT_SEC", defaults.SaveTimeoutSec),
 	}
 }
 
 func getCurrentNamespaceWithFallback() string {
-	cmd := exec.Command("kubectl", "config", "view", "--minify", "--output", "jsonpath={..namespace}")
-	output, err := cmd.Output()
-	if err != nil {
+	namespace, err := k8s.CurrentNamespace()
+	if err != nil || namespace == "" {
 		// log.Printf("Error getting current namespace: %v", err)
 		return "default"
 	}
-	return string(output)
+	return namespace
+}
+
+func getHostnameWithFallback() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "backup-ns-" + GenerateRandomStringOrPanic(6)
+	}
+	return hostname
 }
 
 func GenerateRandomStringOrPanic(n int) string {
@@ -221,13 +754,13 @@ func GenerateRandomStringOrPanic(n int) string {
 	return randString
 }
 
-// GetBAKEnvVars returns all environment variables starting with "BAK_", excluding secrets
+// GetBAKEnvVars returns all environment variables starting with "BAK_", excluding secrets (passwords and webhook URLs)
 func GetBAKEnvVars() map[string]string {
 	envVars := make(map[string]string)
 	for _, env := range os.Environ() {
 		if parts := strings.SplitN(env, "=", 2); len(parts) == 2 {
 			key, value := parts[0], parts[1]
-			if strings.HasPrefix(key, "BAK_") && !strings.Contains(key, "PASSWORD") {
+			if strings.HasPrefix(key, "BAK_") && !strings.Contains(key, "PASSWORD") && !strings.HasSuffix(key, "WEBHOOK_URL") {
 				envVars[key] = value
 			}
 		}
@@ -239,7 +772,7 @@ func GetBAKEnvVars() map[string]string {
 func PrintTimeZone() {
 	t := time.Now()
 	zone, _ := t.Zone()
-	log.Println("TimeZone:", zone, "Now:", t.Format(time.DateOnly), t.Format(time.TimeOnly))
+	slog.Info("Current time", "timezone", zone, "date", t.Format(time.DateOnly), "time", t.Format(time.TimeOnly))
 }
 
 func PrintConfig(config Config) {
@@ -249,5 +782,5 @@ func PrintConfig(config Config) {
 		log.Panic("Failed to PrintConfig")
 	}
 
-	log.Println("Config:", string(c))
+	slog.Info("Config", "config", json.RawMessage(c))
 }
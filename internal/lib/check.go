@@ -0,0 +1,208 @@
+package lib
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// BackupCheckResult is the freshness check result of a single namespace and "backup-ns.sh/pvc".
+type BackupCheckResult struct {
+	Namespace             string            `json:"namespace"`
+	PVCName               string            `json:"pvcName"`
+	NewestSnapshot        string            `json:"newestSnapshot"`
+	NewestSnapshotCreated *time.Time        `json:"newestSnapshotCreated"`
+	Dumps                 []DumpCheckResult `json:"dumps,omitempty"`
+	ChainGaps             []string          `json:"chainGaps,omitempty"`
+	Problems              []string          `json:"problems,omitempty"`
+}
+
+// DumpCheckResult is the freshness check result of a single database dump file.
+type DumpCheckResult struct {
+	Engine   string     `json:"engine"`
+	Name     string     `json:"name"`
+	DumpFile string     `json:"dumpFile"`
+	Modified *time.Time `json:"modified"`
+}
+
+// OK is true if no problems were found.
+func (r BackupCheckResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *BackupCheckResult) addProblem(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// CheckVolumeSnapshots groups the vss by namespace and "backup-ns.sh/pvc" label and checks per group that
+// * the newest ready VolumeSnapshot is not older than maxSnapshotAge and
+// * the daily, weekly and monthly labels of the "daily_weekly_monthly" retained snapshots have no gaps, i.e. every
+// day, week and month between the newest labeled one and the BAK_RETAIN_LAST_* oldest expected one has a labeled snapshot.
+// The expectedPVCs are always checked (thus fail if there are no snapshots at all), the results are sorted by namespace and pvc.
+func CheckVolumeSnapshots(vss []VolumeSnapshotInfo, expectedPVCs []NamespacedK8sObject, now time.Time, maxSnapshotAge time.Duration, retain RetainConfig) []BackupCheckResult {
+	type group struct {
+		namespace string
+		pvcName   string
+	}
+
+	groups := make(map[group][]VolumeSnapshotInfo)
+	for _, pvc := range expectedPVCs {
+		groups[group{namespace: pvc.Namespace, pvcName: pvc.Name}] = nil
+	}
+	for _, vs := range vss {
+		pvcName, ok := vs.Labels["backup-ns.sh/pvc"]
+		if !ok {
+			continue
+		}
+		g := group{namespace: vs.Namespace, pvcName: pvcName}
+		groups[g] = append(groups[g], vs)
+	}
+
+	results := make([]BackupCheckResult, 0, len(groups))
+
+	for g, groupVSS := range groups {
+		result := BackupCheckResult{Namespace: g.namespace, PVCName: g.pvcName}
+
+		var newest *VolumeSnapshotInfo
+		for i, vs := range groupVSS {
+			if vs.ReadyToUse && (newest == nil || vs.CreationTime.After(newest.CreationTime)) {
+				newest = &groupVSS[i]
+			}
+		}
+
+		if newest == nil {
+			result.addProblem("no ready VolumeSnapshot")
+		} else {
+			result.NewestSnapshot = newest.Name
+			result.NewestSnapshotCreated = &newest.CreationTime
+
+			if age := now.Sub(newest.CreationTime); age > maxSnapshotAge {
+				result.addProblem("newest ready VolumeSnapshot is %s old (max %s)", age.Round(time.Minute), maxSnapshotAge)
+			}
+		}
+
+		result.ChainGaps = checkRetentionChain(groupVSS, retain)
+		if len(result.ChainGaps) > 0 {
+			result.addProblem("%d gaps in the retention label chain", len(result.ChainGaps))
+		}
+
+		results = append(results, result)
+	}
+
+	slices.SortFunc(results, func(a, b BackupCheckResult) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.PVCName, b.PVCName))
+	})
+
+	return results
+}
+
+type retentionPeriod struct {
+	labelKey string
+	start    func(t time.Time) time.Time
+	prev     func(t time.Time) time.Time
+	format   func(t time.Time) string
+}
+
+var retentionPeriods = []retentionPeriod{
+	{
+		labelKey: LabelDaily,
+		start: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		},
+		prev:   func(t time.Time) time.Time { return t.AddDate(0, 0, -1) },
+		format: func(t time.Time) string { return t.Format(time.DateOnly) },
+	},
+	{
+		labelKey: LabelWeekly,
+		start: func(t time.Time) time.Time {
+			// ISO weeks start on monday
+			offset := (int(t.Weekday()) + 6) % 7
+			return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, time.Local)
+		},
+		prev: func(t time.Time) time.Time { return t.AddDate(0, 0, -7) },
+		format: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-w%02d", year, week)
+		},
+	},
+	{
+		labelKey: LabelMonthly,
+		start: func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+		},
+		prev:   func(t time.Time) time.Time { return t.AddDate(0, -1, 0) },
+		format: func(t time.Time) string { return t.Format("2006-01") },
+	},
+}
+
+// checkRetentionChain returns the missing days, weeks and months (e.g. "backup-ns.sh/daily=2025-01-02") of the
+// "daily_weekly_monthly" retained vss of a single pvc. The periods are derived from the (local) CreationTime of the
+// labeled snapshots, as the weekly label value has no year.
+// Only periods between the oldest and newest labeled snapshot are checked (so the chain may still be building up)
+// and at most the BAK_RETAIN_LAST_* newest periods (older labels are removed by the retention policy).
+func checkRetentionChain(vss []VolumeSnapshotInfo, retain RetainConfig) []string {
+	counts := map[string]int{
+		LabelDaily:   retain.LastDaily,
+		LabelWeekly:  retain.LastWeekly,
+		LabelMonthly: retain.LastMonthly,
+	}
+
+	var gaps []string
+
+	for _, p := range retentionPeriods {
+		present := make(map[time.Time]struct{})
+		var oldest, newest time.Time
+
+		for _, vs := range vss {
+			if vs.Labels[LabelRetain] != "daily_weekly_monthly" {
+				continue
+			}
+			if _, ok := vs.Labels[p.labelKey]; !ok {
+				continue
+			}
+
+			start := p.start(vs.CreationTime.In(time.Local))
+			present[start] = struct{}{}
+
+			if oldest.IsZero() || start.Before(oldest) {
+				oldest = start
+			}
+			if newest.IsZero() || start.After(newest) {
+				newest = start
+			}
+		}
+
+		if len(present) == 0 {
+			continue
+		}
+
+		period := newest
+		for i := 0; i < counts[p.labelKey] && !period.Before(oldest); i++ {
+			if _, ok := present[period]; !ok {
+				gaps = append(gaps, fmt.Sprintf("%s=%s", p.labelKey, p.format(period)))
+			}
+			period = p.start(p.prev(period))
+		}
+	}
+
+	return gaps
+}
+
+// CheckDumpFile checks that the dump file inside the container was modified within maxDumpAge.
+func (r *BackupCheckResult) CheckDumpFile(engine, name, execResource, execContainer, dumpFile string, now time.Time, maxDumpAge time.Duration) {
+	dump := DumpCheckResult{Engine: engine, Name: name, DumpFile: dumpFile}
+	defer func() { r.Dumps = append(r.Dumps, dump) }()
+
+	modified, err := GetRemoteFileTimestamp(r.Namespace, execResource, execContainer, dumpFile)
+	if err != nil {
+		r.addProblem("%s dump '%s' unavailable: %v", name, dumpFile, err)
+		return
+	}
+
+	dump.Modified = &modified
+
+	if age := now.Sub(modified); age > maxDumpAge {
+		r.addProblem("%s dump '%s' is %s old (max %s)", name, dumpFile, age.Round(time.Minute), maxDumpAge)
+	}
+}
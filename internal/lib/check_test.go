@@ -0,0 +1,67 @@
+package lib_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckVolumeSnapshots(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 1, d, 0, 17, 0, 0, time.Local)
+	}
+	labels := func(daily, weekly, monthly bool) map[string]string {
+		l := map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "daily_weekly_monthly"}
+		if daily {
+			l["backup-ns.sh/daily"] = "x"
+		}
+		if weekly {
+			l["backup-ns.sh/weekly"] = "x"
+		}
+		if monthly {
+			l["backup-ns.sh/monthly"] = "x"
+		}
+		return l
+	}
+
+	vss := []lib.VolumeSnapshotInfo{
+		// ns-a: complete chain, 2025-01-06 is the first day of ISO week 2
+		{Namespace: "ns-a", Name: "data-1", CreationTime: day(1), ReadyToUse: true, Labels: labels(true, true, true)},
+		{Namespace: "ns-a", Name: "data-2", CreationTime: day(2), ReadyToUse: true, Labels: labels(true, false, false)},
+		{Namespace: "ns-a", Name: "data-3", CreationTime: day(3), ReadyToUse: true, Labels: labels(true, false, false)},
+		{Namespace: "ns-a", Name: "data-4", CreationTime: day(4), ReadyToUse: true, Labels: labels(true, false, false)},
+		{Namespace: "ns-a", Name: "data-5", CreationTime: day(5), ReadyToUse: true, Labels: labels(true, false, false)},
+		{Namespace: "ns-a", Name: "data-6", CreationTime: day(6), ReadyToUse: true, Labels: labels(true, true, false)},
+		// ns-b: missing daily snapshot on 2025-01-05 and the newest one is not yet ready (thus too old)
+		{Namespace: "ns-b", Name: "data-3", CreationTime: day(3), ReadyToUse: true, Labels: labels(true, true, true)},
+		{Namespace: "ns-b", Name: "data-4", CreationTime: day(4), ReadyToUse: true, Labels: labels(true, false, false)},
+		{Namespace: "ns-b", Name: "data-6", CreationTime: day(6), ReadyToUse: false, Labels: labels(true, true, false)},
+		// no pvc label, ignored
+		{Namespace: "ns-b", Name: "unknown", CreationTime: day(6), ReadyToUse: true},
+	}
+
+	now := day(6).Add(2 * time.Hour)
+
+	results := lib.CheckVolumeSnapshots(vss, []lib.NamespacedK8sObject{{Namespace: "ns-c", Name: "data"}}, now, 26*time.Hour, lib.RetainConfig{LastDaily: 7, LastWeekly: 4, LastMonthly: 12})
+	require.Len(t, results, 3)
+
+	require.Equal(t, "ns-a", results[0].Namespace)
+	require.Equal(t, "data-6", results[0].NewestSnapshot)
+	require.Empty(t, results[0].ChainGaps)
+	require.True(t, results[0].OK(), results[0].Problems)
+
+	require.Equal(t, "ns-b", results[1].Namespace)
+	require.Equal(t, "data-4", results[1].NewestSnapshot)
+	require.Equal(t, []string{"backup-ns.sh/daily=2025-01-05"}, results[1].ChainGaps)
+	require.Equal(t, []string{"newest ready VolumeSnapshot is 50h0m0s old (max 26h0m0s)", "1 gaps in the retention label chain"}, results[1].Problems)
+
+	// expected, but no snapshots at all
+	require.Equal(t, lib.BackupCheckResult{Namespace: "ns-c", PVCName: "data", Problems: []string{"no ready VolumeSnapshot"}}, results[2])
+
+	// only the newest BAK_RETAIN_LAST_DAILY days are checked
+	results = lib.CheckVolumeSnapshots(vss, nil, now, 26*time.Hour, lib.RetainConfig{LastDaily: 1, LastWeekly: 4, LastMonthly: 12})
+	require.Len(t, results, 2)
+	require.Empty(t, results[1].ChainGaps)
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompressionConfig is the compression of the dump files (BAK_DUMP_COMPRESSION), shared by all engines.
+type CompressionConfig struct {
+	Algorithm string `json:"BAK_DUMP_COMPRESSION"`
+	Level     int    `json:"BAK_DUMP_COMPRESSION_LEVEL"`
+	Threads   int    `json:"BAK_DUMP_COMPRESSION_THREADS"`
+}
+
+// algorithm defaults to gzip (e.g. for configs not loaded via LoadConfig).
+func (c CompressionConfig) algorithm() string {
+	if c.Algorithm == "" {
+		return "gzip"
+	}
+	return c.Algorithm
+}
+
+// Binary is the cli required to compress ("" for none).
+func (c CompressionConfig) Binary() string {
+	if c.algorithm() == "none" {
+		return ""
+	}
+	return c.algorithm()
+}
+
+// Extension is the file extension of compressed files (e.g. ".zst", "" for none).
+func (c CompressionConfig) Extension() string {
+	switch c.algorithm() {
+	case "zstd":
+		return ".zst"
+	case "none":
+		return ""
+	}
+	return ".gz"
+}
+
+// Command compresses stdin to stdout.
+func (c CompressionConfig) Command() string {
+	var args []string
+
+	switch c.algorithm() {
+	case "none":
+		return "cat"
+	case "pigz":
+		args = []string{"pigz", "-c"}
+		if c.Threads > 0 {
+			args = append(args, fmt.Sprintf("-p %d", c.Threads))
+		}
+	case "zstd":
+		args = []string{"zstd", "-c", "-q"}
+		if c.Threads > 0 {
+			args = append(args, fmt.Sprintf("-T%d", c.Threads))
+		}
+	default:
+		args = []string{"gzip", "-c"}
+	}
+
+	if c.Level > 0 {
+		args = append(args, fmt.Sprintf("-%d", c.Level))
+	}
+
+	return strings.Join(args, " ")
+}
+
+// DecompressCommand decompresses the file to stdout (used in hints for downloaded dumps, the templates detect the
+// compression of the dump file instead).
+func (c CompressionConfig) DecompressCommand(file string) string {
+	switch c.algorithm() {
+	case "zstd":
+		return fmt.Sprintf("zstd -dc %s", file)
+	case "none":
+		return fmt.Sprintf("cat %s", file)
+	}
+	return fmt.Sprintf("gzip -dc %s", file)
+}
+
+// compressedDumpFile replaces the compression extension (".gz" or ".zst") of the dump file with the one of the compression
+// (e.g. "/data/dump.sql.gz" becomes "/data/dump.sql.zst" for zstd and "/data/dump.sql" for none), other files are kept.
+func compressedDumpFile(dumpFile string, compression CompressionConfig) string {
+	for _, ext := range []string{".gz", ".zst"} {
+		if name, ok := strings.CutSuffix(dumpFile, ext); ok {
+			return name + compression.Extension()
+		}
+	}
+	return dumpFile
+}
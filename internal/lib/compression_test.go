@@ -0,0 +1,57 @@
+package lib_test
+
+import (
+	"testing"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionConfig(t *testing.T) {
+	// zero value (configs not loaded via LoadConfig) is gzip
+	require.Equal(t, "gzip -c", lib.CompressionConfig{}.Command())
+	require.Equal(t, ".gz", lib.CompressionConfig{}.Extension())
+
+	require.Equal(t, "gzip -c -9", lib.CompressionConfig{Algorithm: "gzip", Level: 9, Threads: 4}.Command())
+	require.Equal(t, "pigz -c -p 4 -6", lib.CompressionConfig{Algorithm: "pigz", Level: 6, Threads: 4}.Command())
+	require.Equal(t, ".gz", lib.CompressionConfig{Algorithm: "pigz"}.Extension())
+
+	zstd := lib.CompressionConfig{Algorithm: "zstd", Level: 19, Threads: 2}
+	require.Equal(t, "zstd -c -q -T2 -19", zstd.Command())
+	require.Equal(t, ".zst", zstd.Extension())
+	require.Equal(t, "zstd", zstd.Binary())
+	require.Equal(t, "zstd -dc dump.sql.zst", zstd.DecompressCommand("dump.sql.zst"))
+
+	none := lib.CompressionConfig{Algorithm: "none"}
+	require.Equal(t, "cat", none.Command())
+	require.Empty(t, none.Extension())
+	require.Empty(t, none.Binary())
+}
+
+func TestLoadConfigDumpCompression(t *testing.T) {
+	t.Setenv("BAK_DUMP_COMPRESSION", "zstd")
+	t.Setenv("BAK_DUMP_COMPRESSION_THREADS", "4")
+	t.Setenv("BAK_DB_MYSQL_1_NAME", "legacy")
+	t.Setenv("BAK_DB_MONGO_DUMP_FILE", "/data/db/mongo.archive")
+
+	config := lib.LoadConfig()
+	require.Equal(t, lib.CompressionConfig{Algorithm: "zstd", Threads: 4}, config.DumpCompression)
+
+	require.Equal(t, "/var/lib/postgresql/data/dump.sql.zst", config.Postgres.DumpFile)
+	require.Equal(t, "/var/lib/mysql/dump.sql.zst", config.MySQL.DumpFile)
+	require.Equal(t, "/var/lib/mysql/dump_1.sql.zst", config.AdditionalMySQL[0].DumpFile)
+	require.Equal(t, config.DumpCompression, config.AdditionalMySQL[0].Compression)
+	require.Equal(t, "/data/db/mongo.archive", config.Mongo.DumpFile)
+
+	engine, err := lib.GetEngine(config, "mysql")
+	require.NoError(t, err)
+	formatter, ok := engine.(lib.DumpFormatter)
+	require.True(t, ok)
+	require.Equal(t, ".sql.zst", formatter.DumpFileSuffix())
+
+	t.Setenv("BAK_DUMP_COMPRESSION", "none")
+
+	config = lib.LoadConfig()
+	require.Equal(t, "/var/lib/postgresql/data/dump.sql", config.Postgres.DumpFile)
+	require.Equal(t, "/var/lib/mysql/dump_1.sql", config.AdditionalMySQL[0].DumpFile)
+}
@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// The backoff before restarting a failed VolumeSnapshot watch.
+var watchRetryBackoff = 5 * time.Second
+
+// VolumeSnapshotEventHandler is called for every VolumeSnapshot event, deleted is true if the vs no longer exists.
+type VolumeSnapshotEventHandler func(vs VolumeSnapshotInfo, deleted bool)
+
+// WatchVolumeSnapshots watches all VolumeSnapshots (across all namespaces) matching the labelSelector and calls
+// handler for every event. Each (re)started watch first delivers all existing VolumeSnapshots, the watch is restarted
+// every resyncInterval (0 disables the periodic resync) and after failures.
+// Blocks until ctx is done.
+func WatchVolumeSnapshots(ctx context.Context, labelSelector string, resyncInterval time.Duration, handler VolumeSnapshotEventHandler) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	for {
+		err := watchVolumeSnapshotsOnce(ctx, client.WatchVolumeSnapshots, labelSelector, resyncInterval, handler)
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		backoff := time.Duration(0)
+		if err != nil {
+			slog.Warn("VolumeSnapshot watch failed, restarting", "backoff", watchRetryBackoff, "error", err)
+			backoff = watchRetryBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+	}
+}
+
+type watchFunc func(ctx context.Context, namespace, labelSelector string) (watch.Interface, error)
+
+func watchVolumeSnapshotsOnce(ctx context.Context, watchFn watchFunc, labelSelector string, resyncInterval time.Duration, handler VolumeSnapshotEventHandler) error {
+	watchCtx := ctx
+	if resyncInterval > 0 {
+		var cancel context.CancelFunc
+		watchCtx, cancel = context.WithTimeout(ctx, resyncInterval)
+		defer cancel()
+	}
+
+	w, err := watchFn(watchCtx, "", labelSelector)
+	if err != nil {
+		return err
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-watchCtx.Done():
+			return nil // resync
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return nil // closed by the api server, restart
+			}
+
+			switch event.Type {
+			case watch.Added, watch.Modified, watch.Deleted:
+				vs, ok := event.Object.(*unstructured.Unstructured)
+				if !ok {
+					return fmt.Errorf("unexpected object type %T in VolumeSnapshot watch", event.Object)
+				}
+				handler(volumeSnapshotInfoFromUnstructured(*vs), event.Type == watch.Deleted)
+			case watch.Error:
+				return errors.New("received error event")
+			case watch.Bookmark:
+				// noop
+			}
+		}
+	}
+}
+
+// SyncVSLabelsToVscIfChanged syncs the "backup-ns.sh/" labels of the VolumeSnapshot to its bound VolumeSnapshotContent
+// (see SyncVSLabelsToVsc) if they differ. Returns true if a sync was necessary.
+func SyncVSLabelsToVscIfChanged(vs VolumeSnapshotInfo, dryRun bool) (bool, error) {
+	if vs.ContentName == "" {
+		return false, nil // not yet bound
+	}
+
+	vscLabels, err := GetBackupNsLabelMap(vs.Namespace, "volumesnapshotcontent", vs.ContentName)
+	if err != nil {
+		return false, err
+	}
+
+	vsLabels := make(map[string]string)
+	for k, v := range vs.Labels {
+		if strings.HasPrefix(k, "backup-ns.sh/") {
+			vsLabels[k] = v
+		}
+	}
+
+	if maps.Equal(vsLabels, vscLabels) {
+		return false, nil
+	}
+
+	if dryRun {
+		slog.Info("Skipping vsc label sync - dry run mode is active", "namespace", vs.Namespace, "vs_name", vs.Name)
+		return true, nil
+	}
+
+	return true, SyncVSLabelsToVsc(vs.Namespace, vs.Name)
+}
@@ -0,0 +1,62 @@
+package lib_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchSyncsVSLabelsToVsc(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC)
+	newTestCluster(t, &now)
+
+	vsName := createVS(t, now, lib.LabelVSConfig{Type: "cronjob", Retain: "daily_weekly_monthly"})
+	vscName, err := lib.GetVolumeSnapshotContentName(testNamespace, vsName)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var events, synced atomic.Int32
+	done := make(chan error)
+
+	go func() {
+		done <- lib.WatchVolumeSnapshots(ctx, "backup-ns.sh/type", 0, func(vs lib.VolumeSnapshotInfo, deleted bool) {
+			events.Add(1)
+			if deleted {
+				return
+			}
+			ok, err := lib.SyncVSLabelsToVscIfChanged(vs, false)
+			require.NoError(t, err)
+			if ok {
+				synced.Add(1)
+			}
+		})
+	}()
+
+	// the initial ADDED event for the already synced vs is a noop
+	require.Eventually(t, func() bool { return events.Load() == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(0), synced.Load())
+
+	require.NoError(t, lib.RemoveVolumeSnapshotLabel(testNamespace, vsName, lib.LabelDaily))
+	require.NoError(t, lib.MarkVolumeSnapshotDeleteAfter(testNamespace, vsName, "2025-01-01"))
+
+	require.Eventually(t, func() bool {
+		vscLabels, err := lib.GetBackupNsLabelMap(testNamespace, "volumesnapshotcontent", vscName)
+		require.NoError(t, err)
+		_, hasDaily := vscLabels[lib.LabelDaily]
+		return !hasDaily && vscLabels[lib.LabelDeleteAfter] == "2025-01-01"
+	}, time.Second, 10*time.Millisecond)
+	// both changes might be synced at once
+	require.GreaterOrEqual(t, synced.Load(), int32(1))
+
+	require.NoError(t, lib.PruneVolumeSnapshot(testNamespace, vsName, true))
+	require.Eventually(t, func() bool { return events.Load() == 4 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
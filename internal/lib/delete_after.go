@@ -0,0 +1,255 @@
+package lib
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+const (
+	LabelRetain      = "backup-ns.sh/retain"
+	LabelDeleteAfter = "backup-ns.sh/delete-after"
+)
+
+// DeleteAfterMark is a single planned "backup-ns.sh/delete-after" label addition to a VolumeSnapshot.
+type DeleteAfterMark struct {
+	Namespace    string    `json:"namespace"`
+	VSName       string    `json:"vsName"`
+	PVCName      string    `json:"pvcName"`
+	CreationTime time.Time `json:"creationTime"`
+	DeleteAfter  string    `json:"deleteAfter"`
+}
+
+// PlanDeleteAfterMark returns all "backup-ns.sh/retain=daily_weekly_monthly" snapshots that no longer have any
+// daily, weekly or monthly retention label and are not yet marked with a "backup-ns.sh/delete-after" label.
+// These snapshots are planned to be marked with delete-after today, thus they will be swept tomorrow.
+func PlanDeleteAfterMark(vss []VolumeSnapshotInfo, now time.Time) []DeleteAfterMark {
+	deleteAfter := now.Format(time.DateOnly)
+
+	var marks []DeleteAfterMark
+
+	for _, vs := range vss {
+		if vs.Labels[LabelRetain] != "daily_weekly_monthly" {
+			continue
+		}
+
+		if hasAnyLabel(vs.Labels, LabelDaily, LabelWeekly, LabelMonthly, LabelDeleteAfter) {
+			continue
+		}
+
+		marks = append(marks, DeleteAfterMark{
+			Namespace:    vs.Namespace,
+			VSName:       vs.Name,
+			PVCName:      vs.Labels["backup-ns.sh/pvc"],
+			CreationTime: vs.CreationTime,
+			DeleteAfter:  deleteAfter,
+		})
+	}
+
+	return marks
+}
+
+func hasAnyLabel(labels map[string]string, keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := labels[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkVolumeSnapshotDeleteAfter labels the VolumeSnapshot with "backup-ns.sh/delete-after".
+// An already existing delete-after label is never overwritten.
+func MarkVolumeSnapshotDeleteAfter(namespace, vsName, deleteAfter string) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	vs, err := client.GetVolumeSnapshot(ctx, namespace, vsName)
+	if err != nil {
+		return fmt.Errorf("failed to get VolumeSnapshot '%s' in namespace '%s': %w", vsName, namespace, err)
+	}
+
+	if existing, ok := vs.GetLabels()[LabelDeleteAfter]; ok {
+		return fmt.Errorf("VolumeSnapshot '%s' in namespace '%s' already has label '%s=%s', refusing to overwrite", vsName, namespace, LabelDeleteAfter, existing)
+	}
+
+	patch, err := labelPatch(nil, map[string]string{LabelDeleteAfter: deleteAfter})
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.PatchVolumeSnapshot(ctx, namespace, vsName, patch); err != nil {
+		return fmt.Errorf("failed to label VolumeSnapshot '%s' in namespace '%s' with '%s=%s': %w", vsName, namespace, LabelDeleteAfter, deleteAfter, err)
+	}
+	slog.Info("Successfully labeled vs", "namespace", namespace, "vs_name", vsName, "label", LabelDeleteAfter, "value", deleteAfter)
+	return nil
+}
+
+// Reasons why a delete-after labeled VolumeSnapshot is not deleted by the sweep.
+const (
+	SweepSkipLastReady    = "last ready snapshot of pvc"
+	SweepSkipMaxDeletions = "max deletions per run reached"
+	SweepSkipGroupMember  = "other member of group not swept"
+)
+
+// SweepCandidate is a VolumeSnapshot whose "backup-ns.sh/delete-after" date lies before today.
+// If Skip is set, the sweep refuses to delete it (see SweepSkip* for reasons).
+// Members of a VolumeGroupSnapshot (Group is set) are deleted by deleting their group.
+type SweepCandidate struct {
+	Namespace    string    `json:"namespace"`
+	VSName       string    `json:"vsName"`
+	PVCName      string    `json:"pvcName"`
+	Group        string    `json:"group,omitempty"`
+	CreationTime time.Time `json:"creationTime"`
+	ReadyToUse   bool      `json:"readyToUse"`
+	DeleteAfter  string    `json:"deleteAfter"`
+	Skip         string    `json:"skip,omitempty"`
+}
+
+// PlanDeleteAfterSweep returns all "backup-ns.sh/retain" snapshots with a "backup-ns.sh/delete-after" label before
+// today (oldest first). vss must contain all managed snapshots (not only the labeled ones) as we refuse to delete the
+// last remaining ready snapshot of a pvc. At most maxDeletions candidates are planned for deletion (0 means unlimited).
+// The members of a VolumeGroupSnapshot ("backup-ns.sh/group" label) are planned as a unit: they are only deleted if all
+// of them are due and none is skipped, the group counts as a single deletion.
+func PlanDeleteAfterSweep(vss []VolumeSnapshotInfo, now time.Time, maxDeletions int) []SweepCandidate {
+	today := now.Format(time.DateOnly)
+
+	type group struct {
+		namespace string
+		pvcName   string
+	}
+
+	type vsGroup struct {
+		namespace string
+		name      string
+	}
+
+	readyCount := make(map[group]int)
+	groupSize := make(map[vsGroup]int)
+	var candidates []SweepCandidate
+
+	for _, vs := range vss {
+		g := group{namespace: vs.Namespace, pvcName: vs.Labels["backup-ns.sh/pvc"]}
+
+		if vs.ReadyToUse {
+			readyCount[g]++
+		}
+
+		if name := vs.Labels[LabelGroup]; name != "" {
+			groupSize[vsGroup{namespace: vs.Namespace, name: name}]++
+		}
+
+		if _, ok := vs.Labels[LabelRetain]; !ok {
+			continue
+		}
+
+		// YYYY-MM-DD formatted dates may be compared lexicographically
+		deleteAfter, ok := vs.Labels[LabelDeleteAfter]
+		if !ok || deleteAfter >= today {
+			continue
+		}
+
+		candidates = append(candidates, SweepCandidate{
+			Namespace:    vs.Namespace,
+			VSName:       vs.Name,
+			PVCName:      g.pvcName,
+			Group:        vs.Labels[LabelGroup],
+			CreationTime: vs.CreationTime,
+			ReadyToUse:   vs.ReadyToUse,
+			DeleteAfter:  deleteAfter,
+		})
+	}
+
+	slices.SortFunc(candidates, func(a, b SweepCandidate) int {
+		return cmp.Or(
+			cmp.Compare(a.DeleteAfter, b.DeleteAfter),
+			a.CreationTime.Compare(b.CreationTime),
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.VSName, b.VSName),
+		)
+	})
+
+	groupMembers := make(map[vsGroup][]int)
+	for i, c := range candidates {
+		if c.Group != "" {
+			k := vsGroup{namespace: c.Namespace, name: c.Group}
+			groupMembers[k] = append(groupMembers[k], i)
+		}
+	}
+
+	deletions := 0
+
+	for i := range candidates {
+		c := &candidates[i]
+		g := group{namespace: c.Namespace, pvcName: c.PVCName}
+
+		if c.Group != "" {
+			k := vsGroup{namespace: c.Namespace, name: c.Group}
+			members, ok := groupMembers[k]
+			if !ok {
+				// already planned with its first member
+				continue
+			}
+			delete(groupMembers, k)
+
+			// the group must not hold the last ready snapshot of any of its pvcs
+			readyMembers := make(map[group]int)
+			for _, j := range members {
+				if candidates[j].ReadyToUse {
+					readyMembers[group{namespace: c.Namespace, pvcName: candidates[j].PVCName}]++
+				}
+			}
+
+			skip := ""
+			if len(members) < groupSize[k] {
+				skip = SweepSkipGroupMember
+			} else {
+				for pg, count := range readyMembers {
+					if readyCount[pg]-count < 1 {
+						skip = SweepSkipLastReady
+					}
+				}
+			}
+			if skip == "" && maxDeletions > 0 && deletions >= maxDeletions {
+				skip = SweepSkipMaxDeletions
+			}
+
+			if skip != "" {
+				for _, j := range members {
+					candidates[j].Skip = skip
+				}
+				continue
+			}
+
+			for pg, count := range readyMembers {
+				readyCount[pg] -= count
+			}
+			deletions++
+			continue
+		}
+
+		if c.ReadyToUse && readyCount[g] <= 1 {
+			c.Skip = SweepSkipLastReady
+			continue
+		}
+
+		if maxDeletions > 0 && deletions >= maxDeletions {
+			c.Skip = SweepSkipMaxDeletions
+			continue
+		}
+
+		if c.ReadyToUse {
+			readyCount[g]--
+		}
+		deletions++
+	}
+
+	return candidates
+}
@@ -0,0 +1,116 @@
+package lib_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanDeleteAfterMark(t *testing.T) {
+	now := time.Date(2025, 1, 9, 11, 36, 0, 0, time.UTC)
+	created := time.Date(2025, 1, 2, 0, 17, 0, 0, time.UTC)
+
+	vss := []lib.VolumeSnapshotInfo{
+		// lost all retention labels -> mark
+		{Namespace: "ns-a", Name: "data-1", CreationTime: created, Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "daily_weekly_monthly"}},
+		// still retained
+		{Namespace: "ns-a", Name: "data-2", CreationTime: created, Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "daily_weekly_monthly", "backup-ns.sh/daily": "2025-01-02"}},
+		{Namespace: "ns-a", Name: "data-3", CreationTime: created, Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "daily_weekly_monthly", "backup-ns.sh/weekly": "w01"}},
+		{Namespace: "ns-a", Name: "data-4", CreationTime: created, Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "daily_weekly_monthly", "backup-ns.sh/monthly": "2025-01"}},
+		// already marked
+		{Namespace: "ns-a", Name: "data-5", CreationTime: created, Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "daily_weekly_monthly", "backup-ns.sh/delete-after": "2025-01-08"}},
+		// other retain policy
+		{Namespace: "ns-a", Name: "data-6", CreationTime: created, Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "days"}},
+	}
+
+	require.Equal(t, []lib.DeleteAfterMark{
+		{Namespace: "ns-a", VSName: "data-1", PVCName: "data", CreationTime: created, DeleteAfter: "2025-01-09"},
+	}, lib.PlanDeleteAfterMark(vss, now))
+}
+
+func TestPlanDeleteAfterSweep(t *testing.T) {
+	now := time.Date(2025, 1, 9, 11, 36, 0, 0, time.UTC)
+	day := func(d int) time.Time {
+		return time.Date(2025, 1, d, 0, 17, 0, 0, time.UTC)
+	}
+
+	vss := []lib.VolumeSnapshotInfo{
+		// ns-a: two expired snapshots and one still retained ready snapshot
+		{Namespace: "ns-a", Name: "data-1", ReadyToUse: true, CreationTime: day(1), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "daily_weekly_monthly", "backup-ns.sh/delete-after": "2025-01-07"}},
+		{Namespace: "ns-a", Name: "data-2", ReadyToUse: true, CreationTime: day(2), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "daily_weekly_monthly", "backup-ns.sh/delete-after": "2025-01-08"}},
+		{Namespace: "ns-a", Name: "data-8", ReadyToUse: true, CreationTime: day(8), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "daily_weekly_monthly", "backup-ns.sh/daily": "2025-01-08"}},
+		// ns-a: delete-after today or in the future is kept
+		{Namespace: "ns-a", Name: "data-9", ReadyToUse: true, CreationTime: day(9), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "days", "backup-ns.sh/delete-after": "2025-01-09"}},
+		// ns-b: the only ready snapshot of the pvc is expired, a non-ready one may be deleted
+		{Namespace: "ns-b", Name: "data-1", ReadyToUse: false, CreationTime: day(1), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "days", "backup-ns.sh/delete-after": "2025-01-02"}},
+		{Namespace: "ns-b", Name: "data-2", ReadyToUse: true, CreationTime: day(2), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/retain": "days", "backup-ns.sh/delete-after": "2025-01-03"}},
+		// ns-b: no retain label, never touched
+		{Namespace: "ns-b", Name: "manual", ReadyToUse: true, CreationTime: day(1), Labels: map[string]string{"backup-ns.sh/pvc": "other", "backup-ns.sh/delete-after": "2025-01-01"}},
+	}
+
+	require.Equal(t, []lib.SweepCandidate{
+		{Namespace: "ns-b", VSName: "data-1", PVCName: "data", CreationTime: day(1), ReadyToUse: false, DeleteAfter: "2025-01-02"},
+		{Namespace: "ns-b", VSName: "data-2", PVCName: "data", CreationTime: day(2), ReadyToUse: true, DeleteAfter: "2025-01-03", Skip: lib.SweepSkipLastReady},
+		{Namespace: "ns-a", VSName: "data-1", PVCName: "data", CreationTime: day(1), ReadyToUse: true, DeleteAfter: "2025-01-07"},
+		{Namespace: "ns-a", VSName: "data-2", PVCName: "data", CreationTime: day(2), ReadyToUse: true, DeleteAfter: "2025-01-08", Skip: lib.SweepSkipMaxDeletions},
+	}, lib.PlanDeleteAfterSweep(vss, now, 2))
+
+	// unlimited: ns-a keeps data-8 and data-9 as ready snapshots, thus both expired ones may go
+	unlimited := lib.PlanDeleteAfterSweep(vss, now, 0)
+	require.Len(t, unlimited, 4)
+	require.Empty(t, unlimited[2].Skip)
+	require.Empty(t, unlimited[3].Skip)
+}
+
+func TestPlanDeleteAfterSweepGroups(t *testing.T) {
+	now := time.Date(2025, 1, 9, 11, 36, 0, 0, time.UTC)
+	day := func(d int) time.Time {
+		return time.Date(2025, 1, d, 0, 17, 0, 0, time.UTC)
+	}
+	member := func(name, pvc, group string, d int, deleteAfter string) lib.VolumeSnapshotInfo {
+		labels := map[string]string{"backup-ns.sh/pvc": pvc, "backup-ns.sh/retain": "days", lib.LabelGroup: group}
+		if deleteAfter != "" {
+			labels["backup-ns.sh/delete-after"] = deleteAfter
+		}
+		return lib.VolumeSnapshotInfo{Namespace: "ns-a", Name: name, ReadyToUse: true, CreationTime: day(d), Labels: labels}
+	}
+
+	vss := []lib.VolumeSnapshotInfo{
+		// g1: all members expired, swept as a unit
+		member("g1-data", "data", "g1", 1, "2025-01-02"),
+		member("g1-uploads", "uploads", "g1", 1, "2025-01-02"),
+		// g2: only one member expired, the group is kept
+		member("g2-data", "data", "g2", 2, "2025-01-03"),
+		member("g2-uploads", "uploads", "g2", 2, ""),
+		// g3: the last ready snapshot of the uploads pvc, the whole group is kept
+		member("g3-data", "data", "g3", 3, "2025-01-04"),
+		member("g3-uploads", "uploads", "g3", 3, "2025-01-04"),
+		member("data-8", "data", "", 8, ""),
+	}
+
+	// g2-uploads is not swept either, so g3-uploads is not the last ready one of uploads
+	candidates := lib.PlanDeleteAfterSweep(vss, now, 0)
+	require.Equal(t, []lib.SweepCandidate{
+		{Namespace: "ns-a", VSName: "g1-data", PVCName: "data", Group: "g1", CreationTime: day(1), ReadyToUse: true, DeleteAfter: "2025-01-02"},
+		{Namespace: "ns-a", VSName: "g1-uploads", PVCName: "uploads", Group: "g1", CreationTime: day(1), ReadyToUse: true, DeleteAfter: "2025-01-02"},
+		{Namespace: "ns-a", VSName: "g2-data", PVCName: "data", Group: "g2", CreationTime: day(2), ReadyToUse: true, DeleteAfter: "2025-01-03", Skip: lib.SweepSkipGroupMember},
+		{Namespace: "ns-a", VSName: "g3-data", PVCName: "data", Group: "g3", CreationTime: day(3), ReadyToUse: true, DeleteAfter: "2025-01-04"},
+		{Namespace: "ns-a", VSName: "g3-uploads", PVCName: "uploads", Group: "g3", CreationTime: day(3), ReadyToUse: true, DeleteAfter: "2025-01-04"},
+	}, candidates)
+
+	// without g2-uploads, g3-uploads is the last ready snapshot of uploads
+	vss = append(vss[:3], vss[4:]...)
+	candidates = lib.PlanDeleteAfterSweep(vss, now, 0)
+	require.Len(t, candidates, 5)
+	require.Empty(t, candidates[0].Skip)
+	require.Equal(t, lib.SweepSkipLastReady, candidates[3].Skip)
+	require.Equal(t, lib.SweepSkipLastReady, candidates[4].Skip)
+
+	// a group counts as a single deletion
+	candidates = lib.PlanDeleteAfterSweep(vss, now, 1)
+	require.Empty(t, candidates[0].Skip)
+	require.Empty(t, candidates[1].Skip)
+	require.Equal(t, lib.SweepSkipMaxDeletions, candidates[2].Skip)
+}
@@ -0,0 +1,552 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// LabelVerified is set to the date (2006-01-02) of the last passed restore drill of the volume snapshot.
+	LabelVerified = "backup-ns.sh/verified"
+
+	// The container of the drill pod and the mount path of the restored pvc within it.
+	drillContainer = "drill"
+	drillMountPath = "/drill"
+)
+
+// DrillConfig configures the restore drills of volume snapshots ("backup-ns drill").
+type DrillConfig struct {
+	Image        string   `json:"BAK_DRILL_IMAGE"`
+	StorageClass string   `json:"BAK_DRILL_STORAGE_CLASS"`
+	Timeout      string   `json:"BAK_DRILL_TIMEOUT"`
+	MaxDuration  string   `json:"BAK_DRILL_MAX_DURATION"`
+	Probes       []string `json:"BAK_DRILL_PROBES"`
+}
+
+// DrillResult is the result of the restore drill of a single volume snapshot.
+type DrillResult struct {
+	Namespace string `json:"namespace"`
+	VSName    string `json:"vsName"`
+
+	// The "backup-ns.sh/pvc" of the volume snapshot
+	PVCName string `json:"pvcName"`
+
+	// The temporary pvc the volume snapshot was restored to (in SandboxNamespace if set, otherwise in Namespace)
+	RestoredPVCName  string `json:"restoredPvcName"`
+	SandboxNamespace string `json:"sandboxNamespace,omitempty"`
+
+	Drilled         time.Time          `json:"drilled"`
+	DurationSeconds float64            `json:"durationSeconds"`
+	Dumps           []DrillDumpResult  `json:"dumps,omitempty"`
+	Probes          []DrillProbeResult `json:"probes,omitempty"`
+	Problems        []string           `json:"problems,omitempty"`
+
+	// The error that prevented the drill (set by the controller drills, which continue with the next namespace)
+	Error string `json:"error,omitempty"`
+}
+
+// DrillDumpResult is the check of a dump within the restored volume against its backup-ns.sh/<name>-manifest annotation.
+type DrillDumpResult struct {
+	Name string `json:"name"`
+
+	// The path of the matching dump within the restored volume ("" if none matched)
+	DumpFile string `json:"dumpFile"`
+	SHA256   string `json:"sha256"`
+	OK       bool   `json:"ok"`
+}
+
+// DrillProbeResult is the check of a file probe (BAK_DRILL_PROBES) within the restored volume.
+type DrillProbeResult struct {
+	Probe string `json:"probe"`
+
+	// The number of non-empty files and directories matching the probe
+	Matches int  `json:"matches"`
+	OK      bool `json:"ok"`
+}
+
+// OK is true if the drill was run and no problems were found.
+func (r DrillResult) OK() bool {
+	return r.Error == "" && len(r.Problems) == 0
+}
+
+func (r *DrillResult) addProblem(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// volumeSnapshotDumpManifests returns the dump manifests recorded in the backup-ns.sh/<name>-manifest annotations, sorted by name.
+func volumeSnapshotDumpManifests(annotations map[string]string) []DumpManifest {
+	var manifests []DumpManifest
+	for key, value := range annotations {
+		if !strings.HasPrefix(key, "backup-ns.sh/") || !strings.HasSuffix(key, "-manifest") {
+			continue
+		}
+
+		var manifest DumpManifest
+		if err := json.Unmarshal([]byte(value), &manifest); err != nil || manifest.SHA256 == "" {
+			slog.Warn("Ignoring invalid dump manifest annotation", "annotation", key, "error", err)
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Name < manifests[j].Name })
+	return manifests
+}
+
+// drillProbes returns the configured probes plus the BAK_DRILL_PROBES of the backup job that created the volume snapshot
+// (recorded in its backup-ns.sh/env-config annotation), so every namespace can define its own probes.
+func drillProbes(probes []string, annotations map[string]string) []string {
+	result := slices.Clone(probes)
+
+	for _, line := range strings.Split(annotations["backup-ns.sh/env-config"], "\n") {
+		value, ok := strings.CutPrefix(line, "BAK_DRILL_PROBES=")
+		if !ok {
+			continue
+		}
+
+		for _, probe := range strings.Split(strings.Trim(value, "'"), ",") {
+			if probe = strings.TrimSpace(probe); probe != "" && !slices.Contains(result, probe) {
+				result = append(result, probe)
+			}
+		}
+	}
+
+	return result
+}
+
+// DrillVolumeSnapshot restores the volume snapshot to a temporary pvc, mounts it (read-only) into a drill pod and checks that
+//   - the restored volume is not empty,
+//   - every dump recorded in the backup-ns.sh/<name>-manifest annotations of the volume snapshot is found within the volume
+//     (by the name of its dump file) with the checksum and size of its manifest and
+//   - every file probe (glob relative to the volume root, e.g. "uploads/*", see drillProbes) matches at least one non-empty
+//     file or directory.
+//
+// The drill pod and pvc are always deleted afterwards. Failed checks are reported via DrillResult.Problems (err is nil).
+// Once ctx is done, no pvc or pod is created and waiting for the pod is stopped.
+func DrillVolumeSnapshot(ctx context.Context, namespace, vsName string, config DrillConfig) (DrillResult, error) {
+	start := time.Now()
+	result := DrillResult{Namespace: namespace, VSName: vsName}
+
+	timeout, err := parseTimeout(config.Timeout)
+	if err != nil {
+		return result, err
+	}
+
+	maxDuration, err := parseTimeout(config.MaxDuration)
+	if err != nil {
+		return result, err
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return result, err
+	}
+
+	vs, err := client.GetVolumeSnapshot(ctx, namespace, vsName)
+	if err != nil {
+		return result, err
+	}
+	info := volumeSnapshotInfoFromUnstructured(*vs)
+	result.PVCName = info.Labels["backup-ns.sh/pvc"]
+
+	if !info.ReadyToUse {
+		return result, fmt.Errorf("VolumeSnapshot '%s' in namespace '%s' is not ready to use", vsName, namespace)
+	}
+
+	name := fmt.Sprintf("backup-ns-drill-%s", GenerateRandomStringOrPanic(6))
+	result.RestoredPVCName = name
+
+	slog.Info("Starting restore drill...", "namespace", namespace, "vs_name", vsName, "pvc", result.PVCName, "restored_pvc", name)
+
+	if err := ctx.Err(); err != nil {
+		return result, fmt.Errorf("restore drill of VolumeSnapshot '%s' stopped: %w", vsName, err)
+	}
+
+	// the pvc is only bound as soon as the drill pod is scheduled (WaitForFirstConsumer), the pod waits for it
+	if err := RestoreVolumeSnapshot(namespace, vsName, name, config.StorageClass, false, ""); err != nil {
+		return result, err
+	}
+	defer func() {
+		if err := client.DeletePersistentVolumeClaim(context.Background(), namespace, name); err != nil {
+			slog.Error("Failed to delete drill PVC", "namespace", namespace, "pvc", name, "error", err)
+			return
+		}
+		slog.Info("Deleted drill PVC", "namespace", namespace, "pvc", name)
+	}()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "backup-ns",
+				"backup-ns.sh/drill":           result.PVCName,
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{{
+				Name:         drillContainer,
+				Image:        config.Image,
+				Command:      []string{"sh", "-c", "trap 'exit 0' TERM; while true; do sleep 60; done"},
+				VolumeMounts: []corev1.VolumeMount{{Name: "restored", MountPath: drillMountPath, ReadOnly: true}},
+			}},
+			Volumes: []corev1.Volume{{Name: "restored", VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: name, ReadOnly: true},
+			}}},
+		},
+	}
+	if maxDuration > 0 {
+		seconds := int64(maxDuration.Seconds())
+		pod.Spec.ActiveDeadlineSeconds = &seconds
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, fmt.Errorf("restore drill of VolumeSnapshot '%s' stopped: %w", vsName, err)
+	}
+
+	if _, err := client.CreatePod(ctx, pod); err != nil {
+		return result, err
+	}
+	defer func() {
+		if err := client.DeletePod(context.Background(), namespace, name); err != nil {
+			slog.Error("Failed to delete drill pod", "namespace", namespace, "pod", name, "error", err)
+			return
+		}
+		slog.Info("Deleted drill pod", "namespace", namespace, "pod", name)
+	}()
+
+	if err := waitForPodReady(ctx, namespace, name, drillContainer, "", timeout); err != nil {
+		return result, err
+	}
+
+	if err := checkDrillVolume(namespace, name, vs.GetAnnotations(), drillProbes(config.Probes, vs.GetAnnotations()), &result); err != nil {
+		return result, err
+	}
+
+	result.Drilled = time.Now().UTC()
+	result.DurationSeconds = time.Since(start).Seconds()
+
+	if result.OK() {
+		slog.Info("Restore drill passed", "namespace", namespace, "vs_name", vsName, "dumps", len(result.Dumps), "probes", len(result.Probes))
+	} else {
+		slog.Error("Restore drill failed", "namespace", namespace, "vs_name", vsName, "problems", strings.Join(result.Problems, "; "))
+	}
+
+	return result, nil
+}
+
+// checkDrillVolume runs the checks of DrillVolumeSnapshot within the running drill pod.
+func checkDrillVolume(namespace, podName string, annotations map[string]string, probes []string, result *DrillResult) error {
+	resource := "pod/" + podName
+
+	output, err := execInResource(namespace, resource, drillContainer, []string{"sh", "-c", `ls -A "$1" | head -n 1`, "sh", drillMountPath}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to list the restored volume: %w (output: %s)", err, output)
+	}
+	if strings.TrimSpace(output) == "" {
+		result.addProblem("restored volume is empty")
+	}
+
+	for _, manifest := range volumeSnapshotDumpManifests(annotations) {
+		dump := DrillDumpResult{Name: manifest.Name, SHA256: manifest.SHA256}
+
+		// the dump file path is the one within the database container, the volume may be mounted anywhere (or as subPath)
+		output, err := execInResource(namespace, resource, drillContainer, []string{"find", drillMountPath, "-name", path.Base(manifest.DumpFile)}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to find the dump file '%s': %w (output: %s)", path.Base(manifest.DumpFile), err, output)
+		}
+
+		for _, candidate := range strings.Split(strings.TrimSpace(output), "\n") {
+			if candidate == "" {
+				continue
+			}
+
+			checksum, err := GetRemoteFileChecksum(namespace, resource, drillContainer, candidate)
+			if err != nil {
+				return err
+			}
+			size, err := GetRemoteFileSize(namespace, resource, drillContainer, candidate)
+			if err != nil {
+				return err
+			}
+
+			if manifest.Verify(checksum, size) == nil {
+				dump.DumpFile, dump.OK = strings.TrimPrefix(candidate, drillMountPath+"/"), true
+				break
+			}
+			slog.Warn("Dump file does not match its manifest", "name", manifest.Name, "dump_file", candidate, "sha256", checksum, "expected_sha256", manifest.SHA256)
+		}
+
+		if !dump.OK {
+			result.addProblem("no dump file '%s' matching the manifest of %s (sha256 %s)", path.Base(manifest.DumpFile), manifest.Name, manifest.SHA256)
+		}
+		result.Dumps = append(result.Dumps, dump)
+	}
+
+	// the probe is expanded by the shell relative to the volume root, only non-empty files and directories count
+	script := `cd "$1" && IFS= && count=0 && for f in $2; do if { [ -f "$f" ] && [ -s "$f" ]; } || { [ -d "$f" ] && [ -n "$(ls -A "$f")" ]; }; then count=$((count + 1)); fi; done && echo "$count"`
+
+	for _, probe := range probes {
+		output, err := execInResource(namespace, resource, drillContainer, []string{"sh", "-c", script, "sh", drillMountPath, strings.TrimPrefix(probe, "/")}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to check the probe '%s': %w (output: %s)", probe, err, output)
+		}
+
+		matches, err := strconv.Atoi(strings.TrimSpace(output))
+		if err != nil {
+			return fmt.Errorf("failed to parse the matches of the probe '%s': %w", probe, err)
+		}
+
+		result.Probes = append(result.Probes, DrillProbeResult{Probe: probe, Matches: matches, OK: matches > 0})
+		if matches == 0 {
+			result.addProblem("probe '%s' matches no non-empty file", probe)
+		}
+	}
+
+	return nil
+}
+
+// MarkVolumeSnapshotVerified sets the backup-ns.sh/verified label of the volume snapshot to the date of the drill.
+func MarkVolumeSnapshotVerified(namespace, vsName string, drilled time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	patch, err := labelPatch(nil, map[string]string{LabelVerified: drilled.UTC().Format("2006-01-02")})
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.PatchVolumeSnapshot(context.Background(), namespace, vsName, patch); err != nil {
+		return fmt.Errorf("failed to label VolumeSnapshot '%s' in namespace '%s': %w", vsName, namespace, err)
+	}
+
+	slog.Info("Labeled volume snapshot as verified", "namespace", namespace, "vs_name", vsName, "label", LabelVerified, "date", drilled.UTC().Format("2006-01-02"))
+	return nil
+}
+
+// PickDrillVolumeSnapshots picks a random ready volume snapshot per namespace (sorted by namespace) for the scheduled
+// restore drills of the controller. Snapshots marked for deletion (they might be swept during the drill) and snapshots
+// in the sandbox namespace are skipped. intN returns a random number in [0, n) (e.g. rand.IntN).
+func PickDrillVolumeSnapshots(vss []VolumeSnapshotInfo, sandboxNamespace string, intN func(n int) int) []VolumeSnapshotInfo {
+	candidates := make(map[string][]VolumeSnapshotInfo)
+	for _, vs := range vss {
+		if !vs.ReadyToUse || vs.Namespace == sandboxNamespace || vs.Labels[LabelDeleteAfter] != "" {
+			continue
+		}
+		candidates[vs.Namespace] = append(candidates[vs.Namespace], vs)
+	}
+
+	picked := make([]VolumeSnapshotInfo, 0, len(candidates))
+	for _, namespace := range sortedKeys(candidates) {
+		// sorted, so the pick only depends on intN
+		vss := candidates[namespace]
+		sort.Slice(vss, func(i, j int) bool { return vss[i].Name < vss[j].Name })
+
+		picked = append(picked, vss[intN(len(vss))])
+	}
+
+	return picked
+}
+
+// DrillVolumeSnapshotInSandbox runs the restore drill (see DrillVolumeSnapshot) of the volume snapshot in the sandbox
+// namespace: a pre-provisioned VolumeSnapshotContent (deletionPolicy Retain) referencing the snapshot handle of the
+// original one is bound to a temporary volume snapshot in the sandbox namespace (with the annotations of the original),
+// which is restored and checked there. The sandbox volume snapshot and its content are deleted afterwards, the snapshot
+// on the storage system is kept (Retain). Like DrillVolumeSnapshot, nothing is created anymore once ctx is done.
+func DrillVolumeSnapshotInSandbox(ctx context.Context, namespace, vsName, sandboxNamespace string, config DrillConfig) (DrillResult, error) {
+	result := DrillResult{Namespace: namespace, VSName: vsName, SandboxNamespace: sandboxNamespace}
+
+	client, err := getClient()
+	if err != nil {
+		return result, err
+	}
+
+	vs, err := client.GetVolumeSnapshot(ctx, namespace, vsName)
+	if err != nil {
+		return result, err
+	}
+	info := volumeSnapshotInfoFromUnstructured(*vs)
+	result.PVCName = info.Labels["backup-ns.sh/pvc"]
+
+	if !info.ReadyToUse || info.ContentName == "" {
+		return result, fmt.Errorf("VolumeSnapshot '%s' in namespace '%s' is not ready to use", vsName, namespace)
+	}
+
+	vsc, err := client.GetVolumeSnapshotContent(ctx, info.ContentName)
+	if err != nil {
+		return result, err
+	}
+
+	snapshotHandle, _, _ := unstructured.NestedString(vsc.Object, "status", "snapshotHandle")
+	driver, _, _ := unstructured.NestedString(vsc.Object, "spec", "driver")
+	vsClassName, _, _ := unstructured.NestedString(vsc.Object, "spec", "volumeSnapshotClassName")
+	if snapshotHandle == "" || driver == "" {
+		return result, fmt.Errorf("VolumeSnapshotContent '%s' has no snapshotHandle or driver", info.ContentName)
+	}
+
+	name := fmt.Sprintf("backup-ns-drill-%s", GenerateRandomStringOrPanic(6))
+
+	sandboxVSC := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshotContent",
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"labels":      map[string]interface{}{"app.kubernetes.io/managed-by": "backup-ns"},
+			"annotations": map[string]interface{}{"backup-ns.sh/drill-source": namespace + "/" + vsName},
+		},
+		"spec": map[string]interface{}{
+			"deletionPolicy":          "Retain",
+			"driver":                  driver,
+			"volumeSnapshotClassName": vsClassName,
+			"source":                  map[string]interface{}{"snapshotHandle": snapshotHandle},
+			"volumeSnapshotRef":       map[string]interface{}{"name": name, "namespace": sandboxNamespace},
+		},
+	}}
+
+	// no backup-ns.sh/ labels, so the sandbox snapshot is neither synced, retained nor checked, but the dump manifests
+	// and the env-config (drill probes) annotations are needed by the drill
+	vsAnnotations := map[string]interface{}{"backup-ns.sh/drill-source": namespace + "/" + vsName}
+	for key, value := range vs.GetAnnotations() {
+		vsAnnotations[key] = value
+	}
+
+	sandboxVS := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshot",
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"namespace":   sandboxNamespace,
+			"labels":      map[string]interface{}{"app.kubernetes.io/managed-by": "backup-ns"},
+			"annotations": vsAnnotations,
+		},
+		"spec": map[string]interface{}{
+			"volumeSnapshotClassName": vsClassName,
+			"source":                  map[string]interface{}{"volumeSnapshotContentName": name},
+		},
+	}}
+
+	if err := ctx.Err(); err != nil {
+		return result, fmt.Errorf("restore drill of VolumeSnapshot '%s' stopped: %w", vsName, err)
+	}
+
+	slog.Info("Creating sandbox VolumeSnapshot...", "namespace", namespace, "vs_name", vsName, "sandbox_namespace", sandboxNamespace, "sandbox_vs_name", name, "snapshot_handle", snapshotHandle)
+
+	if _, err := client.CreateVolumeSnapshotContent(ctx, sandboxVSC); err != nil {
+		return result, fmt.Errorf("failed to create sandbox VolumeSnapshotContent: %w", err)
+	}
+	defer func() {
+		if err := client.DeleteVolumeSnapshotContent(context.Background(), name); err != nil {
+			slog.Error("Failed to delete sandbox VolumeSnapshotContent", "vsc_name", name, "error", err)
+		}
+	}()
+
+	if _, err := client.CreateVolumeSnapshot(ctx, sandboxVS); err != nil {
+		return result, fmt.Errorf("failed to create sandbox VolumeSnapshot: %w", err)
+	}
+	defer func() {
+		if err := client.DeleteVolumeSnapshot(context.Background(), sandboxNamespace, name); err != nil {
+			slog.Error("Failed to delete sandbox VolumeSnapshot", "namespace", sandboxNamespace, "vs_name", name, "error", err)
+		}
+	}()
+
+	if err := waitForVolumeSnapshotReady(ctx, client, sandboxNamespace, name, config.Timeout); err != nil {
+		return result, err
+	}
+
+	drill, err := DrillVolumeSnapshot(ctx, sandboxNamespace, name, config)
+
+	drill.Namespace, drill.VSName, drill.PVCName, drill.SandboxNamespace = namespace, vsName, result.PVCName, sandboxNamespace
+	return drill, err
+}
+
+const (
+	// DrillReportConfigMap is the ConfigMap in the sandbox namespace holding the report of the controller drills.
+	DrillReportConfigMap = "backup-ns-drill-report"
+	drillReportKey       = "report.json"
+)
+
+// DrillReport holds the last restore drill result per namespace.
+type DrillReport struct {
+	Updated time.Time `json:"updated"`
+
+	// Sorted by namespace
+	Drills []DrillResult `json:"drills"`
+}
+
+// UpdateDrillReport merges the results into the report stored in the DrillReportConfigMap of the sandbox namespace
+// (replacing the previous result of their namespace) and returns the updated report.
+func UpdateDrillReport(sandboxNamespace string, results []DrillResult, now time.Time) (DrillReport, error) {
+	var report DrillReport
+
+	client, err := getClient()
+	if err != nil {
+		return report, err
+	}
+
+	ctx := context.Background()
+
+	cm, err := client.GetConfigMap(ctx, sandboxNamespace, DrillReportConfigMap)
+	if err != nil && !k8s.IsNotFound(err) {
+		return report, err
+	}
+
+	if cm != nil && cm.Data[drillReportKey] != "" {
+		if err := json.Unmarshal([]byte(cm.Data[drillReportKey]), &report); err != nil {
+			slog.Warn("Replacing invalid drill report", "namespace", sandboxNamespace, "configmap", DrillReportConfigMap, "error", err)
+			report = DrillReport{}
+		}
+	}
+
+	for _, r := range results {
+		report.Drills = slices.DeleteFunc(report.Drills, func(d DrillResult) bool { return d.Namespace == r.Namespace })
+		report.Drills = append(report.Drills, r)
+	}
+	sort.Slice(report.Drills, func(i, j int) bool { return report.Drills[i].Namespace < report.Drills[j].Namespace })
+	report.Updated = now.UTC()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return report, fmt.Errorf("failed to marshal drill report: %w", err)
+	}
+
+	if cm == nil {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: sandboxNamespace,
+			Name:      DrillReportConfigMap,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "backup-ns"},
+		}}
+		cm.Data = map[string]string{drillReportKey: string(data)}
+
+		if _, err := client.CreateConfigMap(ctx, cm); err != nil {
+			return report, err
+		}
+	} else {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[drillReportKey] = string(data)
+
+		if _, err := client.UpdateConfigMap(ctx, cm); err != nil {
+			return report, err
+		}
+	}
+
+	slog.Info("Updated drill report", "namespace", sandboxNamespace, "configmap", DrillReportConfigMap, "drills", len(report.Drills))
+	return report, nil
+}
@@ -0,0 +1,38 @@
+package lib_test
+
+import (
+	"testing"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickDrillVolumeSnapshots(t *testing.T) {
+	labels := map[string]string{"backup-ns.sh/pvc": "data"}
+
+	vss := []lib.VolumeSnapshotInfo{
+		{Namespace: "ns-b", Name: "data-3", ReadyToUse: true, Labels: labels},
+		{Namespace: "ns-b", Name: "data-1", ReadyToUse: true, Labels: labels},
+		{Namespace: "ns-b", Name: "data-2", ReadyToUse: false, Labels: labels},
+		{Namespace: "ns-a", Name: "data-1", ReadyToUse: true, Labels: labels},
+		// marked for deletion
+		{Namespace: "ns-a", Name: "data-2", ReadyToUse: true, Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/delete-after": "2025-01-09"}},
+		// only not ready snapshots
+		{Namespace: "ns-c", Name: "data-1", ReadyToUse: false, Labels: labels},
+		// the sandbox namespace itself
+		{Namespace: "backup-ns-drill", Name: "data-1", ReadyToUse: true, Labels: labels},
+	}
+
+	var choices []int
+	picked := lib.PickDrillVolumeSnapshots(vss, "backup-ns-drill", func(n int) int {
+		choices = append(choices, n)
+		return n - 1
+	})
+
+	require.Equal(t, []int{1, 2}, choices)
+	require.Len(t, picked, 2)
+	require.Equal(t, "ns-a", picked[0].Namespace)
+	require.Equal(t, "data-1", picked[0].Name)
+	require.Equal(t, "ns-b", picked[1].Namespace)
+	require.Equal(t, "data-3", picked[1].Name)
+}
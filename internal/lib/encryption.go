@@ -0,0 +1,200 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// EncryptionConfig is the client-side encryption of the dump files (BAK_DUMP_ENCRYPTION), shared by all engines.
+// Dumps are encrypted inside the database container to the public keys of the recipients, the private key is only
+// required to decrypt them (restore, downloadDump --decrypt).
+type EncryptionConfig struct {
+	Algorithm           string `json:"BAK_DUMP_ENCRYPTION"`
+	Recipients          string `json:"BAK_DUMP_ENCRYPTION_RECIPIENTS"`
+	DecryptionKeyFile   string `json:"BAK_DUMP_DECRYPTION_KEY_FILE"`
+	DecryptionKeySecret string `json:"BAK_DUMP_DECRYPTION_KEY_SECRET"`
+}
+
+// Enabled is true if the dumps are encrypted.
+func (c EncryptionConfig) Enabled() bool {
+	return c.Algorithm == "age" || c.Algorithm == "gpg"
+}
+
+// Binary is the cli required to encrypt ("" for none).
+func (c EncryptionConfig) Binary() string {
+	if !c.Enabled() {
+		return ""
+	}
+	return c.Algorithm
+}
+
+// Extension is the file extension of encrypted files (".age", ".gpg", "" for none).
+func (c EncryptionConfig) Extension() string {
+	if !c.Enabled() {
+		return ""
+	}
+	return "." + c.Algorithm
+}
+
+// RecipientsFile is the content of the age recipients file (one recipient per line, comma separated recipients are
+// split) or the armored gpg public key(s).
+func (c EncryptionConfig) RecipientsFile() string {
+	if c.Algorithm != "age" {
+		return strings.TrimSpace(c.Recipients)
+	}
+
+	var recipients []string
+	for _, line := range strings.Split(c.Recipients, "\n") {
+		for _, recipient := range strings.Split(line, ",") {
+			if recipient = strings.TrimSpace(recipient); recipient != "" {
+				recipients = append(recipients, recipient)
+			}
+		}
+	}
+	return strings.Join(recipients, "\n")
+}
+
+// DecryptCommand decrypts the file to stdout (used in hints for downloaded dumps, "" if the dumps are not encrypted).
+func (c EncryptionConfig) DecryptCommand(file string) string {
+	switch c.Algorithm {
+	case "age":
+		return fmt.Sprintf("age --decrypt --identity <key-file> %s", file)
+	case "gpg":
+		return fmt.Sprintf("gpg --decrypt %s", file)
+	}
+	return ""
+}
+
+// Validate ensures recipients are set if the dumps are encrypted.
+func (c EncryptionConfig) Validate() error {
+	if c.Enabled() && c.RecipientsFile() == "" {
+		return fmt.Errorf("BAK_DUMP_ENCRYPTION_RECIPIENTS must be set for BAK_DUMP_ENCRYPTION=%s", c.Algorithm)
+	}
+	return nil
+}
+
+// encryptedDumpFile replaces the encryption extension (".age" or ".gpg") of the dump file with the one of the encryption
+// (e.g. "/data/dump.sql.gz" becomes "/data/dump.sql.gz.age" for age).
+func encryptedDumpFile(dumpFile string, encryption EncryptionConfig) string {
+	return unencryptedDumpFile(dumpFile) + encryption.Extension()
+}
+
+// unencryptedDumpFile strips the encryption extension (".age" or ".gpg") of the dump file.
+func unencryptedDumpFile(dumpFile string) string {
+	for _, ext := range []string{".age", ".gpg"} {
+		if name, ok := strings.CutSuffix(dumpFile, ext); ok {
+			return name
+		}
+	}
+	return dumpFile
+}
+
+// LoadDecryptionKey returns the private key to decrypt the dumps, read from BAK_DUMP_DECRYPTION_KEY_FILE or the
+// BAK_DUMP_DECRYPTION_KEY_SECRET ("<secret>/<key>") in the namespace, "" if neither is set.
+func LoadDecryptionKey(namespace string, encryption EncryptionConfig) (string, error) {
+	if encryption.DecryptionKeyFile != "" {
+		key, err := os.ReadFile(encryption.DecryptionKeyFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read BAK_DUMP_DECRYPTION_KEY_FILE: %w", err)
+		}
+		return string(key), nil
+	}
+
+	if encryption.DecryptionKeySecret == "" {
+		return "", nil
+	}
+
+	secretName, secretKey, ok := strings.Cut(encryption.DecryptionKeySecret, "/")
+	if !ok || secretName == "" || secretKey == "" {
+		return "", fmt.Errorf("invalid BAK_DUMP_DECRYPTION_KEY_SECRET '%s', expected '<secret>/<key>'", encryption.DecryptionKeySecret)
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := client.GetSecret(context.Background(), namespace, secretName)
+	if err != nil {
+		return "", err
+	}
+
+	key, ok := secret.Data[secretKey]
+	if !ok {
+		return "", fmt.Errorf("Secret '%s' in namespace '%s' has no key '%s'", secretName, namespace, secretKey)
+	}
+
+	slog.Info("Loaded decryption key", "namespace", namespace, "secret", secretName, "key", secretKey)
+
+	return string(key), nil
+}
+
+// DecryptFile decrypts the downloaded (age or gpg encrypted) dump file src to dst with the private key via the local
+// age or gpg cli (the encryption is detected via the header of the file).
+func DecryptFile(src, dst, key string) error {
+	header := make([]byte, 32)
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	n, err := f.Read(header)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", src, err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "backup-ns-decrypt-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	keyFile := filepath.Join(tmpDir, "key")
+	if err := os.WriteFile(keyFile, []byte(key), 0o600); err != nil {
+		return err
+	}
+
+	var cmds [][]string
+	switch detectEncryption(header[:n]) {
+	case "age":
+		cmds = [][]string{{"age", "--decrypt", "--identity", keyFile, "--output", dst, src}}
+	case "gpg":
+		cmds = [][]string{
+			{"gpg", "--batch", "--quiet", "--homedir", tmpDir, "--import", keyFile},
+			{"gpg", "--batch", "--quiet", "--homedir", tmpDir, "--output", dst, "--decrypt", src},
+		}
+	default:
+		return fmt.Errorf("'%s' is not age or gpg encrypted", src)
+	}
+
+	for _, args := range cmds {
+		var stderr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to decrypt '%s' via %s: %w (output: %s)", src, args[0], err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	return nil
+}
+
+// detectEncryption returns "age", "gpg" or "" for the header of a file, like the decrypt function of the templates.
+func detectEncryption(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("age-encryption.org/v1")), bytes.HasPrefix(header, []byte("-----BEGIN AGE ENCRYPTED FILE-----")):
+		return "age"
+	case bytes.HasPrefix(header, []byte("-----BEGIN PGP MESSAGE-----")):
+		return "gpg"
+	case len(header) > 0 && (header[0] == 0x84 || header[0] == 0x85 || header[0] == 0xc1):
+		// binary OpenPGP public-key encrypted session key packet (old and new format)
+		return "gpg"
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptionConfig(t *testing.T) {
+	// zero value (configs not loaded via LoadConfig) is unencrypted
+	require.False(t, lib.EncryptionConfig{}.Enabled())
+	require.Empty(t, lib.EncryptionConfig{}.Extension())
+	require.Empty(t, lib.EncryptionConfig{Algorithm: "none"}.Binary())
+	require.NoError(t, lib.EncryptionConfig{Algorithm: "none"}.Validate())
+
+	age := lib.EncryptionConfig{Algorithm: "age", Recipients: " age1abc,age1def \nssh-ed25519 AAAAC3 user@host\n"}
+	require.True(t, age.Enabled())
+	require.Equal(t, ".age", age.Extension())
+	require.Equal(t, "age", age.Binary())
+	require.Equal(t, "age1abc\nage1def\nssh-ed25519 AAAAC3 user@host", age.RecipientsFile())
+	require.Equal(t, "age --decrypt --identity <key-file> dump.sql.gz.age", age.DecryptCommand("dump.sql.gz.age"))
+	require.NoError(t, age.Validate())
+
+	gpg := lib.EncryptionConfig{Algorithm: "gpg", Recipients: "\n-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nmQ\n-----END PGP PUBLIC KEY BLOCK-----\n"}
+	require.Equal(t, ".gpg", gpg.Extension())
+	require.Equal(t, "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nmQ\n-----END PGP PUBLIC KEY BLOCK-----", gpg.RecipientsFile())
+
+	require.ErrorContains(t, lib.EncryptionConfig{Algorithm: "age", Recipients: " , "}.Validate(), "BAK_DUMP_ENCRYPTION_RECIPIENTS")
+}
+
+func TestLoadConfigDumpEncryption(t *testing.T) {
+	t.Setenv("BAK_DUMP_ENCRYPTION", "age")
+	t.Setenv("BAK_DUMP_ENCRYPTION_RECIPIENTS", "age1abc")
+	t.Setenv("BAK_DUMP_COMPRESSION", "zstd")
+	t.Setenv("BAK_DB_MYSQL_1_NAME", "legacy")
+	t.Setenv("BAK_DB_POSTGRES_1_DUMP_FORMAT", "custom")
+
+	config := lib.LoadConfig()
+	require.Equal(t, "age", config.DumpEncryption.Algorithm)
+
+	require.Equal(t, "/var/lib/postgresql/data/dump.sql.zst.age", config.Postgres.DumpFile)
+	require.Equal(t, "/var/lib/postgresql/data/dump_1.pgdump.age", config.AdditionalPostgres[0].DumpFile)
+	require.Equal(t, "/var/lib/mysql/dump.sql.zst.age", config.MySQL.DumpFile)
+	require.Equal(t, "/var/lib/mysql/dump_1.sql.zst.age", config.AdditionalMySQL[0].DumpFile)
+	require.Equal(t, config.DumpEncryption, config.AdditionalMySQL[0].Encryption)
+	require.Equal(t, "/data/db/dump.archive.zst.age", config.Mongo.DumpFile)
+
+	engine, err := lib.GetEngine(config, "mongo")
+	require.NoError(t, err)
+	formatter, ok := engine.(lib.DumpFormatter)
+	require.True(t, ok)
+	require.Equal(t, ".archive.zst.age", formatter.DumpFileSuffix())
+	require.Equal(t, config.DumpEncryption, formatter.DumpEncryption())
+
+	// directory dumps are not encrypted by pg_dump
+	t.Setenv("BAK_DB_POSTGRES_DUMP_FORMAT", "directory")
+
+	config = lib.LoadConfig()
+	require.Equal(t, "/var/lib/postgresql/data/dump.dir", config.Postgres.DumpFile)
+	require.ErrorContains(t, lib.EnsurePostgresAvailable(config.Namespace, config.Postgres), "directory")
+}
+
+func TestLoadDecryptionKeyFile(t *testing.T) {
+	key, err := lib.LoadDecryptionKey("default", lib.EncryptionConfig{})
+	require.NoError(t, err)
+	require.Empty(t, key)
+
+	keyFile := filepath.Join(t.TempDir(), "key.txt")
+	require.NoError(t, os.WriteFile(keyFile, []byte("AGE-SECRET-KEY-1ABC\n"), 0o600))
+
+	key, err = lib.LoadDecryptionKey("default", lib.EncryptionConfig{DecryptionKeyFile: keyFile})
+	require.NoError(t, err)
+	require.Equal(t, "AGE-SECRET-KEY-1ABC\n", key)
+
+	_, err = lib.LoadDecryptionKey("default", lib.EncryptionConfig{DecryptionKeySecret: "backup-key"})
+	require.ErrorContains(t, err, "<secret>/<key>")
+}
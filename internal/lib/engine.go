@@ -0,0 +1,236 @@
+package lib
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Engine is a database that is dumped inside its container before the volume snapshot is taken (application-aware backup).
+type Engine interface {
+	// Name identifies the engine in commands, logs, metrics and notifications (e.g. "postgres").
+	Name() string
+
+	// Instance is the configured name of this database (e.g. "postgres" or "postgres-1" via BAK_DB_POSTGRES_1_NAME), unique across all engines.
+	Instance() string
+
+	// Enabled is true if the engine is enabled via its BAK_DB_* (or indexed BAK_DB_*_<N>) env var.
+	Enabled() bool
+
+	// ExecTarget is the k8s resource and the container inside it the engine scripts are executed in.
+	ExecTarget() (resource string, container string)
+
+	// DumpFile is the absolute path of the dump file inside the container.
+	DumpFile() string
+
+	// Check ensures the exec resource exists and the database is accessible.
+	Check(namespace string) error
+
+	// Dump creates the dump file.
+	Dump(namespace string, dryRun bool) (DumpResult, error)
+
+	// Info returns the modification time and size of the current dump file.
+	Info(namespace string) (DumpInfo, error)
+
+	// Shell opens an interactive database shell inside the container (attached to stdin/stdout).
+	Shell(namespace string) error
+}
+
+// DumpInfo describes the current dump file of an engine.
+type DumpInfo struct {
+	Engine    string    `json:"engine"`
+	Name      string    `json:"name"`
+	DumpFile  string    `json:"dumpFile"`
+	Modified  time.Time `json:"modified"`
+	SizeBytes int64     `json:"sizeBytes"`
+}
+
+// DumpRestorer is optionally implemented by engines that can restore their current dump file in place,
+// the "backup-ns <engine> restore" subcommand is only generated for them.
+type DumpRestorer interface {
+	// Restore restores the database from the current dump file.
+	Restore(namespace string, dryRun bool) error
+}
+
+// DumpFormatter is optionally implemented by engines with a configurable dump format, compression (BAK_DUMP_COMPRESSION)
+// or encryption (BAK_DUMP_ENCRYPTION).
+type DumpFormatter interface {
+	// DumpFileSuffix is the suffix of downloaded dump files (overrides EngineRegistration.DumpFileSuffix).
+	DumpFileSuffix() string
+
+	// DumpIsDirectory is true if the DumpFile is a directory (e.g. pg_dump --format=directory), it is downloaded as tar archive.
+	DumpIsDirectory() bool
+
+	// DumpEncryption is the encryption of the dump file (directory dumps contain encrypted files instead).
+	DumpEncryption() EncryptionConfig
+}
+
+// DumpHint describes how to use a downloaded dump file locally (e.g. how to import it).
+type DumpHint struct {
+	Description string
+	Command     string
+}
+
+// DumpHinter is optionally implemented by engines to print hints after downloading a dump file.
+type DumpHinter interface {
+	DumpHints(localPath string) []DumpHint
+}
+
+// EngineRegistration describes an engine, the "backup-ns <name> ..." subcommands are generated from it.
+type EngineRegistration struct {
+	// The name of the engine and its command (must match Engine.Name)
+	Name string
+
+	// The human readable database name used in the command help texts (e.g. "mysql/mariadb")
+	Title string
+
+	// The env var enabling the engine (e.g. "BAK_DB_POSTGRES")
+	EnabledEnv string
+
+	// The suffix of downloaded dump files (e.g. ".sql.gz")
+	DumpFileSuffix string
+
+	// Creates the engine instances from the loaded config, the base BAK_DB_<ENGINE> instance first, followed by the indexed BAK_DB_<ENGINE>_<N> instances
+	Instances func(config Config) []Engine
+}
+
+// EnabledInstances returns the enabled instances of the engine.
+func (r EngineRegistration) EnabledInstances(config Config) []Engine {
+	var engines []Engine
+	for _, engine := range r.Instances(config) {
+		if engine.Enabled() {
+			engines = append(engines, engine)
+		}
+	}
+	return engines
+}
+
+// SelectInstance returns the enabled instance with the name.
+// If name is "", the only enabled instance is returned (it's an error if multiple instances are enabled).
+func (r EngineRegistration) SelectInstance(config Config, name string) (Engine, error) {
+	engines := r.EnabledInstances(config)
+	if len(engines) == 0 {
+		return nil, fmt.Errorf("%s=true must be set", r.EnabledEnv)
+	}
+
+	names := make([]string, 0, len(engines))
+	for _, engine := range engines {
+		if engine.Instance() == name {
+			return engine, nil
+		}
+		names = append(names, engine.Instance())
+	}
+
+	if name == "" {
+		if len(engines) == 1 {
+			return engines[0], nil
+		}
+		return nil, fmt.Errorf("multiple %s databases are enabled, select one by name (available: %s)", r.Name, strings.Join(names, ", "))
+	}
+
+	return nil, fmt.Errorf("unknown %s database '%s' (available: %s)", r.Name, name, strings.Join(names, ", "))
+}
+
+var engineRegistry []EngineRegistration
+
+// RegisterEngine adds the engine to the registry (typically from the init func of the engine's file).
+// Engines are dumped in the order of their registration.
+func RegisterEngine(registration EngineRegistration) {
+	for _, r := range engineRegistry {
+		if r.Name == registration.Name {
+			log.Panicf("Engine '%s' is already registered.", registration.Name)
+		}
+	}
+
+	engineRegistry = append(engineRegistry, registration)
+}
+
+// RegisteredEngines returns all registered engines in the order of their registration.
+func RegisteredEngines() []EngineRegistration {
+	return append([]EngineRegistration(nil), engineRegistry...)
+}
+
+// EnabledEngines returns all engine instances enabled in the config.
+func EnabledEngines(config Config) []Engine {
+	var engines []Engine
+	for _, r := range engineRegistry {
+		engines = append(engines, r.EnabledInstances(config)...)
+	}
+	return engines
+}
+
+// ValidateEnabledEngines ensures the enabled engine instances have unique names (across all engines, the names are used
+// in the backup-ns.sh/<name>-* annotations) and don't dump into the same file.
+func ValidateEnabledEngines(config Config) error {
+	names := make(map[string]string)
+	dumpFiles := make(map[string]string)
+
+	for _, engine := range EnabledEngines(config) {
+		if other, ok := names[engine.Instance()]; ok {
+			return fmt.Errorf("the %s database name '%s' is already used by a %s database, set a unique name via BAK_DB_*_NAME", engine.Name(), engine.Instance(), other)
+		}
+		names[engine.Instance()] = engine.Name()
+
+		resource, container := engine.ExecTarget()
+		target := resource + "/" + container + ":" + engine.DumpFile()
+		if other, ok := dumpFiles[target]; ok {
+			return fmt.Errorf("the %s database '%s' and the database '%s' use the same dump file '%s' in %s (container %s), set a unique file via BAK_DB_*_DUMP_FILE", engine.Name(), engine.Instance(), other, engine.DumpFile(), resource, container)
+		}
+		dumpFiles[target] = engine.Instance()
+	}
+
+	return nil
+}
+
+// GetEngine returns the registered engine with the name (its base BAK_DB_<ENGINE> instance).
+func GetEngine(config Config, name string) (Engine, error) {
+	for _, r := range engineRegistry {
+		if r.Name == name {
+			return r.Instances(config)[0], nil
+		}
+	}
+
+	names := make([]string, 0, len(engineRegistry))
+	for _, r := range engineRegistry {
+		names = append(names, r.Name)
+	}
+	return nil, fmt.Errorf("unknown engine '%s' (available: %s)", name, strings.Join(names, ", "))
+}
+
+// EnabledEnvVars returns the BAK_DB_* env vars enabling the registered engines.
+func EnabledEnvVars() []string {
+	envVars := make([]string, 0, len(engineRegistry))
+	for _, r := range engineRegistry {
+		envVars = append(envVars, r.EnabledEnv)
+	}
+	return envVars
+}
+
+// getDumpInfo stats the dump file inside the container.
+func getDumpInfo(namespace string, engine Engine) (DumpInfo, error) {
+	resource, container := engine.ExecTarget()
+
+	modified, err := GetRemoteFileTimestamp(namespace, resource, container, engine.DumpFile())
+	if err != nil {
+		return DumpInfo{}, err
+	}
+
+	size, err := GetRemoteFileSize(namespace, resource, container, engine.DumpFile())
+	if err != nil {
+		return DumpInfo{}, err
+	}
+
+	return DumpInfo{Engine: engine.Name(), Name: engine.Instance(), DumpFile: engine.DumpFile(), Modified: modified, SizeBytes: size}, nil
+}
+
+// indexedDumpFile inserts "_<index>" before the extension of the dump file name (e.g. "/data/dump.sql.gz" becomes "/data/dump_1.sql.gz").
+func indexedDumpFile(dumpFile string, index int) string {
+	dir, file := filepath.Split(dumpFile)
+	name, ext, _ := strings.Cut(file, ".")
+	if ext != "" {
+		ext = "." + ext
+	}
+	return fmt.Sprintf("%s%s_%d%s", dir, name, index, ext)
+}
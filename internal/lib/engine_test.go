@@ -0,0 +1,197 @@
+package lib_test
+
+import (
+	"testing"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisteredEngines(t *testing.T) {
+	var names []string
+	for _, r := range lib.RegisteredEngines() {
+		names = append(names, r.Name)
+
+		instances := r.Instances(lib.Config{})
+		require.Len(t, instances, 1)
+
+		engine := instances[0]
+		require.Equal(t, r.Name, engine.Name())
+		require.False(t, engine.Enabled())
+		require.NotEmpty(t, r.EnabledEnv)
+		require.NotEmpty(t, r.DumpFileSuffix)
+	}
+
+	require.ElementsMatch(t, []string{"postgres", "mysql", "mongo", "redis"}, names)
+}
+
+func TestEnabledEngines(t *testing.T) {
+	config := lib.Config{}
+	require.Empty(t, lib.EnabledEngines(config))
+
+	config.Postgres = lib.PostgresConfig{Enabled: true, ExecResource: "deployment/app-base", ExecContainer: "postgres", DumpFile: "/var/lib/postgresql/data/dump.sql.gz"}
+	config.Redis = lib.RedisConfig{Enabled: true, ExecResource: "deployment/redis", ExecContainer: "redis", DumpFile: "/data/dump.rdb"}
+
+	engines := lib.EnabledEngines(config)
+	require.Len(t, engines, 2)
+
+	byName := make(map[string]lib.Engine)
+	for _, engine := range engines {
+		byName[engine.Name()] = engine
+	}
+
+	resource, container := byName["postgres"].ExecTarget()
+	require.Equal(t, "deployment/app-base", resource)
+	require.Equal(t, "postgres", container)
+	require.Equal(t, "/var/lib/postgresql/data/dump.sql.gz", byName["postgres"].DumpFile())
+
+	// redis loads its persistence files on startup, the volume snapshot is restored instead
+	require.Implements(t, (*lib.DumpRestorer)(nil), byName["postgres"])
+	_, ok := byName["redis"].(lib.DumpRestorer)
+	require.False(t, ok)
+}
+
+func TestGetEngine(t *testing.T) {
+	engine, err := lib.GetEngine(lib.Config{}, "mysql")
+	require.NoError(t, err)
+	require.Equal(t, "mysql", engine.Name())
+
+	_, err = lib.GetEngine(lib.Config{}, "oracle")
+	require.ErrorContains(t, err, "unknown engine 'oracle'")
+}
+
+func TestLoadConfigIndexedEngines(t *testing.T) {
+	t.Setenv("BAK_DB_POSTGRES", "true")
+	t.Setenv("BAK_DB_POSTGRES_1_EXEC_RESOURCE", "deployment/reporting")
+	t.Setenv("BAK_DB_POSTGRES_2_NAME", "analytics")
+	t.Setenv("BAK_DB_POSTGRES_2_DUMP_FILE", "/data/analytics.sql.gz")
+	t.Setenv("BAK_DB_MYSQL_1", "false")
+
+	config := lib.LoadConfig()
+	require.Len(t, config.AdditionalPostgres, 2)
+
+	first := config.AdditionalPostgres[0]
+	require.True(t, first.Enabled)
+	require.Equal(t, "postgres-1", first.Name)
+	require.Equal(t, "deployment/reporting", first.ExecResource)
+	require.Equal(t, config.Postgres.ExecContainer, first.ExecContainer)
+	require.Equal(t, "/var/lib/postgresql/data/dump_1.sql.gz", first.DumpFile)
+
+	second := config.AdditionalPostgres[1]
+	require.Equal(t, "analytics", second.Name)
+	require.Equal(t, config.Postgres.ExecResource, second.ExecResource)
+	require.Equal(t, "/data/analytics.sql.gz", second.DumpFile)
+
+	require.Len(t, config.AdditionalMySQL, 1)
+	require.False(t, config.AdditionalMySQL[0].Enabled)
+
+	var names []string
+	for _, engine := range lib.EnabledEngines(config) {
+		names = append(names, engine.Instance())
+	}
+	require.Equal(t, []string{"postgres", "postgres-1", "analytics"}, names)
+	require.NoError(t, lib.ValidateEnabledEngines(config))
+}
+
+func TestValidateEnabledEngines(t *testing.T) {
+	t.Setenv("BAK_DB_POSTGRES", "true")
+	t.Setenv("BAK_DB_MYSQL", "true")
+	t.Setenv("BAK_DB_POSTGRES_0_NAME", "ignored")
+	t.Setenv("BAK_DB_POSTGRES_1_NAME", "mysql")
+
+	config := lib.LoadConfig()
+	require.Len(t, config.AdditionalPostgres, 1)
+	require.ErrorContains(t, lib.ValidateEnabledEngines(config), "the postgres database name 'mysql' is already used by a mysql database")
+
+	t.Setenv("BAK_DB_POSTGRES_1_NAME", "reporting")
+	t.Setenv("BAK_DB_POSTGRES_1_DUMP_FILE", "/var/lib/postgresql/data/dump.sql.gz")
+
+	config = lib.LoadConfig()
+	require.ErrorContains(t, lib.ValidateEnabledEngines(config), "the postgres database 'reporting' and the database 'postgres' use the same dump file")
+
+	t.Setenv("BAK_DB_POSTGRES_1_EXEC_RESOURCE", "deployment/reporting")
+
+	config = lib.LoadConfig()
+	require.NoError(t, lib.ValidateEnabledEngines(config))
+}
+
+func TestLoadConfigPostgresDumpFormat(t *testing.T) {
+	t.Setenv("BAK_DB_POSTGRES_DUMP_FORMAT", "custom")
+	t.Setenv("BAK_DB_POSTGRES_1_DUMP_FORMAT", "directory")
+	t.Setenv("BAK_DB_POSTGRES_1_JOBS", "8")
+	t.Setenv("BAK_DB_POSTGRES_2_DUMP_FILE", "/data/analytics.backup")
+
+	config := lib.LoadConfig()
+	require.Equal(t, "custom", config.Postgres.DumpFormat)
+	require.Equal(t, 4, config.Postgres.Jobs)
+	require.Equal(t, "/var/lib/postgresql/data/dump.pgdump", config.Postgres.DumpFile)
+
+	require.Len(t, config.AdditionalPostgres, 2)
+	require.Equal(t, "directory", config.AdditionalPostgres[0].DumpFormat)
+	require.Equal(t, 8, config.AdditionalPostgres[0].Jobs)
+	require.Equal(t, "/var/lib/postgresql/data/dump_1.dir", config.AdditionalPostgres[0].DumpFile)
+
+	require.Equal(t, "custom", config.AdditionalPostgres[1].DumpFormat)
+	require.Equal(t, "/data/analytics.backup", config.AdditionalPostgres[1].DumpFile)
+
+	var engine lib.Engine
+	for _, e := range lib.EnabledEngines(config) {
+		if e.Instance() == "postgres-1" {
+			engine = e
+		}
+	}
+	require.NotNil(t, engine)
+	formatter, ok := engine.(lib.DumpFormatter)
+	require.True(t, ok)
+	require.True(t, formatter.DumpIsDirectory())
+	require.Equal(t, ".tar", formatter.DumpFileSuffix())
+}
+
+func TestLoadConfigPostgresAllDatabases(t *testing.T) {
+	t.Setenv("BAK_DB_POSTGRES_ALL_DATABASES", "true")
+	t.Setenv("BAK_DB_POSTGRES_1_ALL_DATABASES", "false")
+
+	config := lib.LoadConfig()
+	require.True(t, config.Postgres.AllDatabases)
+	require.Equal(t, "/var/lib/postgresql/data/dump.all", config.Postgres.DumpFile)
+
+	require.Len(t, config.AdditionalPostgres, 1)
+	require.False(t, config.AdditionalPostgres[0].AllDatabases)
+	require.Equal(t, "/var/lib/postgresql/data/dump_1.sql.gz", config.AdditionalPostgres[0].DumpFile)
+
+	engine, err := lib.GetEngine(config, "postgres")
+	require.NoError(t, err)
+	formatter, ok := engine.(lib.DumpFormatter)
+	require.True(t, ok)
+	require.True(t, formatter.DumpIsDirectory())
+	require.Equal(t, ".tar", formatter.DumpFileSuffix())
+}
+
+func TestSelectInstance(t *testing.T) {
+	var postgres lib.EngineRegistration
+	for _, r := range lib.RegisteredEngines() {
+		if r.Name == "postgres" {
+			postgres = r
+		}
+	}
+
+	config := lib.Config{}
+	_, err := postgres.SelectInstance(config, "")
+	require.ErrorContains(t, err, "BAK_DB_POSTGRES=true must be set")
+
+	config.Postgres = lib.PostgresConfig{Enabled: true, Name: "postgres"}
+	engine, err := postgres.SelectInstance(config, "")
+	require.NoError(t, err)
+	require.Equal(t, "postgres", engine.Instance())
+
+	config.AdditionalPostgres = []lib.PostgresConfig{{Enabled: true, Name: "postgres-1"}, {Enabled: false, Name: "postgres-2"}}
+	_, err = postgres.SelectInstance(config, "")
+	require.ErrorContains(t, err, "multiple postgres databases are enabled")
+
+	engine, err = postgres.SelectInstance(config, "postgres-1")
+	require.NoError(t, err)
+	require.Equal(t, "postgres-1", engine.Instance())
+
+	_, err = postgres.SelectInstance(config, "postgres-2")
+	require.ErrorContains(t, err, "unknown postgres database 'postgres-2' (available: postgres, postgres-1)")
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"math/big"
 	"os"
 	"os/exec"
@@ -54,7 +55,7 @@ func (f *Flock) WithRetryInterval(retryInterval time.Duration) *Flock {
 
 func (f *Flock) Lock(dryRun bool) (func() error, error) {
 	if dryRun {
-		log.Println("Skipping flock - dry run mode is active")
+		slog.Info("Skipping flock - dry run mode is active")
 		return noop, nil
 	}
 
@@ -72,7 +73,7 @@ func (f *Flock) Lock(dryRun bool) (func() error, error) {
 	for {
 		err := syscall.Flock(int(lockFd.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
 		if err == nil {
-			log.Printf("Got lock on %q", f.path)
+			slog.Info("Got lock", "lock_file", f.path)
 
 			return func() error {
 				if err := syscall.Flock(int(lockFd.Fd()), syscall.LOCK_UN); err != nil {
@@ -82,7 +83,7 @@ func (f *Flock) Lock(dryRun bool) (func() error, error) {
 					return fmt.Errorf("failed to close lock file: %w", err)
 				}
 
-				log.Printf("Released lock from %q", f.path)
+				slog.Info("Released lock", "lock_file", f.path)
 				return nil
 			}, nil
 		}
@@ -103,12 +104,12 @@ func GetDefaultFlockCount() int {
 	cmd := exec.Command("nproc", "--all")
 	output, err := cmd.Output()
 	if err != nil {
-		log.Printf("Error getting nproc: %v", err)
+		slog.Warn("Error getting nproc", "error", err)
 		return 2
 	}
 	nproc, err := strconv.Atoi(strings.TrimSpace(string(output)))
 	if err != nil {
-		log.Printf("Error parsing nproc: %v", err)
+		slog.Warn("Error parsing nproc", "error", err)
 		return 2
 	}
 	if nproc < 2 {
@@ -1,23 +1,27 @@
+//go:build kind
+
 package lib_test
 
 import (
 	"fmt"
 	"log"
-	"os/exec"
 	"strings"
 	"sync"
 
 	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
 )
 
-// Immediately error out if kubectl is currently not in the context of our kind test k8s cluster
+// Immediately error out if the current kubeconfig context is not our kind test k8s cluster
 // We do no want to accidentally run tests against a production Kubernetes cluster (the one you might have configured on your host)
 //
 // $ kubectl config current-context
 // # kind-backup-ns
+//
+// These integration tests are only built with the "kind" build tag (make test or go test -tags kind ./...).
 func init() {
-	if context, _ := exec.Command("kubectl", "config", "current-context").Output(); !strings.Contains(string(context), "kind-backup-ns") {
-		log.Fatalf("kubectl is not currently running within the context of the kind test k8s cluster named 'kind-backup-ns', exit now!")
+	if context, _ := k8s.CurrentContext(); !strings.Contains(context, "kind-backup-ns") {
+		log.Fatalf("kubeconfig is not currently set within the context of the kind test k8s cluster named 'kind-backup-ns', exit now!")
 	}
 
 	cleanupTestVolumeSnapshots()
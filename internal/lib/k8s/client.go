@@ -0,0 +1,185 @@
+// Package k8s is the typed Kubernetes API layer of backup-ns.
+// All interactions with the cluster (VolumeSnapshots, VolumeSnapshotContents, PVCs, pod exec and copy) go through the
+// Client interface, the default implementation is based on client-go (typed and dynamic clients), so no kubectl binary
+// is required in PATH.
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	VolumeSnapshotGVR        = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+	VolumeSnapshotContentGVR = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshotcontents"}
+
+	VolumeGroupSnapshotGVR        = schema.GroupVersionResource{Group: "groupsnapshot.storage.k8s.io", Version: "v1alpha1", Resource: "volumegroupsnapshots"}
+	VolumeGroupSnapshotContentGVR = schema.GroupVersionResource{Group: "groupsnapshot.storage.k8s.io", Version: "v1alpha1", Resource: "volumegroupsnapshotcontents"}
+)
+
+var (
+	ErrNoPodFound         = errors.New("no running pod found")
+	ErrLeaderElectionLost = errors.New("leader election lost")
+)
+
+// ExecOptions configures a command execution within a container of a pod.
+type ExecOptions struct {
+	Namespace string
+	Pod       string
+	Container string
+	Command   []string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// TTY allocates a terminal, Stderr is ignored then (merged into Stdout by the container runtime)
+	TTY bool
+
+	// TerminalSizeQueue is optional and only used with TTY
+	TerminalSizeQueue TerminalSizeQueue
+}
+
+// TerminalSizeQueue yields the terminal size, Next blocks until a new size is available (returns nil when done).
+type TerminalSizeQueue interface {
+	Next() *TerminalSize
+}
+
+type TerminalSize struct {
+	Width  uint16
+	Height uint16
+}
+
+// Client is the subset of the Kubernetes API that backup-ns uses.
+// VolumeSnapshot and VolumeSnapshotContent objects are handled as unstructured objects (no CRD client dependency).
+// Patches are JSON merge patches (RFC 7386).
+// Errors are the typed client-go errors (see IsNotFound), wrapped with additional context.
+type Client interface {
+	// namespace "" lists across all namespaces
+	ListVolumeSnapshots(ctx context.Context, namespace, labelSelector string) ([]unstructured.Unstructured, error)
+	// WatchVolumeSnapshots starts at the current state (all existing objects are delivered as ADDED events first)
+	WatchVolumeSnapshots(ctx context.Context, namespace, labelSelector string) (watch.Interface, error)
+	GetVolumeSnapshot(ctx context.Context, namespace, name string) (*unstructured.Unstructured, error)
+	CreateVolumeSnapshot(ctx context.Context, vs *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	PatchVolumeSnapshot(ctx context.Context, namespace, name string, patch []byte) (*unstructured.Unstructured, error)
+	DeleteVolumeSnapshot(ctx context.Context, namespace, name string) error
+
+	GetVolumeSnapshotContent(ctx context.Context, name string) (*unstructured.Unstructured, error)
+	CreateVolumeSnapshotContent(ctx context.Context, vsc *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	PatchVolumeSnapshotContent(ctx context.Context, name string, patch []byte) (*unstructured.Unstructured, error)
+	DeleteVolumeSnapshotContent(ctx context.Context, name string) error
+
+	// VolumeGroupSnapshots snapshot all PVCs matching a label selector at once, the snapshot controller creates a member
+	// VolumeSnapshot per PVC (referenced in .status.pvcVolumeSnapshotRefList)
+	GetVolumeGroupSnapshot(ctx context.Context, namespace, name string) (*unstructured.Unstructured, error)
+	CreateVolumeGroupSnapshot(ctx context.Context, vgs *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	DeleteVolumeGroupSnapshot(ctx context.Context, namespace, name string) error
+
+	GetVolumeGroupSnapshotContent(ctx context.Context, name string) (*unstructured.Unstructured, error)
+	PatchVolumeGroupSnapshotContent(ctx context.Context, name string, patch []byte) (*unstructured.Unstructured, error)
+
+	GetPersistentVolumeClaim(ctx context.Context, namespace, name string) (*corev1.PersistentVolumeClaim, error)
+	CreatePersistentVolumeClaim(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error)
+	DeletePersistentVolumeClaim(ctx context.Context, namespace, name string) error
+	ListPersistentVolumeClaims(ctx context.Context, namespace, labelSelector string) ([]corev1.PersistentVolumeClaim, error)
+
+	GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error)
+
+	GetConfigMap(ctx context.Context, namespace, name string) (*corev1.ConfigMap, error)
+	CreateConfigMap(ctx context.Context, cm *corev1.ConfigMap) (*corev1.ConfigMap, error)
+	// UpdateConfigMap fails with a conflict if the resourceVersion of cm is outdated
+	UpdateConfigMap(ctx context.Context, cm *corev1.ConfigMap) (*corev1.ConfigMap, error)
+
+	// GetResource returns an arbitrary namespaced resource in the format kind/name (e.g. deployment/app-base)
+	GetResource(ctx context.Context, namespace, resource string) (*unstructured.Unstructured, error)
+	ListPods(ctx context.Context, namespace, labelSelector string) ([]corev1.Pod, error)
+	GetPod(ctx context.Context, namespace, name string) (*corev1.Pod, error)
+	CreatePod(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error)
+	DeletePod(ctx context.Context, namespace, name string) error
+
+	Exec(ctx context.Context, opts ExecOptions) error
+	// CopyFromPod streams the file at srcPath within the container to dst
+	CopyFromPod(ctx context.Context, namespace, pod, container, srcPath string, dst io.Writer) error
+
+	// LeaderElect blocks until ctx is done or the leadership is lost (ErrLeaderElectionLost), run is called with a
+	// context that is canceled as soon as we are no longer the leader.
+	LeaderElect(ctx context.Context, opts LeaderElectionOptions, run func(ctx context.Context)) error
+}
+
+// LeaderElectionOptions configures the coordination.k8s.io Lease used for leader election.
+type LeaderElectionOptions struct {
+	LeaseNamespace string
+	LeaseName      string
+	// Identity must be unique per participant (e.g. the pod name)
+	Identity string
+
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// IsNotFound returns true if the (wrapped) error was caused by a non existing object.
+func IsNotFound(err error) bool {
+	return apierrors.IsNotFound(err)
+}
+
+var (
+	defaultClient    Client
+	defaultClientErr error
+	defaultClientMu  sync.Mutex
+)
+
+// Default returns the process wide Client. It is lazily initialized from the in-cluster config or the current
+// kubeconfig context (respecting KUBECONFIG) on first use.
+func Default() (Client, error) {
+	defaultClientMu.Lock()
+	defer defaultClientMu.Unlock()
+
+	if defaultClient == nil && defaultClientErr == nil {
+		defaultClient, defaultClientErr = NewFromKubeconfig()
+	}
+
+	return defaultClient, defaultClientErr
+}
+
+// SetDefault replaces the process wide Client (e.g. with a fake in tests), nil resets it to the lazily initialized one.
+func SetDefault(c Client) {
+	defaultClientMu.Lock()
+	defer defaultClientMu.Unlock()
+
+	defaultClient = c
+	defaultClientErr = nil
+}
+
+func clientConfig() clientcmd.ClientConfig {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+}
+
+// CurrentNamespace returns the namespace of the current kubeconfig context (or the in-cluster namespace).
+func CurrentNamespace() (string, error) {
+	namespace, _, err := clientConfig().Namespace()
+	if err != nil {
+		return "", fmt.Errorf("error getting current namespace: %w", err)
+	}
+	return namespace, nil
+}
+
+// CurrentContext returns the name of the current kubeconfig context.
+func CurrentContext() (string, error) {
+	rawConfig, err := clientConfig().RawConfig()
+	if err != nil {
+		return "", fmt.Errorf("error getting current context: %w", err)
+	}
+	return rawConfig.CurrentContext, nil
+}
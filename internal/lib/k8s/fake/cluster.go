@@ -0,0 +1,821 @@
+// Package fake provides an in-memory k8s.Client that simulates the parts of the snapshot API backup-ns relies on:
+// VolumeSnapshots bind to (dynamically or pre-provisioned) VolumeSnapshotContents, become readyToUse immediately or once
+// marked ready (see ManualReady) and deleting a VolumeSnapshot honors the deletionPolicy of its bound content.
+// VolumeGroupSnapshots create a member VolumeSnapshot per PVC matching their selector.
+//
+// Install it for all of internal/lib via k8s.SetDefault(fake.NewCluster()).
+package fake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	DeletionPolicyRetain = "Retain"
+	DeletionPolicyDelete = "Delete"
+
+	// Driver is the csi driver name used for dynamically provisioned VolumeSnapshotContents.
+	Driver = "fake.csi.backup-ns.sh"
+)
+
+var (
+	pvcGR    = schema.GroupResource{Resource: "persistentvolumeclaims"}
+	secretGR = schema.GroupResource{Resource: "secrets"}
+	cmGR     = schema.GroupResource{Resource: "configmaps"}
+	podGR    = schema.GroupResource{Resource: "pods"}
+)
+
+// ExecFunc handles a command execution within a pod (see Cluster.Exec).
+type ExecFunc func(ctx context.Context, opts k8s.ExecOptions) error
+
+// Cluster is an in-memory k8s.Client. All fields may be set before first use, it is safe for concurrent use afterwards.
+type Cluster struct {
+	// Now is the clock used for creationTimestamps (defaults to time.Now).
+	Now func() time.Time
+
+	// ManualReady keeps new VolumeSnapshots at readyToUse=false until MarkReady is called.
+	// false means they are ready immediately after creation.
+	ManualReady bool
+
+	// VolumeSnapshotClasses maps a VolumeSnapshotClass (or VolumeGroupSnapshotClass) name to its deletionPolicy.
+	// Unknown classes use DefaultDeletionPolicy.
+	VolumeSnapshotClasses map[string]string
+	DefaultDeletionPolicy string
+
+	// ExecFunc is called for Exec and CopyFromPod (as "cat <srcPath>"), Exec fails if unset.
+	ExecFunc ExecFunc
+
+	mu        sync.Mutex
+	vss       map[string]*unstructured.Unstructured
+	vscs      map[string]*unstructured.Unstructured
+	vgss      map[string]*unstructured.Unstructured
+	vgscs     map[string]*unstructured.Unstructured
+	pvcs      map[string]*corev1.PersistentVolumeClaim
+	pods      map[string]*corev1.Pod
+	secrets   map[string]*corev1.Secret
+	cms       map[string]*corev1.ConfigMap
+	resources map[string]*unstructured.Unstructured
+
+	// snapshot handles that exist on the simulated storage system
+	handles map[string]bool
+
+	watchers []*watcher
+	leader   string
+}
+
+var _ k8s.Client = &Cluster{}
+
+// NewCluster returns an empty Cluster with a Retain default deletionPolicy.
+func NewCluster() *Cluster {
+	return &Cluster{
+		Now:                   time.Now,
+		VolumeSnapshotClasses: map[string]string{},
+		DefaultDeletionPolicy: DeletionPolicyRetain,
+		vss:                   map[string]*unstructured.Unstructured{},
+		vscs:                  map[string]*unstructured.Unstructured{},
+		vgss:                  map[string]*unstructured.Unstructured{},
+		vgscs:                 map[string]*unstructured.Unstructured{},
+		pvcs:                  map[string]*corev1.PersistentVolumeClaim{},
+		pods:                  map[string]*corev1.Pod{},
+		secrets:               map[string]*corev1.Secret{},
+		cms:                   map[string]*corev1.ConfigMap{},
+		resources:             map[string]*unstructured.Unstructured{},
+		handles:               map[string]bool{},
+	}
+}
+
+func key(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func (c *Cluster) now() metav1.Time {
+	if c.Now == nil {
+		return metav1.Now()
+	}
+	return metav1.NewTime(c.Now().UTC().Truncate(time.Second))
+}
+
+// AddPersistentVolumeClaim stores the pvc, it is reported as Bound.
+func (c *Cluster) AddPersistentVolumeClaim(pvc *corev1.PersistentVolumeClaim) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pvc = pvc.DeepCopy()
+	pvc.Status.Phase = corev1.ClaimBound
+	c.pvcs[key(pvc.Namespace, pvc.Name)] = pvc
+}
+
+// AddPod stores the pod (make sure to set .status.phase=Running to make it eligible for exec).
+func (c *Cluster) AddPod(pod *corev1.Pod) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pods[key(pod.Namespace, pod.Name)] = pod.DeepCopy()
+}
+
+// AddSecret stores the secret.
+func (c *Cluster) AddSecret(secret *corev1.Secret) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.secrets[key(secret.Namespace, secret.Name)] = secret.DeepCopy()
+}
+
+// AddResource stores an arbitrary namespaced object (e.g. a Deployment) that is returned by GetResource.
+func (c *Cluster) AddResource(obj *unstructured.Unstructured) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.resources[strings.ToLower(obj.GetKind())+"/"+key(obj.GetNamespace(), obj.GetName())] = obj.DeepCopy()
+}
+
+// SnapshotHandles returns the sorted handles of all snapshots that still exist on the simulated storage system.
+func (c *Cluster) SnapshotHandles() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	handles := make([]string, 0, len(c.handles))
+	for h := range c.handles {
+		handles = append(handles, h)
+	}
+	slices.Sort(handles)
+	return handles
+}
+
+// VolumeSnapshotContentNames returns the sorted names of all VolumeSnapshotContents.
+func (c *Cluster) VolumeSnapshotContentNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.vscs))
+	for name := range c.vscs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (c *Cluster) ListVolumeSnapshots(_ context.Context, namespace, labelSelector string) ([]unstructured.Unstructured, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid label selector '%s': %v", labelSelector, err))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	items := []unstructured.Unstructured{}
+	for _, vs := range c.vss {
+		if namespace != "" && vs.GetNamespace() != namespace {
+			continue
+		}
+		if !selector.Matches(labels.Set(vs.GetLabels())) {
+			continue
+		}
+		items = append(items, *vs.DeepCopy())
+	}
+
+	slices.SortFunc(items, func(a, b unstructured.Unstructured) int {
+		return strings.Compare(key(a.GetNamespace(), a.GetName()), key(b.GetNamespace(), b.GetName()))
+	})
+
+	return items, nil
+}
+
+func (c *Cluster) GetVolumeSnapshot(_ context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vs, ok := c.vss[key(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(k8s.VolumeSnapshotGVR.GroupResource(), name)
+	}
+
+	return vs.DeepCopy(), nil
+}
+
+// MarkReady simulates the snapshot controller finishing the VolumeSnapshot (see ManualReady), it and its bound
+// VolumeSnapshotContent report readyToUse=true afterwards.
+func (c *Cluster) MarkReady(namespace, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vs, ok := c.vss[key(namespace, name)]
+	if !ok {
+		return apierrors.NewNotFound(k8s.VolumeSnapshotGVR.GroupResource(), name)
+	}
+
+	old := vs.DeepCopy()
+	c.setReady(vs)
+	c.notify(watch.Modified, vs, old)
+
+	return nil
+}
+
+func (c *Cluster) setReady(vs *unstructured.Unstructured) {
+	_ = unstructured.SetNestedField(vs.Object, true, "status", "readyToUse")
+
+	vscName, _, _ := unstructured.NestedString(vs.Object, "status", "boundVolumeSnapshotContentName")
+	if vsc, ok := c.vscs[vscName]; ok {
+		_ = unstructured.SetNestedField(vsc.Object, true, "status", "readyToUse")
+	}
+}
+
+func (c *Cluster) CreateVolumeSnapshot(_ context.Context, vs *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.createVolumeSnapshot(vs)
+}
+
+func (c *Cluster) createVolumeSnapshot(vs *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	vs = vs.DeepCopy()
+	k := key(vs.GetNamespace(), vs.GetName())
+	if _, ok := c.vss[k]; ok {
+		return nil, apierrors.NewAlreadyExists(k8s.VolumeSnapshotGVR.GroupResource(), vs.GetName())
+	}
+
+	now := c.now()
+	vs.SetUID(types.UID(uuid.New().String()))
+	vs.SetCreationTimestamp(now)
+
+	status := map[string]interface{}{
+		"readyToUse":   false,
+		"creationTime": now.Format(time.RFC3339),
+	}
+
+	if vscName, ok, _ := unstructured.NestedString(vs.Object, "spec", "source", "volumeSnapshotContentName"); ok {
+		// pre-provisioned: bind to the existing content
+		vsc, ok := c.vscs[vscName]
+		if !ok {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("VolumeSnapshotContent '%s' not found", vscName))
+		}
+
+		refName, _, _ := unstructured.NestedString(vsc.Object, "spec", "volumeSnapshotRef", "name")
+		refNamespace, _, _ := unstructured.NestedString(vsc.Object, "spec", "volumeSnapshotRef", "namespace")
+		if refName != vs.GetName() || refNamespace != vs.GetNamespace() {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("VolumeSnapshotContent '%s' references %s/%s", vscName, refNamespace, refName))
+		}
+
+		_ = unstructured.SetNestedField(vsc.Object, string(vs.GetUID()), "spec", "volumeSnapshotRef", "uid")
+		status["boundVolumeSnapshotContentName"] = vscName
+		// like the real api, the vsc status reports bytes and unix nanoseconds
+		if restoreSize, ok, _ := unstructured.NestedInt64(vsc.Object, "status", "restoreSize"); ok {
+			status["restoreSize"] = resource.NewQuantity(restoreSize, resource.BinarySI).String()
+		}
+		if creationTime, ok, _ := unstructured.NestedInt64(vsc.Object, "status", "creationTime"); ok {
+			status["creationTime"] = time.Unix(0, creationTime).UTC().Format(time.RFC3339)
+		}
+	} else {
+		pvcName, ok, _ := unstructured.NestedString(vs.Object, "spec", "source", "persistentVolumeClaimName")
+		if !ok {
+			return nil, apierrors.NewBadRequest("spec.source must either set persistentVolumeClaimName or volumeSnapshotContentName")
+		}
+
+		pvc, ok := c.pvcs[key(vs.GetNamespace(), pvcName)]
+		if !ok {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("PersistentVolumeClaim '%s' not found", pvcName))
+		}
+
+		restoreSize := resource.MustParse("1Gi")
+		if size, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			restoreSize = size
+		}
+
+		vscName := "snapcontent-" + string(vs.GetUID())
+		handle := "snapshot-" + string(vs.GetUID())
+		className, _, _ := unstructured.NestedString(vs.Object, "spec", "volumeSnapshotClassName")
+
+		c.vscs[vscName] = &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshotContent",
+			"metadata": map[string]interface{}{
+				"name":              vscName,
+				"uid":               uuid.New().String(),
+				"creationTimestamp": now.Format(time.RFC3339),
+			},
+			"spec": map[string]interface{}{
+				"deletionPolicy":          c.deletionPolicy(className),
+				"driver":                  Driver,
+				"volumeSnapshotClassName": className,
+				"source": map[string]interface{}{
+					"volumeHandle": "pvc-" + string(pvc.UID),
+				},
+				"volumeSnapshotRef": map[string]interface{}{
+					"name":      vs.GetName(),
+					"namespace": vs.GetNamespace(),
+					"uid":       string(vs.GetUID()),
+				},
+			},
+			"status": map[string]interface{}{
+				"readyToUse":     false,
+				"snapshotHandle": handle,
+				"restoreSize":    restoreSize.Value(),
+				"creationTime":   now.UnixNano(),
+			},
+		}}
+		c.handles[handle] = true
+
+		status["boundVolumeSnapshotContentName"] = vscName
+		status["restoreSize"] = restoreSize.String()
+	}
+
+	vs.Object["status"] = status
+	c.vss[k] = vs
+
+	if !c.ManualReady {
+		c.setReady(vs)
+	}
+
+	c.notify(watch.Added, vs, nil)
+
+	return vs.DeepCopy(), nil
+}
+
+func (c *Cluster) deletionPolicy(className string) string {
+	if policy, ok := c.VolumeSnapshotClasses[className]; ok {
+		return policy
+	}
+	if c.DefaultDeletionPolicy != "" {
+		return c.DefaultDeletionPolicy
+	}
+	return DeletionPolicyRetain
+}
+
+func (c *Cluster) PatchVolumeSnapshot(_ context.Context, namespace, name string, patch []byte) (*unstructured.Unstructured, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vs, ok := c.vss[key(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(k8s.VolumeSnapshotGVR.GroupResource(), name)
+	}
+
+	old := vs.DeepCopy()
+	if err := mergePatch(vs, patch); err != nil {
+		return nil, err
+	}
+
+	c.notify(watch.Modified, vs, old)
+	return vs.DeepCopy(), nil
+}
+
+// DeleteVolumeSnapshot removes the VolumeSnapshot, its bound VolumeSnapshotContent (and the snapshot on the storage
+// system) is only removed with the Delete deletionPolicy.
+func (c *Cluster) DeleteVolumeSnapshot(_ context.Context, namespace, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key(namespace, name)
+	vs, ok := c.vss[k]
+	if !ok {
+		return apierrors.NewNotFound(k8s.VolumeSnapshotGVR.GroupResource(), name)
+	}
+
+	// like the snapshot controller, members of a group can only be deleted with their VolumeGroupSnapshot
+	for _, ref := range vs.GetOwnerReferences() {
+		if ref.Kind == "VolumeGroupSnapshot" {
+			return apierrors.NewBadRequest(fmt.Sprintf("VolumeSnapshot '%s' is a member of VolumeGroupSnapshot '%s'", name, ref.Name))
+		}
+	}
+
+	c.deleteVolumeSnapshot(k, vs)
+	return nil
+}
+
+// deleteVolumeSnapshot removes the VolumeSnapshot and with the Delete deletionPolicy its bound content.
+func (c *Cluster) deleteVolumeSnapshot(k string, vs *unstructured.Unstructured) {
+	delete(c.vss, k)
+	c.notify(watch.Deleted, vs, nil)
+
+	vscName, _, _ := unstructured.NestedString(vs.Object, "status", "boundVolumeSnapshotContentName")
+	vsc, ok := c.vscs[vscName]
+	if !ok {
+		return
+	}
+
+	if policy, _, _ := unstructured.NestedString(vsc.Object, "spec", "deletionPolicy"); policy == DeletionPolicyDelete {
+		c.deleteVolumeSnapshotContent(vscName)
+	}
+}
+
+func (c *Cluster) GetVolumeSnapshotContent(_ context.Context, name string) (*unstructured.Unstructured, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vsc, ok := c.vscs[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(k8s.VolumeSnapshotContentGVR.GroupResource(), name)
+	}
+
+	return vsc.DeepCopy(), nil
+}
+
+// CreateVolumeSnapshotContent stores a pre-provisioned content, spec.source.snapshotHandle must reference an existing
+// snapshot on the simulated storage system.
+func (c *Cluster) CreateVolumeSnapshotContent(_ context.Context, vsc *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vsc = vsc.DeepCopy()
+	if _, ok := c.vscs[vsc.GetName()]; ok {
+		return nil, apierrors.NewAlreadyExists(k8s.VolumeSnapshotContentGVR.GroupResource(), vsc.GetName())
+	}
+
+	handle, ok, _ := unstructured.NestedString(vsc.Object, "spec", "source", "snapshotHandle")
+	if !ok || !c.handles[handle] {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("snapshot handle '%s' does not exist", handle))
+	}
+
+	now := c.now()
+	vsc.SetUID(types.UID(uuid.New().String()))
+	vsc.SetCreationTimestamp(now)
+
+	// the original creationTime and restoreSize of the snapshot is reported by the csi driver again
+	status := map[string]interface{}{
+		"readyToUse":     true,
+		"snapshotHandle": handle,
+		"creationTime":   now.UnixNano(),
+	}
+	for _, other := range c.vscs {
+		if otherHandle, _, _ := unstructured.NestedString(other.Object, "status", "snapshotHandle"); otherHandle == handle {
+			if creationTime, ok, _ := unstructured.NestedInt64(other.Object, "status", "creationTime"); ok {
+				status["creationTime"] = creationTime
+			}
+			if restoreSize, ok, _ := unstructured.NestedInt64(other.Object, "status", "restoreSize"); ok {
+				status["restoreSize"] = restoreSize
+			}
+			break
+		}
+	}
+	vsc.Object["status"] = status
+
+	c.vscs[vsc.GetName()] = vsc
+	return vsc.DeepCopy(), nil
+}
+
+func (c *Cluster) PatchVolumeSnapshotContent(_ context.Context, name string, patch []byte) (*unstructured.Unstructured, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vsc, ok := c.vscs[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(k8s.VolumeSnapshotContentGVR.GroupResource(), name)
+	}
+
+	if err := mergePatch(vsc, patch); err != nil {
+		return nil, err
+	}
+
+	return vsc.DeepCopy(), nil
+}
+
+func (c *Cluster) DeleteVolumeSnapshotContent(_ context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.vscs[name]; !ok {
+		return apierrors.NewNotFound(k8s.VolumeSnapshotContentGVR.GroupResource(), name)
+	}
+
+	c.deleteVolumeSnapshotContent(name)
+	return nil
+}
+
+// deleteVolumeSnapshotContent removes the content and with the Delete deletionPolicy the snapshot on the storage
+// system (unless still referenced by another content).
+func (c *Cluster) deleteVolumeSnapshotContent(name string) {
+	vsc := c.vscs[name]
+	delete(c.vscs, name)
+
+	if policy, _, _ := unstructured.NestedString(vsc.Object, "spec", "deletionPolicy"); policy != DeletionPolicyDelete {
+		return
+	}
+
+	handle, _, _ := unstructured.NestedString(vsc.Object, "status", "snapshotHandle")
+	for _, other := range c.vscs {
+		if otherHandle, _, _ := unstructured.NestedString(other.Object, "status", "snapshotHandle"); otherHandle == handle {
+			return
+		}
+	}
+	delete(c.handles, handle)
+}
+
+func (c *Cluster) GetPersistentVolumeClaim(_ context.Context, namespace, name string) (*corev1.PersistentVolumeClaim, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pvc, ok := c.pvcs[key(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(pvcGR, name)
+	}
+
+	return pvc.DeepCopy(), nil
+}
+
+// CreatePersistentVolumeClaim stores the pvc as Bound, a VolumeSnapshot dataSource must exist and be ready.
+func (c *Cluster) CreatePersistentVolumeClaim(_ context.Context, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pvc = pvc.DeepCopy()
+	k := key(pvc.Namespace, pvc.Name)
+	if _, ok := c.pvcs[k]; ok {
+		return nil, apierrors.NewAlreadyExists(pvcGR, pvc.Name)
+	}
+
+	if ds := pvc.Spec.DataSource; ds != nil && ds.Kind == "VolumeSnapshot" {
+		vs, ok := c.vss[key(pvc.Namespace, ds.Name)]
+		if !ok {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("VolumeSnapshot '%s' not found", ds.Name))
+		}
+		if ready, _, _ := unstructured.NestedBool(vs.Object, "status", "readyToUse"); !ready {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("VolumeSnapshot '%s' is not ready to use", ds.Name))
+		}
+	}
+
+	if _, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; !ok {
+		if pvc.Spec.Resources.Requests == nil {
+			pvc.Spec.Resources.Requests = corev1.ResourceList{}
+		}
+		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = resource.MustParse("1Gi")
+	}
+
+	pvc.UID = types.UID(uuid.New().String())
+	pvc.CreationTimestamp = c.now()
+	pvc.Spec.VolumeName = "pvc-" + string(pvc.UID)
+	pvc.Status.Phase = corev1.ClaimBound
+
+	c.pvcs[k] = pvc
+	return pvc.DeepCopy(), nil
+}
+
+func (c *Cluster) DeletePersistentVolumeClaim(_ context.Context, namespace, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key(namespace, name)
+	if _, ok := c.pvcs[k]; !ok {
+		return apierrors.NewNotFound(pvcGR, name)
+	}
+
+	delete(c.pvcs, k)
+	return nil
+}
+
+// ListPersistentVolumeClaims returns the matching pvcs sorted by name.
+func (c *Cluster) ListPersistentVolumeClaims(_ context.Context, namespace, labelSelector string) ([]corev1.PersistentVolumeClaim, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid label selector '%s': %v", labelSelector, err))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pvcs := []corev1.PersistentVolumeClaim{}
+	for _, pvc := range c.pvcs {
+		if pvc.Namespace == namespace && selector.Matches(labels.Set(pvc.Labels)) {
+			pvcs = append(pvcs, *pvc.DeepCopy())
+		}
+	}
+
+	slices.SortFunc(pvcs, func(a, b corev1.PersistentVolumeClaim) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return pvcs, nil
+}
+
+func (c *Cluster) GetSecret(_ context.Context, namespace, name string) (*corev1.Secret, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	secret, ok := c.secrets[key(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(secretGR, name)
+	}
+
+	return secret.DeepCopy(), nil
+}
+
+func (c *Cluster) GetConfigMap(_ context.Context, namespace, name string) (*corev1.ConfigMap, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cm, ok := c.cms[key(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(cmGR, name)
+	}
+
+	return cm.DeepCopy(), nil
+}
+
+func (c *Cluster) CreateConfigMap(_ context.Context, cm *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cm = cm.DeepCopy()
+	k := key(cm.Namespace, cm.Name)
+	if _, ok := c.cms[k]; ok {
+		return nil, apierrors.NewAlreadyExists(cmGR, cm.Name)
+	}
+
+	cm.UID = types.UID(uuid.New().String())
+	cm.CreationTimestamp = c.now()
+	cm.ResourceVersion = "1"
+
+	c.cms[k] = cm
+	return cm.DeepCopy(), nil
+}
+
+// UpdateConfigMap replaces the ConfigMap if its resourceVersion is the current one (optimistic concurrency).
+func (c *Cluster) UpdateConfigMap(_ context.Context, cm *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key(cm.Namespace, cm.Name)
+	current, ok := c.cms[k]
+	if !ok {
+		return nil, apierrors.NewNotFound(cmGR, cm.Name)
+	}
+	if cm.ResourceVersion != current.ResourceVersion {
+		return nil, apierrors.NewConflict(cmGR, cm.Name, fmt.Errorf("resourceVersion %s is outdated", cm.ResourceVersion))
+	}
+
+	version, _ := strconv.Atoi(current.ResourceVersion)
+
+	cm = cm.DeepCopy()
+	cm.ResourceVersion = strconv.Itoa(version + 1)
+
+	c.cms[k] = cm
+	return cm.DeepCopy(), nil
+}
+
+func (c *Cluster) GetResource(_ context.Context, namespace, res string) (*unstructured.Unstructured, error) {
+	kind, name, ok := strings.Cut(res, "/")
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid resource format, expected kind/name, got: %s", res))
+	}
+	kind = strings.ToLower(kind)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch kind {
+	case "persistentvolumeclaim", "persistentvolumeclaims", "pvc":
+		pvc, ok := c.pvcs[key(namespace, name)]
+		if !ok {
+			return nil, apierrors.NewNotFound(pvcGR, name)
+		}
+		return toUnstructured(pvc, "PersistentVolumeClaim")
+	case "pod", "pods", "po":
+		pod, ok := c.pods[key(namespace, name)]
+		if !ok {
+			return nil, apierrors.NewNotFound(podGR, name)
+		}
+		return toUnstructured(pod, "Pod")
+	}
+
+	for k, obj := range c.resources {
+		objKind := strings.ToLower(obj.GetKind())
+		if (kind == objKind || kind == objKind+"s") && k == objKind+"/"+key(namespace, name) {
+			return obj.DeepCopy(), nil
+		}
+	}
+
+	return nil, apierrors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+}
+
+func (c *Cluster) ListPods(_ context.Context, namespace, labelSelector string) ([]corev1.Pod, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid label selector '%s': %v", labelSelector, err))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pods := []corev1.Pod{}
+	for _, pod := range c.pods {
+		if pod.Namespace == namespace && selector.Matches(labels.Set(pod.Labels)) {
+			pods = append(pods, *pod.DeepCopy())
+		}
+	}
+
+	return pods, nil
+}
+
+func (c *Cluster) GetPod(_ context.Context, namespace, name string) (*corev1.Pod, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pod, ok := c.pods[key(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(podGR, name)
+	}
+
+	return pod.DeepCopy(), nil
+}
+
+// CreatePod stores the pod as Running (scheduled and started immediately).
+func (c *Cluster) CreatePod(_ context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pod = pod.DeepCopy()
+	k := key(pod.Namespace, pod.Name)
+	if _, ok := c.pods[k]; ok {
+		return nil, apierrors.NewAlreadyExists(podGR, pod.Name)
+	}
+
+	pod.UID = types.UID(uuid.New().String())
+	pod.CreationTimestamp = c.now()
+	pod.Status.Phase = corev1.PodRunning
+
+	c.pods[k] = pod
+	return pod.DeepCopy(), nil
+}
+
+func (c *Cluster) DeletePod(_ context.Context, namespace, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key(namespace, name)
+	if _, ok := c.pods[k]; !ok {
+		return apierrors.NewNotFound(podGR, name)
+	}
+
+	delete(c.pods, k)
+	return nil
+}
+
+func (c *Cluster) Exec(ctx context.Context, opts k8s.ExecOptions) error {
+	c.mu.Lock()
+	_, ok := c.pods[key(opts.Namespace, opts.Pod)]
+	execFunc := c.ExecFunc
+	c.mu.Unlock()
+
+	if !ok {
+		return apierrors.NewNotFound(podGR, opts.Pod)
+	}
+	if execFunc == nil {
+		return fmt.Errorf("exec of %v in pod %s/%s is not supported by the fake cluster", opts.Command, opts.Namespace, opts.Pod)
+	}
+
+	return execFunc(ctx, opts)
+}
+
+func (c *Cluster) CopyFromPod(ctx context.Context, namespace, pod, container, srcPath string, dst io.Writer) error {
+	var stderr bytes.Buffer
+
+	if err := c.Exec(ctx, k8s.ExecOptions{
+		Namespace: namespace,
+		Pod:       pod,
+		Container: container,
+		Command:   []string{"cat", srcPath},
+		Stdout:    dst,
+		Stderr:    &stderr,
+	}); err != nil {
+		return fmt.Errorf("failed to copy '%s' from pod %s/%s: %w (stderr: %s)", srcPath, namespace, pod, err, stderr.String())
+	}
+
+	return nil
+}
+
+func toUnstructured(obj interface{}, kind string) (*unstructured.Unstructured, error) {
+	objJSON, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if err := json.Unmarshal(objJSON, &u.Object); err != nil {
+		return nil, err
+	}
+	u.SetAPIVersion("v1")
+	u.SetKind(kind)
+
+	return u, nil
+}
@@ -0,0 +1,260 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func (c *Cluster) GetVolumeGroupSnapshot(_ context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vgs, ok := c.vgss[key(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(k8s.VolumeGroupSnapshotGVR.GroupResource(), name)
+	}
+
+	c.readVolumeGroupSnapshot(vgs)
+	return vgs.DeepCopy(), nil
+}
+
+// readVolumeGroupSnapshot checks all members, the group becomes readyToUse once all of them are ready.
+func (c *Cluster) readVolumeGroupSnapshot(vgs *unstructured.Unstructured) {
+	refs, _, _ := unstructured.NestedSlice(vgs.Object, "status", "pvcVolumeSnapshotRefList")
+	if len(refs) == 0 {
+		return
+	}
+
+	ready := true
+	for _, ref := range refs {
+		vsName, _, _ := unstructured.NestedString(ref.(map[string]interface{}), "volumeSnapshotRef", "name")
+		vs, ok := c.vss[key(vgs.GetNamespace(), vsName)]
+		if !ok {
+			ready = false
+			continue
+		}
+
+		if vsReady, _, _ := unstructured.NestedBool(vs.Object, "status", "readyToUse"); !vsReady {
+			ready = false
+		}
+	}
+
+	_ = unstructured.SetNestedField(vgs.Object, ready, "status", "readyToUse")
+
+	vgscName, _, _ := unstructured.NestedString(vgs.Object, "status", "boundVolumeGroupSnapshotContentName")
+	if vgsc, ok := c.vgscs[vgscName]; ok {
+		_ = unstructured.SetNestedField(vgsc.Object, ready, "status", "readyToUse")
+	}
+}
+
+// CreateVolumeGroupSnapshot creates a dynamically provisioned member VolumeSnapshot (owned by the group) per PVC
+// matching spec.source.selector. The group reports an error (and never becomes ready) if no PVC matches.
+func (c *Cluster) CreateVolumeGroupSnapshot(_ context.Context, vgs *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vgs = vgs.DeepCopy()
+	k := key(vgs.GetNamespace(), vgs.GetName())
+	if _, ok := c.vgss[k]; ok {
+		return nil, apierrors.NewAlreadyExists(k8s.VolumeGroupSnapshotGVR.GroupResource(), vgs.GetName())
+	}
+
+	selectorObj, ok, _ := unstructured.NestedMap(vgs.Object, "spec", "source", "selector")
+	if !ok {
+		return nil, apierrors.NewBadRequest("spec.source.selector must be set (pre-provisioned groups are not supported by the fake cluster)")
+	}
+
+	var labelSelector metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selectorObj, &labelSelector); err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid spec.source.selector: %v", err))
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid spec.source.selector: %v", err))
+	}
+
+	now := c.now()
+	vgs.SetUID(types.UID(uuid.New().String()))
+	vgs.SetCreationTimestamp(now)
+
+	status := map[string]interface{}{
+		"readyToUse":   false,
+		"creationTime": now.Format(time.RFC3339),
+	}
+	vgs.Object["status"] = status
+
+	var pvcs []*corev1.PersistentVolumeClaim
+	for _, pvc := range c.pvcs {
+		if pvc.Namespace == vgs.GetNamespace() && selector.Matches(labels.Set(pvc.Labels)) {
+			pvcs = append(pvcs, pvc)
+		}
+	}
+	slices.SortFunc(pvcs, func(a, b *corev1.PersistentVolumeClaim) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	if len(pvcs) == 0 {
+		status["error"] = map[string]interface{}{
+			"message": fmt.Sprintf("no PersistentVolumeClaims match the selector '%s'", selector.String()),
+			"time":    now.Format(time.RFC3339),
+		}
+		c.vgss[k] = vgs
+		return vgs.DeepCopy(), nil
+	}
+
+	className, _, _ := unstructured.NestedString(vgs.Object, "spec", "volumeGroupSnapshotClassName")
+	policy := c.deletionPolicy(className)
+
+	refs := make([]interface{}, 0, len(pvcs))
+	for _, pvc := range pvcs {
+		vs := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshot",
+			"metadata": map[string]interface{}{
+				"name":      "snapshot-" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+				"namespace": vgs.GetNamespace(),
+			},
+			"spec": map[string]interface{}{
+				"volumeSnapshotClassName": className,
+				"source": map[string]interface{}{
+					"persistentVolumeClaimName": pvc.Name,
+				},
+			},
+		}}
+		vs.SetOwnerReferences([]metav1.OwnerReference{{
+			APIVersion: k8s.VolumeGroupSnapshotGVR.GroupVersion().String(),
+			Kind:       "VolumeGroupSnapshot",
+			Name:       vgs.GetName(),
+			UID:        vgs.GetUID(),
+		}})
+
+		created, err := c.createVolumeSnapshot(vs)
+		if err != nil {
+			return nil, err
+		}
+
+		refs = append(refs, map[string]interface{}{
+			"persistentVolumeClaimRef": map[string]interface{}{"name": pvc.Name},
+			"volumeSnapshotRef":        map[string]interface{}{"name": created.GetName()},
+		})
+	}
+
+	vgscName := "groupsnapcontent-" + string(vgs.GetUID())
+	c.vgscs[vgscName] = &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": k8s.VolumeGroupSnapshotContentGVR.GroupVersion().String(),
+		"kind":       "VolumeGroupSnapshotContent",
+		"metadata": map[string]interface{}{
+			"name":              vgscName,
+			"uid":               uuid.New().String(),
+			"creationTimestamp": now.Format(time.RFC3339),
+		},
+		"spec": map[string]interface{}{
+			"deletionPolicy":               policy,
+			"driver":                       Driver,
+			"volumeGroupSnapshotClassName": className,
+			"volumeGroupSnapshotRef": map[string]interface{}{
+				"name":      vgs.GetName(),
+				"namespace": vgs.GetNamespace(),
+				"uid":       string(vgs.GetUID()),
+			},
+		},
+		"status": map[string]interface{}{
+			"readyToUse":                false,
+			"volumeGroupSnapshotHandle": "group-snapshot-" + string(vgs.GetUID()),
+		},
+	}}
+
+	status["boundVolumeGroupSnapshotContentName"] = vgscName
+	status["pvcVolumeSnapshotRefList"] = refs
+	c.vgss[k] = vgs
+
+	c.readVolumeGroupSnapshot(vgs)
+
+	return vgs.DeepCopy(), nil
+}
+
+// DeleteVolumeGroupSnapshot removes the group and its member VolumeSnapshots, the bound contents (and the snapshots on
+// the storage system) are only removed with the Delete deletionPolicy.
+func (c *Cluster) DeleteVolumeGroupSnapshot(_ context.Context, namespace, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key(namespace, name)
+	vgs, ok := c.vgss[k]
+	if !ok {
+		return apierrors.NewNotFound(k8s.VolumeGroupSnapshotGVR.GroupResource(), name)
+	}
+
+	delete(c.vgss, k)
+
+	refs, _, _ := unstructured.NestedSlice(vgs.Object, "status", "pvcVolumeSnapshotRefList")
+	for _, ref := range refs {
+		vsName, _, _ := unstructured.NestedString(ref.(map[string]interface{}), "volumeSnapshotRef", "name")
+		if vs, ok := c.vss[key(namespace, vsName)]; ok {
+			c.deleteVolumeSnapshot(key(namespace, vsName), vs)
+		}
+	}
+
+	vgscName, _, _ := unstructured.NestedString(vgs.Object, "status", "boundVolumeGroupSnapshotContentName")
+	if vgsc, ok := c.vgscs[vgscName]; ok {
+		if policy, _, _ := unstructured.NestedString(vgsc.Object, "spec", "deletionPolicy"); policy == DeletionPolicyDelete {
+			delete(c.vgscs, vgscName)
+		}
+	}
+
+	return nil
+}
+
+func (c *Cluster) GetVolumeGroupSnapshotContent(_ context.Context, name string) (*unstructured.Unstructured, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vgsc, ok := c.vgscs[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(k8s.VolumeGroupSnapshotContentGVR.GroupResource(), name)
+	}
+
+	return vgsc.DeepCopy(), nil
+}
+
+func (c *Cluster) PatchVolumeGroupSnapshotContent(_ context.Context, name string, patch []byte) (*unstructured.Unstructured, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vgsc, ok := c.vgscs[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(k8s.VolumeGroupSnapshotContentGVR.GroupResource(), name)
+	}
+
+	if err := mergePatch(vgsc, patch); err != nil {
+		return nil, err
+	}
+
+	return vgsc.DeepCopy(), nil
+}
+
+// VolumeGroupSnapshotContentNames returns the sorted names of all VolumeGroupSnapshotContents.
+func (c *Cluster) VolumeGroupSnapshotContentNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.vgscs))
+	for name := range c.vgscs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
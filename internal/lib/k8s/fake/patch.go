@@ -0,0 +1,44 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// mergePatch applies the JSON merge patch (RFC 7386) to obj in place.
+func mergePatch(obj *unstructured.Unstructured, patch []byte) error {
+	var p map[string]interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("invalid merge patch: %v", err))
+	}
+
+	obj.Object = mergeMaps(obj.Object, p)
+	return nil
+}
+
+func mergeMaps(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = map[string]interface{}{}
+	}
+
+	for k, v := range patch {
+		if v == nil {
+			delete(target, k)
+			continue
+		}
+
+		patchMap, ok := v.(map[string]interface{})
+		if !ok {
+			target[k] = v
+			continue
+		}
+
+		targetMap, _ := target[k].(map[string]interface{})
+		target[k] = mergeMaps(targetMap, patchMap)
+	}
+
+	return target
+}
@@ -0,0 +1,154 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// the max number of undelivered events of a watcher, slower watchers are closed (like the api server does).
+const watchBufferSize = 1024
+
+type watcher struct {
+	cluster   *Cluster
+	namespace string
+	selector  labels.Selector
+
+	result chan watch.Event
+	once   sync.Once
+}
+
+func (w *watcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *watcher) Stop() {
+	w.cluster.mu.Lock()
+	defer w.cluster.mu.Unlock()
+
+	w.cluster.removeWatcher(w)
+}
+
+// close must be called with the cluster lock held.
+func (w *watcher) close() {
+	w.once.Do(func() { close(w.result) })
+}
+
+func (w *watcher) matches(vs *unstructured.Unstructured) bool {
+	if w.namespace != "" && vs.GetNamespace() != w.namespace {
+		return false
+	}
+	return w.selector.Matches(labels.Set(vs.GetLabels()))
+}
+
+// send must be called with the cluster lock held.
+func (w *watcher) send(event watch.Event) bool {
+	select {
+	case w.result <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Cluster) WatchVolumeSnapshots(ctx context.Context, namespace, labelSelector string) (watch.Interface, error) {
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid label selector '%s': %v", labelSelector, err))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &watcher{
+		cluster:   c,
+		namespace: namespace,
+		selector:  selector,
+		result:    make(chan watch.Event, watchBufferSize),
+	}
+
+	// start at the current state
+	for _, vs := range c.vss {
+		if w.matches(vs) && !w.send(watch.Event{Type: watch.Added, Object: vs.DeepCopy()}) {
+			w.close()
+			return nil, apierrors.NewTooManyRequests("too many objects to watch", 1)
+		}
+	}
+
+	c.watchers = append(c.watchers, w)
+
+	go func() {
+		<-ctx.Done()
+		w.Stop()
+	}()
+
+	return w, nil
+}
+
+// notify delivers the event to all matching watchers, must be called with the cluster lock held.
+// old is the object before a modification, so watchers whose selector no longer matches receive a DELETED event.
+func (c *Cluster) notify(eventType watch.EventType, vs, old *unstructured.Unstructured) {
+	for _, w := range slices.Clone(c.watchers) {
+		matchesNew := w.matches(vs)
+		matchesOld := old != nil && w.matches(old)
+
+		var event watch.Event
+		switch {
+		case eventType == watch.Modified && matchesNew && !matchesOld:
+			event = watch.Event{Type: watch.Added, Object: vs.DeepCopy()}
+		case eventType == watch.Modified && !matchesNew && matchesOld:
+			event = watch.Event{Type: watch.Deleted, Object: vs.DeepCopy()}
+		case matchesNew:
+			event = watch.Event{Type: eventType, Object: vs.DeepCopy()}
+		default:
+			continue
+		}
+
+		if !w.send(event) {
+			c.removeWatcher(w)
+		}
+	}
+}
+
+// removeWatcher must be called with the cluster lock held.
+func (c *Cluster) removeWatcher(w *watcher) {
+	c.watchers = slices.DeleteFunc(c.watchers, func(other *watcher) bool { return other == w })
+	w.close()
+}
+
+// LeaderElect immediately grants the leadership to the caller, unless another identity is currently the leader (then
+// it blocks until ctx is done).
+func (c *Cluster) LeaderElect(ctx context.Context, opts k8s.LeaderElectionOptions, run func(ctx context.Context)) error {
+	c.mu.Lock()
+	if c.leader != "" && c.leader != opts.Identity {
+		c.mu.Unlock()
+		<-ctx.Done()
+		return nil
+	}
+	c.leader = opts.Identity
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.leader = ""
+		c.mu.Unlock()
+	}()
+
+	run(ctx)
+	return nil
+}
+
+// Leader returns the identity currently holding the leadership ("" if none).
+func (c *Cluster) Leader() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.leader
+}
@@ -0,0 +1,40 @@
+package fake_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s/fake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderElect(t *testing.T) {
+	cluster := fake.NewCluster()
+
+	leaderCtx, stopLeader := context.WithCancel(context.Background())
+	leading := make(chan struct{})
+	leaderDone := make(chan error)
+
+	go func() {
+		leaderDone <- cluster.LeaderElect(leaderCtx, k8s.LeaderElectionOptions{Identity: "pod-a"}, func(ctx context.Context) {
+			close(leading)
+			<-ctx.Done()
+		})
+	}()
+
+	<-leading
+	require.Equal(t, "pod-a", cluster.Leader())
+
+	// a second participant never becomes active while pod-a holds the lease
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.NoError(t, cluster.LeaderElect(ctx, k8s.LeaderElectionOptions{Identity: "pod-b"}, func(_ context.Context) {
+		t.Error("pod-b must not become the leader")
+	}))
+
+	stopLeader()
+	require.NoError(t, <-leaderDone)
+	require.Empty(t, cluster.Leader())
+}
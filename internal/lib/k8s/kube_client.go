@@ -0,0 +1,440 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// KubeClient is the client-go based Client implementation.
+type KubeClient struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	mapper    meta.RESTMapper
+}
+
+var _ Client = (*KubeClient)(nil)
+
+// NewFromKubeconfig creates a new KubeClient from the in-cluster config or the current kubeconfig context.
+func NewFromKubeconfig() (*KubeClient, error) {
+	config, err := clientConfig().ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	return NewKubeClient(config)
+}
+
+// NewKubeClient creates a new KubeClient from the provided rest config.
+func NewKubeClient(config *rest.Config) (*KubeClient, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %w", err)
+	}
+
+	// supports kubectl like short names (e.g. deploy/app-base, pvc/data) for GetResource
+	cachedDiscoveryClient := memory.NewMemCacheClient(discoveryClient)
+	mapper := restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cachedDiscoveryClient), cachedDiscoveryClient, nil)
+
+	return &KubeClient{
+		config:    config,
+		clientset: clientset,
+		dynamic:   dynamicClient,
+		mapper:    mapper,
+	}, nil
+}
+
+// Clientset returns the underlying typed client-go clientset.
+func (c *KubeClient) Clientset() kubernetes.Interface {
+	return c.clientset
+}
+
+// Dynamic returns the underlying client-go dynamic client.
+func (c *KubeClient) Dynamic() dynamic.Interface {
+	return c.dynamic
+}
+
+func (c *KubeClient) ListVolumeSnapshots(ctx context.Context, namespace, labelSelector string) ([]unstructured.Unstructured, error) {
+	list, err := c.dynamic.Resource(VolumeSnapshotGVR).Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VolumeSnapshots (namespace='%s', labelSelector='%s'): %w", namespace, labelSelector, err)
+	}
+	return list.Items, nil
+}
+
+func (c *KubeClient) WatchVolumeSnapshots(ctx context.Context, namespace, labelSelector string) (watch.Interface, error) {
+	w, err := c.dynamic.Resource(VolumeSnapshotGVR).Namespace(namespace).Watch(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch VolumeSnapshots (namespace='%s', labelSelector='%s'): %w", namespace, labelSelector, err)
+	}
+	return w, nil
+}
+
+func (c *KubeClient) GetVolumeSnapshot(ctx context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+	vs, err := c.dynamic.Resource(VolumeSnapshotGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VolumeSnapshot '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return vs, nil
+}
+
+func (c *KubeClient) CreateVolumeSnapshot(ctx context.Context, vs *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	created, err := c.dynamic.Resource(VolumeSnapshotGVR).Namespace(vs.GetNamespace()).Create(ctx, vs, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VolumeSnapshot '%s' in namespace '%s': %w", vs.GetName(), vs.GetNamespace(), err)
+	}
+	return created, nil
+}
+
+func (c *KubeClient) PatchVolumeSnapshot(ctx context.Context, namespace, name string, patch []byte) (*unstructured.Unstructured, error) {
+	patched, err := c.dynamic.Resource(VolumeSnapshotGVR).Namespace(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch VolumeSnapshot '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return patched, nil
+}
+
+func (c *KubeClient) DeleteVolumeSnapshot(ctx context.Context, namespace, name string) error {
+	if err := c.dynamic.Resource(VolumeSnapshotGVR).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to delete VolumeSnapshot '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return nil
+}
+
+func (c *KubeClient) GetVolumeSnapshotContent(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	vsc, err := c.dynamic.Resource(VolumeSnapshotContentGVR).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VolumeSnapshotContent '%s': %w", name, err)
+	}
+	return vsc, nil
+}
+
+func (c *KubeClient) CreateVolumeSnapshotContent(ctx context.Context, vsc *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	created, err := c.dynamic.Resource(VolumeSnapshotContentGVR).Create(ctx, vsc, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VolumeSnapshotContent '%s': %w", vsc.GetName(), err)
+	}
+	return created, nil
+}
+
+func (c *KubeClient) PatchVolumeSnapshotContent(ctx context.Context, name string, patch []byte) (*unstructured.Unstructured, error) {
+	patched, err := c.dynamic.Resource(VolumeSnapshotContentGVR).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch VolumeSnapshotContent '%s': %w", name, err)
+	}
+	return patched, nil
+}
+
+func (c *KubeClient) DeleteVolumeSnapshotContent(ctx context.Context, name string) error {
+	if err := c.dynamic.Resource(VolumeSnapshotContentGVR).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to delete VolumeSnapshotContent '%s': %w", name, err)
+	}
+	return nil
+}
+
+func (c *KubeClient) GetVolumeGroupSnapshot(ctx context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+	vgs, err := c.dynamic.Resource(VolumeGroupSnapshotGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VolumeGroupSnapshot '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return vgs, nil
+}
+
+func (c *KubeClient) CreateVolumeGroupSnapshot(ctx context.Context, vgs *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	created, err := c.dynamic.Resource(VolumeGroupSnapshotGVR).Namespace(vgs.GetNamespace()).Create(ctx, vgs, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create VolumeGroupSnapshot '%s' in namespace '%s': %w", vgs.GetName(), vgs.GetNamespace(), err)
+	}
+	return created, nil
+}
+
+func (c *KubeClient) DeleteVolumeGroupSnapshot(ctx context.Context, namespace, name string) error {
+	if err := c.dynamic.Resource(VolumeGroupSnapshotGVR).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to delete VolumeGroupSnapshot '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return nil
+}
+
+func (c *KubeClient) GetVolumeGroupSnapshotContent(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	vgsc, err := c.dynamic.Resource(VolumeGroupSnapshotContentGVR).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VolumeGroupSnapshotContent '%s': %w", name, err)
+	}
+	return vgsc, nil
+}
+
+func (c *KubeClient) PatchVolumeGroupSnapshotContent(ctx context.Context, name string, patch []byte) (*unstructured.Unstructured, error) {
+	patched, err := c.dynamic.Resource(VolumeGroupSnapshotContentGVR).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch VolumeGroupSnapshotContent '%s': %w", name, err)
+	}
+	return patched, nil
+}
+
+func (c *KubeClient) GetPersistentVolumeClaim(ctx context.Context, namespace, name string) (*corev1.PersistentVolumeClaim, error) {
+	pvc, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PVC '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return pvc, nil
+}
+
+func (c *KubeClient) CreatePersistentVolumeClaim(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (*corev1.PersistentVolumeClaim, error) {
+	created, err := c.clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(ctx, pvc, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PVC '%s' in namespace '%s': %w", pvc.Name, pvc.Namespace, err)
+	}
+	return created, nil
+}
+
+func (c *KubeClient) DeletePersistentVolumeClaim(ctx context.Context, namespace, name string) error {
+	if err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to delete PVC '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return nil
+}
+
+func (c *KubeClient) ListPersistentVolumeClaims(ctx context.Context, namespace, labelSelector string) ([]corev1.PersistentVolumeClaim, error) {
+	list, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVCs (namespace='%s', labelSelector='%s'): %w", namespace, labelSelector, err)
+	}
+	return list.Items, nil
+}
+
+func (c *KubeClient) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Secret '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return secret, nil
+}
+
+func (c *KubeClient) GetConfigMap(ctx context.Context, namespace, name string) (*corev1.ConfigMap, error) {
+	cm, err := c.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ConfigMap '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return cm, nil
+}
+
+func (c *KubeClient) CreateConfigMap(ctx context.Context, cm *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	created, err := c.clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ConfigMap '%s' in namespace '%s': %w", cm.Name, cm.Namespace, err)
+	}
+	return created, nil
+}
+
+func (c *KubeClient) UpdateConfigMap(ctx context.Context, cm *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	updated, err := c.clientset.CoreV1().ConfigMaps(cm.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update ConfigMap '%s' in namespace '%s': %w", cm.Name, cm.Namespace, err)
+	}
+	return updated, nil
+}
+
+func (c *KubeClient) GetResource(ctx context.Context, namespace, resource string) (*unstructured.Unstructured, error) {
+	kind, name, ok := strings.Cut(resource, "/")
+	if !ok || kind == "" || name == "" {
+		return nil, fmt.Errorf("invalid resource format, expected kind/name, got: %s", resource)
+	}
+
+	gvr, err := c.mapper.ResourceFor(schema.ParseGroupResource(strings.ToLower(kind)).WithVersion(""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve resource kind '%s': %w", kind, err)
+	}
+
+	obj, err := c.dynamic.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource '%s' in namespace '%s': %w", resource, namespace, err)
+	}
+	return obj, nil
+}
+
+func (c *KubeClient) ListPods(ctx context.Context, namespace, labelSelector string) ([]corev1.Pod, error) {
+	list, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods (namespace='%s', labelSelector='%s'): %w", namespace, labelSelector, err)
+	}
+	return list.Items, nil
+}
+
+func (c *KubeClient) GetPod(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return pod, nil
+}
+
+func (c *KubeClient) CreatePod(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	created, err := c.clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pod '%s' in namespace '%s': %w", pod.Name, pod.Namespace, err)
+	}
+	return created, nil
+}
+
+func (c *KubeClient) DeletePod(ctx context.Context, namespace, name string) error {
+	if err := c.clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to delete pod '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return nil
+}
+
+func (c *KubeClient) Exec(ctx context.Context, opts ExecOptions) error {
+	req := c.clientset.CoreV1().RESTClient().
+		Post().
+		Resource("pods").
+		Namespace(opts.Namespace).
+		Name(opts.Pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: opts.Container,
+			Command:   opts.Command,
+			Stdin:     opts.Stdin != nil,
+			Stdout:    opts.Stdout != nil,
+			Stderr:    opts.Stderr != nil && !opts.TTY,
+			TTY:       opts.TTY,
+		}, scheme.ParameterCodec)
+
+	executor, err := newExecutor(c.config, req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create executor for pod '%s' in namespace '%s': %w", opts.Pod, opts.Namespace, err)
+	}
+
+	streamOpts := remotecommand.StreamOptions{
+		Stdin:  opts.Stdin,
+		Stdout: opts.Stdout,
+		Tty:    opts.TTY,
+	}
+
+	if !opts.TTY {
+		streamOpts.Stderr = opts.Stderr
+	}
+
+	if opts.TTY && opts.TerminalSizeQueue != nil {
+		streamOpts.TerminalSizeQueue = terminalSizeQueueAdapter{opts.TerminalSizeQueue}
+	}
+
+	if err := executor.StreamWithContext(ctx, streamOpts); err != nil {
+		return fmt.Errorf("failed to exec in container '%s' of pod '%s' in namespace '%s': %w", opts.Container, opts.Pod, opts.Namespace, err)
+	}
+
+	return nil
+}
+
+func (c *KubeClient) CopyFromPod(ctx context.Context, namespace, pod, container, srcPath string, dst io.Writer) error {
+	var stderr strings.Builder
+
+	if err := c.Exec(ctx, ExecOptions{
+		Namespace: namespace,
+		Pod:       pod,
+		Container: container,
+		Command:   []string{"cat", srcPath},
+		Stdout:    dst,
+		Stderr:    &stderr,
+	}); err != nil {
+		return fmt.Errorf("failed to copy '%s' from pod '%s': %w, stderr: %s", srcPath, pod, err, stderr.String())
+	}
+
+	return nil
+}
+
+// newExecutor prefers the websocket executor and falls back to SPDY for older api servers.
+func newExecutor(config *rest.Config, url *url.URL) (remotecommand.Executor, error) {
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(config, "POST", url)
+	if err != nil {
+		return nil, err
+	}
+
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(config, "GET", url.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, httpstream.IsUpgradeFailure)
+}
+
+type terminalSizeQueueAdapter struct {
+	queue TerminalSizeQueue
+}
+
+func (a terminalSizeQueueAdapter) Next() *remotecommand.TerminalSize {
+	size := a.queue.Next()
+	if size == nil {
+		return nil
+	}
+	return &remotecommand.TerminalSize{Width: size.Width, Height: size.Height}
+}
+
+func (c *KubeClient) LeaderElect(ctx context.Context, opts LeaderElectionOptions, run func(ctx context.Context)) error {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      opts.LeaseName,
+			Namespace: opts.LeaseNamespace,
+		},
+		Client: c.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: opts.Identity,
+		},
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   opts.LeaseDuration,
+		RenewDeadline:   opts.RenewDeadline,
+		RetryPeriod:     opts.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            opts.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: run,
+			OnStoppedLeading: func() {},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create leader elector for lease '%s' in namespace '%s': %w", opts.LeaseName, opts.LeaseNamespace, err)
+	}
+
+	// Run returns as soon as ctx is done or the leadership was lost
+	elector.Run(ctx)
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return fmt.Errorf("%w: lease '%s' in namespace '%s' (identity '%s')", ErrLeaderElectionLost, opts.LeaseName, opts.LeaseNamespace, opts.Identity)
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// The interval in which we poll the k8s API while waiting for objects to become ready/bound/deleted.
+var pollInterval = time.Second
+
+func getClient() (k8s.Client, error) {
+	client, err := k8s.Default()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize k8s client: %w", err)
+	}
+	return client, nil
+}
+
+// toUnstructured converts our generated manifests (which may contain typed values like map[string]string labels)
+// into a deep-copied unstructured object with canonical json types.
+func toUnstructured(obj map[string]interface{}) (*unstructured.Unstructured, error) {
+	objJSON, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal object: %w", err)
+	}
+
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(objJSON); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal object: %w", err)
+	}
+
+	return u, nil
+}
+
+// labelPatch returns a json merge patch that removes the labels with the del keys and sets the add labels.
+func labelPatch(del []string, add map[string]string) ([]byte, error) {
+	labels := make(map[string]interface{}, len(del)+len(add))
+	for _, k := range del {
+		labels[k] = nil
+	}
+	for k, v := range add {
+		labels[k] = v
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": labels,
+		},
+	})
+}
+
+// parseTimeout parses a go formatted duration spec (e.g. "15m", "25s"), 0 or empty is no timeout.
+func parseTimeout(timeout string) (time.Duration, error) {
+	if strings.TrimSpace(timeout) == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout '%s': %w", timeout, err)
+	}
+
+	return d, nil
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes (stdout and stderr of an exec are copied concurrently).
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/allaboutapps/backup-ns/internal/util"
+	"github.com/google/uuid"
+)
+
+// AnnotationRunID is the VolumeSnapshot annotation holding the RunID of the backup-ns run that created it.
+const AnnotationRunID = "backup-ns.sh/run-id"
+
+// RunID identifies all log records, notifications and the VolumeSnapshot of a single backup-ns invocation.
+// Taken from BAK_RUN_ID (e.g. to correlate with an outer job) or randomly generated once per process.
+var RunID = sync.OnceValue(func() string {
+	return util.GetEnv("BAK_RUN_ID", uuid.NewString())
+})
+
+type runIDKey struct{}
+
+// ContextWithNewRunID returns a copy of ctx carrying a newly generated run id, e.g. for a single cycle of the
+// long-running controller. Records logged with this ctx (slog.InfoContext, ...) carry it instead of RunID.
+func ContextWithNewRunID(ctx context.Context) context.Context {
+	return context.WithValue(ctx, runIDKey{}, uuid.NewString())
+}
+
+// RunIDFromContext returns the run id of ctx (see ContextWithNewRunID), RunID if it has none.
+func RunIDFromContext(ctx context.Context) string {
+	if runID, ok := ctx.Value(runIDKey{}).(string); ok {
+		return runID
+	}
+	return RunID()
+}
+
+// runIDHandler adds the "run_id" attribute (see RunIDFromContext) to every record.
+type runIDHandler struct {
+	slog.Handler
+}
+
+func (h runIDHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(slog.String("run_id", RunIDFromContext(ctx)))
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h runIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return runIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h runIDHandler) WithGroup(name string) slog.Handler {
+	return runIDHandler{h.Handler.WithGroup(name)}
+}
+
+// LoadLogFormat returns the BAK_LOG_FORMAT ("text" or "json").
+func LoadLogFormat() string {
+	return util.GetEnvEnum("BAK_LOG_FORMAT", "text", []string{"text", "json"})
+}
+
+// SetupLogging sets the default slog logger writing to stderr in the given format ("text" or "json"), every record
+// carries the "run_id" attribute (see RunIDFromContext). Remaining output of the log package (log.Fatal, log.Panic)
+// is logged with level ERROR.
+func SetupLogging(format string) {
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, nil)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, nil)
+	}
+
+	slog.SetDefault(slog.New(runIDHandler{handler}))
+	slog.SetLogLoggerLevel(slog.LevelError)
+}
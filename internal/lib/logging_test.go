@@ -0,0 +1,21 @@
+package lib_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunIDFromContext(t *testing.T) {
+	require.Equal(t, lib.RunID(), lib.RunIDFromContext(context.Background()))
+
+	ctx := lib.ContextWithNewRunID(context.Background())
+	runID := lib.RunIDFromContext(ctx)
+	require.NotEqual(t, lib.RunID(), runID)
+	require.Equal(t, runID, lib.RunIDFromContext(ctx))
+
+	// every cycle gets its own run id
+	require.NotEqual(t, runID, lib.RunIDFromContext(lib.ContextWithNewRunID(ctx)))
+}
@@ -0,0 +1,291 @@
+package lib
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrDumpManifestMismatch is returned if a dump file does not match the checksum or size recorded in its manifest.
+var ErrDumpManifestMismatch = errors.New("dump does not match its manifest")
+
+// DumpManifest describes a dump, it is stored as json next to the dump file (see ManifestFile) and in the
+// backup-ns.sh/<name>-manifest volume snapshot annotation (without the row counts).
+type DumpManifest struct {
+	Engine       string `json:"engine"`
+	Name         string `json:"name"`
+	DB           string `json:"db,omitempty"`
+	AllDatabases bool   `json:"allDatabases,omitempty"`
+	DumpFile     string `json:"dumpFile"`
+	Format       string `json:"format,omitempty"`
+	Compression  string `json:"compression,omitempty"`
+	Encryption   string `json:"encryption,omitempty"`
+
+	// The sha256 of the dump file, for directories the sha256 of the "sha256sum" listing of all files within
+	// (sorted by their "./<path>")
+	SHA256    string `json:"sha256"`
+	SizeBytes int64  `json:"sizeBytes"`
+
+	// The size of the dump stream before its compression and encryption (0 if the dump is compressed by the database cli)
+	UncompressedSizeBytes int64 `json:"uncompressedSizeBytes,omitempty"`
+
+	ServerVersion string    `json:"serverVersion,omitempty"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+
+	// The estimated rows per table (documents per collection, keys per redis database) at the time of the dump
+	RowCounts map[string]int64 `json:"rowCounts,omitempty"`
+}
+
+// ManifestFile is the path of the manifest of the dump file.
+func ManifestFile(dumpFile string) string {
+	return dumpFile + ".manifest.json"
+}
+
+// DumpManifestAnnotation is the volume snapshot annotation holding the DumpManifest (json) of the dump of the database.
+func DumpManifestAnnotation(name string) string {
+	return fmt.Sprintf("backup-ns.sh/%s-manifest", name)
+}
+
+// dumpStatsFile is the file the dump scripts record the server version, uncompressed size and row counts in
+// (tab separated lines, see ApplyStats), it is removed after the manifest was created.
+func dumpStatsFile(dumpFile string) string {
+	return dumpFile + ".stats"
+}
+
+// ApplyStats sets the server version, uncompressed size (summed up) and row counts recorded by the dump scripts
+// ("server_version\t<version>", "uncompressed_size\t<bytes>" and "rows\t<table>\t<count>" lines), other lines are ignored.
+func (m *DumpManifest) ApplyStats(stats string) {
+	for _, line := range strings.Split(stats, "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+
+		switch {
+		case fields[0] == "server_version" && len(fields) == 2:
+			m.ServerVersion = strings.TrimSpace(fields[1])
+		case fields[0] == "uncompressed_size" && len(fields) == 2:
+			if size, err := strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64); err == nil {
+				m.UncompressedSizeBytes += size
+			}
+		case fields[0] == "rows" && len(fields) == 3:
+			if rows, err := strconv.ParseInt(strings.TrimSpace(fields[2]), 10, 64); err == nil {
+				if m.RowCounts == nil {
+					m.RowCounts = map[string]int64{}
+				}
+				m.RowCounts[fields[1]] = rows
+			}
+		}
+	}
+}
+
+// Verify ensures the checksum and size match the manifest.
+func (m DumpManifest) Verify(sha256 string, sizeBytes int64) error {
+	if sha256 != m.SHA256 {
+		return fmt.Errorf("%w: sha256 is %s, expected %s (dump of %s)", ErrDumpManifestMismatch, sha256, m.SHA256, m.End.UTC().Format(time.RFC3339))
+	}
+	if sizeBytes != m.SizeBytes {
+		return fmt.Errorf("%w: size is %d bytes, expected %d bytes (dump of %s)", ErrDumpManifestMismatch, sizeBytes, m.SizeBytes, m.End.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// GetRemoteFileChecksum returns the sha256 of the file, for directories the sha256 of the sorted sha256sum listing of all files within.
+func GetRemoteFileChecksum(namespace, execResource, execContainer, absolutePathToFile string) (string, error) {
+	script := `if [ -d "$1" ]; then (cd "$1" && find . -type f -print0 | LC_ALL=C sort -z | xargs -0 -r sha256sum) | sha256sum; else sha256sum "$1"; fi | cut -d " " -f 1`
+
+	output, err := execInResource(namespace, execResource, execContainer, []string{"sh", "-c", script, "sh", absolutePathToFile}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get file checksum: %w (output: %s)", err, output)
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// recordDumpManifest completes the manifest of a successful dump with its checksum, size and the stats recorded by the dump
+// script, writes it next to the dump file and adds its annotation to the result.
+func recordDumpManifest(namespace, execResource, execContainer string, manifest DumpManifest, result *DumpResult) error {
+	var err error
+
+	manifest.SHA256, err = GetRemoteFileChecksum(namespace, execResource, execContainer, manifest.DumpFile)
+	if err != nil {
+		return err
+	}
+
+	manifest.SizeBytes, err = GetRemoteFileSize(namespace, execResource, execContainer, manifest.DumpFile)
+	if err != nil {
+		return err
+	}
+
+	stats, err := execInResource(namespace, execResource, execContainer, []string{"sh", "-c", `if [ -f "$1" ]; then cat "$1" && rm -f "$1"; fi`, "sh", dumpStatsFile(manifest.DumpFile)}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read the stats of the dump: %w (output: %s)", err, stats)
+	}
+	manifest.ApplyStats(stats)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	output, err := execInResource(namespace, execResource, execContainer, []string{"sh", "-c", `cat > "$1.tmp" && mv "$1.tmp" "$1"`, "sh", ManifestFile(manifest.DumpFile)}, bytes.NewReader(append(manifestJSON, '\n')))
+	if err != nil {
+		return fmt.Errorf("failed to write the dump manifest: %w (output: %s)", err, output)
+	}
+
+	// the row counts are only stored in the manifest file (annotations are limited in size)
+	annotationManifest := manifest
+	annotationManifest.RowCounts = nil
+	annotation, err := json.Marshal(annotationManifest)
+	if err != nil {
+		return err
+	}
+
+	if result.Annotations == nil {
+		result.Annotations = map[string]string{}
+	}
+	result.Annotations[DumpManifestAnnotation(manifest.Name)] = string(annotation)
+
+	slog.Info("Recorded dump manifest", "namespace", namespace, "name", manifest.Name, "manifest_file", ManifestFile(manifest.DumpFile),
+		"sha256", manifest.SHA256, "size_bytes", manifest.SizeBytes, "uncompressed_size_bytes", manifest.UncompressedSizeBytes,
+		"server_version", manifest.ServerVersion, "tables", len(manifest.RowCounts))
+
+	return nil
+}
+
+// ReadDumpManifest returns the manifest of the dump file inside the container, nil if there is none (e.g. dumps created
+// before manifests were introduced).
+func ReadDumpManifest(namespace, execResource, execContainer, dumpFile string) (*DumpManifest, error) {
+	output, err := execInResource(namespace, execResource, execContainer, []string{"sh", "-c", `if [ -f "$1" ]; then cat "$1"; fi`, "sh", ManifestFile(dumpFile)}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the dump manifest: %w (output: %s)", err, output)
+	}
+
+	if strings.TrimSpace(output) == "" {
+		return nil, nil
+	}
+
+	var manifest DumpManifest
+	if err := json.Unmarshal([]byte(output), &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse the dump manifest '%s': %w", ManifestFile(dumpFile), err)
+	}
+
+	return &manifest, nil
+}
+
+// VerifyDumpManifest compares the checksum and size of the current dump file of the engine with its manifest, the manifest
+// is nil if there is none.
+func VerifyDumpManifest(namespace string, engine Engine) (*DumpManifest, error) {
+	resource, container := engine.ExecTarget()
+	return verifyDumpManifest(namespace, resource, container, engine.DumpFile())
+}
+
+func verifyDumpManifest(namespace, execResource, execContainer, dumpFile string) (*DumpManifest, error) {
+	manifest, err := ReadDumpManifest(namespace, execResource, execContainer, dumpFile)
+	if err != nil || manifest == nil {
+		return manifest, err
+	}
+
+	checksum, err := GetRemoteFileChecksum(namespace, execResource, execContainer, dumpFile)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := GetRemoteFileSize(namespace, execResource, execContainer, dumpFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := manifest.Verify(checksum, size); err != nil {
+		return nil, fmt.Errorf("'%s': %w", dumpFile, err)
+	}
+
+	return manifest, nil
+}
+
+// verifyDumpBeforeRestore ensures the dump file matches its manifest, dumps without manifest are restored with a warning.
+func verifyDumpBeforeRestore(namespace, execResource, execContainer, dumpFile string) error {
+	manifest, err := verifyDumpManifest(namespace, execResource, execContainer, dumpFile)
+	if err != nil {
+		return err
+	}
+
+	if manifest == nil {
+		slog.Warn("No dump manifest found, the dump file cannot be verified", "namespace", namespace, "dump_file", dumpFile)
+		return nil
+	}
+
+	slog.Info("Verified dump file", "namespace", namespace, "dump_file", dumpFile, "sha256", manifest.SHA256, "dumped", manifest.End.UTC().Format(time.RFC3339), "server_version", manifest.ServerVersion)
+	return nil
+}
+
+// LocalDumpChecksum returns the sha256 and size of a downloaded dump file like GetRemoteFileChecksum and GetRemoteFileSize,
+// tarArchive is set for downloaded directory dumps (their files are checksummed instead of the archive).
+func LocalDumpChecksum(localPath string, tarArchive bool) (string, int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	if !tarArchive {
+		hash := sha256.New()
+		size, err := io.Copy(hash, f)
+		if err != nil {
+			return "", 0, err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), size, nil
+	}
+
+	var (
+		size    int64
+		listing = map[string]string{}
+	)
+
+	reader := tar.NewReader(f)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		hash := sha256.New()
+		n, err := io.Copy(hash, reader)
+		if err != nil {
+			return "", 0, err
+		}
+		size += n
+
+		name := "./" + strings.TrimPrefix(path.Clean(header.Name), "./")
+		listing[name] = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	names := make([]string, 0, len(listing))
+	for name := range listing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s  %s\n", listing[name], name)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
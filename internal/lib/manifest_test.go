@@ -0,0 +1,81 @@
+package lib_test
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpManifestApplyStats(t *testing.T) {
+	var manifest lib.DumpManifest
+	manifest.ApplyStats("server_version\t16.4 (Debian 16.4-1.pgdg120+1)\n" +
+		"uncompressed_size\t1024\n" +
+		"rows\tapp.public.users\t42\n" +
+		"uncompressed_size\t2048\n" +
+		"rows\tapp.public.orders\t0\r\n" +
+		"invalid\n" +
+		"rows\tapp.public.broken\tNULL\n")
+
+	require.Equal(t, "16.4 (Debian 16.4-1.pgdg120+1)", manifest.ServerVersion)
+	require.Equal(t, int64(3072), manifest.UncompressedSizeBytes)
+	require.Equal(t, map[string]int64{"app.public.users": 42, "app.public.orders": 0}, manifest.RowCounts)
+}
+
+func TestDumpManifestVerify(t *testing.T) {
+	manifest := lib.DumpManifest{SHA256: "abc", SizeBytes: 10, End: time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)}
+
+	require.NoError(t, manifest.Verify("abc", 10))
+	require.ErrorIs(t, manifest.Verify("def", 10), lib.ErrDumpManifestMismatch)
+	require.ErrorIs(t, manifest.Verify("abc", 11), lib.ErrDumpManifestMismatch)
+
+	require.Equal(t, "/data/dump.sql.gz.manifest.json", lib.ManifestFile("/data/dump.sql.gz"))
+	require.Equal(t, "backup-ns.sh/postgres-1-manifest", lib.DumpManifestAnnotation("postgres-1"))
+}
+
+func TestLocalDumpChecksum(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "dump.sql")
+	require.NoError(t, os.WriteFile(file, []byte("SELECT 1;\n"), 0o600))
+
+	checksum, size, err := lib.LocalDumpChecksum(file, false)
+	require.NoError(t, err)
+	require.Equal(t, "b4e0497804e46e0a0b0b8c31975b062152d551bac49c3c2e80932567b4085dcd", checksum)
+	require.Equal(t, int64(10), size)
+
+	// directory dumps are downloaded as "tar -C <dir> .", the checksum matches the one of the sorted sha256sum listing
+	// of the files within the directory (in the container)
+	writeTar := func(name string, files [][2]string) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		defer f.Close()
+
+		w := tar.NewWriter(f)
+		require.NoError(t, w.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755}))
+		for _, file := range files {
+			require.NoError(t, w.WriteHeader(&tar.Header{Name: file[0], Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(file[1]))}))
+			_, err := w.Write([]byte(file[1]))
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		return path
+	}
+
+	// (cd dir && find . -type f -print0 | LC_ALL=C sort -z | xargs -0 -r sha256sum) | sha256sum
+	expected := "34b272f0487b15eb9a1efeb3cf353fc7e3ab6ad2774825dad269bf4921a56522"
+
+	checksum, size, err = lib.LocalDumpChecksum(writeTar("a.tar", [][2]string{{"./toc.dat", "toc"}, {"./sub/1.dat.gz", "data1"}, {"./3.dat", "x"}}), true)
+	require.NoError(t, err)
+	require.Equal(t, expected, checksum)
+	require.Equal(t, int64(9), size)
+
+	checksum, _, err = lib.LocalDumpChecksum(writeTar("b.tar", [][2]string{{"3.dat", "x"}, {"sub/1.dat.gz", "data1"}, {"toc.dat", "toc"}}), true)
+	require.NoError(t, err)
+	require.Equal(t, expected, checksum)
+}
@@ -0,0 +1,218 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const namespace = "backup_ns"
+
+// Registry holds all backup-ns metrics (without the go runtime and process collectors, so pushed groups stay small).
+var Registry = prometheus.NewRegistry()
+
+// failedRunRegistry holds all metrics of Registry but LastSuccessTimestamp, it is pushed if SetSuccess was not called.
+var failedRunRegistry = prometheus.NewRegistry()
+
+// succeeded is set by SetSuccess.
+var succeeded atomic.Bool
+
+var (
+	LastSuccessfulSnapshotTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_snapshot_timestamp_seconds",
+		Help:      "Creation time of the newest ready VolumeSnapshot per namespace and pvc.",
+	}, []string{"namespace", "pvc"})
+
+	SnapshotReadyDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "snapshot_ready_duration_seconds",
+		Help:      "Time it took for the last created VolumeSnapshot to become readyToUse.",
+	}, []string{"namespace", "pvc"})
+
+	DumpDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dump_duration_seconds",
+		Help:      "Duration of the last database dump.",
+	}, []string{"namespace", "engine", "database"})
+
+	DumpSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dump_size_bytes",
+		Help:      "Size of the last database dump file.",
+	}, []string{"namespace", "engine", "database"})
+
+	FlockWaitDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "flock_wait_duration_seconds",
+		Help:      "Time waited for the flock lock before the last backup started.",
+	}, []string{"namespace"})
+
+	RetentionLabels = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "retention_labels",
+		Help:      "Number of VolumeSnapshots per namespace and pvc carrying the daily, weekly or monthly retention label after applying the retention policy.",
+	}, []string{"namespace", "pvc", "label"})
+
+	SweepDeletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sweep_deletions_total",
+		Help:      "Number of VolumeSnapshots handled by deleteAfterSweep by result (deleted, skipped, failed).",
+	}, []string{"namespace", "result"})
+
+	DrillSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "drill_success",
+		Help:      "1 if the last restore drill of a VolumeSnapshot of the namespace and pvc passed, 0 if it failed.",
+	}, []string{"namespace", "pvc"})
+
+	LastSuccessfulDrillTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_drill_timestamp_seconds",
+		Help:      "Time of the last passed restore drill of a VolumeSnapshot of the namespace and pvc.",
+	}, []string{"namespace", "pvc"})
+
+	DrillDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "drill_duration_seconds",
+		Help:      "Duration of the last restore drill of a VolumeSnapshot of the namespace and pvc.",
+	}, []string{"namespace", "pvc"})
+
+	Drills = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "drills_total",
+		Help:      "Number of restore drills per namespace by result (passed, failed, error).",
+	}, []string{"namespace", "result"})
+
+	// Pushed metric groups carry the command as grouping label.
+	LastSuccessTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Time of the last successful run of the one-shot command or of the controller run prune loop.",
+	})
+)
+
+func init() {
+	collectors := []prometheus.Collector{
+		LastSuccessfulSnapshotTimestamp,
+		SnapshotReadyDuration,
+		DumpDuration,
+		DumpSize,
+		FlockWaitDuration,
+		RetentionLabels,
+		SweepDeletions,
+		DrillSuccess,
+		LastSuccessfulDrillTimestamp,
+		DrillDuration,
+		Drills,
+	}
+
+	failedRunRegistry.MustRegister(collectors...)
+	Registry.MustRegister(append(collectors, LastSuccessTimestamp)...)
+}
+
+var (
+	lastSnapshotsMu sync.Mutex
+	lastSnapshots   = make(map[[2]string]time.Time)
+)
+
+// ObserveSuccessfulSnapshot sets the last successful snapshot timestamp of the namespace/pvc if t is newer than the
+// current one (events might be delivered out of order).
+func ObserveSuccessfulSnapshot(namespace, pvcName string, t time.Time) {
+	lastSnapshotsMu.Lock()
+	defer lastSnapshotsMu.Unlock()
+
+	key := [2]string{namespace, pvcName}
+	if last, ok := lastSnapshots[key]; ok && !t.After(last) {
+		return
+	}
+
+	lastSnapshots[key] = t
+	LastSuccessfulSnapshotTimestamp.WithLabelValues(namespace, pvcName).Set(float64(t.Unix()))
+}
+
+// ObserveDrill records a restore drill of a VolumeSnapshot of the namespace/pvc finished at t (result is passed, failed
+// or error).
+func ObserveDrill(namespace, pvcName, result string, duration time.Duration, t time.Time) {
+	Drills.WithLabelValues(namespace, result).Inc()
+	DrillDuration.WithLabelValues(namespace, pvcName).Set(duration.Seconds())
+
+	if result != "passed" {
+		DrillSuccess.WithLabelValues(namespace, pvcName).Set(0)
+		return
+	}
+
+	DrillSuccess.WithLabelValues(namespace, pvcName).Set(1)
+	LastSuccessfulDrillTimestamp.WithLabelValues(namespace, pvcName).Set(float64(t.Unix()))
+}
+
+// SetSuccess marks the command (or the controller run prune loop) as successfully finished now.
+func SetSuccess() {
+	LastSuccessTimestamp.SetToCurrentTime()
+	succeeded.Store(true)
+}
+
+// Serve exposes the metrics on addr at /metrics until ctx is done.
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Failed to shutdown metrics server", "error", err)
+		}
+	}()
+
+	slog.Info("Serving metrics...", "address", addr, "path", "/metrics")
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("metrics server failed: %w", err)
+	}
+
+	return nil
+}
+
+// Push adds all collected metrics to the Pushgateway at url (job and grouping labels identify the metric group).
+// Metrics with the same name within the group are replaced, all others are kept (e.g. the last successful
+// snapshot timestamp of a previous run is not dropped by a failing run). LastSuccessTimestamp is only pushed after
+// SetSuccess, so the metrics of a failed run keep the last success time of the group.
+func Push(url, job string, grouping map[string]string) error {
+	var gatherer prometheus.Gatherer = failedRunRegistry
+	if succeeded.Load() {
+		gatherer = Registry
+	}
+
+	pusher := push.New(url, job).Gatherer(gatherer)
+
+	// the order of the grouping labels within the url is random, the Pushgateway identifies the group by the label set
+	for name, value := range grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+
+	if err := pusher.Add(); err != nil {
+		return fmt.Errorf("failed to push metrics to '%s': %w", url, err)
+	}
+
+	slog.Info("Pushed metrics", "url", url, "job", job)
+	return nil
+}
@@ -0,0 +1,79 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveSuccessfulSnapshot(t *testing.T) {
+	t1 := time.Date(2025, 1, 2, 0, 17, 0, 0, time.UTC)
+	t0 := t1.Add(-24 * time.Hour)
+
+	metrics.ObserveSuccessfulSnapshot("app", "data", t1)
+	// older snapshots (e.g. delivered later by a watch) never decrease the timestamp
+	metrics.ObserveSuccessfulSnapshot("app", "data", t0)
+
+	require.InDelta(t, float64(t1.Unix()), testutil.ToFloat64(metrics.LastSuccessfulSnapshotTimestamp.WithLabelValues("app", "data")), 0)
+}
+
+func TestObserveDrill(t *testing.T) {
+	t1 := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	failed := testutil.ToFloat64(metrics.Drills.WithLabelValues("drill", "failed"))
+
+	metrics.ObserveDrill("drill", "data", "passed", 2*time.Minute, t1)
+	require.InDelta(t, 1, testutil.ToFloat64(metrics.DrillSuccess.WithLabelValues("drill", "data")), 0)
+	require.InDelta(t, 120, testutil.ToFloat64(metrics.DrillDuration.WithLabelValues("drill", "data")), 0)
+
+	// a failed drill keeps the time of the last passed one
+	metrics.ObserveDrill("drill", "data", "failed", time.Minute, t1.Add(24*time.Hour))
+	require.InDelta(t, 0, testutil.ToFloat64(metrics.DrillSuccess.WithLabelValues("drill", "data")), 0)
+	require.InDelta(t, float64(t1.Unix()), testutil.ToFloat64(metrics.LastSuccessfulDrillTimestamp.WithLabelValues("drill", "data")), 0)
+	require.InDelta(t, failed+1, testutil.ToFloat64(metrics.Drills.WithLabelValues("drill", "failed")), 0)
+}
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		method, path, body = r.Method, r.URL.Path, string(b)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	// a failed run does not reset the last success time of its group
+	require.NoError(t, metrics.Push(server.URL, "backup-ns", map[string]string{"command": "create", "instance": "app"}))
+	require.False(t, strings.Contains(body, "backup_ns_last_success_timestamp_seconds"))
+
+	metrics.SetSuccess()
+
+	require.NoError(t, metrics.Push(server.URL, "backup-ns", map[string]string{"command": "create", "instance": "app"}))
+
+	// POST only replaces the pushed metric names within the group
+	require.Equal(t, http.MethodPost, method)
+	require.True(t, strings.HasPrefix(path, "/metrics/job/backup-ns/"), path)
+	require.ElementsMatch(t, []string{"command/create", "instance/app"}, groupingPairs(strings.TrimPrefix(path, "/metrics/job/backup-ns/")))
+	require.True(t, strings.Contains(body, "backup_ns_last_success_timestamp_seconds"))
+
+	require.Error(t, metrics.Push(server.URL+"/invalid\x00", "backup-ns", nil))
+}
+
+// groupingPairs splits the "<label>/<value>/..." grouping key path into "<label>/<value>" pairs.
+func groupingPairs(path string) []string {
+	parts := strings.Split(path, "/")
+
+	pairs := make([]string, 0, len(parts)/2)
+	for i := 0; i+1 < len(parts); i += 2 {
+		pairs = append(pairs, parts[i]+"/"+parts[i+1])
+	}
+	return pairs
+}
@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+)
+
+func EnsureMongoAvailable(namespace string, config MongoConfig) error {
+	slog.Info("Checking if MongoDB is available...", "namespace", namespace, "name", config.Name)
+
+	if err := config.Encryption.Validate(); err != nil {
+		return err
+	}
+
+	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().MongoCheck, config)
+}
+
+func DumpMongo(namespace string, dryRun bool, config MongoConfig) (DumpResult, error) {
+	if dryRun {
+		slog.Info("Skipping MongoDB backup - dry run mode is active")
+		return DumpResult{Engine: "mongo", Name: config.Name, DumpFile: config.DumpFile}, nil
+	}
+	slog.Info("Backing up MongoDB database...", "namespace", namespace, "name", config.Name, "db", config.DB)
+
+	if err := config.Encryption.Validate(); err != nil {
+		return DumpResult{}, err
+	}
+
+	// Create template data with computed fields
+	type templateData struct {
+		MongoConfig
+		DumpFileDir string
+		StatsFile   string
+	}
+	data := templateData{
+		MongoConfig: config,
+		DumpFileDir: filepath.Dir(config.DumpFile),
+		StatsFile:   dumpStatsFile(config.DumpFile),
+	}
+
+	start := time.Now()
+	if err := KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().MongoDump, data); err != nil {
+		return DumpResult{}, err
+	}
+	end := time.Now()
+
+	result := observeDump(namespace, "mongo", config.Name, config.ExecResource, config.ExecContainer, config.DumpFile, end.Sub(start))
+
+	manifest := DumpManifest{
+		Engine:      "mongo",
+		Name:        config.Name,
+		DB:          config.DB,
+		DumpFile:    config.DumpFile,
+		Compression: config.Compression.algorithm(),
+		Encryption:  config.Encryption.Binary(),
+		Start:       start.UTC(),
+		End:         end.UTC(),
+	}
+
+	if err := recordDumpManifest(namespace, config.ExecResource, config.ExecContainer, manifest, &result); err != nil {
+		return DumpResult{}, err
+	}
+
+	return result, nil
+}
+
+func RestoreMongo(namespace string, dryRun bool, config MongoConfig) error {
+	if dryRun {
+		slog.Info("Skipping MongoDB restore - dry run mode is active")
+		return nil
+	}
+	slog.Info("Restoring MongoDB database...", "namespace", namespace, "name", config.Name, "db", config.DB)
+
+	if err := verifyDumpBeforeRestore(namespace, config.ExecResource, config.ExecContainer, config.DumpFile); err != nil {
+		return err
+	}
+
+	decryptionKey, err := LoadDecryptionKey(namespace, config.Encryption)
+	if err != nil {
+		return err
+	}
+
+	type templateData struct {
+		MongoConfig
+		DecryptionKey string
+	}
+	data := templateData{
+		MongoConfig:   config,
+		DecryptionKey: decryptionKey,
+	}
+
+	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().MongoRestore, data)
+}
+
+func init() {
+	RegisterEngine(EngineRegistration{
+		Name:           "mongo",
+		Title:          "mongodb",
+		EnabledEnv:     "BAK_DB_MONGO",
+		DumpFileSuffix: ".archive.gz",
+		Instances: func(config Config) []Engine {
+			engines := []Engine{mongoEngine{config: config.Mongo}}
+			for _, c := range config.AdditionalMongo {
+				engines = append(engines, mongoEngine{config: c})
+			}
+			return engines
+		},
+	})
+}
+
+type mongoEngine struct {
+	config MongoConfig
+}
+
+func (e mongoEngine) Name() string     { return "mongo" }
+func (e mongoEngine) Instance() string { return e.config.Name }
+func (e mongoEngine) Enabled() bool    { return e.config.Enabled }
+
+func (e mongoEngine) ExecTarget() (string, string) {
+	return e.config.ExecResource, e.config.ExecContainer
+}
+
+func (e mongoEngine) DumpFile() string { return e.config.DumpFile }
+
+func (e mongoEngine) DumpFileSuffix() string {
+	return ".archive" + e.config.Compression.Extension() + e.config.Encryption.Extension()
+}
+
+func (e mongoEngine) DumpIsDirectory() bool { return false }
+
+func (e mongoEngine) DumpEncryption() EncryptionConfig { return e.config.Encryption }
+
+func (e mongoEngine) Check(namespace string) error {
+	if err := EnsureResourceAvailable(namespace, e.config.ExecResource); err != nil {
+		return err
+	}
+	return EnsureMongoAvailable(namespace, e.config)
+}
+
+func (e mongoEngine) Dump(namespace string, dryRun bool) (DumpResult, error) {
+	return DumpMongo(namespace, dryRun, e.config)
+}
+
+func (e mongoEngine) Restore(namespace string, dryRun bool) error {
+	return RestoreMongo(namespace, dryRun, e.config)
+}
+
+func (e mongoEngine) Info(namespace string) (DumpInfo, error) {
+	return getDumpInfo(namespace, e)
+}
+
+func (e mongoEngine) Shell(namespace string) error {
+	// Connect and authenticate via --eval before the interactive shell is started (--shell)
+	// Environment variables MONGO_USER and MONGO_PASSWORD are used instead of the --password flag (not visible in the process list)
+	eval := fmt.Sprintf(`db = connect('mongodb://%s:%s/%s'); if (process.env.MONGO_USER) { db.auth(process.env.MONGO_USER, process.env.MONGO_PASSWORD); }`,
+		e.config.Host,
+		e.config.Port,
+		e.config.AuthenticationDatabase,
+	)
+
+	if e.config.DB != "" {
+		eval += fmt.Sprintf(` db = db.getSiblingDB('%s');`, e.config.DB)
+	}
+
+	// Interactive exec wrapped in bash -c
+	return ExecInteractive(namespace, e.config.ExecResource, e.config.ExecContainer, []string{"bash", "-c", fmt.Sprintf(`export MONGO_USER="%s" MONGO_PASSWORD="%s"; mongosh --nodb --shell --eval "%s"`,
+		e.config.User,     // may contain ${MONGO_INITDB_ROOT_USERNAME}
+		e.config.Password, // may contain ${MONGO_INITDB_ROOT_PASSWORD}
+		eval,
+	)})
+}
+
+func (e mongoEngine) DumpHints(localPath string) []DumpHint {
+	return []DumpHint{
+		{Description: "To inspect", Command: fmt.Sprintf("%s | mongorestore --archive --dryRun --verbose", e.config.Compression.DecompressCommand(localPath))},
+		{Description: "To import", Command: fmt.Sprintf("%s | mongorestore --host=127.0.0.1 --port=27017 --username=%s --authenticationDatabase=%s --drop --archive",
+			e.config.Compression.DecompressCommand(localPath),
+			e.config.User,
+			e.config.AuthenticationDatabase)},
+	}
+}
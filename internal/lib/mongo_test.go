@@ -0,0 +1,88 @@
+//go:build kind
+
+package lib_test
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+)
+
+func TestDumpAndRestoreMongo(t *testing.T) {
+	vsName := fmt.Sprintf("test-backup-mongo-%s", lib.GenerateRandomStringOrPanic(6))
+	namespace := "mongo-test"
+
+	mongoConfig := lib.MongoConfig{
+		Enabled:                true,
+		ExecResource:           "deployment/mongo",
+		ExecContainer:          "mongo",
+		DumpFile:               "/data/db/dump.archive.gz",
+		Host:                   "127.0.0.1",
+		Port:                   "27017",
+		User:                   "${MONGO_INITDB_ROOT_USERNAME}", // read inside container
+		Password:               "${MONGO_INITDB_ROOT_PASSWORD}", // read inside container
+		AuthenticationDatabase: "admin",
+		DB:                     "${MONGO_INITDB_DATABASE}", // read inside container
+	}
+
+	labelVSConfig := lib.LabelVSConfig{
+		Type:       "adhoc",
+		Pod:        "gotest",
+		Retain:     "days",
+		RetainDays: 1,
+	}
+
+	if err := lib.EnsurePVCAvailable(namespace, "data"); err != nil {
+		t.Fatal("ensure pvc failed: ", err)
+	}
+
+	if err := lib.EnsureResourceAvailable(namespace, mongoConfig.ExecResource); err != nil {
+		t.Fatal("ensure res failed: ", err)
+	}
+
+	if err := lib.EnsureMongoAvailable(namespace, mongoConfig); err != nil {
+		t.Fatal("ensure MongoDB available failed: ", err)
+	}
+
+	if err := lib.EnsureFreeSpace(namespace, mongoConfig.ExecResource, mongoConfig.ExecContainer, filepath.Dir(mongoConfig.DumpFile), 90); err != nil {
+		t.Fatal("ensure free space failed: ", err)
+	}
+
+	if _, err := lib.DumpMongo(namespace, false, mongoConfig); err != nil {
+		t.Fatal("backup MongoDB failed: ", err)
+	}
+
+	timestamp, err := lib.GetRemoteFileTimestamp(namespace, mongoConfig.ExecResource, mongoConfig.ExecContainer, mongoConfig.DumpFile)
+	if err != nil {
+		t.Fatal("get remote file timestamp failed: ", err)
+	}
+
+	// Verify timestamp is recent (within last minute)
+	now := time.Now()
+	if !timestamp.After(now.Add(-1*time.Minute)) || !timestamp.Before(now) {
+		t.Fatal("dump file timestamp not within expected range")
+	}
+
+	vsLabels := lib.GenerateVSLabels(namespace, "data", labelVSConfig, time.Now())
+	vsAnnotations := lib.GenerateVSAnnotations(lib.GetBAKEnvVars())
+
+	vsObject := lib.GenerateVSObject(namespace, "csi-hostpath-snapclass", "data", vsName, vsLabels, vsAnnotations)
+
+	if err := lib.CreateVolumeSnapshot(namespace, false, vsName, vsObject, false, "25s"); err != nil {
+		t.Fatal("create vs failed: ", err)
+	}
+
+	cmd := exec.Command("kubectl", "get", "vs", vsName, "-n", namespace)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatal("get vs failed: ", err, string(output))
+	}
+
+	if err := lib.RestoreMongo(namespace, false, mongoConfig); err != nil {
+		t.Fatal("restore MongoDB failed: ", err)
+	}
+}
@@ -1,42 +1,322 @@
 package lib
 
 import (
-	"log"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// MySQLBinlogCoordinates is the binlog position (and GTID set) a BAK_DB_MYSQL_SINGLE_TRANSACTION dump is consistent with,
+// binlog events after it can be replayed for point-in-time recovery.
+type MySQLBinlogCoordinates struct {
+	File     string `json:"file"`
+	Position int64  `json:"position"`
+	GTIDSet  string `json:"gtidSet,omitempty"`
+}
+
+var (
+	mysqlBinlogFileRegex     = regexp.MustCompile(`_LOG_FILE='([^']+)'`)
+	mysqlBinlogPositionRegex = regexp.MustCompile(`_LOG_POS=(\d+)`)
+	mysqlGTIDPurgedRegex     = regexp.MustCompile(`GTID_PURGED=(?:/\*!\d+ '\+'\*/\s*)?'([^']*)'`)
+	mysqlGTIDSlavePosRegex   = regexp.MustCompile(`gtid_slave_pos='([^']*)'`)
+)
+
+// ParseMySQLBinlogCoordinates parses the "CHANGE MASTER TO" / "CHANGE REPLICATION SOURCE TO" comment and the GTID
+// statements of a mysqldump (mysql GTID_PURGED or mariadb gtid_slave_pos), ok is false if there are no coordinates.
+func ParseMySQLBinlogCoordinates(header string) (coordinates MySQLBinlogCoordinates, ok bool) {
+	fileMatch := mysqlBinlogFileRegex.FindStringSubmatch(header)
+	positionMatch := mysqlBinlogPositionRegex.FindStringSubmatch(header)
+	if fileMatch == nil || positionMatch == nil {
+		return MySQLBinlogCoordinates{}, false
+	}
+
+	position, err := strconv.ParseInt(positionMatch[1], 10, 64)
+	if err != nil {
+		return MySQLBinlogCoordinates{}, false
+	}
+
+	coordinates = MySQLBinlogCoordinates{File: fileMatch[1], Position: position}
+
+	// multiple GTID sets are separated by ",\n"
+	unwrapped := strings.ReplaceAll(header, "\n", "")
+	if match := mysqlGTIDPurgedRegex.FindStringSubmatch(unwrapped); match != nil {
+		coordinates.GTIDSet = match[1]
+	} else if match := mysqlGTIDSlavePosRegex.FindStringSubmatch(unwrapped); match != nil {
+		coordinates.GTIDSet = match[1]
+	}
+
+	return coordinates, true
+}
+
+// MySQLBinlogAnnotation is the volume snapshot annotation holding the MySQLBinlogCoordinates (json) of the dump of the database.
+func MySQLBinlogAnnotation(name string) string {
+	return fmt.Sprintf("backup-ns.sh/%s-binlog", name)
+}
+
+// mysqlBinlogFile is the file next to the dump holding the binlog coordinates and GTID statements of its header.
+func mysqlBinlogFile(config MySQLConfig) string {
+	return config.DumpFile + ".binlog"
+}
+
 func EnsureMySQLAvailable(namespace string, config MySQLConfig) error {
-	log.Printf("Checking if MySQL is available in namespace '%s'...", namespace)
+	slog.Info("Checking if MySQL is available...", "namespace", namespace, "name", config.Name)
+
+	if err := config.Encryption.Validate(); err != nil {
+		return err
+	}
 
 	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().MySQLCheck, config)
 }
 
-func DumpMySQL(namespace string, dryRun bool, config MySQLConfig) error {
+func DumpMySQL(namespace string, dryRun bool, config MySQLConfig) (DumpResult, error) {
 	if dryRun {
-		log.Println("Skipping MySQL backup - dry run mode is active")
-		return nil
+		slog.Info("Skipping MySQL backup - dry run mode is active")
+		return DumpResult{Engine: "mysql", Name: config.Name, DumpFile: config.DumpFile}, nil
+	}
+	slog.Info("Backing up MySQL database...", "namespace", namespace, "name", config.Name, "db", config.DB)
+
+	if err := config.Encryption.Validate(); err != nil {
+		return DumpResult{}, err
 	}
-	log.Printf("Backing up MySQL database '%s' in namespace '%s'...", config.DB, namespace)
 
 	// Create template data with computed fields
 	type templateData struct {
 		MySQLConfig
 		DumpFileDir string
+		BinlogFile  string
+		StatsFile   string
 	}
 	data := templateData{
 		MySQLConfig: config,
 		DumpFileDir: filepath.Dir(config.DumpFile),
+		BinlogFile:  mysqlBinlogFile(config),
+		StatsFile:   dumpStatsFile(config.DumpFile),
 	}
 
-	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().MySQLDump, data)
+	start := time.Now()
+	if err := KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().MySQLDump, data); err != nil {
+		return DumpResult{}, err
+	}
+	end := time.Now()
+
+	result := observeDump(namespace, "mysql", config.Name, config.ExecResource, config.ExecContainer, config.DumpFile, end.Sub(start))
+	result.Annotations = map[string]string{}
+
+	if config.SingleTransaction {
+		annotation, err := getMySQLBinlogAnnotation(namespace, config)
+		if err != nil {
+			return DumpResult{}, err
+		}
+		if annotation != "" {
+			result.Annotations[MySQLBinlogAnnotation(config.Name)] = annotation
+		}
+	}
+
+	manifest := DumpManifest{
+		Engine:       "mysql",
+		Name:         config.Name,
+		AllDatabases: config.AllDatabases,
+		DumpFile:     config.DumpFile,
+		Compression:  config.Compression.algorithm(),
+		Encryption:   config.Encryption.Binary(),
+		Start:        start.UTC(),
+		End:          end.UTC(),
+	}
+	if !config.AllDatabases {
+		manifest.DB = config.DB
+	}
+
+	if err := recordDumpManifest(namespace, config.ExecResource, config.ExecContainer, manifest, &result); err != nil {
+		return DumpResult{}, err
+	}
+
+	return result, nil
+}
+
+// getMySQLBinlogAnnotation reads the binlog coordinates recorded by the dump, "" if binary logging is disabled.
+func getMySQLBinlogAnnotation(namespace string, config MySQLConfig) (string, error) {
+	header, err := execInResource(namespace, config.ExecResource, config.ExecContainer, []string{"cat", mysqlBinlogFile(config)}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the binlog coordinates of the mysql dump: %w (output: %s)", err, header)
+	}
+
+	coordinates, ok := ParseMySQLBinlogCoordinates(header)
+	if !ok {
+		slog.Info("No binlog coordinates recorded, binary logging is disabled", "namespace", namespace, "name", config.Name)
+		return "", nil
+	}
+
+	annotation, err := json.Marshal(coordinates)
+	if err != nil {
+		return "", err
+	}
+
+	slog.Info("Recorded binlog coordinates", "namespace", namespace, "name", config.Name, "binlog_file", coordinates.File, "binlog_position", coordinates.Position, "gtid_set", coordinates.GTIDSet)
+
+	return string(annotation), nil
 }
 
 func RestoreMySQL(namespace string, dryRun bool, config MySQLConfig) error {
 	if dryRun {
-		log.Println("Skipping MySQL restore - dry run mode is active")
+		slog.Info("Skipping MySQL restore - dry run mode is active")
 		return nil
 	}
-	log.Printf("Restoring MySQL database '%s' in namespace '%s'...", config.DB, namespace)
+	slog.Info("Restoring MySQL database...", "namespace", namespace, "name", config.Name, "db", config.DB)
+
+	if err := verifyDumpBeforeRestore(namespace, config.ExecResource, config.ExecContainer, config.DumpFile); err != nil {
+		return err
+	}
+
+	decryptionKey, err := LoadDecryptionKey(namespace, config.Encryption)
+	if err != nil {
+		return err
+	}
 
-	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().MySQLRestore, config)
+	type templateData struct {
+		MySQLConfig
+		DecryptionKey string
+	}
+	data := templateData{
+		MySQLConfig:   config,
+		DecryptionKey: decryptionKey,
+	}
+
+	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().MySQLRestore, data)
+}
+
+// VerifyMySQL restores the current dump into an ephemeral copy of the mysql container and checks the restored tables
+// against its manifest, BAK_DB_MYSQL_VERIFY_SQL is run afterwards.
+func VerifyMySQL(namespace string, config MySQLConfig, verifyConfig VerifyConfig) (VerifyResult, error) {
+	slog.Info("Verifying MySQL dump...", "namespace", namespace, "name", config.Name, "dump_file", config.DumpFile)
+
+	var ready bytes.Buffer
+	if err := GetTemplateAtlas().MySQLReady.Execute(&ready, config); err != nil {
+		return VerifyResult{}, fmt.Errorf("failed to populate data in templated script '%s': %w", GetTemplateAtlas().MySQLReady.Name(), err)
+	}
+
+	return verifyDump(namespace, verifyConfig, dumpVerification{
+		engine:        "mysql",
+		name:          config.Name,
+		execResource:  config.ExecResource,
+		execContainer: config.ExecContainer,
+		dumpFile:      config.DumpFile,
+		ready:         ready.String(),
+		restore: func(execResource, dumpFile string) error {
+			verifier := config
+			verifier.ExecResource, verifier.ExecContainer, verifier.DumpFile = execResource, verifierContainer, dumpFile
+
+			if err := RestoreMySQL(namespace, false, verifier); err != nil {
+				return err
+			}
+
+			type templateData struct {
+				MySQLConfig
+				StatsFile string
+			}
+			data := templateData{
+				MySQLConfig: verifier,
+				StatsFile:   dumpStatsFile(verifier.DumpFile),
+			}
+
+			return KubectlExecTemplate(namespace, verifier.ExecResource, verifier.ExecContainer, GetTemplateAtlas().MySQLVerify, data)
+		},
+	})
+}
+
+func init() {
+	RegisterEngine(EngineRegistration{
+		Name:           "mysql",
+		Title:          "mysql/mariadb",
+		EnabledEnv:     "BAK_DB_MYSQL",
+		DumpFileSuffix: ".sql.gz",
+		Instances: func(config Config) []Engine {
+			engines := []Engine{mysqlEngine{config: config.MySQL}}
+			for _, c := range config.AdditionalMySQL {
+				engines = append(engines, mysqlEngine{config: c})
+			}
+			return engines
+		},
+	})
+}
+
+type mysqlEngine struct {
+	config MySQLConfig
+}
+
+func (e mysqlEngine) Name() string     { return "mysql" }
+func (e mysqlEngine) Instance() string { return e.config.Name }
+func (e mysqlEngine) Enabled() bool    { return e.config.Enabled }
+
+func (e mysqlEngine) ExecTarget() (string, string) {
+	return e.config.ExecResource, e.config.ExecContainer
+}
+
+func (e mysqlEngine) DumpFile() string { return e.config.DumpFile }
+
+func (e mysqlEngine) DumpFileSuffix() string {
+	return ".sql" + e.config.Compression.Extension() + e.config.Encryption.Extension()
+}
+
+func (e mysqlEngine) DumpIsDirectory() bool { return false }
+
+func (e mysqlEngine) DumpEncryption() EncryptionConfig { return e.config.Encryption }
+
+func (e mysqlEngine) Check(namespace string) error {
+	if err := EnsureResourceAvailable(namespace, e.config.ExecResource); err != nil {
+		return err
+	}
+	return EnsureMySQLAvailable(namespace, e.config)
+}
+
+func (e mysqlEngine) Dump(namespace string, dryRun bool) (DumpResult, error) {
+	return DumpMySQL(namespace, dryRun, e.config)
+}
+
+func (e mysqlEngine) Restore(namespace string, dryRun bool) error {
+	return RestoreMySQL(namespace, dryRun, e.config)
+}
+
+func (e mysqlEngine) Verify(namespace string, config VerifyConfig) (VerifyResult, error) {
+	return VerifyMySQL(namespace, e.config, config)
+}
+
+func (e mysqlEngine) Info(namespace string) (DumpInfo, error) {
+	return getDumpInfo(namespace, e)
+}
+
+func (e mysqlEngine) Shell(namespace string) error {
+	// Construct mysql command with proper quoting for bash -c
+	mysqlCmd := fmt.Sprintf(`mysql --host=%s --port=%s --user=%s --password="%s" --default-character-set=%s %s`,
+		e.config.Host,
+		e.config.Port,
+		e.config.User,
+		e.config.Password, // may contain ${MYSQL_ROOT_PASSWORD}
+		e.config.DefaultCharacterSet,
+		e.config.DB, // may contain ${MYSQL_DATABASE}
+	)
+
+	// Interactive exec wrapped in bash -c
+	return ExecInteractive(namespace, e.config.ExecResource, e.config.ExecContainer, []string{"bash", "-c", mysqlCmd})
+}
+
+func (e mysqlEngine) DumpHints(localPath string) []DumpHint {
+	db := e.config.DB
+	if e.config.AllDatabases {
+		db = ""
+	}
+
+	return []DumpHint{
+		{Description: "To unpack", Command: fmt.Sprintf("%s > dump.sql", e.config.Compression.DecompressCommand(localPath))},
+		{Description: "To import", Command: strings.TrimSpace(fmt.Sprintf("%s | mysql --host=127.0.0.1 --port=3306 --user=%s --default-character-set=%s %s",
+			e.config.Compression.DecompressCommand(localPath),
+			e.config.User,
+			e.config.DefaultCharacterSet,
+			db))},
+	}
 }
@@ -0,0 +1,35 @@
+package lib_test
+
+import (
+	"testing"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMySQLBinlogCoordinates(t *testing.T) {
+	// mysql 8.0 with GTIDs (--source-data=2 --set-gtid-purged=COMMENTED)
+	coordinates, ok := lib.ParseMySQLBinlogCoordinates(`-- CHANGE REPLICATION SOURCE TO SOURCE_LOG_FILE='binlog.000003', SOURCE_LOG_POS=1337;
+/* SET @@GLOBAL.GTID_PURGED=/*!80000 '+'*/ '3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,
+8c8b1f6a-2a4f-11ef-9c1d-0242ac120002:1-42'; */
+`)
+	require.True(t, ok)
+	require.Equal(t, lib.MySQLBinlogCoordinates{
+		File:     "binlog.000003",
+		Position: 1337,
+		GTIDSet:  "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,8c8b1f6a-2a4f-11ef-9c1d-0242ac120002:1-42",
+	}, coordinates)
+
+	// mariadb (--master-data=2 --gtid)
+	coordinates, ok = lib.ParseMySQLBinlogCoordinates(`-- CHANGE MASTER TO MASTER_LOG_FILE='mysqld-bin.000002', MASTER_LOG_POS=328;
+-- SET GLOBAL gtid_slave_pos='0-1-100';
+`)
+	require.True(t, ok)
+	require.Equal(t, lib.MySQLBinlogCoordinates{File: "mysqld-bin.000002", Position: 328, GTIDSet: "0-1-100"}, coordinates)
+
+	// binary logging disabled
+	_, ok = lib.ParseMySQLBinlogCoordinates("")
+	require.False(t, ok)
+
+	require.Equal(t, "backup-ns.sh/mysql-1-binlog", lib.MySQLBinlogAnnotation("mysql-1"))
+}
@@ -1,3 +1,5 @@
+//go:build kind
+
 package lib_test
 
 import (
@@ -50,7 +52,7 @@ func TestDumpAndRestoreMySQL(t *testing.T) {
 		t.Fatal("ensure free space failed: ", err)
 	}
 
-	if err := lib.DumpMySQL(namespace, false, mysqlConfig); err != nil {
+	if _, err := lib.DumpMySQL(namespace, false, mysqlConfig); err != nil {
 		t.Fatal("backup MySQL failed: ", err)
 	}
 
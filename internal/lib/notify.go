@@ -0,0 +1,255 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// NotifyEvent is the payload of a notification sent at the end of a command (POSTed as is to BAK_NOTIFY_WEBHOOK_URL).
+type NotifyEvent struct {
+	Command         string       `json:"command"`
+	Success         bool         `json:"success"`
+	Namespace       string       `json:"namespace,omitempty"`
+	PVCName         string       `json:"pvcName,omitempty"`
+	VSName          string       `json:"vsName,omitempty"`
+	Set             string       `json:"set,omitempty"`
+	StartedAt       time.Time    `json:"startedAt"`
+	DurationSeconds float64      `json:"durationSeconds"`
+	Dumps           []DumpResult `json:"dumps,omitempty"`
+	Error           string       `json:"error,omitempty"`
+	Hostname        string       `json:"hostname"`
+	RunID           string       `json:"runId"`
+}
+
+// Finish sets the outcome of the command.
+func (e *NotifyEvent) Finish(err error) {
+	e.Success = err == nil
+	if err != nil {
+		e.Error = err.Error()
+	}
+	e.DurationSeconds = time.Since(e.StartedAt).Seconds()
+	e.Hostname = getHostnameWithFallback()
+	if e.RunID == "" {
+		e.RunID = RunID()
+	}
+}
+
+func (e NotifyEvent) status() string {
+	if e.Success {
+		return "succeeded"
+	}
+	return "failed"
+}
+
+// Summary is a single line human readable description of the event.
+func (e NotifyEvent) Summary() string {
+	var target []string
+	if e.Namespace != "" {
+		target = append(target, fmt.Sprintf("ns='%s'", e.Namespace))
+	}
+	if e.PVCName != "" {
+		target = append(target, fmt.Sprintf("pvc='%s'", e.PVCName))
+	}
+	if e.VSName != "" {
+		target = append(target, fmt.Sprintf("vs_name='%s'", e.VSName))
+	}
+	if e.Set != "" {
+		target = append(target, fmt.Sprintf("set='%s'", e.Set))
+	}
+
+	summary := fmt.Sprintf("backup-ns %s %s", e.Command, e.status())
+	if len(target) > 0 {
+		summary += " for " + strings.Join(target, " ")
+	}
+	return summary + fmt.Sprintf(" after %s", time.Duration(e.DurationSeconds*float64(time.Second)).Round(time.Second))
+}
+
+func (e NotifyEvent) details() string {
+	var b strings.Builder
+	b.WriteString(e.Summary())
+	b.WriteString("\n")
+
+	for _, d := range e.Dumps {
+		fmt.Fprintf(&b, "%s dump '%s': %d bytes in %.1fs\n", d.Name, d.DumpFile, d.SizeBytes, d.DurationSeconds)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&b, "error: %s\n", e.Error)
+	}
+	fmt.Fprintf(&b, "host: %s\n", e.Hostname)
+	fmt.Fprintf(&b, "run id: %s\n", e.RunID)
+
+	return b.String()
+}
+
+// Notify sends the event to all configured notification targets (if BAK_NOTIFY_ON matches the outcome).
+// Failing targets are only logged, a notification never changes the outcome of the command itself.
+func Notify(config NotifyConfig, event NotifyEvent) {
+	if config.On == "never" || (config.On == "failure" && event.Success) {
+		return
+	}
+
+	timeout, err := time.ParseDuration(config.Timeout)
+	if err != nil {
+		slog.Warn("Invalid BAK_NOTIFY_TIMEOUT, using 10s", "timeout", config.Timeout, "error", err)
+		timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if config.WebhookURL != "" {
+		if err := notifyWebhook(ctx, config.WebhookURL, event); err != nil {
+			slog.Warn("Ignoring error while sending webhook notification", "error", err)
+		}
+	}
+
+	if config.SlackWebhookURL != "" {
+		if err := notifySlack(ctx, config.SlackWebhookURL, event); err != nil {
+			slog.Warn("Ignoring error while sending slack notification", "error", err)
+		}
+	}
+
+	if config.SMTP.Host != "" {
+		if len(smtpRecipients(config.SMTP.To)) == 0 {
+			slog.Warn("Skipping smtp notification, BAK_NOTIFY_SMTP_TO has no recipients", "host", config.SMTP.Host)
+		} else if err := notifySMTP(ctx, config.SMTP, event); err != nil {
+			slog.Warn("Ignoring error while sending smtp notification", "error", err)
+		}
+	}
+}
+
+func notifyWebhook(ctx context.Context, url string, event NotifyEvent) error {
+	return postJSON(ctx, url, event)
+}
+
+func notifySlack(ctx context.Context, url string, event NotifyEvent) error {
+	icon := ":white_check_mark:"
+	if !event.Success {
+		icon = ":x:"
+	}
+
+	return postJSON(ctx, url, map[string]string{
+		"text": fmt.Sprintf("%s %s", icon, strings.TrimSpace(event.details())),
+	})
+}
+
+func postJSON(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		resBody, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("notification endpoint returned status %d: %s", res.StatusCode, strings.TrimSpace(string(resBody)))
+	}
+
+	return nil
+}
+
+// smtpRecipients returns the non-empty addresses of the comma separated recipients.
+func smtpRecipients(to string) []string {
+	var recipients []string
+	for _, r := range strings.Split(to, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	return recipients
+}
+
+func notifySMTP(ctx context.Context, config NotifySMTPConfig, event NotifyEvent) error {
+	to := smtpRecipients(config.To)
+
+	payload, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: [backup-ns] %s\r\n", event.Summary())
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(event.details(), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(string(payload), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	addr := net.JoinHostPort(config.Host, config.Port)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server '%s': %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return fmt.Errorf("failed to set smtp deadline: %w", err)
+		}
+	}
+
+	client, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to create smtp client: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: config.Host, MinVersion: tls.VersionTLS12}); err != nil {
+			return fmt.Errorf("failed to start smtp tls: %w", err)
+		}
+	}
+
+	if config.User != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.User, config.Password, config.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate against smtp server: %w", err)
+		}
+	}
+
+	if err := client.Mail(config.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO '%s' failed: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to write smtp message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send smtp message: %w", err)
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,133 @@
+package lib_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyWebhookAndSlack(t *testing.T) {
+	var webhookBody, slackBody []byte
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		webhookBody, _ = io.ReadAll(r.Body)
+	}))
+	defer webhook.Close()
+
+	slack := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		slackBody, _ = io.ReadAll(r.Body)
+	}))
+	defer slack.Close()
+
+	config := lib.NotifyConfig{On: "failure", Timeout: "5s", WebhookURL: webhook.URL, SlackWebhookURL: slack.URL}
+
+	event := lib.NotifyEvent{Command: "create", Namespace: "app", PVCName: "data", VSName: "data-2025-01-01-001700-abcdef", StartedAt: time.Now()}
+	event.Dumps = []lib.DumpResult{{Engine: "postgres", Name: "postgres", DumpFile: "/var/lib/postgresql/data/dump.sql.gz", DurationSeconds: 1.5, SizeBytes: 1024}}
+
+	// successful events are not sent with BAK_NOTIFY_ON=failure
+	event.Finish(nil)
+	lib.Notify(config, event)
+	require.Nil(t, webhookBody)
+	require.Nil(t, slackBody)
+
+	event.Finish(errors.New("flock timeout"))
+	lib.Notify(config, event)
+
+	var received lib.NotifyEvent
+	require.NoError(t, json.Unmarshal(webhookBody, &received))
+	require.False(t, received.Success)
+	require.Equal(t, "flock timeout", received.Error)
+	require.Equal(t, "data-2025-01-01-001700-abcdef", received.VSName)
+	require.Equal(t, int64(1024), received.Dumps[0].SizeBytes)
+	require.NotEmpty(t, received.RunID)
+	require.Equal(t, lib.RunID(), received.RunID)
+
+	var slackMessage map[string]string
+	require.NoError(t, json.Unmarshal(slackBody, &slackMessage))
+	require.True(t, strings.HasPrefix(slackMessage["text"], ":x: backup-ns create failed for ns='app' pvc='data' vs_name='data-2025-01-01-001700-abcdef'"), slackMessage["text"])
+	require.Contains(t, slackMessage["text"], "error: flock timeout")
+}
+
+func TestNotifySMTP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+
+	// minimal smtp server (no STARTTLS, no AUTH)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost")
+
+		var data strings.Builder
+		inData := false
+
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				reply("250 OK")
+			case "DATA":
+				inData = true
+				reply("354 go ahead")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 unsupported")
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	config := lib.NotifyConfig{On: "always", Timeout: "5s", SMTP: lib.NotifySMTPConfig{Host: host, Port: port, From: "backup-ns@localhost", To: "ops@example.com, , dev@example.com,"}}
+
+	event := lib.NotifyEvent{Command: "controller deleteAfterSweep", StartedAt: time.Now()}
+	event.Finish(nil)
+	lib.Notify(config, event)
+
+	select {
+	case msg := <-received:
+		require.Contains(t, msg, "Subject: [backup-ns] backup-ns controller deleteAfterSweep succeeded")
+		require.Contains(t, msg, "To: ops@example.com, dev@example.com")
+		require.Contains(t, msg, `"success": true`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+}
@@ -1,42 +1,310 @@
 package lib
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
+// The extension of the postgres dump directory with BAK_DB_POSTGRES_ALL_DATABASES.
+const postgresAllDatabasesExtension = ".all"
+
+// postgresDumpFileExtension is the extension of a postgres dump in the BAK_DB_POSTGRES_DUMP_FORMAT, plain dumps get the
+// extension of the compression (e.g. ".sql.gz"), plain and custom dumps the one of the encryption (e.g. ".pgdump.age").
+func postgresDumpFileExtension(format string, compression CompressionConfig, encryption EncryptionConfig) string {
+	switch format {
+	case "custom":
+		return ".pgdump" + encryption.Extension()
+	case "directory":
+		return ".dir"
+	}
+	return ".sql" + compression.Extension() + encryption.Extension()
+}
+
+// postgresDumpFile replaces a known extension of the dump file with the one of the format (e.g. "/data/dump.sql.gz" becomes
+// "/data/dump.pgdump" for the custom format and "/data/dump.all" for all databases), custom extensions are kept.
+func postgresDumpFile(dumpFile string, format string, allDatabases bool, compression CompressionConfig, encryption EncryptionConfig) string {
+	ext := postgresDumpFileExtension(format, compression, encryption)
+	if allDatabases {
+		ext = postgresAllDatabasesExtension
+	}
+
+	dumpFile = unencryptedDumpFile(dumpFile)
+	for _, known := range []string{".sql.gz", ".sql.zst", ".sql", ".pgdump", ".dir", postgresAllDatabasesExtension} {
+		if name, ok := strings.CutSuffix(dumpFile, known); ok {
+			return name + ext
+		}
+	}
+	return dumpFile
+}
+
+// postgresTemplateData is passed to the postgres templates.
+type postgresTemplateData struct {
+	PostgresConfig
+
+	// The directory of the dump file
+	DumpFileDir string
+
+	// The path the dump is created at before it replaces the dump file (DumpFile unless the dump is a directory)
+	DumpTarget string
+
+	// The extension of the per database dumps with AllDatabases (e.g. ".sql.gz"), globals.sql gets the extension of the compression and encryption
+	DatabaseDumpExtension string
+
+	// The file the dump records the stats of its manifest in
+	StatsFile string
+
+	// The private key to decrypt the dump on restore (BAK_DUMP_DECRYPTION_KEY_FILE or BAK_DUMP_DECRYPTION_KEY_SECRET)
+	DecryptionKey string
+}
+
+func newPostgresTemplateData(config PostgresConfig) postgresTemplateData {
+	data := postgresTemplateData{
+		PostgresConfig:        config,
+		DumpFileDir:           filepath.Dir(config.DumpFile),
+		DumpTarget:            config.DumpFile,
+		DatabaseDumpExtension: postgresDumpFileExtension(config.DumpFormat, config.Compression, config.Encryption),
+		StatsFile:             dumpStatsFile(config.DumpFile),
+	}
+
+	if config.AllDatabases || config.DumpFormat == "directory" {
+		data.DumpTarget = config.DumpFile + ".tmp"
+	}
+
+	return data
+}
+
+// validatePostgresEncryption ensures the dump format supports the encryption (directory dumps are written by pg_dump itself).
+func validatePostgresEncryption(config PostgresConfig) error {
+	if config.Encryption.Enabled() && config.DumpFormat == "directory" {
+		return fmt.Errorf("BAK_DUMP_ENCRYPTION=%s is not supported with the postgres directory dump format", config.Encryption.Algorithm)
+	}
+	return config.Encryption.Validate()
+}
+
 func EnsurePostgresAvailable(namespace string, config PostgresConfig) error {
-	log.Printf("Checking if Postgres is available in namespace '%s'...", namespace)
+	slog.Info("Checking if Postgres is available...", "namespace", namespace, "name", config.Name)
 
-	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().PostgresCheck, config)
+	if err := validatePostgresEncryption(config); err != nil {
+		return err
+	}
+
+	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().PostgresCheck, newPostgresTemplateData(config))
 }
 
-func DumpPostgres(namespace string, dryRun bool, config PostgresConfig) error {
+func DumpPostgres(namespace string, dryRun bool, config PostgresConfig) (DumpResult, error) {
 	if dryRun {
-		log.Println("Skipping Postgres backup - dry run mode is active")
-		return nil
+		slog.Info("Skipping Postgres backup - dry run mode is active")
+		return DumpResult{Engine: "postgres", Name: config.Name, DumpFile: config.DumpFile}, nil
 	}
-	log.Printf("Backing up Postgres database '%s' in namespace '%s'...", config.DB, namespace)
+	slog.Info("Backing up Postgres database...", "namespace", namespace, "name", config.Name, "db", config.DB, "all_databases", config.AllDatabases)
 
-	// Create template data with computed fields
-	type templateData struct {
-		PostgresConfig
-		DumpFileDir string
+	if err := validatePostgresEncryption(config); err != nil {
+		return DumpResult{}, err
 	}
-	data := templateData{
-		PostgresConfig: config,
-		DumpFileDir:    filepath.Dir(config.DumpFile),
+
+	start := time.Now()
+	if err := KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().PostgresDump, newPostgresTemplateData(config)); err != nil {
+		return DumpResult{}, err
 	}
+	end := time.Now()
+
+	result := observeDump(namespace, "postgres", config.Name, config.ExecResource, config.ExecContainer, config.DumpFile, end.Sub(start))
 
-	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().PostgresDump, data)
+	manifest := DumpManifest{
+		Engine:       "postgres",
+		Name:         config.Name,
+		AllDatabases: config.AllDatabases,
+		DumpFile:     config.DumpFile,
+		Format:       config.DumpFormat,
+		Encryption:   config.Encryption.Binary(),
+		Start:        start.UTC(),
+		End:          end.UTC(),
+	}
+	if !config.AllDatabases {
+		manifest.DB = config.DB
+	}
+	// custom and directory dumps are compressed by pg_dump (the globals of all databases dumps are always plain)
+	if config.AllDatabases || (config.DumpFormat != "custom" && config.DumpFormat != "directory") {
+		manifest.Compression = config.Compression.algorithm()
+	}
+
+	if err := recordDumpManifest(namespace, config.ExecResource, config.ExecContainer, manifest, &result); err != nil {
+		return DumpResult{}, err
+	}
+
+	return result, nil
 }
 
 func RestorePostgres(namespace string, dryRun bool, config PostgresConfig) error {
 	if dryRun {
-		log.Println("Skipping Postgres restore - dry run mode is active")
+		slog.Info("Skipping Postgres restore - dry run mode is active")
 		return nil
 	}
-	log.Printf("Restoring Postgres database '%s' in namespace '%s'...", config.DB, namespace)
+	slog.Info("Restoring Postgres database...", "namespace", namespace, "name", config.Name, "db", config.DB, "all_databases", config.AllDatabases)
+
+	if err := verifyDumpBeforeRestore(namespace, config.ExecResource, config.ExecContainer, config.DumpFile); err != nil {
+		return err
+	}
+
+	data := newPostgresTemplateData(config)
+
+	decryptionKey, err := LoadDecryptionKey(namespace, config.Encryption)
+	if err != nil {
+		return err
+	}
+	data.DecryptionKey = decryptionKey
+
+	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().PostgresRestore, data)
+}
 
-	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().PostgresRestore, config)
+// VerifyPostgres restores the current dump into an ephemeral copy of the postgres container and checks the restored tables
+// against its manifest, BAK_DB_POSTGRES_VERIFY_SQL is run afterwards.
+func VerifyPostgres(namespace string, config PostgresConfig, verifyConfig VerifyConfig) (VerifyResult, error) {
+	slog.Info("Verifying Postgres dump...", "namespace", namespace, "name", config.Name, "dump_file", config.DumpFile)
+
+	if err := validatePostgresEncryption(config); err != nil {
+		return VerifyResult{}, err
+	}
+
+	return verifyDump(namespace, verifyConfig, dumpVerification{
+		engine:        "postgres",
+		name:          config.Name,
+		execResource:  config.ExecResource,
+		execContainer: config.ExecContainer,
+		dumpFile:      config.DumpFile,
+		isDirectory:   config.AllDatabases || config.DumpFormat == "directory",
+		ready:         fmt.Sprintf("pg_isready --host %s --port %s", config.Host, config.Port),
+		restore: func(execResource, dumpFile string) error {
+			verifier := config
+			verifier.ExecResource, verifier.ExecContainer, verifier.DumpFile = execResource, verifierContainer, dumpFile
+
+			if err := RestorePostgres(namespace, false, verifier); err != nil {
+				return err
+			}
+			return KubectlExecTemplate(namespace, verifier.ExecResource, verifier.ExecContainer, GetTemplateAtlas().PostgresVerify, newPostgresTemplateData(verifier))
+		},
+	})
+}
+
+func init() {
+	RegisterEngine(EngineRegistration{
+		Name:           "postgres",
+		Title:          "postgres",
+		EnabledEnv:     "BAK_DB_POSTGRES",
+		DumpFileSuffix: ".sql.gz",
+		Instances: func(config Config) []Engine {
+			engines := []Engine{postgresEngine{config: config.Postgres}}
+			for _, c := range config.AdditionalPostgres {
+				engines = append(engines, postgresEngine{config: c})
+			}
+			return engines
+		},
+	})
+}
+
+type postgresEngine struct {
+	config PostgresConfig
+}
+
+func (e postgresEngine) Name() string     { return "postgres" }
+func (e postgresEngine) Instance() string { return e.config.Name }
+func (e postgresEngine) Enabled() bool    { return e.config.Enabled }
+
+func (e postgresEngine) ExecTarget() (string, string) {
+	return e.config.ExecResource, e.config.ExecContainer
+}
+
+func (e postgresEngine) DumpFile() string { return e.config.DumpFile }
+
+func (e postgresEngine) DumpFileSuffix() string {
+	if e.config.AllDatabases {
+		return ".tar"
+	}
+
+	if e.config.DumpFormat == "directory" {
+		return ".tar"
+	}
+	return postgresDumpFileExtension(e.config.DumpFormat, e.config.Compression, e.config.Encryption)
+}
+
+func (e postgresEngine) DumpIsDirectory() bool {
+	return e.config.AllDatabases || e.config.DumpFormat == "directory"
+}
+
+func (e postgresEngine) DumpEncryption() EncryptionConfig { return e.config.Encryption }
+
+func (e postgresEngine) Check(namespace string) error {
+	if err := EnsureResourceAvailable(namespace, e.config.ExecResource); err != nil {
+		return err
+	}
+	return EnsurePostgresAvailable(namespace, e.config)
+}
+
+func (e postgresEngine) Dump(namespace string, dryRun bool) (DumpResult, error) {
+	return DumpPostgres(namespace, dryRun, e.config)
+}
+
+func (e postgresEngine) Restore(namespace string, dryRun bool) error {
+	return RestorePostgres(namespace, dryRun, e.config)
+}
+
+func (e postgresEngine) Verify(namespace string, config VerifyConfig) (VerifyResult, error) {
+	return VerifyPostgres(namespace, e.config, config)
+}
+
+func (e postgresEngine) Info(namespace string) (DumpInfo, error) {
+	return getDumpInfo(namespace, e)
+}
+
+func (e postgresEngine) Shell(namespace string) error {
+	// Construct psql command with proper quoting for bash -c
+	psqlCmd := fmt.Sprintf(`psql --host=%s --port=%s --username=%s --dbname=%s`,
+		e.config.Host,
+		e.config.Port,
+		e.config.User,
+		e.config.DB,
+	)
+
+	// Interactive exec wrapped in bash -c
+	// Environment variable PGPASSWORD is used instead of --password flag
+	return ExecInteractive(namespace, e.config.ExecResource, e.config.ExecContainer, []string{"bash", "-c", fmt.Sprintf("PGPASSWORD='%s' %s", e.config.Password, psqlCmd)})
+}
+
+func (e postgresEngine) DumpHints(localPath string) []DumpHint {
+	pgRestore := fmt.Sprintf("pg_restore --host 127.0.0.1 --port 5432 --username=%s --dbname=%s --clean --if-exists --jobs=%d", e.config.User, e.config.DB, e.config.Jobs)
+
+	if e.config.AllDatabases {
+		hints := []DumpHint{
+			{Description: "To unpack", Command: fmt.Sprintf("mkdir dump.all && tar -xf %s -C dump.all", localPath)},
+		}
+		if e.config.Encryption.Enabled() {
+			ext := e.config.Encryption.Extension()
+			hints = append(hints, DumpHint{Description: "To decrypt the dumps", Command: fmt.Sprintf(`for f in dump.all/*%s; do %s > "${f%%%s}"; done`, ext, e.config.Encryption.DecryptCommand(`"$f"`), ext)})
+		}
+		return append(hints,
+			DumpHint{Description: "To import the roles (before the databases)", Command: fmt.Sprintf("%s | psql --host 127.0.0.1 --port 5432 --username=%s postgres", e.config.Compression.DecompressCommand("dump.all/globals.sql"+e.config.Compression.Extension()), e.config.User)},
+			DumpHint{Description: fmt.Sprintf("To list the dumped databases (dump.all/<db>%s)", postgresDumpFileExtension(e.config.DumpFormat, e.config.Compression, EncryptionConfig{})), Command: "cat dump.all/databases.txt"},
+		)
+	}
+
+	switch e.config.DumpFormat {
+	case "custom":
+		return []DumpHint{
+			{Description: "To list the contents", Command: fmt.Sprintf("pg_restore --list %s", localPath)},
+			{Description: "To import", Command: fmt.Sprintf("%s %s", pgRestore, localPath)},
+		}
+	case "directory":
+		return []DumpHint{
+			{Description: "To unpack", Command: fmt.Sprintf("mkdir dump.dir && tar -xf %s -C dump.dir", localPath)},
+			{Description: "To import", Command: fmt.Sprintf("%s dump.dir", pgRestore)},
+		}
+	}
+
+	return []DumpHint{
+		{Description: "To unpack", Command: fmt.Sprintf("%s > dump.sql", e.config.Compression.DecompressCommand(localPath))},
+		{Description: "To import", Command: fmt.Sprintf("%s | psql --host 127.0.0.1 --port 5432 --username=%s %s", e.config.Compression.DecompressCommand(localPath), e.config.User, e.config.DB)},
+	}
 }
@@ -1,3 +1,5 @@
+//go:build kind
+
 package lib_test
 
 import (
@@ -50,10 +52,28 @@ func TestDumpAndRestorePostgres(t *testing.T) {
 		t.Fatal("ensure free space failed: ", err)
 	}
 
-	if err := lib.DumpPostgres(namespace, false, postgresConfig); err != nil {
+	result, err := lib.DumpPostgres(namespace, false, postgresConfig)
+	if err != nil {
 		t.Fatal("backup Postgres failed: ", err)
 	}
 
+	if result.Annotations[lib.DumpManifestAnnotation(postgresConfig.Name)] == "" {
+		t.Fatal("dump manifest annotation missing")
+	}
+
+	manifest, err := lib.ReadDumpManifest(namespace, postgresConfig.ExecResource, postgresConfig.ExecContainer, postgresConfig.DumpFile)
+	if err != nil || manifest == nil {
+		t.Fatal("read dump manifest failed: ", err)
+	}
+
+	checksum, err := lib.GetRemoteFileChecksum(namespace, postgresConfig.ExecResource, postgresConfig.ExecContainer, postgresConfig.DumpFile)
+	if err != nil {
+		t.Fatal("get remote file checksum failed: ", err)
+	}
+	if err := manifest.Verify(checksum, result.SizeBytes); err != nil {
+		t.Fatal("dump does not match its manifest: ", err)
+	}
+
 	timestamp, err := lib.GetRemoteFileTimestamp(namespace, postgresConfig.ExecResource, postgresConfig.ExecContainer, postgresConfig.DumpFile)
 	if err != nil {
 		t.Fatal("get remote file timestamp failed: ", err)
@@ -91,3 +111,87 @@ func TestDumpAndRestorePostgres(t *testing.T) {
 	}
 
 }
+
+func TestDumpAndRestorePostgresAllDatabases(t *testing.T) {
+	namespace := "postgres-test"
+
+	postgresConfig := lib.PostgresConfig{
+		Enabled:       true,
+		ExecResource:  "deployment/postgres",
+		ExecContainer: "postgres",
+		DumpFile:      "/var/lib/postgresql/data/dump.all",
+		DumpFormat:    "custom",
+		Jobs:          2,
+		AllDatabases:  true,
+		User:          "${POSTGRES_USER}",     // read inside container
+		Password:      "${POSTGRES_PASSWORD}", // read inside container
+		DB:            "${POSTGRES_DB}",       // read inside container
+		Host:          "127.0.0.1",
+		Port:          "5432",
+	}
+
+	if err := lib.EnsurePostgresAvailable(namespace, postgresConfig); err != nil {
+		t.Fatal("ensure Postgres available failed: ", err)
+	}
+
+	result, err := lib.DumpPostgres(namespace, false, postgresConfig)
+	if err != nil {
+		t.Fatal("backup Postgres failed: ", err)
+	}
+
+	if result.SizeBytes <= 0 {
+		t.Fatal("dump size of all databases is empty")
+	}
+
+	if err := lib.RestorePostgres(namespace, false, postgresConfig); err != nil {
+		t.Fatal("restore Postgres failed: ", err)
+	}
+}
+
+func TestVerifyPostgres(t *testing.T) {
+	namespace := "postgres-test"
+
+	postgresConfig := lib.PostgresConfig{
+		Enabled:       true,
+		Name:          "postgres",
+		ExecResource:  "deployment/postgres",
+		ExecContainer: "postgres",
+		DumpFile:      "/var/lib/postgresql/data/dump_verify.sql.gz",
+		User:          "${POSTGRES_USER}",     // read inside container
+		Password:      "${POSTGRES_PASSWORD}", // read inside container
+		DB:            "${POSTGRES_DB}",       // read inside container
+		Host:          "127.0.0.1",
+		Port:          "5432",
+		VerifySQL:     "SELECT count(*) = 3 FROM verify_test;",
+	}
+
+	if err := lib.KubectlExecCommand(namespace, postgresConfig.ExecResource, postgresConfig.ExecContainer,
+		`PGPASSWORD="${POSTGRES_PASSWORD}" psql --host 127.0.0.1 --username="${POSTGRES_USER}" "${POSTGRES_DB}" -c "DROP TABLE IF EXISTS verify_test; CREATE TABLE verify_test AS SELECT generate_series(1, 3) AS id;"`); err != nil {
+		t.Fatal("create test table failed: ", err)
+	}
+
+	if _, err := lib.DumpPostgres(namespace, false, postgresConfig); err != nil {
+		t.Fatal("backup Postgres failed: ", err)
+	}
+
+	result, err := lib.VerifyPostgres(namespace, postgresConfig, lib.VerifyConfig{ReadyTimeout: "5m", MaxDuration: "15m"})
+	if err != nil {
+		t.Fatal("verify Postgres failed: ", err)
+	}
+	if !result.Passed {
+		t.Fatal("verify Postgres did not pass: ", result.Error)
+	}
+	if result.RowCounts["public.verify_test"] != 3 {
+		t.Fatalf("expected 3 restored rows in public.verify_test, got %v", result.RowCounts)
+	}
+
+	postgresConfig.VerifySQL = "SELECT count(*) = 4 FROM verify_test;"
+
+	result, err = lib.VerifyPostgres(namespace, postgresConfig, lib.VerifyConfig{ReadyTimeout: "5m", MaxDuration: "15m"})
+	if err != nil {
+		t.Fatal("verify Postgres failed: ", err)
+	}
+	if result.Passed {
+		t.Fatal("verify Postgres passed despite the failing BAK_DB_POSTGRES_VERIFY_SQL")
+	}
+}
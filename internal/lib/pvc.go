@@ -1,40 +1,65 @@
 package lib
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os/exec"
+	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
 )
 
 func EnsurePVCAvailable(namespace, pvcName string) error {
-	log.Printf("Checking if PVC '%s' exists in namespace '%s'...", pvcName, namespace)
-	// #nosec G204
-	cmd := exec.Command("kubectl", "get", "pvc", pvcName, "-n", namespace)
-	output, err := cmd.CombinedOutput()
+	slog.Info("Checking if PVC exists...", "namespace", namespace, "pvc", pvcName)
+
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	pvc, err := client.GetPersistentVolumeClaim(context.Background(), namespace, pvcName)
 	if err != nil {
 		return fmt.Errorf("PVC '%s' not found in namespace '%s': %w", pvcName, namespace, err)
 	}
-	log.Printf("PVC '%s' is available in namespace '%s'. Output:\n%s", pvcName, namespace, string(output))
+	slog.Info("PVC is available", "namespace", namespace, "pvc", pvcName, "phase", pvc.Status.Phase, "volume", pvc.Spec.VolumeName)
 	return nil
 }
 
+// ListPVCNames returns the names of the PVCs matching the label selector (e.g. BAK_VGS_SELECTOR).
+func ListPVCNames(namespace, labelSelector string) ([]string, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pvcs, err := client.ListPersistentVolumeClaims(context.Background(), namespace, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(pvcs))
+	for _, pvc := range pvcs {
+		names = append(names, pvc.Name)
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
+
 func EnsureFreeSpace(namespace, resource, container, dir string, thresholdSpaceUsedPercent int) error {
-	log.Printf("Checking free space on %s in namespace '%s'...", dir, namespace)
-	// #nosec G204
-	cmd := exec.Command("kubectl", "exec", "-n", namespace, resource, "-c", container, "--", "df", "-hP", dir)
-	output, err := cmd.Output()
+	slog.Info("Checking free space...", "namespace", namespace, "resource", resource, "dir", dir)
+
+	output, err := execInResource(namespace, resource, container, []string{"df", "-hP", dir}, nil)
 	if err != nil {
 		return fmt.Errorf("Error checking free space: %w", err)
 	}
-	lines := strings.Split(string(output), "\n")
+	lines := strings.Split(output, "\n")
 	if len(lines) < 2 {
-		return fmt.Errorf("Unexpected df output: %s", string(output))
+		return fmt.Errorf("Unexpected df output: %s", output)
 	}
 	fields := strings.Fields(lines[1])
 	if len(fields) < 5 {
-		return fmt.Errorf("Unexpected df output: %s", string(output))
+		return fmt.Errorf("Unexpected df output: %s", output)
 	}
 	usedPercent, err := strconv.Atoi(strings.TrimRight(fields[4], "%"))
 	if err != nil {
@@ -44,6 +69,7 @@ func EnsureFreeSpace(namespace, resource, container, dir string, thresholdSpaceU
 		return fmt.Errorf("Not enough free space. Used: %d%%, Threshold: %d%%", usedPercent, thresholdSpaceUsedPercent)
 	}
 
-	log.Printf("Free space check succeeded. Used: %d%%, Threshold: %d%%. Output:\n%s", usedPercent, thresholdSpaceUsedPercent, string(output))
+	slog.Info("Free space check succeeded", "namespace", namespace, "dir", dir, "used_percent", usedPercent, "threshold_percent", thresholdSpaceUsedPercent)
+	logOutputLines(strings.TrimSpace(output), "source", "df", "namespace", namespace, "resource", resource, "container", container)
 	return nil
 }
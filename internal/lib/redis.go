@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+)
+
+func EnsureRedisAvailable(namespace string, config RedisConfig) error {
+	slog.Info("Checking if Redis is available...", "namespace", namespace, "name", config.Name)
+
+	return KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().RedisCheck, config)
+}
+
+// DumpRedis lets redis persist a fresh RDB file (after rewriting the AOF if enabled) and verifies it.
+// Unlike the other engines, the dump file is written by redis itself and thus never removed on failure.
+func DumpRedis(namespace string, dryRun bool, config RedisConfig) (DumpResult, error) {
+	if dryRun {
+		slog.Info("Skipping Redis backup - dry run mode is active")
+		return DumpResult{Engine: "redis", Name: config.Name, DumpFile: config.DumpFile}, nil
+	}
+	slog.Info("Persisting Redis database...", "namespace", namespace, "name", config.Name)
+
+	// Create template data with computed fields
+	type templateData struct {
+		RedisConfig
+		DumpFileDir string
+		StatsFile   string
+	}
+	data := templateData{
+		RedisConfig: config,
+		DumpFileDir: filepath.Dir(config.DumpFile),
+		StatsFile:   dumpStatsFile(config.DumpFile),
+	}
+
+	start := time.Now()
+	if err := KubectlExecTemplate(namespace, config.ExecResource, config.ExecContainer, GetTemplateAtlas().RedisDump, data); err != nil {
+		return DumpResult{}, err
+	}
+	end := time.Now()
+
+	result := observeDump(namespace, "redis", config.Name, config.ExecResource, config.ExecContainer, config.DumpFile, end.Sub(start))
+
+	manifest := DumpManifest{Engine: "redis", Name: config.Name, DumpFile: config.DumpFile, Start: start.UTC(), End: end.UTC()}
+	if err := recordDumpManifest(namespace, config.ExecResource, config.ExecContainer, manifest, &result); err != nil {
+		return DumpResult{}, err
+	}
+
+	return result, nil
+}
+
+func init() {
+	RegisterEngine(EngineRegistration{
+		Name:           "redis",
+		Title:          "redis",
+		EnabledEnv:     "BAK_DB_REDIS",
+		DumpFileSuffix: ".rdb",
+		Instances: func(config Config) []Engine {
+			engines := []Engine{redisEngine{config: config.Redis}}
+			for _, c := range config.AdditionalRedis {
+				engines = append(engines, redisEngine{config: c})
+			}
+			return engines
+		},
+	})
+}
+
+type redisEngine struct {
+	config RedisConfig
+}
+
+func (e redisEngine) Name() string     { return "redis" }
+func (e redisEngine) Instance() string { return e.config.Name }
+func (e redisEngine) Enabled() bool    { return e.config.Enabled }
+
+func (e redisEngine) ExecTarget() (string, string) {
+	return e.config.ExecResource, e.config.ExecContainer
+}
+
+func (e redisEngine) DumpFile() string { return e.config.DumpFile }
+
+func (e redisEngine) Check(namespace string) error {
+	if err := EnsureResourceAvailable(namespace, e.config.ExecResource); err != nil {
+		return err
+	}
+	return EnsureRedisAvailable(namespace, e.config)
+}
+
+func (e redisEngine) Dump(namespace string, dryRun bool) (DumpResult, error) {
+	return DumpRedis(namespace, dryRun, e.config)
+}
+
+func (e redisEngine) Info(namespace string) (DumpInfo, error) {
+	return getDumpInfo(namespace, e)
+}
+
+func (e redisEngine) Shell(namespace string) error {
+	// Construct redis-cli command with proper quoting for bash -c
+	redisCliCmd := fmt.Sprintf(`redis-cli -h %s -p %s`,
+		e.config.Host,
+		e.config.Port,
+	)
+
+	// Interactive exec wrapped in bash -c
+	// Environment variable REDISCLI_AUTH is used instead of -a flag (only if the password is not empty)
+	return ExecInteractive(namespace, e.config.ExecResource, e.config.ExecContainer, []string{"bash", "-c", fmt.Sprintf(`PASSWORD="%s"; [ -z "${PASSWORD}" ] || export REDISCLI_AUTH="${PASSWORD}"; %s`, e.config.Password, redisCliCmd)})
+}
+
+func (e redisEngine) DumpHints(localPath string) []DumpHint {
+	return []DumpHint{
+		{Description: "To verify", Command: fmt.Sprintf("redis-check-rdb %s", localPath)},
+	}
+}
@@ -0,0 +1,83 @@
+//go:build kind
+
+package lib_test
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+)
+
+func TestDumpRedis(t *testing.T) {
+	vsName := fmt.Sprintf("test-backup-redis-%s", lib.GenerateRandomStringOrPanic(6))
+	namespace := "redis-test"
+
+	redisConfig := lib.RedisConfig{
+		Enabled:        true,
+		ExecResource:   "deployment/redis",
+		ExecContainer:  "redis",
+		DumpFile:       "/data/dump.rdb",
+		Host:           "127.0.0.1",
+		Port:           "6379",
+		Password:       "${REDIS_PASSWORD}", // read inside container
+		SaveTimeoutSec: 60,
+	}
+
+	labelVSConfig := lib.LabelVSConfig{
+		Type:       "adhoc",
+		Pod:        "gotest",
+		Retain:     "days",
+		RetainDays: 1,
+	}
+
+	if err := lib.EnsurePVCAvailable(namespace, "data"); err != nil {
+		t.Fatal("ensure pvc failed: ", err)
+	}
+
+	if err := lib.EnsureResourceAvailable(namespace, redisConfig.ExecResource); err != nil {
+		t.Fatal("ensure res failed: ", err)
+	}
+
+	if err := lib.EnsureRedisAvailable(namespace, redisConfig); err != nil {
+		t.Fatal("ensure Redis available failed: ", err)
+	}
+
+	if err := lib.EnsureFreeSpace(namespace, redisConfig.ExecResource, redisConfig.ExecContainer, filepath.Dir(redisConfig.DumpFile), 90); err != nil {
+		t.Fatal("ensure free space failed: ", err)
+	}
+
+	// the test deployment has AOF enabled, thus BGREWRITEAOF and BGSAVE are both exercised
+	if _, err := lib.DumpRedis(namespace, false, redisConfig); err != nil {
+		t.Fatal("backup Redis failed: ", err)
+	}
+
+	timestamp, err := lib.GetRemoteFileTimestamp(namespace, redisConfig.ExecResource, redisConfig.ExecContainer, redisConfig.DumpFile)
+	if err != nil {
+		t.Fatal("get remote file timestamp failed: ", err)
+	}
+
+	// Verify timestamp is recent (within last minute)
+	now := time.Now()
+	if !timestamp.After(now.Add(-1*time.Minute)) || !timestamp.Before(now) {
+		t.Fatal("rdb file timestamp not within expected range")
+	}
+
+	vsLabels := lib.GenerateVSLabels(namespace, "data", labelVSConfig, time.Now())
+	vsAnnotations := lib.GenerateVSAnnotations(lib.GetBAKEnvVars())
+
+	vsObject := lib.GenerateVSObject(namespace, "csi-hostpath-snapclass", "data", vsName, vsLabels, vsAnnotations)
+
+	if err := lib.CreateVolumeSnapshot(namespace, false, vsName, vsObject, false, "25s"); err != nil {
+		t.Fatal("create vs failed: ", err)
+	}
+
+	cmd := exec.Command("kubectl", "get", "vs", vsName, "-n", namespace)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatal("get vs failed: ", err, string(output))
+	}
+}
@@ -0,0 +1,196 @@
+package lib
+
+import (
+	"cmp"
+	"slices"
+)
+
+// The retention label keys that are set by GenerateVSLabels for the "daily_weekly_monthly" retain policy.
+const (
+	LabelDaily   = "backup-ns.sh/daily"
+	LabelWeekly  = "backup-ns.sh/weekly"
+	LabelMonthly = "backup-ns.sh/monthly"
+)
+
+// RetentionLabelRemoval is a single planned removal of a retention label from a VolumeSnapshot.
+type RetentionLabelRemoval struct {
+	Namespace  string
+	PVCName    string
+	VSName     string
+	LabelKey   string
+	LabelValue string
+}
+
+// PlanRetentionPolicy returns the retention labels that must be removed to enforce the retain config.
+// The vss are grouped by namespace and "backup-ns.sh/pvc" label. Per group only the newest N snapshots
+// (by CreationTime) keep their daily, weekly and monthly label, all older ones lose it.
+func PlanRetentionPolicy(vss []VolumeSnapshotInfo, config RetainConfig) []RetentionLabelRemoval {
+	type group struct {
+		namespace string
+		pvcName   string
+	}
+
+	groups := make(map[group][]VolumeSnapshotInfo)
+	for _, vs := range vss {
+		pvcName, ok := vs.Labels["backup-ns.sh/pvc"]
+		if !ok {
+			continue
+		}
+		g := group{namespace: vs.Namespace, pvcName: pvcName}
+		groups[g] = append(groups[g], vs)
+	}
+
+	// deterministic processing order
+	keys := make([]group, 0, len(groups))
+	for g := range groups {
+		keys = append(keys, g)
+	}
+	slices.SortFunc(keys, func(a, b group) int {
+		return cmp.Or(cmp.Compare(a.namespace, b.namespace), cmp.Compare(a.pvcName, b.pvcName))
+	})
+
+	retainCounts := []struct {
+		labelKey string
+		count    int
+	}{
+		{LabelDaily, config.LastDaily},
+		{LabelWeekly, config.LastWeekly},
+		{LabelMonthly, config.LastMonthly},
+	}
+
+	var removals []RetentionLabelRemoval
+
+	for _, g := range keys {
+		for _, rc := range retainCounts {
+			labeled := make([]VolumeSnapshotInfo, 0, len(groups[g]))
+			for _, vs := range groups[g] {
+				if _, ok := vs.Labels[rc.labelKey]; ok {
+					labeled = append(labeled, vs)
+				}
+			}
+
+			// newest first
+			slices.SortFunc(labeled, func(a, b VolumeSnapshotInfo) int {
+				return cmp.Or(b.CreationTime.Compare(a.CreationTime), cmp.Compare(b.Name, a.Name))
+			})
+
+			for i, vs := range labeled {
+				if i < rc.count {
+					continue
+				}
+
+				removals = append(removals, RetentionLabelRemoval{
+					Namespace:  vs.Namespace,
+					PVCName:    g.pvcName,
+					VSName:     vs.Name,
+					LabelKey:   rc.labelKey,
+					LabelValue: vs.Labels[rc.labelKey],
+				})
+			}
+		}
+	}
+
+	return keepGroupsTogether(vss, removals)
+}
+
+// keepGroupsTogether drops the removals planned for members of a VolumeGroupSnapshot ("backup-ns.sh/group" label)
+// unless the label is removed from all members, so a group keeps its retention labels as long as any of its pvcs
+// still needs them.
+func keepGroupsTogether(vss []VolumeSnapshotInfo, removals []RetentionLabelRemoval) []RetentionLabelRemoval {
+	type groupLabel struct {
+		namespace string
+		group     string
+		labelKey  string
+	}
+
+	groups := make(map[[2]string]string)
+	labeled := make(map[groupLabel]int)
+	for _, vs := range vss {
+		group := vs.Labels[LabelGroup]
+		if group == "" {
+			continue
+		}
+		groups[[2]string{vs.Namespace, vs.Name}] = group
+
+		for _, labelKey := range []string{LabelDaily, LabelWeekly, LabelMonthly} {
+			if _, ok := vs.Labels[labelKey]; ok {
+				labeled[groupLabel{namespace: vs.Namespace, group: group, labelKey: labelKey}]++
+			}
+		}
+	}
+
+	planned := make(map[groupLabel]int)
+	for _, r := range removals {
+		if group, ok := groups[[2]string{r.Namespace, r.VSName}]; ok {
+			planned[groupLabel{namespace: r.Namespace, group: group, labelKey: r.LabelKey}]++
+		}
+	}
+
+	kept := make([]RetentionLabelRemoval, 0, len(removals))
+	for _, r := range removals {
+		if group, ok := groups[[2]string{r.Namespace, r.VSName}]; ok {
+			k := groupLabel{namespace: r.Namespace, group: group, labelKey: r.LabelKey}
+			if planned[k] < labeled[k] {
+				continue
+			}
+		}
+		kept = append(kept, r)
+	}
+
+	return kept
+}
+
+// RetentionLabelCount is the number of VolumeSnapshots of a namespace and pvc carrying a retention label.
+type RetentionLabelCount struct {
+	Namespace string
+	PVCName   string
+	LabelKey  string
+	Count     int
+}
+
+// CountRetentionLabels returns the number of daily, weekly and monthly labels per namespace and "backup-ns.sh/pvc"
+// label that remain after the removals were applied (including zero counts), sorted by namespace, pvc and label.
+func CountRetentionLabels(vss []VolumeSnapshotInfo, removals []RetentionLabelRemoval) []RetentionLabelCount {
+	type key struct {
+		namespace string
+		pvcName   string
+		labelKey  string
+	}
+
+	removed := make(map[[3]string]struct{}, len(removals))
+	for _, r := range removals {
+		removed[[3]string{r.Namespace, r.VSName, r.LabelKey}] = struct{}{}
+	}
+
+	counts := make(map[key]int)
+	for _, vs := range vss {
+		pvcName, ok := vs.Labels["backup-ns.sh/pvc"]
+		if !ok {
+			continue
+		}
+
+		for _, labelKey := range []string{LabelDaily, LabelWeekly, LabelMonthly} {
+			k := key{namespace: vs.Namespace, pvcName: pvcName, labelKey: labelKey}
+			counts[k] += 0
+
+			if _, ok := vs.Labels[labelKey]; !ok {
+				continue
+			}
+			if _, ok := removed[[3]string{vs.Namespace, vs.Name, labelKey}]; ok {
+				continue
+			}
+			counts[k]++
+		}
+	}
+
+	result := make([]RetentionLabelCount, 0, len(counts))
+	for k, count := range counts {
+		result = append(result, RetentionLabelCount{Namespace: k.namespace, PVCName: k.pvcName, LabelKey: k.labelKey, Count: count})
+	}
+
+	slices.SortFunc(result, func(a, b RetentionLabelCount) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.PVCName, b.PVCName), cmp.Compare(a.LabelKey, b.LabelKey))
+	})
+
+	return result
+}
@@ -0,0 +1,90 @@
+package lib_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRetentionPolicy(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 1, d, 0, 17, 0, 0, time.UTC)
+	}
+
+	vss := []lib.VolumeSnapshotInfo{
+		{Namespace: "ns-a", Name: "data-1", CreationTime: day(1), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/daily": "2025-01-01", "backup-ns.sh/monthly": "2025-01"}},
+		{Namespace: "ns-a", Name: "data-2", CreationTime: day(2), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/daily": "2025-01-02"}},
+		{Namespace: "ns-a", Name: "data-3", CreationTime: day(3), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/daily": "2025-01-03"}},
+		{Namespace: "ns-a", Name: "data-6", CreationTime: day(6), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/daily": "2025-01-06", "backup-ns.sh/weekly": "w02"}},
+		// other pvc within the same namespace is retained separately
+		{Namespace: "ns-a", Name: "uploads-1", CreationTime: day(1), Labels: map[string]string{"backup-ns.sh/pvc": "uploads", "backup-ns.sh/daily": "2025-01-01"}},
+		// other namespace is retained separately
+		{Namespace: "ns-b", Name: "data-1", CreationTime: day(1), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/daily": "2025-01-01"}},
+		{Namespace: "ns-b", Name: "data-2", CreationTime: day(2), Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/daily": "2025-01-02"}},
+		// no pvc label, ignored
+		{Namespace: "ns-b", Name: "unknown", CreationTime: day(1), Labels: map[string]string{"backup-ns.sh/daily": "2025-01-01"}},
+	}
+
+	removals := lib.PlanRetentionPolicy(vss, lib.RetainConfig{LastDaily: 2, LastWeekly: 1, LastMonthly: 0})
+
+	require.Equal(t, []lib.RetentionLabelRemoval{
+		{Namespace: "ns-a", PVCName: "data", VSName: "data-2", LabelKey: "backup-ns.sh/daily", LabelValue: "2025-01-02"},
+		{Namespace: "ns-a", PVCName: "data", VSName: "data-1", LabelKey: "backup-ns.sh/daily", LabelValue: "2025-01-01"},
+		{Namespace: "ns-a", PVCName: "data", VSName: "data-1", LabelKey: "backup-ns.sh/monthly", LabelValue: "2025-01"},
+	}, removals)
+
+	require.Empty(t, lib.PlanRetentionPolicy(vss, lib.RetainConfig{LastDaily: 7, LastWeekly: 4, LastMonthly: 12}))
+}
+
+func TestPlanRetentionPolicyGroups(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 1, d, 0, 17, 0, 0, time.UTC)
+	}
+	member := func(name, pvc, group string, d int) lib.VolumeSnapshotInfo {
+		return lib.VolumeSnapshotInfo{Namespace: "ns-a", Name: name, CreationTime: day(d), Labels: map[string]string{
+			"backup-ns.sh/pvc": pvc, lib.LabelGroup: group, "backup-ns.sh/daily": day(d).Format(time.DateOnly),
+		}}
+	}
+
+	vss := []lib.VolumeSnapshotInfo{
+		member("g1-data", "data", "g1", 1),
+		member("g1-uploads", "uploads", "g1", 1),
+		member("g2-data", "data", "g2", 2),
+	}
+
+	// g1-uploads is still the newest daily of uploads, so g1-data keeps its label too
+	require.Empty(t, lib.PlanRetentionPolicy(vss, lib.RetainConfig{LastDaily: 1}))
+
+	vss = append(vss, member("g3-data", "data", "g3", 3), member("g3-uploads", "uploads", "g3", 3))
+
+	require.Equal(t, []lib.RetentionLabelRemoval{
+		{Namespace: "ns-a", PVCName: "data", VSName: "g2-data", LabelKey: "backup-ns.sh/daily", LabelValue: "2025-01-02"},
+		{Namespace: "ns-a", PVCName: "data", VSName: "g1-data", LabelKey: "backup-ns.sh/daily", LabelValue: "2025-01-01"},
+		{Namespace: "ns-a", PVCName: "uploads", VSName: "g1-uploads", LabelKey: "backup-ns.sh/daily", LabelValue: "2025-01-01"},
+	}, lib.PlanRetentionPolicy(vss, lib.RetainConfig{LastDaily: 1}))
+}
+
+func TestCountRetentionLabels(t *testing.T) {
+	vss := []lib.VolumeSnapshotInfo{
+		{Namespace: "ns-a", Name: "data-1", Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/daily": "2025-01-01", "backup-ns.sh/monthly": "2025-01"}},
+		{Namespace: "ns-a", Name: "data-2", Labels: map[string]string{"backup-ns.sh/pvc": "data", "backup-ns.sh/daily": "2025-01-02"}},
+		{Namespace: "ns-b", Name: "data-1", Labels: map[string]string{"backup-ns.sh/pvc": "data"}},
+		// no pvc label, ignored
+		{Namespace: "ns-b", Name: "unknown", Labels: map[string]string{"backup-ns.sh/daily": "2025-01-01"}},
+	}
+
+	removals := []lib.RetentionLabelRemoval{
+		{Namespace: "ns-a", PVCName: "data", VSName: "data-1", LabelKey: "backup-ns.sh/daily", LabelValue: "2025-01-01"},
+	}
+
+	require.Equal(t, []lib.RetentionLabelCount{
+		{Namespace: "ns-a", PVCName: "data", LabelKey: "backup-ns.sh/daily", Count: 1},
+		{Namespace: "ns-a", PVCName: "data", LabelKey: "backup-ns.sh/monthly", Count: 1},
+		{Namespace: "ns-a", PVCName: "data", LabelKey: "backup-ns.sh/weekly", Count: 0},
+		{Namespace: "ns-b", PVCName: "data", LabelKey: "backup-ns.sh/daily", Count: 0},
+		{Namespace: "ns-b", PVCName: "data", LabelKey: "backup-ns.sh/monthly", Count: 0},
+		{Namespace: "ns-b", PVCName: "data", LabelKey: "backup-ns.sh/weekly", Count: 0},
+	}, lib.CountRetentionLabels(vss, removals))
+}
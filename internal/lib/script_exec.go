@@ -2,10 +2,15 @@ package lib
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"log"
-	"os/exec"
+	"log/slog"
+	"os"
+	"strings"
 	"text/template"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"golang.org/x/term"
 )
 
 func KubectlExecTemplate(namespace, execResource, execContainer string, tmpl *template.Template, templateData any) error {
@@ -17,24 +22,95 @@ func KubectlExecTemplate(namespace, execResource, execContainer string, tmpl *te
 		return fmt.Errorf("Failed to populate data in templated script '%s': %w", tmplName, err)
 	}
 
-	// #nosec G204
-	cmd := exec.Command("kubectl", "exec", "-i", "-n", namespace, execResource, "-c", execContainer, "--", "bash", "-s")
-	cmd.Stdin = bytes.NewBufferString(script.String() + "\n")
-	output, err := cmd.CombinedOutput()
+	attrs := []any{"script", tmplName, "namespace", namespace, "resource", execResource, "container", execContainer}
+
+	output, err := execInResource(namespace, execResource, execContainer, []string{"bash", "-s"}, bytes.NewBufferString(script.String()+"\n"))
+	logOutputLines(output, attrs...)
 	if err != nil {
-		return fmt.Errorf("Error running templated script '%s': %w\nOutput: %s", tmplName, err, string(output))
+		return fmt.Errorf("Error running templated script '%s': %w", tmplName, err)
 	}
-	log.Printf("Templated script '%s' completed. Output:\n%s", tmplName, string(output))
+
+	slog.Info("Templated script completed", attrs...)
 	return nil
 }
 
 func KubectlExecCommand(namespace, execResource, execContainer, command string) error {
-	cmd := exec.Command("kubectl", "exec", "-n", namespace, execResource, "-c", execContainer, "--", "bash", "-c", command)
-	output, err := cmd.CombinedOutput()
+	attrs := []any{"command", command, "namespace", namespace, "resource", execResource, "container", execContainer}
+
+	output, err := execInResource(namespace, execResource, execContainer, []string{"bash", "-c", command}, nil)
+	logOutputLines(output, attrs...)
 	if err != nil {
-		return fmt.Errorf("Error executing command '%s': %w\nOutput: %s", command, err, string(output))
+		return fmt.Errorf("Error executing command '%s': %w", command, err)
 	}
 
-	log.Printf("ExecCommand completed. Output:\n%s", string(output))
+	slog.Info("ExecCommand completed", attrs...)
 	return nil
 }
+
+// logOutputLines logs every non-empty line of the (script) output as separate record with the given attributes.
+func logOutputLines(output string, attrs ...any) {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		slog.Info(line, append([]any{"stream", "output"}, attrs...)...)
+	}
+}
+
+// ExecInteractive attaches the local terminal (stdin/stdout/stderr) to the command running within the container of the
+// resource (kind/name). If stdin is a terminal, it is put into raw mode and a tty is allocated within the container.
+func ExecInteractive(namespace, execResource, execContainer string, command []string) error {
+	podName, err := GetPodFromResource(namespace, execResource)
+	if err != nil {
+		return err
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	opts := k8s.ExecOptions{
+		Namespace: namespace,
+		Pod:       podName,
+		Container: execContainer,
+		Command:   command,
+		Stdin:     os.Stdin,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+	}
+
+	fd := int(os.Stdin.Fd()) // #nosec G115
+	if term.IsTerminal(fd) {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to put terminal into raw mode: %w", err)
+		}
+		defer func() { _ = term.Restore(fd, oldState) }()
+
+		opts.TTY = true
+		opts.TerminalSizeQueue = &fixedTerminalSize{fd: fd}
+	}
+
+	return client.Exec(context.Background(), opts)
+}
+
+// fixedTerminalSize reports the size of the local terminal once (resizing while attached is not propagated).
+type fixedTerminalSize struct {
+	fd   int
+	sent bool
+}
+
+func (t *fixedTerminalSize) Next() *k8s.TerminalSize {
+	if t.sent {
+		return nil
+	}
+	t.sent = true
+
+	width, height, err := term.GetSize(t.fd)
+	if err != nil {
+		return nil
+	}
+
+	return &k8s.TerminalSize{Width: uint16(width), Height: uint16(height)} // #nosec G115
+}
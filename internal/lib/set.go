@@ -0,0 +1,127 @@
+package lib
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// LabelSet is the label shared by all VolumeSnapshots created by the same backup run (one per pvc in BAK_PVC_NAME).
+const LabelSet = "backup-ns.sh/set"
+
+// GenerateSetName returns the "backup-ns.sh/set" label value of a backup run.
+func GenerateSetName(vsRand string, now time.Time) string {
+	return fmt.Sprintf("%s-%s", now.Format("2006-01-02-150405"), vsRand)
+}
+
+// VolumeSnapshotSet are the VolumeSnapshots of a single backup run, which are listed and restored as a unit.
+type VolumeSnapshotSet struct {
+	Namespace string
+	Name      string
+	Snapshots []VolumeSnapshotInfo
+}
+
+// ReadyToUse is true if all snapshots of the set are ready.
+func (s VolumeSnapshotSet) ReadyToUse() bool {
+	for _, vs := range s.Snapshots {
+		if !vs.ReadyToUse {
+			return false
+		}
+	}
+	return true
+}
+
+// CreationTime is the creation time of the oldest snapshot of the set.
+func (s VolumeSnapshotSet) CreationTime() time.Time {
+	var creationTime time.Time
+	for _, vs := range s.Snapshots {
+		if creationTime.IsZero() || vs.CreationTime.Before(creationTime) {
+			creationTime = vs.CreationTime
+		}
+	}
+	return creationTime
+}
+
+// Group is the VolumeGroupSnapshot the set was created from ("" if the snapshots were created individually).
+func (s VolumeSnapshotSet) Group() string {
+	if len(s.Snapshots) == 0 {
+		return ""
+	}
+	return s.Snapshots[0].Labels[LabelGroup]
+}
+
+// PVCNames returns the pvc names of the snapshots in the set.
+func (s VolumeSnapshotSet) PVCNames() []string {
+	pvcNames := make([]string, 0, len(s.Snapshots))
+	for _, vs := range s.Snapshots {
+		pvcNames = append(pvcNames, vs.Labels["backup-ns.sh/pvc"])
+	}
+	return pvcNames
+}
+
+// GroupVolumeSnapshotSets groups the VolumeSnapshots by namespace and their "backup-ns.sh/set" label (snapshots without it are skipped).
+// Sets are ordered by namespace and creation time, the snapshots within a set by pvc name.
+func GroupVolumeSnapshotSets(vss []VolumeSnapshotInfo) []VolumeSnapshotSet {
+	type key struct {
+		namespace string
+		set       string
+	}
+
+	var keys []key
+	groups := make(map[key][]VolumeSnapshotInfo)
+
+	for _, vs := range vss {
+		set := vs.Labels[LabelSet]
+		if set == "" {
+			continue
+		}
+
+		k := key{namespace: vs.Namespace, set: set}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], vs)
+	}
+
+	sets := make([]VolumeSnapshotSet, 0, len(keys))
+	for _, k := range keys {
+		snapshots := groups[k]
+		slices.SortFunc(snapshots, func(a, b VolumeSnapshotInfo) int {
+			return cmp.Or(cmp.Compare(a.Labels["backup-ns.sh/pvc"], b.Labels["backup-ns.sh/pvc"]), cmp.Compare(a.Name, b.Name))
+		})
+		sets = append(sets, VolumeSnapshotSet{Namespace: k.namespace, Name: k.set, Snapshots: snapshots})
+	}
+
+	slices.SortFunc(sets, func(a, b VolumeSnapshotSet) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), a.CreationTime().Compare(b.CreationTime()), cmp.Compare(a.Name, b.Name))
+	})
+
+	return sets
+}
+
+// GetVolumeSnapshotSet returns the backup set in the namespace, it fails if the set has no snapshots
+// or multiple snapshots of the same pvc (so it can be restored as a unit).
+func GetVolumeSnapshotSet(namespace, set string) (VolumeSnapshotSet, error) {
+	vss, err := GetVolumeSnapshotInfos(namespace, fmt.Sprintf("%s=%s", LabelSet, set))
+	if err != nil {
+		return VolumeSnapshotSet{}, err
+	}
+
+	sets := GroupVolumeSnapshotSets(vss)
+	if len(sets) == 0 {
+		return VolumeSnapshotSet{}, fmt.Errorf("no VolumeSnapshots of set '%s' found in namespace '%s'", set, namespace)
+	}
+
+	pvcNames := sets[0].PVCNames()
+	for i, pvcName := range pvcNames {
+		if pvcName == "" {
+			return VolumeSnapshotSet{}, fmt.Errorf("VolumeSnapshot '%s' of set '%s' has no backup-ns.sh/pvc label", sets[0].Snapshots[i].Name, set)
+		}
+		if i > 0 && pvcNames[i-1] == pvcName {
+			return VolumeSnapshotSet{}, fmt.Errorf("set '%s' contains multiple VolumeSnapshots of pvc '%s'", set, pvcName)
+		}
+	}
+
+	return sets[0], nil
+}
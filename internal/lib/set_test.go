@@ -0,0 +1,53 @@
+package lib_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupVolumeSnapshotSets(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2025, 1, d, 0, 17, 0, 0, time.UTC)
+	}
+	labels := func(pvc, set string) map[string]string {
+		l := map[string]string{"backup-ns.sh/pvc": pvc}
+		if set != "" {
+			l[lib.LabelSet] = set
+		}
+		return l
+	}
+
+	vss := []lib.VolumeSnapshotInfo{
+		{Namespace: "ns-a", Name: "uploads-2", CreationTime: day(2).Add(time.Second), ReadyToUse: false, Labels: labels("uploads", "set-2")},
+		{Namespace: "ns-a", Name: "data-2", CreationTime: day(2), ReadyToUse: true, Labels: labels("data", "set-2")},
+		{Namespace: "ns-a", Name: "uploads-1", CreationTime: day(1), ReadyToUse: true, Labels: labels("uploads", "set-1")},
+		{Namespace: "ns-a", Name: "data-1", CreationTime: day(1), ReadyToUse: true, Labels: labels("data", "set-1")},
+		// created before backup sets existed, skipped
+		{Namespace: "ns-a", Name: "data-0", CreationTime: day(1), ReadyToUse: true, Labels: labels("data", "")},
+		// same set name in another namespace is another set
+		{Namespace: "ns-b", Name: "data-1", CreationTime: day(1), ReadyToUse: true, Labels: labels("data", "set-1")},
+	}
+
+	sets := lib.GroupVolumeSnapshotSets(vss)
+	require.Len(t, sets, 3)
+
+	require.Equal(t, "ns-a", sets[0].Namespace)
+	require.Equal(t, "set-1", sets[0].Name)
+	require.Equal(t, []string{"data", "uploads"}, sets[0].PVCNames())
+	require.True(t, sets[0].ReadyToUse())
+
+	require.Equal(t, "set-2", sets[1].Name)
+	require.Equal(t, "data-2", sets[1].Snapshots[0].Name)
+	require.Equal(t, day(2), sets[1].CreationTime())
+	require.False(t, sets[1].ReadyToUse())
+
+	require.Equal(t, "ns-b", sets[2].Namespace)
+	require.Equal(t, []string{"data"}, sets[2].PVCNames())
+}
+
+func TestGenerateSetName(t *testing.T) {
+	require.Equal(t, "2025-01-08-023042-abc123", lib.GenerateSetName("abc123", time.Date(2025, 1, 8, 2, 30, 42, 0, time.UTC)))
+}
@@ -10,12 +10,20 @@ import (
 var templates embed.FS
 
 type TemplateAtlas struct {
+	MongoCheck      *template.Template
+	MongoDump       *template.Template
+	MongoRestore    *template.Template
 	MySQLCheck      *template.Template
 	MySQLDump       *template.Template
+	MySQLReady      *template.Template
 	MySQLRestore    *template.Template
+	MySQLVerify     *template.Template
 	PostgresCheck   *template.Template
 	PostgresDump    *template.Template
 	PostgresRestore *template.Template
+	PostgresVerify  *template.Template
+	RedisCheck      *template.Template
+	RedisDump       *template.Template
 	TestTrap        *template.Template
 }
 
@@ -29,12 +37,20 @@ func init() {
 	}
 
 	templateAtlas = TemplateAtlas{
+		MongoCheck:      ensureChildTemplate(tmpl, "mongo_check.sh.tmpl"),
+		MongoDump:       ensureChildTemplate(tmpl, "mongo_dump.sh.tmpl"),
+		MongoRestore:    ensureChildTemplate(tmpl, "mongo_restore.sh.tmpl"),
 		MySQLCheck:      ensureChildTemplate(tmpl, "mysql_check.sh.tmpl"),
 		MySQLDump:       ensureChildTemplate(tmpl, "mysql_dump.sh.tmpl"),
+		MySQLReady:      ensureChildTemplate(tmpl, "mysql_ready.sh.tmpl"),
 		MySQLRestore:    ensureChildTemplate(tmpl, "mysql_restore.sh.tmpl"),
+		MySQLVerify:     ensureChildTemplate(tmpl, "mysql_verify.sh.tmpl"),
 		PostgresCheck:   ensureChildTemplate(tmpl, "postgres_check.sh.tmpl"),
 		PostgresDump:    ensureChildTemplate(tmpl, "postgres_dump.sh.tmpl"),
 		PostgresRestore: ensureChildTemplate(tmpl, "postgres_restore.sh.tmpl"),
+		PostgresVerify:  ensureChildTemplate(tmpl, "postgres_verify.sh.tmpl"),
+		RedisCheck:      ensureChildTemplate(tmpl, "redis_check.sh.tmpl"),
+		RedisDump:       ensureChildTemplate(tmpl, "redis_dump.sh.tmpl"),
 		TestTrap:        ensureChildTemplate(tmpl, "test_trap.sh.tmpl"),
 	}
 
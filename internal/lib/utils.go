@@ -1,55 +1,49 @@
 package lib
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
-	"os/exec"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"github.com/allaboutapps/backup-ns/internal/lib/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func EnsureResourceAvailable(namespace, resource string) error {
-	log.Printf("Checking if resource '%s' exists in namespace '%s'...", resource, namespace)
+	slog.Info("Checking if resource exists...", "namespace", namespace, "resource", resource)
 
-	cmd := exec.Command("kubectl", "get", "-n", namespace, resource, "-o", "wide")
-	output, err := cmd.CombinedOutput()
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
 
+	obj, err := client.GetResource(context.Background(), namespace, resource)
 	if err != nil {
-		return fmt.Errorf("Error checking resource availability: %w\nOutput: %s", err, string(output))
+		return fmt.Errorf("Error checking resource availability: %w", err)
 	}
-	log.Printf("Resource '%s' is available in namespace '%s'. Output:\n%s", resource, namespace, string(output))
+	slog.Info("Resource is available", "namespace", namespace, "resource", resource, "kind", obj.GetKind(), "uid", obj.GetUID())
 	return nil
 }
 
 func GetCurrentNamespace() (string, error) {
-	cmd := exec.Command("kubectl", "config", "view", "--minify", "--output", "jsonpath={..namespace}")
-	output, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("error getting current namespace: %w", err)
-	}
-	return string(output), nil
+	return k8s.CurrentNamespace()
 }
 
 func GetRemoteFileTimestamp(namespace, execResource, execContainer, absolutePathToFile string) (time.Time, error) {
-	cmd := exec.Command("kubectl",
-		"exec",
-		"-n", namespace,
-		"-c", execContainer,
-		execResource,
-		"--",
-		"stat",
-		"-c", "%Y",
-		absolutePathToFile,
-	)
-
-	output, err := cmd.Output()
+	output, err := execInResource(namespace, execResource, execContainer, []string{"stat", "-c", "%Y", absolutePathToFile}, nil)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to get file timestamp: %w", err)
 	}
 
-	unixTimestamp, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	unixTimestamp, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to parse timestamp: %w", err)
 	}
@@ -57,6 +51,51 @@ func GetRemoteFileTimestamp(namespace, execResource, execContainer, absolutePath
 	return time.Unix(unixTimestamp, 0), nil
 }
 
+// GetRemoteFileSize returns the size of the file, for directories (e.g. pg_dump --format=directory) the total size of all files within.
+func GetRemoteFileSize(namespace, execResource, execContainer, absolutePathToFile string) (int64, error) {
+	script := `if [ -d "$1" ]; then find "$1" -type f -exec stat -c %s {} + | awk '{ s += $1 } END { print s + 0 }'; else stat -c %s "$1"; fi`
+
+	output, err := execInResource(namespace, execResource, execContainer, []string{"sh", "-c", script, "sh", absolutePathToFile}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file size: %w", err)
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse file size: %w", err)
+	}
+
+	return size, nil
+}
+
+// DumpResult describes a successfully created database dump.
+type DumpResult struct {
+	Engine          string  `json:"engine"`
+	Name            string  `json:"name"`
+	DumpFile        string  `json:"dumpFile"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	SizeBytes       int64   `json:"sizeBytes"`
+
+	// Additional volume snapshot annotations describing the dump (e.g. the mysql binlog coordinates)
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// observeDump records the duration and the resulting file size of a successful dump.
+func observeDump(namespace, engine, name, execResource, execContainer, dumpFile string, duration time.Duration) DumpResult {
+	result := DumpResult{Engine: engine, Name: name, DumpFile: dumpFile, DurationSeconds: duration.Seconds()}
+	metrics.DumpDuration.WithLabelValues(namespace, engine, name).Set(result.DurationSeconds)
+
+	size, err := GetRemoteFileSize(namespace, execResource, execContainer, dumpFile)
+	if err != nil {
+		slog.Warn("Ignoring error while getting the dump file size", "namespace", namespace, "dump_file", dumpFile, "error", err)
+		return result
+	}
+
+	result.SizeBytes = size
+	metrics.DumpSize.WithLabelValues(namespace, engine, name).Set(float64(size))
+	return result
+}
+
 // Returns a --selector compatible string (e.g. app=postgres) from a resource in the format kind/name
 func GetSelectorFromResource(namespace, resource string) (string, error) {
 	parts := strings.Split(resource, "/")
@@ -64,57 +103,173 @@ func GetSelectorFromResource(namespace, resource string) (string, error) {
 		return "", fmt.Errorf("invalid resource format, expected kind/name, got: %s", resource)
 	}
 
-	// Get selector from resource
-	cmd := exec.Command("kubectl",
-		"get",
-		"-n", namespace,
-		resource,
-		"-o", "jsonpath={.spec.selector.matchLabels}")
+	client, err := getClient()
+	if err != nil {
+		return "", err
+	}
 
-	output, err := cmd.Output()
+	// Get selector from resource
+	obj, err := client.GetResource(context.Background(), namespace, resource)
 	if err != nil {
 		return "", fmt.Errorf("failed to get resource selector: %w", err)
 	}
 
-	// Parse JSON map
-	var labels map[string]string
-	if err := json.Unmarshal(output, &labels); err != nil {
+	labels, ok, err := unstructured.NestedStringMap(obj.Object, "spec", "selector", "matchLabels")
+	if err != nil {
 		return "", fmt.Errorf("failed to parse selector labels: %w", err)
 	}
+	if !ok || len(labels) == 0 {
+		return "", fmt.Errorf("resource %s in namespace %s has no .spec.selector.matchLabels", resource, namespace)
+	}
 
 	// Convert to key=value format
-	var selectorParts []string
-	for k, v := range labels {
-		selectorParts = append(selectorParts, fmt.Sprintf("%s=%s", k, v))
+	selectorParts := make([]string, 0, len(labels))
+	for _, k := range sortedKeys(labels) {
+		selectorParts = append(selectorParts, fmt.Sprintf("%s=%s", k, labels[k]))
 	}
 
 	return strings.Join(selectorParts, ","), nil
 }
 
+// GetPodFromResource returns the name of a running pod backing the resource in the format kind/name.
+// Pods (pod/name) are returned as is, for all other kinds the first running pod (sorted by name) matching the
+// .spec.selector.matchLabels of the resource is returned.
 func GetPodFromResource(namespace, resource string) (string, error) {
+	kind, name, ok := strings.Cut(resource, "/")
+	if ok && slices.Contains([]string{"pod", "pods", "po"}, strings.ToLower(kind)) {
+		return name, nil
+	}
+
 	selector, err := GetSelectorFromResource(namespace, resource)
+	if err != nil {
+		return "", err
+	}
 
+	client, err := getClient()
 	if err != nil {
 		return "", err
 	}
 
 	// Get first pod using selector
-	podCmd := exec.Command("kubectl",
-		"get",
-		"pods",
-		"-n", namespace,
-		"--selector", selector,
-		"-o", "jsonpath={.items[0].metadata.name}")
-
-	podOutput, err := podCmd.Output()
+	pods, err := client.ListPods(context.Background(), namespace, selector)
 	if err != nil {
 		return "", fmt.Errorf("failed to get pod name: %w", err)
 	}
 
-	podName := strings.TrimSpace(string(podOutput))
-	if podName == "" {
-		return "", fmt.Errorf("no pod found for %s in namespace %s", resource, namespace)
+	slices.SortFunc(pods, func(a, b corev1.Pod) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			return pod.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w for %s in namespace %s", k8s.ErrNoPodFound, resource, namespace)
+}
+
+// execInResource runs the command within the container of the resource (kind/name) and returns the combined output.
+func execInResource(namespace, execResource, execContainer string, command []string, stdin io.Reader) (string, error) {
+	podName, err := GetPodFromResource(namespace, execResource)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return "", err
+	}
+
+	var output syncBuffer
+
+	err = client.Exec(context.Background(), k8s.ExecOptions{
+		Namespace: namespace,
+		Pod:       podName,
+		Container: execContainer,
+		Command:   command,
+		Stdin:     stdin,
+		Stdout:    &output,
+		Stderr:    &output,
+	})
+
+	return output.String(), err
+}
+
+// CopyFileFromResource copies the file at srcPath within the container of the resource (kind/name) to the local dstPath.
+// The copy is retried (from scratch) up to retries times on failure.
+func CopyFileFromResource(namespace, execResource, execContainer, srcPath, dstPath string, retries int) error {
+	return copyFromResource(namespace, execResource, execContainer, srcPath, dstPath, retries, copyFileFromPod)
+}
+
+// CopyDirFromResource copies the directory at srcPath within the container of the resource (kind/name) as uncompressed
+// tar archive (tar must be available in the container) to the local dstPath. The copy is retried like CopyFileFromResource.
+func CopyDirFromResource(namespace, execResource, execContainer, srcPath, dstPath string, retries int) error {
+	return copyFromResource(namespace, execResource, execContainer, srcPath, dstPath, retries, copyDirFromPod)
+}
+
+type copyFromPodFunc func(client k8s.Client, namespace, podName, container, srcPath, dstPath string) error
+
+func copyFromResource(namespace, execResource, execContainer, srcPath, dstPath string, retries int, copyFromPod copyFromPodFunc) error {
+	podName, err := GetPodFromResource(namespace, execResource)
+	if err != nil {
+		return err
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = copyFromPod(client, namespace, podName, execContainer, srcPath, dstPath)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= retries {
+			return fmt.Errorf("failed to copy '%s' from pod '%s' in namespace '%s' after %d attempts: %w", srcPath, podName, namespace, attempt+1, err)
+		}
+
+		slog.Warn("Retrying copy from pod", "namespace", namespace, "pod", podName, "path", srcPath, "attempt", attempt+1, "retries", retries, "error", err)
+	}
+}
+
+func copyFileFromPod(client k8s.Client, namespace, podName, container, srcPath, dstPath string) error {
+	// #nosec G304
+	f, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local file '%s': %w", dstPath, err)
+	}
+
+	if err := client.CopyFromPod(context.Background(), namespace, podName, container, srcPath, f); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func copyDirFromPod(client k8s.Client, namespace, podName, container, srcPath, dstPath string) error {
+	// #nosec G304
+	f, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local file '%s': %w", dstPath, err)
+	}
+
+	var stderr syncBuffer
+
+	if err := client.Exec(context.Background(), k8s.ExecOptions{
+		Namespace: namespace,
+		Pod:       podName,
+		Container: container,
+		Command:   []string{"tar", "-cf", "-", "-C", srcPath, "."},
+		Stdout:    f,
+		Stderr:    &stderr,
+	}); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to copy directory '%s' from pod %s/%s: %w (stderr: %s)", srcPath, namespace, podName, err, stderr.String())
 	}
 
-	return podName, nil
+	return f.Close()
 }
@@ -1,3 +1,5 @@
+//go:build kind
+
 package lib_test
 
 import (
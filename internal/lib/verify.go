@@ -0,0 +1,462 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// The container of the verifier pod (a copy of the database container without its volumes).
+	verifierContainer = "verify"
+
+	// The emptyDir within the verifier container the dump file and its manifest are copied to.
+	verifierDumpDir = "/backup-ns-verify"
+)
+
+// VerifyConfig configures the test-restores of the dumps into ephemeral databases ("backup-ns <engine> verify").
+type VerifyConfig struct {
+	ReadyTimeout string `json:"BAK_VERIFY_READY_TIMEOUT"`
+	MaxDuration  string `json:"BAK_VERIFY_MAX_DURATION"`
+}
+
+// DumpVerifier is optionally implemented by engines that can test-restore their current dump into an ephemeral database,
+// the "backup-ns <engine> verify" subcommand is only generated for them.
+type DumpVerifier interface {
+	// Verify restores the dump within a throwaway copy of the database container and runs the sanity checks.
+	// A dump that could not be restored or failed the checks is reported via VerifyResult.Passed (err is nil).
+	Verify(namespace string, config VerifyConfig) (VerifyResult, error)
+}
+
+// VerifyResult describes the test-restore of a dump, it is stored (without the row counts) in the
+// backup-ns.sh/<name>-verify volume snapshot annotation.
+type VerifyResult struct {
+	Engine          string    `json:"engine"`
+	Name            string    `json:"name"`
+	Passed          bool      `json:"passed"`
+	Verified        time.Time `json:"verified"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	DumpFile        string    `json:"dumpFile"`
+
+	// The sha256 of the verified dump (from its manifest, "" for dumps without manifest)
+	SHA256 string `json:"sha256,omitempty"`
+
+	// The image of the database container the dump was restored into
+	Image string `json:"image,omitempty"`
+
+	// The number of restored tables and their total rows
+	Tables int   `json:"tables"`
+	Rows   int64 `json:"rows"`
+
+	// The tables recorded in the manifest of the dump that were not restored
+	MissingTables []string `json:"missingTables,omitempty"`
+
+	Error string `json:"error,omitempty"`
+
+	// The exact rows per restored table
+	RowCounts map[string]int64 `json:"-"`
+}
+
+// VerifyAnnotation is the volume snapshot annotation holding the VerifyResult (json) of the dump of the database.
+func VerifyAnnotation(name string) string {
+	return fmt.Sprintf("backup-ns.sh/%s-verify", name)
+}
+
+// EvaluateVerifyStats sets the restored row counts ("rows\t<table>\t<count>" lines recorded by the verify scripts) and
+// checks that the tables recorded in the manifest (if any) were restored and that at least one table was restored.
+func (r *VerifyResult) EvaluateVerifyStats(stats string, manifest *DumpManifest) error {
+	restored := DumpManifest{}
+	restored.ApplyStats(stats)
+
+	r.RowCounts = restored.RowCounts
+	r.Tables = len(restored.RowCounts)
+	r.Rows = 0
+	for _, rows := range restored.RowCounts {
+		r.Rows += rows
+	}
+
+	r.MissingTables = nil
+	if manifest != nil {
+		for table := range manifest.RowCounts {
+			if _, ok := restored.RowCounts[table]; !ok {
+				r.MissingTables = append(r.MissingTables, table)
+			}
+		}
+		sort.Strings(r.MissingTables)
+	}
+
+	if len(r.MissingTables) > 0 {
+		return fmt.Errorf("%d of %d tables of the dump were not restored: %s", len(r.MissingTables), len(manifest.RowCounts), strings.Join(r.MissingTables, ", "))
+	}
+	if r.Tables == 0 {
+		return errors.New("no tables were restored")
+	}
+
+	return nil
+}
+
+// dumpVerification describes the engine specific steps of verifyDump.
+type dumpVerification struct {
+	engine        string
+	name          string
+	execResource  string
+	execContainer string
+	dumpFile      string
+	isDirectory   bool
+
+	// ready is the script executed (bash -s, thus secrets are not visible as arguments) within the verifier container
+	// until it succeeds (the database accepts connections)
+	ready string
+
+	// restore restores the dump file copied to the verifier container (exec resource "pod/<name>") and runs the sanity
+	// checks, which record the restored tables in the stats file of the dump file (see dumpStatsFile)
+	restore func(execResource, dumpFile string) error
+}
+
+// verifyDump starts a throwaway copy of the database container (same image, command and env, without volumes), waits until
+// its empty database is ready, copies the dump file (and its manifest) into it, restores it and evaluates the sanity checks.
+// The verifier pod is always deleted afterwards.
+func verifyDump(namespace string, config VerifyConfig, v dumpVerification) (VerifyResult, error) {
+	start := time.Now()
+	result := VerifyResult{Engine: v.engine, Name: v.name, DumpFile: v.dumpFile}
+
+	finish := func(err error) (VerifyResult, error) {
+		result.Verified = time.Now().UTC()
+		result.DurationSeconds = time.Since(start).Seconds()
+		result.Passed = err == nil
+		if err != nil {
+			result.Error = err.Error()
+			slog.Error("Dump verification failed", "namespace", namespace, "engine", v.engine, "name", v.name, "error", err)
+		} else {
+			slog.Info("Dump verification passed", "namespace", namespace, "engine", v.engine, "name", v.name, "tables", result.Tables, "rows", result.Rows)
+		}
+		return result, nil
+	}
+
+	manifest, err := verifyDumpManifest(namespace, v.execResource, v.execContainer, v.dumpFile)
+	if errors.Is(err, ErrDumpManifestMismatch) {
+		return finish(err)
+	}
+	if err != nil {
+		return result, err
+	}
+	if manifest != nil {
+		result.SHA256 = manifest.SHA256
+	} else {
+		slog.Warn("No dump manifest found, the restored tables cannot be compared", "namespace", namespace, "dump_file", v.dumpFile)
+	}
+
+	readyTimeout, err := parseTimeout(config.ReadyTimeout)
+	if err != nil {
+		return result, err
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return result, err
+	}
+
+	pod, err := createVerifierPod(namespace, v, config)
+	if err != nil {
+		return result, err
+	}
+	result.Image = pod.Spec.Containers[0].Image
+
+	defer func() {
+		if err := client.DeletePod(context.Background(), namespace, pod.Name); err != nil {
+			slog.Error("Failed to delete verifier pod", "namespace", namespace, "pod", pod.Name, "error", err)
+			return
+		}
+		slog.Info("Deleted verifier pod", "namespace", namespace, "pod", pod.Name)
+	}()
+
+	verifierResource := "pod/" + pod.Name
+
+	if err := waitForPodReady(context.Background(), namespace, pod.Name, verifierContainer, v.ready, readyTimeout); err != nil {
+		return result, err
+	}
+
+	verifierDumpFile := filepath.Join(verifierDumpDir, filepath.Base(v.dumpFile))
+	if err := copyDumpToVerifier(namespace, v, manifest != nil, pod.Name, verifierDumpFile); err != nil {
+		return finish(fmt.Errorf("failed to copy the dump into the verifier pod: %w", err))
+	}
+
+	restoreErr := v.restore(verifierResource, verifierDumpFile)
+
+	stats, err := execInResource(namespace, verifierResource, verifierContainer, []string{"sh", "-c", `if [ -f "$1" ]; then cat "$1"; fi`, "sh", dumpStatsFile(verifierDumpFile)}, nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to read the verify stats: %w (output: %s)", err, stats)
+	}
+
+	statsErr := result.EvaluateVerifyStats(stats, manifest)
+	if restoreErr != nil {
+		return finish(restoreErr)
+	}
+
+	return finish(statsErr)
+}
+
+// createVerifierPod creates a copy of the database container of the exec resource (image, command, args and env) with
+// an emptyDir for the dump instead of its volumes, deleted by k8s after BAK_VERIFY_MAX_DURATION at the latest.
+func createVerifierPod(namespace string, v dumpVerification, config VerifyConfig) (*corev1.Pod, error) {
+	maxDuration, err := parseTimeout(config.MaxDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	podName, err := GetPodFromResource(namespace, v.execResource)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := client.GetPod(context.Background(), namespace, podName)
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.IndexFunc(source.Spec.Containers, func(c corev1.Container) bool { return c.Name == v.execContainer })
+	if i < 0 {
+		return nil, fmt.Errorf("pod '%s' in namespace '%s' has no container '%s'", podName, namespace, v.execContainer)
+	}
+	container := source.Spec.Containers[i]
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      fmt.Sprintf("backup-ns-verify-%s-%s", strings.ToLower(v.name), GenerateRandomStringOrPanic(6)),
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "backup-ns",
+				"backup-ns.sh/verify":          v.name,
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:    corev1.RestartPolicyNever,
+			ImagePullSecrets: source.Spec.ImagePullSecrets,
+			SecurityContext:  source.Spec.SecurityContext,
+			Containers: []corev1.Container{{
+				Name:            verifierContainer,
+				Image:           container.Image,
+				Command:         container.Command,
+				Args:            container.Args,
+				Env:             container.Env,
+				EnvFrom:         container.EnvFrom,
+				SecurityContext: container.SecurityContext,
+				VolumeMounts:    []corev1.VolumeMount{{Name: "verify", MountPath: verifierDumpDir}},
+			}},
+			Volumes: []corev1.Volume{{Name: "verify", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+		},
+	}
+
+	if maxDuration > 0 {
+		seconds := int64(maxDuration.Seconds())
+		pod.Spec.ActiveDeadlineSeconds = &seconds
+	}
+
+	created, err := client.CreatePod(context.Background(), pod)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Created verifier pod", "namespace", namespace, "pod", created.Name, "image", container.Image, "source_pod", podName)
+	return created, nil
+}
+
+// waitForPodReady waits until the pod is running and the ready script (if any) succeeds within the container.
+func waitForPodReady(ctx context.Context, namespace, podName, container, ready string, timeout time.Duration) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err = wait.PollUntilContextCancel(ctx, pollInterval, true, func(ctx context.Context) (bool, error) {
+		pod, err := client.GetPod(ctx, namespace, podName)
+		if err != nil {
+			if k8s.IsNotFound(err) {
+				return false, err
+			}
+			slog.Warn("Retrying to get pod", "namespace", namespace, "pod", podName, "error", err)
+			return false, nil
+		}
+
+		switch pod.Status.Phase {
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return false, fmt.Errorf("pod terminated (phase %s)", pod.Status.Phase)
+		case corev1.PodRunning:
+		default:
+			for _, status := range pod.Status.ContainerStatuses {
+				if status.State.Waiting != nil && slices.Contains([]string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError"}, status.State.Waiting.Reason) {
+					return false, fmt.Errorf("pod cannot start: %s: %s", status.State.Waiting.Reason, status.State.Waiting.Message)
+				}
+			}
+			return false, nil
+		}
+
+		if ready == "" {
+			return true, nil
+		}
+
+		_, err = execInResource(namespace, "pod/"+podName, container, []string{"bash", "-s"}, strings.NewReader(ready+"\n"))
+		return err == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("pod '%s' did not become ready: %w", podName, err)
+	}
+
+	slog.Info("Pod is ready", "namespace", namespace, "pod", podName)
+	return nil
+}
+
+// copyDumpToVerifier streams the dump file (directories as tar archive) and its manifest from the database container into
+// the verifier container.
+func copyDumpToVerifier(namespace string, v dumpVerification, withManifest bool, podName, verifierDumpFile string) error {
+	src, dst := []string{"cat", v.dumpFile}, []string{"sh", "-c", `cat > "$1"`, "sh", verifierDumpFile}
+	if v.isDirectory {
+		src = []string{"tar", "-cf", "-", "-C", v.dumpFile, "."}
+		dst = []string{"sh", "-c", `mkdir -p "$1" && tar -xf - -C "$1"`, "sh", verifierDumpFile}
+	}
+
+	if err := streamToPod(namespace, v.execResource, v.execContainer, src, podName, dst); err != nil {
+		return err
+	}
+
+	if withManifest {
+		if err := streamToPod(namespace, v.execResource, v.execContainer, []string{"cat", ManifestFile(v.dumpFile)}, podName, []string{"sh", "-c", `cat > "$1"`, "sh", ManifestFile(verifierDumpFile)}); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Copied dump into verifier pod", "namespace", namespace, "pod", podName, "dump_file", verifierDumpFile)
+	return nil
+}
+
+// streamToPod pipes the stdout of the command within the container of the resource to the stdin of the command within
+// the verifier container of the pod.
+func streamToPod(namespace, execResource, execContainer string, src []string, podName string, dst []string) error {
+	srcPod, err := GetPodFromResource(namespace, execResource)
+	if err != nil {
+		return err
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	var srcStderr, dstOutput syncBuffer
+
+	srcErr := make(chan error, 1)
+	go func() {
+		err := client.Exec(context.Background(), k8s.ExecOptions{
+			Namespace: namespace,
+			Pod:       srcPod,
+			Container: execContainer,
+			Command:   src,
+			Stdout:    writer,
+			Stderr:    &srcStderr,
+		})
+		writer.CloseWithError(err)
+		srcErr <- err
+	}()
+
+	err = client.Exec(context.Background(), k8s.ExecOptions{
+		Namespace: namespace,
+		Pod:       podName,
+		Container: verifierContainer,
+		Command:   dst,
+		Stdin:     reader,
+		Stdout:    &dstOutput,
+		Stderr:    &dstOutput,
+	})
+	reader.CloseWithError(io.ErrClosedPipe)
+
+	if err := <-srcErr; err != nil {
+		return fmt.Errorf("failed to read %v: %w (stderr: %s)", src, err, srcStderr.String())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %v: %w (output: %s)", dst, err, dstOutput.String())
+	}
+
+	return nil
+}
+
+// AnnotateVerifiedVolumeSnapshot stores the result in the backup-ns.sh/<name>-verify annotation of the volume snapshot.
+// If vsName is "", the newest volume snapshot of the pvc holding the verified dump is used (its backup-ns.sh/<name>-manifest
+// annotation has the same sha256), "" is returned if there is none (e.g. the dump was not snapshotted yet).
+func AnnotateVerifiedVolumeSnapshot(namespace, pvcName, vsName string, result VerifyResult) (string, error) {
+	client, err := getClient()
+	if err != nil {
+		return "", err
+	}
+
+	if vsName == "" {
+		if pvcName == "" || result.SHA256 == "" {
+			return "", nil
+		}
+
+		items, err := client.ListVolumeSnapshots(context.Background(), namespace, "backup-ns.sh/pvc="+pvcName)
+		if err != nil {
+			return "", err
+		}
+
+		var newest time.Time
+		for _, item := range items {
+			var manifest DumpManifest
+			if err := json.Unmarshal([]byte(item.GetAnnotations()[DumpManifestAnnotation(result.Name)]), &manifest); err != nil || manifest.SHA256 != result.SHA256 {
+				continue
+			}
+			if info := volumeSnapshotInfoFromUnstructured(item); vsName == "" || info.CreationTime.After(newest) {
+				vsName, newest = info.Name, info.CreationTime
+			}
+		}
+
+		if vsName == "" {
+			return "", nil
+		}
+	}
+
+	annotation, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{VerifyAnnotation(result.Name): string(annotation)},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := client.PatchVolumeSnapshot(context.Background(), namespace, vsName, patch); err != nil {
+		return "", fmt.Errorf("failed to annotate VolumeSnapshot '%s' in namespace '%s': %w", vsName, namespace, err)
+	}
+
+	slog.Info("Annotated volume snapshot with the verify result", "namespace", namespace, "vs", vsName, "annotation", VerifyAnnotation(result.Name), "passed", result.Passed)
+	return vsName, nil
+}
@@ -0,0 +1,30 @@
+package lib_test
+
+import (
+	"testing"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyResultEvaluateVerifyStats(t *testing.T) {
+	manifest := &lib.DumpManifest{RowCounts: map[string]int64{"public.users": 40, "public.orders": 0}}
+
+	var result lib.VerifyResult
+	require.NoError(t, result.EvaluateVerifyStats("rows\tpublic.users\t42\nrows\tpublic.orders\t0\nrows\tpublic.new\t1\n", manifest))
+	require.Equal(t, 3, result.Tables)
+	require.Equal(t, int64(43), result.Rows)
+	require.Empty(t, result.MissingTables)
+	require.Equal(t, map[string]int64{"public.users": 42, "public.orders": 0, "public.new": 1}, result.RowCounts)
+
+	err := result.EvaluateVerifyStats("rows\tpublic.orders\t0\n", manifest)
+	require.ErrorContains(t, err, "1 of 2 tables of the dump were not restored: public.users")
+	require.Equal(t, []string{"public.users"}, result.MissingTables)
+	require.Equal(t, int64(0), result.Rows)
+
+	// dumps without manifest only require restored tables
+	require.NoError(t, result.EvaluateVerifyStats("rows\tpublic.users\t1\n", nil))
+	require.ErrorContains(t, result.EvaluateVerifyStats("", nil), "no tables were restored")
+
+	require.Equal(t, "backup-ns.sh/postgres-1-verify", lib.VerifyAnnotation("postgres-1"))
+}
@@ -0,0 +1,327 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"github.com/allaboutapps/backup-ns/internal/lib/metrics"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// LabelGroup is the label holding the name of the VolumeGroupSnapshot on its member VolumeSnapshots.
+// Members are only deleted as a unit by deleting their group (see PruneVolumeGroupSnapshot).
+const LabelGroup = "backup-ns.sh/group"
+
+// VolumeGroupSnapshotMember is a VolumeSnapshot the snapshot controller created for a PVC of the group.
+type VolumeGroupSnapshotMember struct {
+	PVCName string `json:"pvcName"`
+	VSName  string `json:"vsName"`
+}
+
+// GenerateVGSObject returns a VolumeGroupSnapshot over all PVCs in the namespace matching the label selector (e.g. "app=db").
+func GenerateVGSObject(namespace, vgsClassName, selector, vgsName string, labels, annotations map[string]string) (map[string]interface{}, error) {
+	labelSelector, err := metav1.ParseToLabelSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VolumeGroupSnapshot selector '%s': %w", selector, err)
+	}
+
+	selectorObject, err := runtime.DefaultUnstructuredConverter.ToUnstructured(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert VolumeGroupSnapshot selector '%s': %w", selector, err)
+	}
+
+	manifest := map[string]interface{}{
+		"apiVersion": k8s.VolumeGroupSnapshotGVR.GroupVersion().String(),
+		"kind":       "VolumeGroupSnapshot",
+		"metadata": map[string]interface{}{
+			"name":        vgsName,
+			"namespace":   namespace,
+			"labels":      labels,
+			"annotations": annotations,
+		},
+		"spec": map[string]interface{}{
+			"source": map[string]interface{}{
+				"selector": selectorObject,
+			},
+		},
+	}
+
+	if vgsClassName != "" {
+		// else expect that the default VolumeGroupSnapshotClass will automatically be chosen by the cluster
+		manifest["spec"].(map[string]interface{})["volumeGroupSnapshotClassName"] = vgsClassName
+	}
+
+	return manifest, nil
+}
+
+// CreateVolumeGroupSnapshot creates the VolumeGroupSnapshot and applies the memberLabels and annotations to its member
+// VolumeSnapshots (together with their "backup-ns.sh/pvc" and "backup-ns.sh/group" label), so they are listed, retained
+// and checked like any other snapshot. We always wait until the snapshot controller reports the members, if wait is
+// set also until the group is ready.
+func CreateVolumeGroupSnapshot(namespace string, dryRun bool, vgsName string, vgsObject map[string]interface{}, memberLabels, memberAnnotations map[string]string, wait bool, waitTimeout string) ([]VolumeGroupSnapshotMember, error) {
+	stringifiedVGSObject, err := json.MarshalIndent(vgsObject, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalIndent VolumeGroupSnapshot object: %w", err)
+	}
+
+	slog.Info("Creating VolumeGroupSnapshot...", "namespace", namespace, "vgs_name", vgsName, "vgs", json.RawMessage(stringifiedVGSObject))
+
+	vgs, err := toUnstructured(vgsObject)
+	if err != nil {
+		return nil, fmt.Errorf("Error converting VolumeGroupSnapshot object: %w", err)
+	}
+	vgs.SetNamespace(namespace)
+
+	if dryRun {
+		slog.Info("Skipping VolumeGroupSnapshot creation - dry run mode is active")
+		return nil, nil
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	if _, err := client.CreateVolumeGroupSnapshot(ctx, vgs); err != nil {
+		return nil, fmt.Errorf("Error creating VolumeGroupSnapshot '%s': %w", vgsName, err)
+	}
+
+	start := time.Now()
+
+	slog.Info("Waiting for VolumeGroupSnapshot members...", "namespace", namespace, "vgs_name", vgsName, "wait_until_ready", wait, "timeout", waitTimeout)
+
+	if err := waitForVolumeGroupSnapshot(ctx, client, namespace, vgsName, wait, waitTimeout); err != nil {
+		return nil, err
+	}
+
+	created, err := client.GetVolumeGroupSnapshot(ctx, namespace, vgsName)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting VolumeGroupSnapshot details: %w", err)
+	}
+
+	members := volumeGroupSnapshotMembers(created)
+	ready, _, _ := unstructured.NestedBool(created.Object, "status", "readyToUse")
+	vgscName, _, _ := unstructured.NestedString(created.Object, "status", "boundVolumeGroupSnapshotContentName")
+	slog.Info("VolumeGroupSnapshot details", "namespace", namespace, "vgs_name", vgsName, "ready_to_use", ready, "vgsc_name", vgscName, "members", len(members))
+
+	for _, member := range members {
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels":      volumeGroupSnapshotMemberLabels(memberLabels, vgsName, member),
+				"annotations": memberAnnotations,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		patched, err := client.PatchVolumeSnapshot(ctx, namespace, member.VSName, patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to label VolumeSnapshot '%s' of VolumeGroupSnapshot '%s': %w", member.VSName, vgsName, err)
+		}
+
+		info := volumeSnapshotInfoFromUnstructured(*patched)
+		slog.Info("VolumeSnapshot details", "namespace", info.Namespace, "vs_name", info.Name, "vgs_name", vgsName, "pvc", member.PVCName, "ready_to_use", info.ReadyToUse, "vsc_name", info.ContentName, "restore_size", info.RestoreSize)
+
+		if info.ReadyToUse {
+			if wait {
+				metrics.SnapshotReadyDuration.WithLabelValues(namespace, member.PVCName).Set(time.Since(start).Seconds())
+			}
+			metrics.ObserveSuccessfulSnapshot(namespace, member.PVCName, info.CreationTime)
+		}
+	}
+
+	return members, nil
+}
+
+// volumeGroupSnapshotMemberLabels returns the labels of the group plus the pvc and group label of the member.
+func volumeGroupSnapshotMemberLabels(memberLabels map[string]string, vgsName string, member VolumeGroupSnapshotMember) map[string]string {
+	labels := maps.Clone(memberLabels)
+	labels["backup-ns.sh/pvc"] = member.PVCName
+	labels[LabelGroup] = vgsName
+	return labels
+}
+
+// MarkFailedVolumeGroupSnapshot hands a failed (or incomplete) VolumeGroupSnapshot over to "controller deleteAfterSweep":
+// its members are labeled like the members of a created group plus backup-ns.sh/delete-after=<today>, so the sweep
+// deletes the group as a unit. Pruning it right away requires patching the cluster-scoped contents, which the namespaced
+// backup job may not do. A group without members is deleted right away.
+func MarkFailedVolumeGroupSnapshot(namespace, vgsName string, memberLabels map[string]string, now time.Time) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	vgs, err := client.GetVolumeGroupSnapshot(ctx, namespace, vgsName)
+	if err != nil {
+		return err
+	}
+
+	members := volumeGroupSnapshotMembers(vgs)
+	if len(members) == 0 {
+		if err := client.DeleteVolumeGroupSnapshot(ctx, namespace, vgsName); err != nil {
+			return fmt.Errorf("failed to delete VolumeGroupSnapshot: %w", err)
+		}
+		slog.Info("Deleted VolumeGroupSnapshot without members", "namespace", namespace, "vgs_name", vgsName)
+		return nil
+	}
+
+	deleteAfter := now.Format(time.DateOnly)
+
+	for _, member := range members {
+		labels := volumeGroupSnapshotMemberLabels(memberLabels, vgsName, member)
+		labels[LabelDeleteAfter] = deleteAfter
+
+		patch, err := labelPatch(nil, labels)
+		if err != nil {
+			return err
+		}
+
+		if _, err := client.PatchVolumeSnapshot(ctx, namespace, member.VSName, patch); err != nil {
+			return fmt.Errorf("failed to label VolumeSnapshot '%s' of VolumeGroupSnapshot '%s': %w", member.VSName, vgsName, err)
+		}
+	}
+
+	slog.Info("Marked VolumeGroupSnapshot members for deletion", "namespace", namespace, "vgs_name", vgsName, "members", len(members), "delete_after", deleteAfter)
+	return nil
+}
+
+// waitForVolumeGroupSnapshot polls until the group reports its members (and is ready if ready is set).
+func waitForVolumeGroupSnapshot(ctx context.Context, client k8s.Client, namespace, vgsName string, ready bool, waitTimeout string) error {
+	timeout, err := parseTimeout(waitTimeout)
+	if err != nil {
+		return err
+	}
+
+	var lastErrorMessage string
+
+	err = wait.PollUntilContextTimeout(ctx, pollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		vgs, err := client.GetVolumeGroupSnapshot(ctx, namespace, vgsName)
+		if err != nil {
+			if k8s.IsNotFound(err) {
+				return false, err
+			}
+			// transient api errors, retry
+			slog.Warn("Retrying to get VolumeGroupSnapshot", "namespace", namespace, "vgs_name", vgsName, "error", err)
+			return false, nil
+		}
+
+		lastErrorMessage, _, _ = unstructured.NestedString(vgs.Object, "status", "error", "message")
+
+		if len(volumeGroupSnapshotMembers(vgs)) == 0 {
+			return false, nil
+		}
+
+		vgsReady, _, _ := unstructured.NestedBool(vgs.Object, "status", "readyToUse")
+		return vgsReady || !ready, nil
+	})
+
+	if err != nil {
+		if lastErrorMessage != "" {
+			return fmt.Errorf("VolumeGroupSnapshot '%s' did not become ready: %w (last error: %s)", vgsName, err, lastErrorMessage)
+		}
+		return fmt.Errorf("VolumeGroupSnapshot '%s' did not become ready: %w", vgsName, err)
+	}
+
+	return nil
+}
+
+func volumeGroupSnapshotMembers(vgs *unstructured.Unstructured) []VolumeGroupSnapshotMember {
+	refs, _, _ := unstructured.NestedSlice(vgs.Object, "status", "pvcVolumeSnapshotRefList")
+
+	members := make([]VolumeGroupSnapshotMember, 0, len(refs))
+	for _, ref := range refs {
+		refObject, ok := ref.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		pvcName, _, _ := unstructured.NestedString(refObject, "persistentVolumeClaimRef", "name")
+		vsName, _, _ := unstructured.NestedString(refObject, "volumeSnapshotRef", "name")
+		if pvcName == "" || vsName == "" {
+			continue
+		}
+
+		members = append(members, VolumeGroupSnapshotMember{PVCName: pvcName, VSName: vsName})
+	}
+
+	return members
+}
+
+// Dangerous!
+// Delete a VolumeGroupSnapshot, all its member VolumeSnapshots, their contents and the underlying storage!
+// Like PruneVolumeSnapshot, the deletionPolicy of the VolumeGroupSnapshotContent and all member VolumeSnapshotContents
+// is set to "Delete" before deleting the group.
+func PruneVolumeGroupSnapshot(namespace, vgsName string, wait bool) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	vgs, err := client.GetVolumeGroupSnapshot(ctx, namespace, vgsName)
+	if err != nil {
+		return err
+	}
+
+	members := volumeGroupSnapshotMembers(vgs)
+
+	for _, member := range members {
+		vscName, err := GetVolumeSnapshotContentName(namespace, member.VSName)
+		if err != nil {
+			return err
+		}
+		if vscName == "" {
+			continue
+		}
+		if err := patchVolumeSnapshotContentDeletionPolicy(vscName); err != nil {
+			return err
+		}
+	}
+
+	if vgscName, _, _ := unstructured.NestedString(vgs.Object, "status", "boundVolumeGroupSnapshotContentName"); vgscName != "" {
+		if _, err := client.PatchVolumeGroupSnapshotContent(ctx, vgscName, []byte(`{"spec":{"deletionPolicy":"Delete"}}`)); err != nil {
+			return fmt.Errorf("failed to patch VolumeGroupSnapshotContent: %w", err)
+		}
+		slog.Info("Successfully patched VolumeGroupSnapshotContent deletionPolicy to 'Delete'", "vgsc_name", vgscName)
+	}
+
+	if err := client.DeleteVolumeGroupSnapshot(ctx, namespace, vgsName); err != nil {
+		return fmt.Errorf("failed to delete VolumeGroupSnapshot: %w", err)
+	}
+
+	if !wait {
+		return nil
+	}
+
+	if err := waitForDeletion(ctx, func(ctx context.Context) error {
+		_, err := client.GetVolumeGroupSnapshot(ctx, namespace, vgsName)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to wait for VolumeGroupSnapshot '%s' deletion: %w", vgsName, err)
+	}
+
+	for _, member := range members {
+		if err := waitForDeletion(ctx, func(ctx context.Context) error {
+			_, err := client.GetVolumeSnapshot(ctx, namespace, member.VSName)
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to wait for VolumeSnapshot '%s' deletion: %w", member.VSName, err)
+		}
+	}
+
+	return nil
+}
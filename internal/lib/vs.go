@@ -3,17 +3,23 @@ package lib
 import (
 	"bytes"
 	"cmp"
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"log"
-	"math"
-	"os/exec"
+	"log/slog"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"github.com/allaboutapps/backup-ns/internal/lib/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 type NamespacedK8sObject struct {
@@ -23,26 +29,22 @@ type NamespacedK8sObject struct {
 
 // We expect all VS that we manage to have to "backup-ns.sh/type" label key.
 func GetManagedVolumeSnapshots() ([]NamespacedK8sObject, error) {
-	cmd := exec.Command("kubectl", "get", "volumesnapshot", "--all-namespaces", "-lbackup-ns.sh/type", "-o=jsonpath={range .items[*]}{.metadata.namespace} {.metadata.name}{\"\\n\"}{end}")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+	client, err := getClient()
 	if err != nil {
 		return nil, err
 	}
-	vsLines := strings.Split(strings.TrimSpace(out.String()), "\n")
 
-	vss := make([]NamespacedK8sObject, 0, len(vsLines))
+	items, err := client.ListVolumeSnapshots(context.Background(), "", "backup-ns.sh/type")
+	if err != nil {
+		return nil, err
+	}
 
-	for _, line := range vsLines {
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
-		}
+	vss := make([]NamespacedK8sObject, 0, len(items))
 
+	for _, item := range items {
 		vss = append(vss, NamespacedK8sObject{
-			Namespace: parts[0],
-			Name:      parts[1],
+			Namespace: item.GetNamespace(),
+			Name:      item.GetName(),
 		})
 	}
 
@@ -53,6 +55,87 @@ func GetManagedVolumeSnapshots() ([]NamespacedK8sObject, error) {
 	return vss, nil
 }
 
+// VolumeSnapshotInfo holds the metadata of a VolumeSnapshot our controller commands (retain, mark, sweep) operate on.
+type VolumeSnapshotInfo struct {
+	Namespace    string
+	Name         string
+	Labels       map[string]string
+	CreationTime time.Time
+	ReadyToUse   bool
+	ContentName  string
+	RestoreSize  string
+}
+
+// GetVolumeSnapshotInfos returns all VolumeSnapshots in the namespace ("" means all namespaces) matching the labelSelector.
+// The CreationTime is taken from .status.creationTime (falling back to .metadata.creationTimestamp) as restored vs from
+// dangling vsc (new pre-provisioned vsc) are correctly sorted again this way.
+func GetVolumeSnapshotInfos(namespace, labelSelector string) ([]VolumeSnapshotInfo, error) {
+	client, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := client.ListVolumeSnapshots(context.Background(), namespace, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	vss := make([]VolumeSnapshotInfo, 0, len(items))
+
+	for _, item := range items {
+		vss = append(vss, volumeSnapshotInfoFromUnstructured(item))
+	}
+
+	slices.SortFunc(vss, func(a, b VolumeSnapshotInfo) int {
+		return strings.Compare(strings.ToLower(a.Namespace+a.Name), strings.ToLower(b.Namespace+b.Name))
+	})
+
+	return vss, nil
+}
+
+func volumeSnapshotInfoFromUnstructured(vs unstructured.Unstructured) VolumeSnapshotInfo {
+	info := VolumeSnapshotInfo{
+		Namespace:    vs.GetNamespace(),
+		Name:         vs.GetName(),
+		Labels:       vs.GetLabels(),
+		CreationTime: vs.GetCreationTimestamp().Time,
+	}
+
+	if info.Labels == nil {
+		info.Labels = make(map[string]string)
+	}
+
+	if creationTime, ok, _ := unstructured.NestedString(vs.Object, "status", "creationTime"); ok {
+		if t, err := time.Parse(time.RFC3339, creationTime); err == nil {
+			info.CreationTime = t
+		}
+	}
+
+	info.ReadyToUse, _, _ = unstructured.NestedBool(vs.Object, "status", "readyToUse")
+	info.ContentName, _, _ = unstructured.NestedString(vs.Object, "status", "boundVolumeSnapshotContentName")
+	info.RestoreSize, _, _ = unstructured.NestedString(vs.Object, "status", "restoreSize")
+
+	return info
+}
+
+// RemoveVolumeSnapshotLabel removes the label with the given key from the VolumeSnapshot.
+func RemoveVolumeSnapshotLabel(namespace, vsName, labelKey string) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	patch, err := labelPatch([]string{labelKey}, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.PatchVolumeSnapshot(context.Background(), namespace, vsName, patch); err != nil {
+		return fmt.Errorf("failed to remove label '%s' from VolumeSnapshot '%s' in namespace '%s': %w", labelKey, vsName, namespace, err)
+	}
+	return nil
+}
+
 func GenerateVSName(vsNameTemplate string, pvcName string, vsRand string) (string, error) {
 	templ := template.Must(template.New("vsNameTemplate").Parse(vsNameTemplate))
 	var buf bytes.Buffer
@@ -107,14 +190,18 @@ func GenerateVSLabels(namespace, pvcName string, config LabelVSConfig, now time.
 }
 
 func volumeSnapshotWithLabelValueExists(namespace, labelKey, labelValue string) bool {
-	// #nosec G204
-	cmd := exec.Command("kubectl", "get", "volumesnapshot", "-n", namespace, "-l", fmt.Sprintf("%s=%s", labelKey, labelValue), "-o", "name")
-	output, err := cmd.Output()
+	client, err := getClient()
 	if err != nil {
-		log.Printf("Error checking for existing VolumeSnapshot: %v", err)
+		slog.Error("Error checking for existing VolumeSnapshot", "namespace", namespace, "label", labelKey, "error", err)
 		return true // assume it exists to be safe, we don't want to delete existing snapshots by accident with the pruner!
 	}
-	return len(output) > 0
+
+	items, err := client.ListVolumeSnapshots(context.Background(), namespace, fmt.Sprintf("%s=%s", labelKey, labelValue))
+	if err != nil {
+		slog.Error("Error checking for existing VolumeSnapshot", "namespace", namespace, "label", labelKey, "error", err)
+		return true // assume it exists to be safe, we don't want to delete existing snapshots by accident with the pruner!
+	}
+	return len(items) > 0
 }
 
 // typically we'll only save the used safe env vars inside the env-config annotation
@@ -215,106 +302,178 @@ func GenerateVSObjectFromVSC(vscName string, vscObject map[string]interface{}) (
 }
 
 func CreateVolumeSnapshot(namespace string, dryRun bool, vsName string, vsObject map[string]interface{}, wait bool, waitTimeout string) error {
-	stringifiedVSObject, err := json.MarshalIndent(vsObject, "", "  ")
-	if err != nil {
-		return fmt.Errorf("Error marshalIndent VolumeSnapshot object: %w", err)
-	}
+	return CreateVolumeSnapshots(namespace, dryRun, map[string]map[string]interface{}{vsName: vsObject}, wait, waitTimeout)
+}
 
-	log.Printf("Creating VolumeSnapshot '%s' in namespace '%s'...\n%s", vsName, namespace, string(stringifiedVSObject))
+// CreateVolumeSnapshots creates the VolumeSnapshots (keyed by their name) before waiting for any of them to become ready,
+// so the snapshots of a backup set are taken as close together as possible.
+func CreateVolumeSnapshots(namespace string, dryRun bool, vsObjects map[string]map[string]interface{}, wait bool, waitTimeout string) error {
+	vsNames := sortedKeys(vsObjects)
+	vss := make([]*unstructured.Unstructured, 0, len(vsNames))
+
+	for _, vsName := range vsNames {
+		stringifiedVSObject, err := json.MarshalIndent(vsObjects[vsName], "", "  ")
+		if err != nil {
+			return fmt.Errorf("Error marshalIndent VolumeSnapshot object: %w", err)
+		}
+
+		slog.Info("Creating VolumeSnapshot...", "namespace", namespace, "vs_name", vsName, "vs", json.RawMessage(stringifiedVSObject))
+
+		vs, err := toUnstructured(vsObjects[vsName])
+		if err != nil {
+			return fmt.Errorf("Error converting VolumeSnapshot object: %w", err)
+		}
+		vs.SetNamespace(namespace)
+		vss = append(vss, vs)
+	}
 
 	if dryRun {
-		log.Println("Skipping VolumeSnapshot creation - dry run mode is active")
+		slog.Info("Skipping VolumeSnapshot creation - dry run mode is active")
 		return nil
 	}
 
-	vsJSON, err := json.Marshal(vsObject)
+	client, err := getClient()
 	if err != nil {
-		return fmt.Errorf("Error marshaling VolumeSnapshot object: %w", err)
+		return err
 	}
 
-	// #nosec G204
-	cmd := exec.Command("kubectl", "apply", "-f", "-", "-n", namespace)
-	cmd.Stdin = bytes.NewReader(vsJSON)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("Error creating VolumeSnapshot: %w. Output:\n%s", err, string(output))
+	ctx := context.Background()
+
+	for _, vs := range vss {
+		if _, err := client.CreateVolumeSnapshot(ctx, vs); err != nil {
+			return fmt.Errorf("Error creating VolumeSnapshot '%s': %w", vs.GetName(), err)
+		}
 	}
 
-	if wait {
-		log.Printf("Waiting for VolumeSnapshot '%s' to be ready (timeout: %s)...", vsName, waitTimeout)
-
-		// give kubectl some time to actually have a status field to wait for
-		// https://github.com/kubernetes/kubectl/issues/1204
-		// https://github.com/kubernetes/kubernetes/pull/109525
-		// time.Sleep(5 * time.Second)
-
-		maxRetries := 3
-		baseDelay := time.Second
-		maxDelay := 5 * time.Second
-
-		for attempt := 0; attempt < maxRetries; attempt++ {
-			// #nosec G204
-			cmd = exec.Command("kubectl", "wait", "--for=jsonpath={.status.readyToUse}=true", "--timeout", waitTimeout, "volumesnapshot/"+vsName, "-n", namespace)
-			output, err := cmd.CombinedOutput()
-			if err == nil {
-				// Success, break the retry loop
-				break
-			}
+	start := time.Now()
 
-			if attempt == maxRetries-1 {
-				// Last attempt failed
-				return fmt.Errorf("VolumeSnapshot '%s' did not become ready after %d attempts: %w. Output:\n%s", vsName, maxRetries, err, string(output))
-			}
+	for _, vsName := range vsNames {
+		if wait {
+			slog.Info("Waiting for VolumeSnapshot to be ready...", "namespace", namespace, "vs_name", vsName, "timeout", waitTimeout)
 
-			// Calculate delay with exponential backoff
-			delay := time.Duration(math.Pow(2, float64(attempt))) * baseDelay
-			if delay > maxDelay {
-				delay = maxDelay
+			if err := waitForVolumeSnapshotReady(ctx, client, namespace, vsName, waitTimeout); err != nil {
+				return err
 			}
+		}
+
+		created, err := client.GetVolumeSnapshot(ctx, namespace, vsName)
+		if err != nil {
+			return fmt.Errorf("Error getting VolumeSnapshot details: %w", err)
+		}
+
+		info := volumeSnapshotInfoFromUnstructured(*created)
+		slog.Info("VolumeSnapshot details", "namespace", info.Namespace, "vs_name", info.Name, "ready_to_use", info.ReadyToUse, "vsc_name", info.ContentName, "restore_size", info.RestoreSize)
 
-			log.Printf("Attempt %d failed. Retrying in %v...", attempt+1, delay)
-			time.Sleep(delay)
+		if info.ReadyToUse {
+			pvcName := info.Labels["backup-ns.sh/pvc"]
+			if wait {
+				metrics.SnapshotReadyDuration.WithLabelValues(namespace, pvcName).Set(time.Since(start).Seconds())
+			}
+			metrics.ObserveSuccessfulSnapshot(namespace, pvcName, info.CreationTime)
 		}
+	}
 
-		// // #nosec G204
-		// cmd = exec.Command("kubectl", "wait", "--for=jsonpath={.status.readyToUse}=true", "--timeout", waitTimeout, "volumesnapshot/"+vsName, "-n", namespace)
-		// // log.Println(cmd.String())
-		// output, err := cmd.CombinedOutput()
-		// if err != nil {
-		// 	return fmt.Errorf("VolumeSnapshot '%s' did not become ready: %w. Output:\n%s", vsName, err, string(output))
-		// }
+	return nil
+}
+
+func waitForVolumeSnapshotReady(ctx context.Context, client k8s.Client, namespace, vsName, waitTimeout string) error {
+	timeout, err := parseTimeout(waitTimeout)
+	if err != nil {
+		return err
 	}
 
-	// #nosec G204
-	cmd = exec.Command("kubectl", "get", "volumesnapshot/"+vsName, "-n", namespace)
-	output, err = cmd.CombinedOutput()
+	var lastErrorMessage string
+
+	err = wait.PollUntilContextTimeout(ctx, pollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		vs, err := client.GetVolumeSnapshot(ctx, namespace, vsName)
+		if err != nil {
+			if k8s.IsNotFound(err) {
+				return false, err
+			}
+			// transient api errors, retry
+			slog.Warn("Retrying to get VolumeSnapshot", "namespace", namespace, "vs_name", vsName, "error", err)
+			return false, nil
+		}
+
+		// the csi snapshotter might report (transient) errors while creating the snapshot
+		lastErrorMessage, _, _ = unstructured.NestedString(vs.Object, "status", "error", "message")
+
+		ready, _, _ := unstructured.NestedBool(vs.Object, "status", "readyToUse")
+		return ready, nil
+	})
+
 	if err != nil {
-		return fmt.Errorf("Error getting VolumeSnapshot details: %w. Output:\n%s", err, string(output))
+		if lastErrorMessage != "" {
+			return fmt.Errorf("VolumeSnapshot '%s' did not become ready: %w (last error: %s)", vsName, err, lastErrorMessage)
+		}
+		return fmt.Errorf("VolumeSnapshot '%s' did not become ready: %w", vsName, err)
 	}
 
-	log.Printf("VolumeSnapshot details:\n%s", string(output))
 	return nil
 }
 
 func deleteVolumeSnapshot(namespace, volumeSnapshotName string, wait bool) error {
-	args := []string{"delete", "volumesnapshot", volumeSnapshotName, "-n", namespace}
-	if !wait {
-		args = append(args, "--wait=false")
+	client, err := getClient()
+	if err != nil {
+		return err
 	}
 
-	deleteCmd := exec.Command("kubectl", args...)
-	output, err := deleteCmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to delete VolumeSnapshot: %w, output: %s", err, output)
+	ctx := context.Background()
+
+	if err := client.DeleteVolumeSnapshot(ctx, namespace, volumeSnapshotName); err != nil {
+		return fmt.Errorf("failed to delete VolumeSnapshot: %w", err)
+	}
+
+	if wait {
+		if err := waitForDeletion(ctx, func(ctx context.Context) error {
+			_, err := client.GetVolumeSnapshot(ctx, namespace, volumeSnapshotName)
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to wait for VolumeSnapshot '%s' deletion: %w", volumeSnapshotName, err)
+		}
 	}
+
 	return nil
 }
 
+// The max time we wait for an object to be fully deleted (e.g. finalizers of the snapshot controller).
+var deleteWaitTimeout = 10 * time.Minute
+
+// waitForDeletion polls get until it returns a not found error.
+func waitForDeletion(ctx context.Context, get func(ctx context.Context) error) error {
+	return wait.PollUntilContextTimeout(ctx, pollInterval, deleteWaitTimeout, true, func(ctx context.Context) (bool, error) {
+		err := get(ctx)
+		if err == nil {
+			return false, nil
+		}
+		if k8s.IsNotFound(err) {
+			return true, nil
+		}
+		slog.Warn("Retrying to check deletion", "error", err)
+		return false, nil
+	})
+}
+
 // Dangerous!
 // Delete a VolumeSnapshot, its associated VolumeSnapshotContent and the underlying storage!
 // This is a destructive operation and should be used with caution!
 // This function will set the deletionPolicy of the VolumeSnapshotContent to "Delete" before deleting the VolumeSnapshot, thus ensuring the underlying storage is also deleted.
 func PruneVolumeSnapshot(namespace, volumeSnapshotName string, wait bool) error {
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	vs, err := client.GetVolumeSnapshot(context.Background(), namespace, volumeSnapshotName)
+	if err != nil {
+		return err
+	}
+
+	// members of a VolumeGroupSnapshot are crash-consistent with each other, they are only deleted as a unit
+	if group := vs.GetLabels()[LabelGroup]; group != "" {
+		return fmt.Errorf("VolumeSnapshot '%s' is a member of VolumeGroupSnapshot '%s', delete the group instead", volumeSnapshotName, group)
+	}
+
 	// Get the VolumeSnapshotContent name
 	vscName, err := GetVolumeSnapshotContentName(namespace, volumeSnapshotName)
 	if err != nil {
@@ -358,26 +517,23 @@ func CreatePVCManifestFromVolumeSnapshot(namespace, vsName, pvcName, storageClas
 		pvcObject["spec"].(map[string]interface{})["storageClassName"] = storageClass
 	}
 
-	// Get VolumeSnapshot details
-	cmd := exec.Command("kubectl", "get", "volumesnapshot", vsName, "-n", namespace, "-o", "json")
-	output, err := cmd.CombinedOutput()
+	client, err := getClient()
 	if err != nil {
-		return nil, fmt.Errorf("error getting VolumeSnapshot details: %w. Output:\n%s", err, string(output))
+		return nil, err
 	}
 
-	var vs map[string]interface{}
-	if err := json.Unmarshal(output, &vs); err != nil {
-		return nil, fmt.Errorf("error unmarshaling VolumeSnapshot: %w", err)
+	// Get VolumeSnapshot details
+	vs, err := client.GetVolumeSnapshot(context.Background(), namespace, vsName)
+	if err != nil {
+		return nil, fmt.Errorf("error getting VolumeSnapshot details: %w", err)
 	}
 
 	// Copy storage size from snapshot
-	if status, ok := vs["status"].(map[string]interface{}); ok {
-		if restoreSize, ok := status["restoreSize"].(string); ok {
-			pvcObject["spec"].(map[string]interface{})["resources"] = map[string]interface{}{
-				"requests": map[string]interface{}{
-					"storage": restoreSize,
-				},
-			}
+	if restoreSize, ok, _ := unstructured.NestedString(vs.Object, "status", "restoreSize"); ok {
+		pvcObject["spec"].(map[string]interface{})["resources"] = map[string]interface{}{
+			"requests": map[string]interface{}{
+				"storage": restoreSize,
+			},
 		}
 	}
 
@@ -397,40 +553,65 @@ func RestoreVolumeSnapshot(namespace string, vsName string, pvcName string, stor
 		return fmt.Errorf("error marshaling PVC object: %w", err)
 	}
 
-	log.Printf("Creating PVC '%s' in namespace '%s' from VolumeSnapshot '%s'...\n%s",
-		pvcName, namespace, vsName, string(stringifiedPVCObject))
+	slog.Info("Creating PVC from VolumeSnapshot...", "namespace", namespace, "pvc", pvcName, "vs_name", vsName, "pvc_object", json.RawMessage(stringifiedPVCObject))
 
-	pvcJSON, err := json.Marshal(pvcObject)
+	pvcUnstructured, err := toUnstructured(pvcObject)
 	if err != nil {
-		return fmt.Errorf("error marshaling PVC object: %w", err)
+		return fmt.Errorf("error converting PVC object: %w", err)
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(pvcUnstructured.Object, pvc); err != nil {
+		return fmt.Errorf("error converting PVC object: %w", err)
 	}
 
-	cmd := exec.Command("kubectl", "apply", "-f", "-", "-n", namespace)
-	cmd.Stdin = bytes.NewReader(pvcJSON)
-	output, err := cmd.CombinedOutput()
+	client, err := getClient()
 	if err != nil {
-		return fmt.Errorf("error creating PVC: %w. Output:\n%s", err, string(output))
+		return err
+	}
+
+	ctx := context.Background()
+
+	if _, err := client.CreatePersistentVolumeClaim(ctx, pvc); err != nil {
+		return fmt.Errorf("error creating PVC: %w", err)
 	}
 
 	if wait {
-		log.Printf("Waiting for PVC '%s' to be bound (timeout: %s)...", pvcName, waitTimeout)
-		// #nosec G204
-		cmd = exec.Command("kubectl", "wait", "--for=jsonpath={.status.phase}=Bound", "--timeout", waitTimeout,
-			"pvc/"+pvcName, "-n", namespace)
-		log.Println(cmd.Args)
-		output, err = cmd.CombinedOutput()
+		slog.Info("Waiting for PVC to be bound...", "namespace", namespace, "pvc", pvcName, "timeout", waitTimeout)
+
+		timeout, err := parseTimeout(waitTimeout)
 		if err != nil {
-			return fmt.Errorf("PVC '%s' did not become bound: %w. Output:\n%s",
-				pvcName, err, string(output))
+			return err
+		}
+
+		if err := waitForPVCBound(ctx, client, namespace, pvcName, timeout); err != nil {
+			return err
 		}
 	}
-	// #nosec G204
-	cmd = exec.Command("kubectl", "get", "pvc/"+pvcName, "-n", namespace)
-	output, err = cmd.CombinedOutput()
+
+	created, err := client.GetPersistentVolumeClaim(ctx, namespace, pvcName)
 	if err != nil {
-		return fmt.Errorf("error getting PVC details: %w. Output:\n%s", err, string(output))
+		return fmt.Errorf("error getting PVC details: %w", err)
 	}
 
-	log.Printf("PVC details:\n%s", string(output))
+	slog.Info("PVC details", "namespace", created.Namespace, "pvc", created.Name, "phase", created.Status.Phase, "volume", created.Spec.VolumeName)
+	return nil
+}
+
+func waitForPVCBound(ctx context.Context, client k8s.Client, namespace, pvcName string, timeout time.Duration) error {
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		pvc, err := client.GetPersistentVolumeClaim(ctx, namespace, pvcName)
+		if err != nil {
+			if k8s.IsNotFound(err) {
+				return false, err
+			}
+			slog.Warn("Retrying to get PVC", "namespace", namespace, "pvc", pvcName, "error", err)
+			return false, nil
+		}
+		return pvc.Status.Phase == corev1.ClaimBound, nil
+	})
+	if err != nil {
+		return fmt.Errorf("PVC '%s' did not become bound: %w", pvcName, err)
+	}
 	return nil
 }
@@ -1,3 +1,5 @@
+//go:build kind
+
 package lib_test
 
 import (
@@ -241,3 +243,47 @@ func TestRestoreVolumeSnapshot(t *testing.T) {
 	err = lib.PruneVolumeSnapshot(namespace, vsName, false)
 	require.NoError(t, err, "Failed to clean up test snapshot")
 }
+
+func TestCreateAndRestoreVolumeSnapshotSet(t *testing.T) {
+	namespace := "generic-test"
+	vsRand := lib.GenerateRandomStringOrPanic(6)
+	set := lib.GenerateSetName(vsRand, time.Now())
+
+	labelVSConfig := lib.LabelVSConfig{
+		Type:       "adhoc",
+		Pod:        "gotest",
+		Retain:     "days",
+		RetainDays: 30,
+	}
+
+	vsObjects := make(map[string]map[string]interface{})
+	for _, pvcName := range []string{"data", "uploads"} {
+		vsName := fmt.Sprintf("test-backup-set-%s-%s", pvcName, vsRand)
+
+		vsLabels := lib.GenerateVSLabels(namespace, pvcName, labelVSConfig, time.Now())
+		vsLabels[lib.LabelSet] = set
+
+		vsObjects[vsName] = lib.GenerateVSObject(namespace, "csi-hostpath-snapclass", pvcName, vsName, vsLabels, lib.GenerateVSAnnotations(lib.GetBAKEnvVars()))
+	}
+
+	require.NoError(t, lib.CreateVolumeSnapshots(namespace, false, vsObjects, true, "25s"))
+
+	vsSet, err := lib.GetVolumeSnapshotSet(namespace, set)
+	require.NoError(t, err)
+	require.Equal(t, []string{"data", "uploads"}, vsSet.PVCNames())
+	require.True(t, vsSet.ReadyToUse())
+
+	for i, vs := range vsSet.Snapshots {
+		pvcName := fmt.Sprintf("restored-%s-%s", vsSet.PVCNames()[i], vsRand)
+		require.NoError(t, lib.RestoreVolumeSnapshot(namespace, vs.Name, pvcName, "csi-hostpath-sc", true, "25s"))
+
+		cmd := exec.Command("kubectl", "delete", "pvc", pvcName, "-n", namespace)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, "Failed to clean up restored PVC: %s", string(output))
+
+		require.NoError(t, lib.PruneVolumeSnapshot(namespace, vs.Name, false))
+	}
+
+	_, err = lib.GetVolumeSnapshotSet(namespace, "non-existent-set")
+	require.Error(t, err)
+}
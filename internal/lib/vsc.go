@@ -1,42 +1,49 @@
 package lib
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"os/exec"
+	"log/slog"
 	"strings"
 
 	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func GetVolumeSnapshotContentName(namespace, volumeSnapshotName string) (string, error) {
-	cmd := exec.Command("kubectl", "get", "volumesnapshot", volumeSnapshotName, "-n", namespace, "-o", "jsonpath={.status.boundVolumeSnapshotContentName}")
-	output, err := cmd.CombinedOutput()
+	client, err := getClient()
 	if err != nil {
-		return "", fmt.Errorf("failed to get VolumeSnapshotContent name: %w, output: %s", err, output)
+		return "", err
 	}
-	return strings.TrimSpace(string(output)), nil
+
+	vs, err := client.GetVolumeSnapshot(context.Background(), namespace, volumeSnapshotName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get VolumeSnapshotContent name: %w", err)
+	}
+
+	vscName, _, _ := unstructured.NestedString(vs.Object, "status", "boundVolumeSnapshotContentName")
+	return vscName, nil
 }
 
 func patchVolumeSnapshotContentDeletionPolicy(vscName string) error {
-	patchCmd := exec.Command("kubectl", "patch", "volumesnapshotcontent", vscName, "--type", "merge", "-p", `{"spec":{"deletionPolicy":"Delete"}}`)
-	output, err := patchCmd.CombinedOutput()
+	client, err := getClient()
 	if err != nil {
-		return fmt.Errorf("failed to patch VolumeSnapshotContent: %w, output: %s", err, output)
+		return err
 	}
-	log.Printf("Successfully patched VolumeSnapshotContent %s deletionPolicy to 'Delete'\n", vscName)
+
+	if _, err := client.PatchVolumeSnapshotContent(context.Background(), vscName, []byte(`{"spec":{"deletionPolicy":"Delete"}}`)); err != nil {
+		return fmt.Errorf("failed to patch VolumeSnapshotContent: %w", err)
+	}
+	slog.Info("Successfully patched VolumeSnapshotContent deletionPolicy to 'Delete'", "vsc_name", vscName)
 	return nil
 }
 
 func SyncVSLabelsToVsc(namespace, vsName string) error {
-	cmd := exec.Command("kubectl", "get", "volumesnapshot", vsName, "-n", namespace, "-o", "jsonpath={.status.boundVolumeSnapshotContentName}")
-	vscNameBytes, err := cmd.Output()
+	vscName, err := GetVolumeSnapshotContentName(namespace, vsName)
 	if err != nil {
-		return fmt.Errorf("failed to get VolumeSnapshotContent name: %w", err)
+		return err
 	}
-	vscName := strings.TrimSpace(string(vscNameBytes))
 
 	if vscName == "" {
 		return fmt.Errorf("volumeSnapshot %s in namespace %s not found or does not have a boundVolumeSnapshotContentName", vsName, namespace)
@@ -54,68 +61,71 @@ func SyncVSLabelsToVsc(namespace, vsName string) error {
 
 	labelDiff := getLabelDiff(vsLabelsMap, vscLabelsMap)
 
-	log.Printf("namespace=%s vs=%s vsc=%s\nvsLabels=%v\nvscLabels=%v\nlabelDiff=%v\n", namespace, vsName, vscName, vsLabelsMap, vscLabelsMap, labelDiff)
+	slog.Info("Comparing vs and vsc labels", "namespace", namespace, "vs_name", vsName, "vsc_name", vscName, "vs_labels", vsLabelsMap, "vsc_labels", vscLabelsMap, "label_diff", labelDiff)
 
-	if len(labelDiff) == 0 {
-		log.Printf("noop namespace=%s vs=%s vsc=%s already in sync.\n", namespace, vscName, vsName)
+	if len(labelDiff) == 0 && len(vsLabelsMap) == len(vscLabelsMap) {
+		slog.Info("vsc labels already in sync", "namespace", namespace, "vs_name", vsName, "vsc_name", vscName)
 		return nil
 	}
 
-	labelDel := getLabelDel(vscLabelsMap)
-	labelAdd := getLabelAdd(vsLabelsMap)
-
-	if len(labelDel) > 0 {
-		args := append([]string{"label", "volumesnapshotcontent", vscName}, labelDel...)
-		cmd = exec.Command("kubectl", args...)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to delete labels from VolumeSnapshotContent %s of VolumeSnapshot %s: %w", vscName, vsName, err)
+	// a single merge patch: drop all backup-ns.sh/ labels of the vsc that the vs no longer has, set the vs ones.
+	var labelDel []string
+	for k := range vscLabelsMap {
+		if _, ok := vsLabelsMap[k]; !ok {
+			labelDel = append(labelDel, k)
 		}
 	}
 
-	args := append([]string{"label", "volumesnapshotcontent", vscName}, labelAdd...)
-	cmd = exec.Command("kubectl", args...)
-	if err := cmd.Run(); err != nil {
+	patch, err := labelPatch(labelDel, vsLabelsMap)
+	if err != nil {
+		return err
+	}
+
+	client, err := getClient()
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.PatchVolumeSnapshotContent(context.Background(), vscName, patch); err != nil {
 		return fmt.Errorf("failed to apply labels to VolumeSnapshotContent %s of VolumeSnapshot %s: %w", vscName, vsName, err)
 	}
 
 	return nil
 }
 
+// GetBackupNsLabelMap returns all "backup-ns.sh/" prefixed labels of the resource.
+// kind is either volumesnapshot, volumesnapshotcontent (cluster scoped, namespace is ignored) or any other namespaced kind.
 func GetBackupNsLabelMap(namespace, kind, name string) (map[string]string, error) {
-	cmd := exec.Command("kubectl", "get", kind, name, "-n", namespace, "-o", "jsonpath={.metadata.labels}")
-	labelsBytes, err := cmd.Output()
+	client, err := getClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get ns=%s %s/%s labels: %w", namespace, kind, name, err)
+		return nil, err
 	}
-	labels := strings.TrimSpace(string(labelsBytes))
-	labelsMap := parseBackupNsLabels(labels)
 
-	return labelsMap, nil
-}
-
-func parseBackupNsLabels(labels string) map[string]string {
-	labelMap := make(map[string]string)
-	if labels == "" {
-		return labelMap
-	}
-	labels = strings.Trim(labels, "{}")
-	labels = strings.ReplaceAll(labels, "\"", "")
-	pairs := strings.Split(labels, ",")
-	for _, pair := range pairs {
-		kv := strings.SplitN(pair, ":", 2)
-		if len(kv) == 2 {
+	ctx := context.Background()
 
-			key := strings.TrimSpace(kv[0])
-			val := strings.TrimSpace(kv[1])
+	var obj *unstructured.Unstructured
 
-			if strings.Index(key, "backup-ns.sh/") != 0 {
-				continue // filter out.
-			}
+	switch strings.ToLower(kind) {
+	case "volumesnapshot", "volumesnapshots", "vs":
+		obj, err = client.GetVolumeSnapshot(ctx, namespace, name)
+	case "volumesnapshotcontent", "volumesnapshotcontents", "vsc":
+		obj, err = client.GetVolumeSnapshotContent(ctx, name)
+	default:
+		obj, err = client.GetResource(ctx, namespace, kind+"/"+name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ns=%s %s/%s labels: %w", namespace, kind, name, err)
+	}
 
-			labelMap[key] = val
+	labelMap := make(map[string]string)
+	for k, v := range obj.GetLabels() {
+		if !strings.HasPrefix(k, "backup-ns.sh/") {
+			continue // filter out.
 		}
+		labelMap[k] = v
 	}
-	return labelMap
+
+	return labelMap, nil
 }
 
 func getLabelDiff(target, current map[string]string) map[string]string {
@@ -128,35 +138,18 @@ func getLabelDiff(target, current map[string]string) map[string]string {
 	return diff
 }
 
-func getLabelDel(vscLabels map[string]string) []string {
-	var del []string
-	for k := range vscLabels {
-		del = append(del, fmt.Sprintf("%s-", k))
-	}
-	return del
-}
-
-func getLabelAdd(vsLabels map[string]string) []string {
-	var add []string
-	for k, v := range vsLabels {
-		add = append(add, fmt.Sprintf("%s=%s", k, v))
-	}
-	return add
-}
 func GetVolumeSnapshotContentObject(vscName string) (map[string]interface{}, error) {
-	cmd := exec.Command("kubectl", "get", "volumesnapshotcontent", vscName, "-o", "json")
-	output, err := cmd.Output()
+	client, err := getClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get VolumeSnapshotContent object: %w", err)
+		return nil, err
 	}
 
-	var vscObject map[string]interface{}
-	err = json.Unmarshal(output, &vscObject)
+	vsc, err := client.GetVolumeSnapshotContent(context.Background(), vscName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal VolumeSnapshotContent object: %w", err)
+		return nil, fmt.Errorf("failed to get VolumeSnapshotContent object: %w", err)
 	}
 
-	return vscObject, nil
+	return vsc.Object, nil
 }
 
 func CreatePreProvisionedVSC(vscObject map[string]interface{}, postfix string) (map[string]interface{}, error) {
@@ -233,19 +226,21 @@ func CreatePreProvisionedVSC(vscObject map[string]interface{}, postfix string) (
 		return nil, fmt.Errorf("failed to marshalIndent pre-provisioned VSC: %w", err)
 	}
 
-	log.Printf("Creating pre-provisioned VSC '%s' targeting VS '%s' in namespace=%s...\n%s", newVSCName, newVSName, originalVolumeSnapshotRef["namespace"], string(stringifiedVSC))
+	slog.Info("Creating pre-provisioned VSC...", "namespace", originalVolumeSnapshotRef["namespace"], "vsc_name", newVSCName, "vs_name", newVSName, "vsc", json.RawMessage(stringifiedVSC))
 
 	// Create the pre-provisioned VSC
-	vscJSON, err := json.Marshal(preProvisionedVSC)
+	vsc, err := toUnstructured(preProvisionedVSC)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal pre-provisioned VSC: %w", err)
+		return nil, fmt.Errorf("failed to convert pre-provisioned VSC: %w", err)
 	}
 
-	cmd := exec.Command("kubectl", "create", "-f", "-")
-	cmd.Stdin = bytes.NewReader(vscJSON)
-	output, err := cmd.CombinedOutput()
+	client, err := getClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create pre-provisioned VSC: %w, output: %s", err, output)
+		return nil, err
+	}
+
+	if _, err := client.CreateVolumeSnapshotContent(context.Background(), vsc); err != nil {
+		return nil, fmt.Errorf("failed to create pre-provisioned VSC: %w", err)
 	}
 
 	// Fetch the created pre-provisioned VSC
@@ -258,10 +253,13 @@ func CreatePreProvisionedVSC(vscObject map[string]interface{}, postfix string) (
 }
 
 func DeleteVolumeSnapshotContent(volumeSnapshotContentName string) error {
-	deleteCmd := exec.Command("kubectl", "delete", "volumesnapshotcontent", volumeSnapshotContentName)
-	output, err := deleteCmd.CombinedOutput()
+	client, err := getClient()
 	if err != nil {
-		return fmt.Errorf("failed to delete VolumeSnapshotContent: %w, output: %s", err, output)
+		return err
+	}
+
+	if err := client.DeleteVolumeSnapshotContent(context.Background(), volumeSnapshotContentName); err != nil {
+		return fmt.Errorf("failed to delete VolumeSnapshotContent: %w", err)
 	}
 	return nil
 }
@@ -308,10 +306,10 @@ func RebindVsc(oldVSCName, vsRand string, wait bool, waitTimeout string) error {
 		return fmt.Errorf("failed to create VolumeSnapshot: %w", err)
 	}
 
-	fmt.Printf("Successfully rebound old VolumeSnapshotContent '%s' to new VolumeSnapshot '%s' in namespace '%s'\n", oldVSCName, vsName, namespace)
+	slog.Info("Rebound old VolumeSnapshotContent to new VolumeSnapshot", "old_vsc_name", oldVSCName, "vs_name", vsName, "namespace", namespace)
 
 	// Delete the old VolumeSnapshotContent after making sure its deletionPolicy is 'Retain'
-	fmt.Printf("Attempting to delete old VolumeSnapshotContent '%s'...\n", oldVSCName)
+	slog.Info("Attempting to delete old VolumeSnapshotContent...", "old_vsc_name", oldVSCName)
 
 	deletionPolicy, ok := oldVSCObject["spec"].(map[string]interface{})["deletionPolicy"].(string)
 	if !ok {
@@ -322,14 +320,14 @@ func RebindVsc(oldVSCName, vsRand string, wait bool, waitTimeout string) error {
 		return fmt.Errorf("deletionPolicy is not 'Retain' in old VolumeSnapshotContent, refusing to delete")
 	}
 
-	fmt.Printf("Old VolumeSnapshotContent '%s' has deletionPolicy 'Retain' set and is thus safe to delete! Deleting...\n", oldVSCName)
+	slog.Info("Old VolumeSnapshotContent has deletionPolicy 'Retain' set and is thus safe to delete! Deleting...", "old_vsc_name", oldVSCName)
 
 	err = DeleteVolumeSnapshotContent(oldVSCName)
 	if err != nil {
 		return fmt.Errorf("failed to delete old VolumeSnapshotContent: %w", err)
 	}
 
-	fmt.Printf("Successfully deleted old VolumeSnapshotContent '%s'\n", oldVSCName)
+	slog.Info("Deleted old VolumeSnapshotContent", "old_vsc_name", oldVSCName)
 
 	return nil
 }
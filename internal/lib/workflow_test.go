@@ -0,0 +1,741 @@
+package lib_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/allaboutapps/backup-ns/internal/lib"
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s"
+	"github.com/allaboutapps/backup-ns/internal/lib/k8s/fake"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The lib workflows are tested offline against the in-memory fake cluster, see the "kind" build tag for the
+// integration tests against the kind test k8s cluster.
+
+const testNamespace = "app"
+
+// newTestCluster installs a fake cluster with the pvc "data" as k8s client for the duration of the test.
+func newTestCluster(t *testing.T, now *time.Time) *fake.Cluster {
+	t.Helper()
+
+	cluster := fake.NewCluster()
+	cluster.Now = func() time.Time { return *now }
+	cluster.AddPersistentVolumeClaim(&corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "data", UID: "a1b2"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("5Gi")},
+			},
+		},
+	})
+
+	k8s.SetDefault(cluster)
+	t.Cleanup(func() { k8s.SetDefault(nil) })
+
+	return cluster
+}
+
+func createVS(t *testing.T, now time.Time, labelVSConfig lib.LabelVSConfig) string {
+	t.Helper()
+
+	vsName := fmt.Sprintf("data-%s-%s", now.Format("2006-01-02-150405"), lib.GenerateRandomStringOrPanic(6))
+	vsLabels := lib.GenerateVSLabels(testNamespace, "data", labelVSConfig, now)
+	vsObject := lib.GenerateVSObject(testNamespace, "csi-hostpath-snapclass", "data", vsName, vsLabels, lib.GenerateVSAnnotations(map[string]string{}))
+
+	require.NoError(t, lib.CreateVolumeSnapshot(testNamespace, false, vsName, vsObject, true, "25s"))
+	require.NoError(t, lib.SyncVSLabelsToVsc(testNamespace, vsName))
+
+	return vsName
+}
+
+// testDump is the postgres dump recorded by newTestDumpManifest.
+var testDump = []byte("CREATE TABLE users ();\n")
+
+// newTestDumpManifest returns the manifest of testDump at dumpFile.
+func newTestDumpManifest(dumpFile string) lib.DumpManifest {
+	sum := sha256.Sum256(testDump)
+	return lib.DumpManifest{Engine: "postgres", Name: "postgres", DumpFile: dumpFile, SHA256: hex.EncodeToString(sum[:]), SizeBytes: int64(len(testDump))}
+}
+
+// createVSWithDumpManifest creates a ready vs of the pvc "data" like createVS, with the env-config of the backup job
+// and the manifest annotation of the dump.
+func createVSWithDumpManifest(t *testing.T, now time.Time, labelVSConfig lib.LabelVSConfig, env map[string]string, manifest lib.DumpManifest) string {
+	t.Helper()
+
+	manifestJSON, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	vsName := fmt.Sprintf("data-%s-%s", now.Format("2006-01-02-150405"), lib.GenerateRandomStringOrPanic(6))
+	vsLabels := lib.GenerateVSLabels(testNamespace, "data", labelVSConfig, now)
+	vsAnnotations := lib.GenerateVSAnnotations(env)
+	vsAnnotations[lib.DumpManifestAnnotation(manifest.Name)] = string(manifestJSON)
+	vsObject := lib.GenerateVSObject(testNamespace, "csi-hostpath-snapclass", "data", vsName, vsLabels, vsAnnotations)
+
+	require.NoError(t, lib.CreateVolumeSnapshot(testNamespace, false, vsName, vsObject, true, "25s"))
+	require.NoError(t, lib.SyncVSLabelsToVsc(testNamespace, vsName))
+
+	return vsName
+}
+
+func TestReadyToUseTransition(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC)
+	cluster := newTestCluster(t, &now)
+	cluster.ManualReady = true
+
+	vsName := "data-manual"
+	vsObject := lib.GenerateVSObject(testNamespace, "csi-hostpath-snapclass", "data", vsName, map[string]string{"backup-ns.sh/type": "adhoc"}, nil)
+	require.NoError(t, lib.CreateVolumeSnapshot(testNamespace, false, vsName, vsObject, false, ""))
+
+	vss, err := lib.GetVolumeSnapshotInfos(testNamespace, "backup-ns.sh/type")
+	require.NoError(t, err)
+	require.Len(t, vss, 1)
+	require.False(t, vss[0].ReadyToUse)
+	require.Equal(t, "5Gi", vss[0].RestoreSize)
+	require.Equal(t, now, vss[0].CreationTime)
+	require.NotEmpty(t, vss[0].ContentName)
+
+	vsc, err := cluster.GetVolumeSnapshotContent(context.Background(), vss[0].ContentName)
+	require.NoError(t, err)
+	require.Equal(t, fake.DeletionPolicyRetain, vsc.Object["spec"].(map[string]interface{})["deletionPolicy"])
+
+	// pvcs can only be restored from ready snapshots
+	require.Error(t, lib.RestoreVolumeSnapshot(testNamespace, vsName, "data-restored", "", false, ""))
+
+	require.NoError(t, cluster.MarkReady(testNamespace, vsName))
+
+	vss, err = lib.GetVolumeSnapshotInfos("", "backup-ns.sh/type")
+	require.NoError(t, err)
+	require.True(t, vss[0].ReadyToUse)
+
+	vsc, err = cluster.GetVolumeSnapshotContent(context.Background(), vss[0].ContentName)
+	require.NoError(t, err)
+	require.Equal(t, true, vsc.Object["status"].(map[string]interface{})["readyToUse"])
+
+	require.NoError(t, lib.RestoreVolumeSnapshot(testNamespace, vsName, "data-restored", "", true, "25s"))
+	require.NoError(t, lib.EnsurePVCAvailable(testNamespace, "data-restored"))
+}
+
+func TestRebindRetainedVolumeSnapshotContent(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC)
+	cluster := newTestCluster(t, &now)
+
+	vsName := createVS(t, now, lib.LabelVSConfig{Type: "cronjob", Retain: "daily_weekly_monthly"})
+
+	vscName, err := lib.GetVolumeSnapshotContentName(testNamespace, vsName)
+	require.NoError(t, err)
+	handles := cluster.SnapshotHandles()
+	require.Len(t, handles, 1)
+
+	// deleting the vs with the Retain deletionPolicy leaves a dangling vsc (e.g. after an accidental namespace delete)
+	require.NoError(t, cluster.DeleteVolumeSnapshot(context.Background(), testNamespace, vsName))
+	require.Equal(t, []string{vscName}, cluster.VolumeSnapshotContentNames())
+
+	now = now.Add(48 * time.Hour)
+	require.NoError(t, lib.RebindVsc(vscName, "rebound", true, "25s"))
+
+	// the old vsc is replaced by a pre-provisioned one pointing to the same snapshot on the storage system
+	vscNames := cluster.VolumeSnapshotContentNames()
+	require.Len(t, vscNames, 1)
+	require.NotEqual(t, vscName, vscNames[0])
+	require.Equal(t, handles, cluster.SnapshotHandles())
+
+	vss, err := lib.GetVolumeSnapshotInfos(testNamespace, "backup-ns.sh/daily=2025-01-01")
+	require.NoError(t, err)
+	require.Len(t, vss, 1)
+	require.Equal(t, "data-2025-01-01-001700-rebound", vss[0].Name)
+	require.Equal(t, vscNames[0], vss[0].ContentName)
+	require.True(t, vss[0].ReadyToUse)
+	require.Equal(t, "5Gi", vss[0].RestoreSize)
+	// the original creationTime of the snapshot is kept
+	require.Equal(t, time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC), vss[0].CreationTime)
+
+	// pruning finally deletes the snapshot on the storage system
+	require.NoError(t, lib.PruneVolumeSnapshot(testNamespace, vss[0].Name, true))
+	require.Empty(t, cluster.VolumeSnapshotContentNames())
+	require.Empty(t, cluster.SnapshotHandles())
+}
+
+// Simulates the daily backup cronjob and the pruner (applyRetentionPolicy, deleteAfterMark, deleteAfterSweep) over 100 days.
+func TestLifecycle(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC)
+	cluster := newTestCluster(t, &now)
+
+	retainConfig := lib.RetainConfig{LastDaily: 7, LastWeekly: 4, LastMonthly: 12}
+
+	for day := 0; day < 100; day++ {
+		now = time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC).AddDate(0, 0, day)
+
+		createVS(t, now, lib.LabelVSConfig{Type: "cronjob", Retain: "daily_weekly_monthly"})
+
+		now = now.Add(2 * time.Hour)
+
+		vss, err := lib.GetVolumeSnapshotInfos("", "backup-ns.sh/retain,backup-ns.sh/pvc")
+		require.NoError(t, err)
+		for _, removal := range lib.PlanRetentionPolicy(vss, retainConfig) {
+			require.NoError(t, lib.RemoveVolumeSnapshotLabel(removal.Namespace, removal.VSName, removal.LabelKey))
+		}
+
+		vss, err = lib.GetVolumeSnapshotInfos("", "backup-ns.sh/retain=daily_weekly_monthly")
+		require.NoError(t, err)
+		for _, mark := range lib.PlanDeleteAfterMark(vss, now) {
+			require.NoError(t, lib.MarkVolumeSnapshotDeleteAfter(mark.Namespace, mark.VSName, mark.DeleteAfter))
+		}
+
+		vss, err = lib.GetVolumeSnapshotInfos("", "backup-ns.sh/type")
+		require.NoError(t, err)
+		for _, c := range lib.PlanDeleteAfterSweep(vss, now, 0) {
+			require.Empty(t, c.Skip)
+			require.NoError(t, lib.PruneVolumeSnapshot(c.Namespace, c.VSName, true))
+		}
+	}
+
+	vss, err := lib.GetVolumeSnapshotInfos("", "backup-ns.sh/type")
+	require.NoError(t, err)
+
+	var daily, weekly, monthly, marked int
+	for _, vs := range vss {
+		require.True(t, vs.ReadyToUse)
+
+		_, hasDaily := vs.Labels[lib.LabelDaily]
+		_, hasWeekly := vs.Labels[lib.LabelWeekly]
+		_, hasMonthly := vs.Labels[lib.LabelMonthly]
+		deleteAfter, hasDeleteAfter := vs.Labels[lib.LabelDeleteAfter]
+
+		if hasDeleteAfter {
+			// marked today, swept tomorrow
+			require.Equal(t, now.Format("2006-01-02"), deleteAfter)
+			marked++
+			continue
+		}
+
+		require.True(t, hasDaily || hasWeekly || hasMonthly, vs.Name)
+		if hasDaily {
+			daily++
+		}
+		if hasWeekly {
+			weekly++
+		}
+		if hasMonthly {
+			monthly++
+		}
+	}
+
+	require.Equal(t, 7, daily)
+	require.Equal(t, 4, weekly)
+	require.Equal(t, 4, monthly) // 2025-01 to 2025-04
+	require.Equal(t, 1, marked)
+
+	// swept snapshots are gone from the storage system, retained ones are still there
+	require.Len(t, cluster.VolumeSnapshotContentNames(), len(vss))
+	require.Len(t, cluster.SnapshotHandles(), len(vss))
+
+	vscLabels, err := lib.GetBackupNsLabelMap(testNamespace, "volumesnapshotcontent", vss[0].ContentName)
+	require.NoError(t, err)
+	require.Equal(t, "data", vscLabels["backup-ns.sh/pvc"])
+}
+
+func createVGS(t *testing.T, now time.Time, labelVSConfig lib.LabelVSConfig) (string, []lib.VolumeGroupSnapshotMember) {
+	t.Helper()
+
+	vgsName := fmt.Sprintf("group-%s-%s", now.Format("2006-01-02-150405"), lib.GenerateRandomStringOrPanic(6))
+	vgsLabels := lib.GenerateVSLabels(testNamespace, "data", labelVSConfig, now)
+	delete(vgsLabels, "backup-ns.sh/pvc")
+	vgsLabels[lib.LabelSet] = lib.GenerateSetName(lib.GenerateRandomStringOrPanic(6), now)
+
+	vgsObject, err := lib.GenerateVGSObject(testNamespace, "csi-hostpath-groupsnapclass", "app=db", vgsName, vgsLabels, nil)
+	require.NoError(t, err)
+
+	members, err := lib.CreateVolumeGroupSnapshot(testNamespace, false, vgsName, vgsObject, vgsLabels, lib.GenerateVSAnnotations(map[string]string{}), true, "25s")
+	require.NoError(t, err)
+
+	return vgsName, members
+}
+
+// Simulates the daily backup cronjob creating VolumeGroupSnapshots and the pruner over 40 days.
+func TestVolumeGroupSnapshotLifecycle(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC)
+	cluster := newTestCluster(t, &now)
+	for _, name := range []string{"data", "uploads"} {
+		cluster.AddPersistentVolumeClaim(&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name, UID: types.UID(name), Labels: map[string]string{"app": "db"}},
+		})
+	}
+	// not part of the group
+	cluster.AddPersistentVolumeClaim(&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "cache"}})
+
+	// BAK_VGS_SELECTOR is validated against the PVCs before the group is created
+	pvcNames, err := lib.ListPVCNames(testNamespace, "app=db")
+	require.NoError(t, err)
+	require.Equal(t, []string{"data", "uploads"}, pvcNames)
+
+	vgsName, members := createVGS(t, now, lib.LabelVSConfig{Type: "cronjob", Retain: "daily_weekly_monthly"})
+	require.Len(t, members, 2)
+	require.Equal(t, "data", members[0].PVCName)
+	require.Equal(t, "uploads", members[1].PVCName)
+
+	// the members are labeled like individually created snapshots and form a backup set
+	vss, err := lib.GetVolumeSnapshotInfos(testNamespace, lib.LabelGroup+"="+vgsName)
+	require.NoError(t, err)
+	require.Len(t, vss, 2)
+	sets := lib.GroupVolumeSnapshotSets(vss)
+	require.Len(t, sets, 1)
+	require.True(t, sets[0].ReadyToUse())
+	require.Equal(t, vgsName, sets[0].Group())
+	require.Equal(t, []string{"data", "uploads"}, sets[0].PVCNames())
+	require.Equal(t, "2025-01-01", vss[0].Labels[lib.LabelDaily])
+
+	// members can only be deleted with their group
+	require.ErrorContains(t, lib.PruneVolumeSnapshot(testNamespace, members[0].VSName, true), vgsName)
+
+	retainConfig := lib.RetainConfig{LastDaily: 7, LastWeekly: 4, LastMonthly: 12}
+
+	for day := 1; day < 40; day++ {
+		now = time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC).AddDate(0, 0, day)
+
+		createVGS(t, now, lib.LabelVSConfig{Type: "cronjob", Retain: "daily_weekly_monthly"})
+
+		now = now.Add(2 * time.Hour)
+
+		vss, err := lib.GetVolumeSnapshotInfos("", "backup-ns.sh/retain,backup-ns.sh/pvc")
+		require.NoError(t, err)
+		for _, removal := range lib.PlanRetentionPolicy(vss, retainConfig) {
+			require.NoError(t, lib.RemoveVolumeSnapshotLabel(removal.Namespace, removal.VSName, removal.LabelKey))
+		}
+
+		vss, err = lib.GetVolumeSnapshotInfos("", "backup-ns.sh/retain=daily_weekly_monthly")
+		require.NoError(t, err)
+		for _, mark := range lib.PlanDeleteAfterMark(vss, now) {
+			require.NoError(t, lib.MarkVolumeSnapshotDeleteAfter(mark.Namespace, mark.VSName, mark.DeleteAfter))
+		}
+
+		vss, err = lib.GetVolumeSnapshotInfos("", "backup-ns.sh/type")
+		require.NoError(t, err)
+		swept := map[string]bool{}
+		for _, c := range lib.PlanDeleteAfterSweep(vss, now, 1) {
+			require.Empty(t, c.Skip)
+			require.NotEmpty(t, c.Group)
+			if !swept[c.Group] {
+				require.NoError(t, lib.PruneVolumeGroupSnapshot(c.Namespace, c.Group, true))
+				swept[c.Group] = true
+			}
+		}
+	}
+
+	vss, err = lib.GetVolumeSnapshotInfos("", "backup-ns.sh/type")
+	require.NoError(t, err)
+
+	sets = lib.GroupVolumeSnapshotSets(vss)
+	groups := 0
+	for _, set := range sets {
+		require.True(t, set.ReadyToUse())
+		require.Equal(t, []string{"data", "uploads"}, set.PVCNames())
+		groups++
+	}
+
+	require.Equal(t, 13, groups)
+	require.Len(t, vss, groups*2)
+
+	// swept groups are gone from the storage system, including their group content
+	require.Len(t, cluster.VolumeSnapshotContentNames(), len(vss))
+	require.Len(t, cluster.SnapshotHandles(), len(vss))
+	require.Len(t, cluster.VolumeGroupSnapshotContentNames(), groups)
+}
+
+// A failed group is handed over to the sweep of the controller, the backup job may not patch the contents.
+func TestMarkFailedVolumeGroupSnapshot(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC)
+	cluster := newTestCluster(t, &now)
+	for _, name := range []string{"data", "uploads"} {
+		cluster.AddPersistentVolumeClaim(&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name, UID: types.UID(name), Labels: map[string]string{"app": "db"}},
+		})
+	}
+
+	labelVSConfig := lib.LabelVSConfig{Type: "cronjob", Retain: "daily_weekly_monthly"}
+	createVGS(t, now, labelVSConfig)
+
+	// the group does not become ready, its members are not labeled
+	now = now.Add(24 * time.Hour)
+	cluster.ManualReady = true
+
+	vgsName := "group-failed"
+	vgsLabels := lib.GenerateVSLabels(testNamespace, "data", labelVSConfig, now)
+	delete(vgsLabels, "backup-ns.sh/pvc")
+	vgsObject, err := lib.GenerateVGSObject(testNamespace, "csi-hostpath-groupsnapclass", "app=db", vgsName, vgsLabels, nil)
+	require.NoError(t, err)
+	_, err = lib.CreateVolumeGroupSnapshot(testNamespace, false, vgsName, vgsObject, vgsLabels, nil, true, "1s")
+	require.Error(t, err)
+
+	vss, err := lib.GetVolumeSnapshotInfos(testNamespace, lib.LabelGroup+"="+vgsName)
+	require.NoError(t, err)
+	require.Empty(t, vss)
+
+	require.NoError(t, lib.MarkFailedVolumeGroupSnapshot(testNamespace, vgsName, vgsLabels, now))
+
+	vss, err = lib.GetVolumeSnapshotInfos(testNamespace, lib.LabelGroup+"="+vgsName)
+	require.NoError(t, err)
+	require.Len(t, vss, 2)
+	for _, vs := range vss {
+		require.Equal(t, "2025-01-02", vs.Labels[lib.LabelDeleteAfter])
+	}
+
+	// the sweep deletes the group from the next day on
+	vss, err = lib.GetVolumeSnapshotInfos("", "backup-ns.sh/type")
+	require.NoError(t, err)
+	require.Empty(t, lib.PlanDeleteAfterSweep(vss, now, 0))
+
+	candidates := lib.PlanDeleteAfterSweep(vss, now.Add(24*time.Hour), 0)
+	require.Len(t, candidates, 2)
+	for _, c := range candidates {
+		require.Equal(t, vgsName, c.Group)
+		require.Empty(t, c.Skip)
+	}
+	require.NoError(t, lib.PruneVolumeGroupSnapshot(testNamespace, vgsName, true))
+	require.Len(t, cluster.VolumeGroupSnapshotContentNames(), 1)
+
+	// a group without members is deleted right away
+	cluster.ManualReady = false
+	vgsObject, err = lib.GenerateVGSObject(testNamespace, "csi-hostpath-groupsnapclass", "app=none", "group-empty", vgsLabels, nil)
+	require.NoError(t, err)
+	_, err = lib.CreateVolumeGroupSnapshot(testNamespace, false, "group-empty", vgsObject, vgsLabels, nil, false, "1s")
+	require.Error(t, err)
+
+	require.NoError(t, lib.MarkFailedVolumeGroupSnapshot(testNamespace, "group-empty", vgsLabels, now))
+	_, err = cluster.GetVolumeGroupSnapshot(context.Background(), testNamespace, "group-empty")
+	require.True(t, k8s.IsNotFound(err))
+}
+
+func TestLoadDecryptionKeySecret(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC)
+	cluster := newTestCluster(t, &now)
+	cluster.AddSecret(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "backup-key"},
+		Data:       map[string][]byte{"key.txt": []byte("AGE-SECRET-KEY-1ABC\n")},
+	})
+
+	key, err := lib.LoadDecryptionKey(testNamespace, lib.EncryptionConfig{DecryptionKeySecret: "backup-key/key.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "AGE-SECRET-KEY-1ABC\n", key)
+
+	_, err = lib.LoadDecryptionKey(testNamespace, lib.EncryptionConfig{DecryptionKeySecret: "backup-key/missing"})
+	require.ErrorContains(t, err, "has no key 'missing'")
+
+	_, err = lib.LoadDecryptionKey(testNamespace, lib.EncryptionConfig{DecryptionKeySecret: "unknown/key.txt"})
+	require.True(t, k8s.IsNotFound(err))
+}
+
+// execFiles simulates the files within the pods for the commands run by the dump verification.
+func execFiles(restoredStats string) (fake.ExecFunc, *sync.Map) {
+	var files sync.Map
+
+	read := func(file string) []byte {
+		content, _ := files.Load(file)
+		b, _ := content.([]byte)
+		return b
+	}
+
+	return func(_ context.Context, opts k8s.ExecOptions) error {
+		cmd := opts.Command
+		path := func(p string) string { return opts.Pod + ":" + p }
+
+		switch {
+		case cmd[0] == "cat" && len(cmd) == 2:
+			content, ok := files.Load(path(cmd[1]))
+			if !ok {
+				return fmt.Errorf("cat: %s: No such file", cmd[1])
+			}
+			_, err := opts.Stdout.Write(content.([]byte))
+			return err
+		case cmd[0] == "bash" && cmd[1] == "-s":
+			script, err := io.ReadAll(opts.Stdin)
+			if err != nil {
+				return err
+			}
+			if strings.Contains(string(script), "query_to_xml") {
+				files.Store(path("/backup-ns-verify/dump.sql.gz.stats"), []byte(restoredStats))
+			}
+			return nil // e.g. the database accepts connections
+		case cmd[0] == "find" && len(cmd) == 4:
+			files.Range(func(file, _ any) bool {
+				if p := file.(string); strings.HasPrefix(p, path(cmd[1])+"/") && filepath.Base(p) == cmd[3] {
+					fmt.Fprintln(opts.Stdout, strings.TrimPrefix(p, opts.Pod+":"))
+				}
+				return true
+			})
+			return nil
+		case cmd[0] == "sh" && cmd[1] == "-c":
+			script, file := cmd[2], path(cmd[4])
+			switch {
+			case strings.Contains(script, "count=0"):
+				count := 0
+				files.Range(func(f, content any) bool {
+					rel, ok := strings.CutPrefix(f.(string), file+"/")
+					if matched, _ := filepath.Match(cmd[5], rel); ok && matched && len(content.([]byte)) > 0 {
+						count++
+					}
+					return true
+				})
+				_, err := fmt.Fprintln(opts.Stdout, count)
+				return err
+			case strings.Contains(script, "ls -A"):
+				files.Range(func(f, _ any) bool {
+					rel, ok := strings.CutPrefix(f.(string), file+"/")
+					if ok {
+						fmt.Fprintln(opts.Stdout, rel)
+					}
+					return !ok
+				})
+				return nil
+			case strings.Contains(script, "sha256sum"):
+				sum := sha256.Sum256(read(file))
+				_, err := fmt.Fprintln(opts.Stdout, hex.EncodeToString(sum[:]))
+				return err
+			case strings.Contains(script, "stat -c"):
+				_, err := fmt.Fprintln(opts.Stdout, len(read(file)))
+				return err
+			case strings.Contains(script, "cat > "):
+				content, err := io.ReadAll(opts.Stdin)
+				files.Store(file, content)
+				return err
+			case strings.Contains(script, `cat "$1"`):
+				_, err := opts.Stdout.Write(read(file))
+				return err
+			}
+		}
+
+		return fmt.Errorf("unexpected command %v in pod %s", cmd, opts.Pod)
+	}, &files
+}
+
+func TestVerifyPostgresDump(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC)
+	cluster := newTestCluster(t, &now)
+	cluster.AddPod(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "postgres-0"},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "app", Image: "app:1"},
+			{Name: "postgres", Image: "postgres:17", Env: []corev1.EnvVar{{Name: "POSTGRES_DB", Value: "app"}}},
+		}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	})
+
+	manifest := newTestDumpManifest("/data/dump.sql.gz")
+	manifest.RowCounts = map[string]int64{"public.users": 40, "public.orders": 2}
+	manifestJSON, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	config := lib.PostgresConfig{Name: "postgres", ExecResource: "pod/postgres-0", ExecContainer: "postgres", DumpFile: "/data/dump.sql.gz", DB: "app", Host: "127.0.0.1", Port: "5432"}
+	verifyConfig := lib.VerifyConfig{ReadyTimeout: "10s", MaxDuration: "1h"}
+
+	execFunc, files := execFiles("rows\tpublic.users\t42\nrows\tpublic.orders\t2\n")
+	files.Store("postgres-0:/data/dump.sql.gz", testDump)
+	files.Store("postgres-0:/data/dump.sql.gz.manifest.json", manifestJSON)
+	cluster.ExecFunc = execFunc
+
+	result, err := lib.VerifyPostgres(testNamespace, config, verifyConfig)
+	require.NoError(t, err)
+	require.True(t, result.Passed, result.Error)
+	require.Equal(t, "postgres:17", result.Image)
+	require.Equal(t, manifest.SHA256, result.SHA256)
+	require.Equal(t, 2, result.Tables)
+	require.Equal(t, int64(44), result.Rows)
+
+	// the dump and its manifest were copied into the verifier pod, which is deleted afterwards
+	var copied []string
+	files.Range(func(file, _ any) bool {
+		if pod, path, _ := strings.Cut(file.(string), ":"); strings.HasPrefix(pod, "backup-ns-verify-postgres-") {
+			copied = append(copied, path)
+		}
+		return true
+	})
+	require.ElementsMatch(t, []string{"/backup-ns-verify/dump.sql.gz", "/backup-ns-verify/dump.sql.gz.manifest.json", "/backup-ns-verify/dump.sql.gz.stats"}, copied)
+
+	pods, err := cluster.ListPods(context.Background(), testNamespace, "backup-ns.sh/verify=postgres")
+	require.NoError(t, err)
+	require.Empty(t, pods)
+
+	// the result is recorded in the newest vs holding the dump
+	vsName := createVSWithDumpManifest(t, now, lib.LabelVSConfig{Type: "adhoc", Pod: "gotest", Retain: "days", RetainDays: 1}, nil, manifest)
+
+	now = now.Add(time.Hour)
+	otherVSName := createVS(t, now, lib.LabelVSConfig{Type: "adhoc", Pod: "gotest", Retain: "days", RetainDays: 1})
+
+	annotated, err := lib.AnnotateVerifiedVolumeSnapshot(testNamespace, "data", "", result)
+	require.NoError(t, err)
+	require.Equal(t, vsName, annotated)
+
+	vs, err := cluster.GetVolumeSnapshot(context.Background(), testNamespace, vsName)
+	require.NoError(t, err)
+	var recorded lib.VerifyResult
+	require.NoError(t, json.Unmarshal([]byte(vs.GetAnnotations()[lib.VerifyAnnotation("postgres")]), &recorded))
+	require.True(t, recorded.Passed)
+	require.Equal(t, 2, recorded.Tables)
+
+	other, err := cluster.GetVolumeSnapshot(context.Background(), testNamespace, otherVSName)
+	require.NoError(t, err)
+	require.NotContains(t, other.GetAnnotations(), lib.VerifyAnnotation("postgres"))
+
+	// missing tables fail the verification
+	execFunc, files = execFiles("rows\tpublic.users\t42\n")
+	files.Store("postgres-0:/data/dump.sql.gz", testDump)
+	files.Store("postgres-0:/data/dump.sql.gz.manifest.json", manifestJSON)
+	cluster.ExecFunc = execFunc
+
+	result, err = lib.VerifyPostgres(testNamespace, config, verifyConfig)
+	require.NoError(t, err)
+	require.False(t, result.Passed)
+	require.Equal(t, []string{"public.orders"}, result.MissingTables)
+
+	// a dump not matching its manifest is not restored
+	files.Store("postgres-0:/data/dump.sql.gz", []byte("corrupted"))
+
+	result, err = lib.VerifyPostgres(testNamespace, config, verifyConfig)
+	require.NoError(t, err)
+	require.False(t, result.Passed)
+	require.Contains(t, result.Error, lib.ErrDumpManifestMismatch.Error())
+
+	pods, err = cluster.ListPods(context.Background(), testNamespace, "backup-ns.sh/verify=postgres")
+	require.NoError(t, err)
+	require.Empty(t, pods)
+}
+
+func TestDrillVolumeSnapshot(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC)
+	cluster := newTestCluster(t, &now)
+
+	manifest := newTestDumpManifest("/var/lib/postgresql/data/dump.sql.gz")
+	vsName := createVSWithDumpManifest(t, now, lib.LabelVSConfig{Type: "adhoc", Pod: "gotest", Retain: "days", RetainDays: 1}, nil, manifest)
+
+	// the restored volume as seen by the (randomly named) drill pod
+	execFunc, files := execFiles("")
+	files.Store("drill:/drill/data/dump.sql.gz", testDump)
+	files.Store("drill:/drill/data/PG_VERSION", []byte("17\n"))
+	files.Store("drill:/drill/uploads/avatar.png", []byte("png"))
+	cluster.ExecFunc = func(ctx context.Context, opts k8s.ExecOptions) error {
+		if strings.HasPrefix(opts.Pod, "backup-ns-drill-") {
+			opts.Pod = "drill"
+		}
+		return execFunc(ctx, opts)
+	}
+
+	config := lib.DrillConfig{Image: "busybox:1.37", Timeout: "10s", MaxDuration: "1h", Probes: []string{"uploads/*"}}
+
+	result, err := lib.DrillVolumeSnapshot(context.Background(), testNamespace, vsName, config)
+	require.NoError(t, err)
+	require.True(t, result.OK(), result.Problems)
+	require.Equal(t, "data", result.PVCName)
+	require.Equal(t, []lib.DrillDumpResult{{Name: "postgres", DumpFile: "data/dump.sql.gz", SHA256: manifest.SHA256, OK: true}}, result.Dumps)
+	require.Equal(t, []lib.DrillProbeResult{{Probe: "uploads/*", Matches: 1, OK: true}}, result.Probes)
+
+	require.NoError(t, lib.MarkVolumeSnapshotVerified(testNamespace, vsName, result.Drilled))
+	vs, err := cluster.GetVolumeSnapshot(context.Background(), testNamespace, vsName)
+	require.NoError(t, err)
+	require.Equal(t, result.Drilled.Format("2006-01-02"), vs.GetLabels()[lib.LabelVerified])
+
+	// the drill pod and pvc are deleted afterwards
+	pods, err := cluster.ListPods(context.Background(), testNamespace, "backup-ns.sh/drill=data")
+	require.NoError(t, err)
+	require.Empty(t, pods)
+	_, err = cluster.GetPersistentVolumeClaim(context.Background(), testNamespace, result.RestoredPVCName)
+	require.Error(t, err)
+
+	// a corrupted dump and a probe without matches fail the drill
+	files.Store("drill:/drill/data/dump.sql.gz", []byte("corrupted"))
+	config.Probes = []string{"media/*"}
+
+	result, err = lib.DrillVolumeSnapshot(context.Background(), testNamespace, vsName, config)
+	require.NoError(t, err)
+	require.False(t, result.OK())
+	require.Len(t, result.Problems, 2)
+	require.False(t, result.Dumps[0].OK)
+	require.Equal(t, 0, result.Probes[0].Matches)
+}
+
+func TestDrillVolumeSnapshotInSandbox(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 17, 0, 0, time.UTC)
+	cluster := newTestCluster(t, &now)
+
+	// the probes of the backup job are recorded in the env-config annotation of the vs
+	vsName := createVSWithDumpManifest(t, now, lib.LabelVSConfig{Type: "cronjob", Pod: "gotest", Retain: "days", RetainDays: 7},
+		map[string]string{"BAK_DRILL_PROBES": "uploads/*"}, newTestDumpManifest("/data/dump.sql.gz"))
+
+	handles := cluster.SnapshotHandles()
+	contents := cluster.VolumeSnapshotContentNames()
+
+	execFunc, files := execFiles("")
+	files.Store("drill:/drill/dump.sql.gz", testDump)
+	files.Store("drill:/drill/uploads/avatar.png", []byte("png"))
+	cluster.ExecFunc = func(ctx context.Context, opts k8s.ExecOptions) error {
+		if opts.Namespace != "backup-ns-drill" {
+			return fmt.Errorf("unexpected exec in namespace %s", opts.Namespace)
+		}
+		opts.Pod = "drill"
+		return execFunc(ctx, opts)
+	}
+
+	result, err := lib.DrillVolumeSnapshotInSandbox(context.Background(), testNamespace, vsName, "backup-ns-drill", lib.DrillConfig{Image: "busybox:1.37", Timeout: "10s", MaxDuration: "1h"})
+	require.NoError(t, err)
+	require.True(t, result.OK(), result.Problems)
+	require.Equal(t, testNamespace, result.Namespace)
+	require.Equal(t, vsName, result.VSName)
+	require.Equal(t, "data", result.PVCName)
+	require.Equal(t, "backup-ns-drill", result.SandboxNamespace)
+	require.Equal(t, []lib.DrillProbeResult{{Probe: "uploads/*", Matches: 1, OK: true}}, result.Probes)
+
+	// the sandbox vs and its content are removed again, the snapshot on the storage system is kept
+	sandboxVSs, err := cluster.ListVolumeSnapshots(context.Background(), "backup-ns-drill", "")
+	require.NoError(t, err)
+	require.Empty(t, sandboxVSs)
+	require.ElementsMatch(t, contents, cluster.VolumeSnapshotContentNames())
+	require.ElementsMatch(t, handles, cluster.SnapshotHandles())
+
+	// nothing is created in the sandbox anymore once the controller lost its leadership
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = lib.DrillVolumeSnapshotInSandbox(ctx, testNamespace, vsName, "backup-ns-drill", lib.DrillConfig{Image: "busybox:1.37", Timeout: "10s", MaxDuration: "1h"})
+	require.ErrorIs(t, err, context.Canceled)
+	require.ElementsMatch(t, contents, cluster.VolumeSnapshotContentNames())
+	pvcs, err := cluster.ListPersistentVolumeClaims(context.Background(), "backup-ns-drill", "")
+	require.NoError(t, err)
+	require.Empty(t, pvcs)
+	pods, err := cluster.ListPods(context.Background(), "backup-ns-drill", "")
+	require.NoError(t, err)
+	require.Empty(t, pods)
+
+	// the report keeps the last drill per namespace
+	report, err := lib.UpdateDrillReport("backup-ns-drill", []lib.DrillResult{result, {Namespace: "other", VSName: "data-1", Error: "not ready"}}, now)
+	require.NoError(t, err)
+	require.Len(t, report.Drills, 2)
+
+	now = now.Add(24 * time.Hour)
+	failed := result
+	failed.Problems = []string{"restored volume is empty"}
+
+	report, err = lib.UpdateDrillReport("backup-ns-drill", []lib.DrillResult{failed}, now)
+	require.NoError(t, err)
+	require.Equal(t, now, report.Updated)
+	require.Len(t, report.Drills, 2)
+	require.Equal(t, testNamespace, report.Drills[0].Namespace)
+	require.False(t, report.Drills[0].OK())
+	require.Equal(t, "other", report.Drills[1].Namespace)
+
+	cm, err := cluster.GetConfigMap(context.Background(), "backup-ns-drill", lib.DrillReportConfigMap)
+	require.NoError(t, err)
+	var stored lib.DrillReport
+	require.NoError(t, json.Unmarshal([]byte(cm.Data["report.json"]), &stored))
+	require.Equal(t, report, stored)
+}
@@ -2,7 +2,9 @@ package util
 
 import (
 	"log"
+	"log/slog"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -26,7 +28,7 @@ func GetEnvEnum(key string, defaultVal string, allowedValues []string) string {
 	}
 
 	if !ContainsString(allowedValues, val) {
-		log.Printf("Value '%s' is not allowed (key '%s'). Fallback to default value '%s'.\n", val, key, defaultVal)
+		slog.Warn("Value is not allowed, fallback to default value", "key", key, "value", val, "default", defaultVal)
 		return defaultVal
 	}
 
@@ -79,3 +81,35 @@ func GetEnvAsStringArrTrimmed(key string, defaultVal []string, separator ...stri
 
 	return slc
 }
+
+// GetEnvIndices returns the sorted unique indices N >= 1 of all set ENV vars named "<prefix>_<N>" or "<prefix>_<N>_*".
+func GetEnvIndices(prefix string) []int {
+	var indices []int
+
+	for _, env := range os.Environ() {
+		key, _, _ := strings.Cut(env, "=")
+
+		rest, ok := strings.CutPrefix(key, prefix+"_")
+		if !ok {
+			continue
+		}
+
+		digits, _, _ := strings.Cut(rest, "_")
+		index, err := strconv.Atoi(digits)
+		if err != nil || index < 0 || strconv.Itoa(index) != digits {
+			continue
+		}
+
+		if index == 0 {
+			slog.Warn("Indices start at 1, ignoring ENV var", "key", key)
+			continue
+		}
+
+		if !slices.Contains(indices, index) {
+			indices = append(indices, index)
+		}
+	}
+
+	slices.Sort(indices)
+	return indices
+}
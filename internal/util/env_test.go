@@ -127,3 +127,19 @@ func TestGetEnvAsStringArrTrimmed(t *testing.T) {
 	res = util.GetEnvAsStringArrTrimmed(testVarKey, testVal, "||")
 	assert.Equal(t, []string{"a", "b", "c"}, res)
 }
+
+func TestGetEnvIndices(t *testing.T) {
+	prefix := "TEST_ONLY_FOR_UNIT_TEST_INDEXED"
+	assert.Empty(t, util.GetEnvIndices(prefix))
+
+	t.Setenv(prefix+"_2", "true")
+	t.Setenv(prefix+"_2_NAME", "second")
+	t.Setenv(prefix+"_1_NAME", "first")
+	t.Setenv(prefix+"_10", "true")
+	t.Setenv(prefix+"_NAME", "base")
+	t.Setenv(prefix+"_01", "true")
+	t.Setenv(prefix+"_3X", "true")
+	t.Setenv(prefix+"_0", "true")
+	t.Setenv(prefix+"_0_NAME", "zero")
+	assert.Equal(t, []int{1, 2, 10}, util.GetEnvIndices(prefix))
+}
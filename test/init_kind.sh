@@ -49,6 +49,22 @@ kubectl config set-context kind-backup-ns --namespace mysql-test
 kubectl apply -f ./
 
 
+cd /app/test/mongo-test
+kubectl apply -f namespace.yaml
+
+kubectl config set-context kind-backup-ns --namespace mongo-test
+
+kubectl apply -f ./
+
+
+cd /app/test/redis-test
+kubectl apply -f namespace.yaml
+
+kubectl config set-context kind-backup-ns --namespace redis-test
+
+kubectl apply -f ./
+
+
 cd /app/test/generic-test
 kubectl apply -f namespace.yaml
 
@@ -58,4 +74,6 @@ kubectl apply -f ./
 
 kubectl rollout status deployment postgres -n postgres-test
 kubectl rollout status deployment mysql -n mysql-test
+kubectl rollout status deployment mongo -n mongo-test
+kubectl rollout status deployment redis -n redis-test
 kubectl rollout status deployment writer -n generic-test
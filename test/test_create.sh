@@ -10,23 +10,40 @@ if [[ $(kubectl config current-context) != "kind-backup-ns" ]]; then
 fi
 
 BAK_VS_CLASS_NAME=csi-hostpath-snapclass BAK_DB_SKIP=true BAK_NAMESPACE=generic-test backup-ns create
+BAK_VS_CLASS_NAME=csi-hostpath-snapclass BAK_DB_SKIP=true BAK_NAMESPACE=generic-test BAK_PVC_NAME=data,uploads backup-ns create
+backup-ns list --sets -n generic-test
 BAK_VS_CLASS_NAME=csi-hostpath-snapclass BAK_DB_POSTGRES=true BAK_NAMESPACE=postgres-test BAK_DB_POSTGRES_EXEC_RESOURCE=deployment/postgres backup-ns create
 BAK_VS_CLASS_NAME=csi-hostpath-snapclass BAK_DB_MYSQL=true BAK_NAMESPACE=mysql-test BAK_DB_MYSQL_EXEC_RESOURCE=deployment/mysql backup-ns create
+BAK_VS_CLASS_NAME=csi-hostpath-snapclass BAK_DB_MONGO=true BAK_NAMESPACE=mongo-test BAK_DB_MONGO_EXEC_RESOURCE=deployment/mongo backup-ns create
+BAK_VS_CLASS_NAME=csi-hostpath-snapclass BAK_DB_REDIS=true BAK_NAMESPACE=redis-test BAK_DB_REDIS_EXEC_RESOURCE=deployment/redis backup-ns create
 
 BAK_DB_POSTGRES=true BAK_NAMESPACE=postgres-test BAK_DB_POSTGRES_EXEC_RESOURCE=deployment/postgres backup-ns postgres dump
 BAK_DB_POSTGRES=true BAK_NAMESPACE=postgres-test BAK_DB_POSTGRES_EXEC_RESOURCE=deployment/postgres backup-ns postgres info
-BAK_DB_POSTGRES=true BAK_NAMESPACE=postgres-test BAK_DB_POSTGRES_EXEC_RESOURCE=deployment/postgres backup-ns postgres downloadDump -o "$SCRIPT_DIR/postgres-test.tar.gz"
-rm -f "$SCRIPT_DIR/postgres-test.tar.gz"
+BAK_DB_POSTGRES=true BAK_NAMESPACE=postgres-test BAK_DB_POSTGRES_EXEC_RESOURCE=deployment/postgres backup-ns postgres downloadDump -o "$SCRIPT_DIR/postgres-test.sql.gz"
+rm -f "$SCRIPT_DIR/postgres-test.sql.gz"
 BAK_DB_POSTGRES=true BAK_NAMESPACE=postgres-test BAK_DB_POSTGRES_EXEC_RESOURCE=deployment/postgres backup-ns postgres restore --force
 
 # BAK_DB_POSTGRES=true BAK_NAMESPACE=postgres-test BAK_DB_POSTGRES_EXEC_RESOURCE=deployment/postgres backup-ns postgres shell
 
 BAK_DB_MYSQL=true BAK_NAMESPACE=mysql-test BAK_DB_MYSQL_EXEC_RESOURCE=deployment/mysql backup-ns mysql dump
 BAK_DB_MYSQL=true BAK_NAMESPACE=mysql-test BAK_DB_MYSQL_EXEC_RESOURCE=deployment/mysql backup-ns mysql info
-BAK_DB_MYSQL=true BAK_NAMESPACE=mysql-test BAK_DB_MYSQL_EXEC_RESOURCE=deployment/mysql backup-ns mysql downloadDump -o "$SCRIPT_DIR/mysql-test.tar.gz"
-rm -f "$SCRIPT_DIR/mysql-test.tar.gz"
+BAK_DB_MYSQL=true BAK_NAMESPACE=mysql-test BAK_DB_MYSQL_EXEC_RESOURCE=deployment/mysql backup-ns mysql downloadDump -o "$SCRIPT_DIR/mysql-test.sql.gz"
+rm -f "$SCRIPT_DIR/mysql-test.sql.gz"
 BAK_DB_MYSQL=true BAK_NAMESPACE=mysql-test BAK_DB_MYSQL_EXEC_RESOURCE=deployment/mysql backup-ns mysql restore -f
 
 # BAK_DB_MYSQL=true BAK_NAMESPACE=mysql-test BAK_DB_MYSQL_EXEC_RESOURCE=deployment/mysql backup-ns mysql shell
 
+BAK_DB_MONGO=true BAK_NAMESPACE=mongo-test BAK_DB_MONGO_EXEC_RESOURCE=deployment/mongo backup-ns mongo dump
+BAK_DB_MONGO=true BAK_NAMESPACE=mongo-test BAK_DB_MONGO_EXEC_RESOURCE=deployment/mongo backup-ns mongo info
+BAK_DB_MONGO=true BAK_NAMESPACE=mongo-test BAK_DB_MONGO_EXEC_RESOURCE=deployment/mongo backup-ns mongo downloadDump -o "$SCRIPT_DIR/mongo-test.archive.gz"
+rm -f "$SCRIPT_DIR/mongo-test.archive.gz"
+BAK_DB_MONGO=true BAK_NAMESPACE=mongo-test BAK_DB_MONGO_EXEC_RESOURCE=deployment/mongo backup-ns mongo restore -f
+
+# BAK_DB_MONGO=true BAK_NAMESPACE=mongo-test BAK_DB_MONGO_EXEC_RESOURCE=deployment/mongo backup-ns mongo shell
+
+BAK_DB_REDIS=true BAK_NAMESPACE=redis-test BAK_DB_REDIS_EXEC_RESOURCE=deployment/redis backup-ns redis dump
+BAK_DB_REDIS=true BAK_NAMESPACE=redis-test BAK_DB_REDIS_EXEC_RESOURCE=deployment/redis backup-ns redis info
+
+# BAK_DB_REDIS=true BAK_NAMESPACE=redis-test BAK_DB_REDIS_EXEC_RESOURCE=deployment/redis backup-ns redis shell
+
 backup-ns list -A
\ No newline at end of file